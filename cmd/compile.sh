@@ -3,6 +3,9 @@
 set -x
 set -e
 
+# Full-text search uses SQLite's FTS5 extension, which go-sqlite3 only compiles in with this tag
+export GOFLAGS="-tags=sqlite_fts5"
+
 # General build flags
 FLAGS="-s -w -X gitlab.com/offline-twitter/twitter_offline_engine/pkg/webserver.use_embedded=true"
 
@@ -100,7 +100,12 @@ func is_scrape_failure(err error) bool {
 
 // DUPE: full_save_tweet_trove
 func full_save_tweet_trove(trove TweetTrove) {
-	conflicting_users := profile.SaveTweetTrove(trove, true, api.DownloadMedia)
+	full_save_tweet_trove_with_downloader(trove, api.DownloadMedia)
+}
+
+// Like `full_save_tweet_trove`, but with a custom function for getting media files
+func full_save_tweet_trove_with_downloader(trove TweetTrove, download func(string) ([]byte, error)) {
+	conflicting_users := profile.SaveTweetTrove(trove, false, nil)
 	for _, u_id := range conflicting_users {
 		fmt.Printf(terminal_utils.COLOR_YELLOW+
 			"Conflicting user handle found (ID %d); old user has been marked deleted.  Rescraping manually"+
@@ -126,4 +131,29 @@ func full_save_tweet_trove(trove TweetTrove) {
 			))
 		}
 	}
+
+	// Download media content
+	profile.QueueMediaDownloads(trove)
+	download_queued_media(DefaultDownloader{Download: download})
+}
+
+// Download everything that's ready in the media download queue, showing the progress
+func download_queued_media(downloader MediaDownloader) {
+	num_ready, _, _ := profile.CountQueuedMediaDownloads()
+	if num_ready == 0 {
+		return
+	}
+	media_downloads.DownloadAll(downloader, func(progress MediaDownloadProgress) {
+		fmt.Printf("\rDownloading media: %d downloaded, %d errors, %d left   ",
+			progress.NumDownloaded, progress.NumErrors, progress.NumQueued)
+	})
+	fmt.Println()
+
+	progress := media_downloads.Progress()
+	if progress.NumWaitingToRetry != 0 || progress.NumFailed != 0 {
+		fmt.Printf(terminal_utils.COLOR_YELLOW+
+			"%d media downloads will be retried later, and %d have failed (see `download_queued_media`)"+
+			terminal_utils.COLOR_RESET+"\n",
+			progress.NumWaitingToRetry, progress.NumFailed)
+	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"archive/zip"
 	"bufio"
 	"errors"
 	"flag"
@@ -16,6 +17,7 @@ import (
 
 	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
 	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/scraper"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/terminal_utils"
 	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/webserver"
 )
 
@@ -26,6 +28,9 @@ var version_string string
 
 var api scraper.API
 
+// Downloads media for scraped content, from the profile's download queue
+var media_downloads *MediaDownloadManager
+
 func main() {
 	profile_dir := flag.String("profile", ".", "")
 	flag.StringVar(profile_dir, "p", ".", "")
@@ -43,6 +48,12 @@ func main() {
 
 	delay := flag.String("delay", "0ms", "")
 
+	media_workers := flag.Int("media-workers", DEFAULT_MEDIA_DOWNLOAD_WORKERS, "")
+	media_per_host := flag.Int("media-per-host", DEFAULT_MEDIA_DOWNLOADS_PER_HOST, "")
+
+	record_cassette := flag.String("record-cassette", "", "")
+	replay_cassette := flag.String("replay-cassette", "", "")
+
 	var default_log_level string
 	if version_string == "" {
 		default_log_level = "debug"
@@ -83,7 +94,10 @@ func main() {
 	if len(args) < 2 {
 		if len(args) == 1 && (args[0] == "webserver" || args[0] == "fetch_timeline" ||
 			args[0] == "fetch_timeline_following_only" || args[0] == "fetch_inbox" || args[0] == "get_bookmarks" ||
-			args[0] == "get_notifications" || args[0] == "mark_notifications_as_read") {
+			args[0] == "get_notifications" || args[0] == "mark_notifications_as_read" || args[0] == "sweep_deleted_tweets" ||
+			args[0] == "dedupe_media" || args[0] == "prune_media" || args[0] == "check_profile" || args[0] == "migrate" ||
+			args[0] == "list_jobs" || args[0] == "run_jobs" || args[0] == "download_queued_media" ||
+			args[0] == "video_policy") {
 			// Doesn't need a target, so create a fake second arg
 			args = append(args, "")
 		} else {
@@ -98,6 +112,23 @@ func main() {
 		create_profile(target)
 		return
 	}
+	if operation == "migrate" {
+		// Don't load the profile first, since that upgrades it
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		version := fs.Int("to", ENGINE_DATABASE_VERSION, "")
+		is_dry_run := fs.Bool("dry-run", false, "")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+		migrate(*profile_dir, *version, *is_dry_run)
+		return
+	}
+	if operation == "restore" {
+		// Don't load the profile first; nothing should be using it while it's being restored
+		restore(target, *profile_dir)
+		return
+	}
 
 	if *use_default_profile {
 		if *profile_dir != "." {
@@ -128,12 +159,26 @@ func main() {
 		}
 	}
 
+	var cassette *scraper.Cassette
+	if *record_cassette != "" && *replay_cassette != "" {
+		die("Invalid flags: can't use both `--record-cassette` and `--replay-cassette`", false, 1)
+	} else if *record_cassette != "" {
+		cassette, err = scraper.RecordCassette(*record_cassette, nil)
+	} else if *replay_cassette != "" {
+		cassette, err = scraper.LoadCassette(*replay_cassette)
+	}
+	if err != nil {
+		die(err.Error(), false, 1)
+	}
 	if *session_name != "" {
 		if strings.HasSuffix(*session_name, ".session") {
 			// Lop off the ".session" suffix (allows using `--session asdf.session` which lets you tab-autocomplete at command line)
 			*session_name = (*session_name)[:len(*session_name)-8]
 		}
 		profile.LoadSession(UserHandle(*session_name), &api)
+	} else if *replay_cassette != "" {
+		// Replaying doesn't need a connection, so don't get a guest token
+		api = scraper.NewReplaySession(cassette)
 	} else {
 		var err error
 		api, err = scraper.NewGuestSession()
@@ -141,10 +186,23 @@ func main() {
 			log.Warnf("Unable to initialize guest session!  Might be a network issue")
 		} // Don't exit here, some operations don't require a connection
 	}
+	if cassette != nil {
+		api.UseCassette(cassette)
+	}
 	api.Delay, err = time.ParseDuration(*delay)
 	if err != nil {
 		die(fmt.Sprintf("Invalid delay: %q", *delay), false, 1)
 	}
+	if api.RateLimiter != nil {
+		// Scraping from the command line can wait out a whole rate limit window, rather than failing
+		api.RateLimiter.MaxInteractiveWait = scraper.DEFAULT_MAX_BACKGROUND_WAIT
+	}
+	if *media_workers < 1 || *media_per_host < 1 {
+		die("Invalid flags: `--media-workers` and `--media-per-host` must be at least 1", false, 1)
+	}
+	media_downloads = NewMediaDownloadManager(profile)
+	media_downloads.NumWorkers = *media_workers
+	media_downloads.MaxPerHost = *media_per_host
 
 	switch operation {
 	case "login":
@@ -203,6 +261,137 @@ func main() {
 		download_tweet_content(target)
 	case "search":
 		search(target, *how_many)
+	case "sweep_deleted_tweets":
+		sweep_deleted_tweets(UserHandle(target), *how_many)
+	case "import_archive":
+		import_archive(target)
+	case "export":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		query := fs.String("query", "", "")
+		should_bundle_media := fs.Bool("media", false, "")
+
+		if err := fs.Parse(args[2:]); err != nil {
+			panic(err)
+		}
+		export(target, *query, *should_bundle_media)
+	case "import":
+		import_export_file(target)
+	case "merge_profile":
+		merge_profile(target)
+	case "backup":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		should_include_media := fs.Bool("media", false, "")
+		num_to_keep := fs.Int("keep", 0, "")
+
+		if err := fs.Parse(args[2:]); err != nil {
+			panic(err)
+		}
+		backup(target, BackupOptions{IncludeMedia: *should_include_media, NumToKeep: *num_to_keep})
+	case "render_static":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		user_handle := fs.String("user", "", "")
+		list_id := fs.Int("list", 0, "")
+		query := fs.String("query", "", "")
+		page_size := fs.Int("page-size", 50, "")
+
+		if err := fs.Parse(args[2:]); err != nil {
+			panic(err)
+		}
+		render_static(target, UserHandle(*user_handle), ListID(*list_id), *query, *page_size)
+	case "check_profile":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		should_repair := fs.Bool("repair", false, "")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+		check_profile(*should_repair)
+	case "queue_job":
+		if len(args) < 3 {
+			die("", true, 1)
+		}
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		priority := fs.Int("priority", 0, "")
+		max_pages := fs.Int("max-pages", 0, "")
+
+		if err := fs.Parse(args[3:]); err != nil {
+			panic(err)
+		}
+		queue_job(ScrapeJob{Type: ScrapeJobType(target), Target: args[2], Priority: *priority, MaxPages: *max_pages})
+	case "list_jobs":
+		list_jobs()
+	case "cancel_job":
+		cancel_job(target)
+	case "retry_job":
+		retry_job(target)
+	case "prioritize_job":
+		if len(args) < 3 {
+			die("", true, 1)
+		}
+		priority, err := strconv.Atoi(args[2])
+		if err != nil {
+			die(fmt.Sprintf("Invalid priority: %q", args[2]), false, 1)
+		}
+		prioritize_job(target, priority)
+	case "run_jobs":
+		run_jobs()
+	case "download_queued_media":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		should_retry_failed := fs.Bool("retry-failed", false, "")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+		download_queued_media_op(*should_retry_failed)
+	case "video_policy":
+		show_video_policy()
+	case "set_video_policy":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		max_height := fs.Int("max-height", 0, "")
+		max_bitrate := fs.Int("max-bitrate", 0, "")
+
+		if err := fs.Parse(args[2:]); err != nil {
+			panic(err)
+		}
+		set_video_policy(VideoPolicy{Mode: VideoPolicyMode(target), MaxHeight: *max_height, MaxBitrate: *max_bitrate * 1000})
+	case "upgrade_videos":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		max_height := fs.Int("max-height", 0, "")
+		max_bitrate := fs.Int("max-bitrate", 0, "")
+
+		if err := fs.Parse(args[2:]); err != nil {
+			panic(err)
+		}
+		upgrade_videos(target, VideoPolicy{MaxHeight: *max_height, MaxBitrate: *max_bitrate * 1000})
+	case "dedupe_media":
+		dedupe_media()
+	case "prune_media":
+		fs := flag.NewFlagSet("", flag.ExitOnError)
+		is_dry_run := fs.Bool("dry-run", false, "")
+		keep_followed := fs.Bool("keep-followed", true, "")
+		keep_bookmarks := fs.Bool("keep-bookmarks", true, "")
+		images_older_than := fs.Int("images-older-than", -1, "")
+		videos_older_than := fs.Int("videos-older-than", -1, "")
+		max_size := fs.Int64("max-size", 0, "")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+		policy := MediaRetentionPolicy{
+			KeepFollowed:   *keep_followed,
+			KeepBookmarked: *keep_bookmarks,
+			MaxMediaSize:   *max_size * 1e6,
+		}
+		days_ago := func(days int) Timestamp {
+			return Timestamp{time.Now().AddDate(0, 0, -days)}
+		}
+		if *images_older_than >= 0 {
+			policy.ImagesPostedBefore = days_ago(*images_older_than)
+		}
+		if *videos_older_than >= 0 {
+			policy.VideosPostedBefore = days_ago(*videos_older_than)
+		}
+		prune_media(policy, *is_dry_run)
 	case "follow":
 		follow_user(target, true)
 	case "unfollow":
@@ -215,11 +404,14 @@ func main() {
 		fs := flag.NewFlagSet("", flag.ExitOnError)
 		should_auto_open := fs.Bool("auto-open", false, "")
 		addr := fs.String("addr", "localhost:1973", "port to listen on") // Random port that's probably not in use
+		should_sweep_deleted := fs.Bool("sweep-deleted", false, "")
+		mastodon_addr := fs.String("mastodon-addr", "", "")
+		backup_dir := fs.String("backup-dir", "", "")
 
 		if err := fs.Parse(args[1:]); err != nil {
 			panic(err)
 		}
-		start_webserver(*addr, *should_auto_open)
+		start_webserver(*addr, *should_auto_open, *should_sweep_deleted, *mastodon_addr, *backup_dir)
 	case "fetch_inbox":
 		fetch_inbox(*how_many)
 	case "fetch_dm":
@@ -570,6 +762,149 @@ func search(query string, how_many int) {
 	happy_exit(fmt.Sprintf("Saved %d tweets and %d users", len(trove.Tweets), len(trove.Users)), err)
 }
 
+// Re-check a batch of archived tweets to find ones that have been deleted, suspended or hidden
+// since they were scraped.  If a user handle is given, only that user's tweets are checked.
+func sweep_deleted_tweets(handle UserHandle, how_many int) {
+	var user_id UserID
+	if handle != "" {
+		user, err := profile.GetUserByHandle(handle)
+		if err != nil {
+			die(fmt.Sprintf("Couldn't get the user from database:\n  %s", err.Error()), false, 1)
+		}
+		user_id = user.ID
+	}
+
+	started_at := Timestamp{time.Now().Truncate(time.Millisecond)}
+	trove, err := api.RecheckTweets(profile.GetTweetIDsForDeletionSweep(how_many, user_id))
+	full_save_tweet_trove(trove) // Save whatever was checked, even if it failed partway through
+	if is_scrape_failure(err) {
+		die(fmt.Sprintf("Error re-checking tweets:\n  %s", err.Error()), false, -2)
+	}
+
+	num_deleted := 0
+	for id := range trove.Tweets {
+		deletion, err := profile.GetTweetDeletion(id)
+		if err == nil && !deletion.FirstSeenAt.Before(started_at.Time) {
+			num_deleted += 1
+		}
+	}
+	happy_exit(fmt.Sprintf("Re-checked %d tweets; %d newly found deleted, suspended or hidden", len(trove.Tweets), num_deleted), err)
+}
+
+func import_archive(filename string) {
+	archive, err := scraper.OpenTwitterArchive(filename)
+	if err != nil {
+		die(fmt.Sprintf("Error reading archive:\n  %s", err.Error()), false, 1)
+	}
+	trove := archive.Trove
+	owner_id := UserID(archive.Account.AccountID)
+	num_tweets := 0
+	for _, t := range trove.Tweets {
+		if t.UserID == owner_id {
+			num_tweets += 1
+		}
+	}
+
+	// Archives have less info than scraping, so don't overwrite users or stub tweets (i.e., likes)
+	// that are already in the database
+	for id := range trove.Users {
+		if _, err := profile.GetUserByID(id); err == nil {
+			delete(trove.Users, id)
+		}
+	}
+	for id, t := range trove.Tweets {
+		if _, err := profile.GetTweetById(id); err == nil && t.IsStub {
+			delete(trove.Tweets, id)
+		}
+	}
+
+	// Copy media bundled in the archive; anything else (e.g., video thumbnails) gets downloaded
+	full_save_tweet_trove_with_downloader(trove, func(remote_url string) ([]byte, error) {
+		data, err := archive.DownloadMedia(remote_url)
+		if errors.Is(err, scraper.ErrMediaNotInArchive) {
+			return api.DownloadMedia(remote_url)
+		}
+		return data, err
+	})
+	archive.Close()
+
+	for _, id := range archive.FollowerIDs {
+		if err := profile.SaveFollow(id, owner_id); err != nil {
+			die(fmt.Sprintf("Error saving archived followers:\n  %s", err.Error()), false, 1)
+		}
+	}
+	for _, id := range archive.FolloweeIDs {
+		if err := profile.SaveFollow(owner_id, id); err != nil {
+			die(fmt.Sprintf("Error saving archived followees:\n  %s", err.Error()), false, 1)
+		}
+	}
+	happy_exit(fmt.Sprintf(
+		"Imported archive for @%s: %d tweets, %d likes, %d DMs in %d conversations, %d followers, %d followees",
+		archive.Account.Username, num_tweets, len(trove.Likes), len(trove.Messages),
+		len(trove.Rooms), len(archive.FollowerIDs), len(archive.FolloweeIDs),
+	), nil)
+}
+
+// Export the profile's contents (or the results of a search query) to a JSONL file, or a zip file
+// with the media bundled in
+func export(filename string, query string, should_bundle_media bool) {
+	outfile, err := os.Create(filename)
+	if err != nil {
+		die(fmt.Sprintf("Error creating output file:\n  %s", err.Error()), false, 1)
+	}
+	var counts TroveExportCounts
+	if should_bundle_media {
+		counts, err = profile.ExportBundle(outfile, query)
+	} else {
+		counts, err = profile.ExportJSONL(outfile, query)
+	}
+	if err != nil {
+		outfile.Close()
+		os.Remove(filename) // Don't leave a partial export behind
+		die(fmt.Sprintf("Error writing export:\n  %s", err.Error()), false, 1)
+	}
+	if err := outfile.Close(); err != nil {
+		die(fmt.Sprintf("Error writing export:\n  %s", err.Error()), false, 1)
+	}
+	happy_exit(fmt.Sprintf(
+		"Exported %d tweets, %d users, %d retweets, %d likes, %d bookmarks, %d notifications, %d DMs in %d conversations",
+		counts.NumTweets, counts.NumUsers, counts.NumRetweets, counts.NumLikes, counts.NumBookmarks,
+		counts.NumNotifications, counts.NumMessages, counts.NumRooms,
+	), nil)
+}
+
+// Import a file created by "export".  Media bundles are detected automatically.
+func import_export_file(filename string) {
+	var trove TweetTrove
+	zip_reader, err := zip.OpenReader(filename)
+	if err == nil {
+		// It's a bundle
+		trove, _, err = profile.ReadTweetTroveBundle(&zip_reader.Reader)
+		zip_reader.Close()
+	} else {
+		var f *os.File
+		f, err = os.Open(filename)
+		if err != nil {
+			die(fmt.Sprintf("Error opening file:\n  %s", err.Error()), false, 1)
+		}
+		trove, _, err = ReadTweetTroveJSONL(f)
+		f.Close()
+	}
+	if err != nil {
+		die(fmt.Sprintf("Error reading export file:\n  %s", err.Error()), false, 1)
+	}
+
+	conflicting_users := profile.ImportTweetTrove(trove)
+	for _, u_id := range conflicting_users {
+		log.Warnf("Conflicting user handle found (ID %d); old user has been marked deleted.  Rescrape them manually", u_id)
+	}
+	happy_exit(fmt.Sprintf(
+		"Imported %d tweets, %d users, %d retweets, %d likes, %d bookmarks, %d notifications, %d DMs in %d conversations",
+		len(trove.Tweets), len(trove.Users), len(trove.Retweets), len(trove.Likes), len(trove.Bookmarks),
+		len(trove.Notifications), len(trove.Messages), len(trove.Rooms),
+	), nil)
+}
+
 func follow_user(handle string, is_followed bool) {
 	user, err := profile.GetUserByHandle(UserHandle(handle))
 	if err != nil {
@@ -580,7 +915,9 @@ func follow_user(handle string, is_followed bool) {
 		if err != nil {
 			die(fmt.Sprintf("Failed to follow user:\n  %s", err.Error()), false, 1)
 		}
-		profile.SaveFollow(api.UserID, user.ID)
+		if err := profile.SaveFollow(api.UserID, user.ID); err != nil {
+			die(fmt.Sprintf("Followed user, but failed to save it:\n  %s", err.Error()), false, 1)
+		}
 		happy_exit("Followed user: "+handle, nil)
 	} else {
 		err := api.UnfollowUser(user.ID)
@@ -620,17 +957,217 @@ func like_tweet(tweet_identifier string) {
 	happy_exit("Liked the tweet.", nil)
 }
 
-func start_webserver(addr string, should_auto_open bool) {
+func start_webserver(addr string, should_auto_open bool, should_sweep_deleted bool, mastodon_addr string, backup_dir string) {
 	app := webserver.NewApp(profile)
+	app.IsDeletedTweetSweepEnabled = should_sweep_deleted
+	app.BackupDir = backup_dir
+	app.MediaDownloads = media_downloads
 	if api.UserHandle != "" {
 		err := app.SetActiveUser(api.UserHandle)
 		if err != nil {
 			die(err.Error(), false, -1)
 		}
 	}
+	if mastodon_addr != "" {
+		go app.RunMastodonAPI(mastodon_addr)
+	}
 	app.Run(addr, should_auto_open)
 }
 
+// Print the inconsistencies in the profile, grouped by kind, and optionally fix them
+func check_profile(should_repair bool) {
+	issues, err := profile.CheckProfile(should_repair)
+
+	const MAX_SHOWN_PER_KIND = 20
+	kinds := []ProfileIssueKind{}
+	issues_by_kind := map[ProfileIssueKind][]ProfileIssue{}
+	num_unrepaired := 0
+	for _, issue := range issues {
+		if _, is_ok := issues_by_kind[issue.Kind]; !is_ok {
+			kinds = append(kinds, issue.Kind)
+		}
+		issues_by_kind[issue.Kind] = append(issues_by_kind[issue.Kind], issue)
+		if !issue.IsRepaired {
+			num_unrepaired += 1
+		}
+	}
+	for _, kind := range kinds {
+		fmt.Printf(terminal_utils.COLOR_YELLOW+"%s: %d"+terminal_utils.COLOR_RESET+"\n", kind, len(issues_by_kind[kind]))
+		for i, issue := range issues_by_kind[kind] {
+			if i == MAX_SHOWN_PER_KIND {
+				fmt.Printf("    ... and %d more\n", len(issues_by_kind[kind])-MAX_SHOWN_PER_KIND)
+				break
+			}
+			if issue.IsRepaired {
+				fmt.Printf("    %s (repaired)\n", issue.Description)
+			} else {
+				fmt.Printf("    %s\n", issue.Description)
+			}
+		}
+	}
+
+	if err != nil {
+		die(fmt.Sprintf("Error checking profile:\n  %s", err.Error()), false, 1)
+	}
+	if num_unrepaired > 0 {
+		msg := fmt.Sprintf("Found %d problems", len(issues))
+		if should_repair {
+			msg += fmt.Sprintf("; %d couldn't be repaired automatically", num_unrepaired)
+		} else {
+			msg += "; use `--repair` to fix them"
+		}
+		die(msg, false, 1)
+	}
+	if len(issues) == 0 {
+		happy_exit("No problems found", nil)
+	}
+	happy_exit(fmt.Sprintf("Found %d problems; all repaired", len(issues)), nil)
+}
+
+// Move downloaded media to the content-addressed layout, deleting duplicates
+func dedupe_media() {
+	result, err := profile.DedupeMedia()
+	if err != nil {
+		die(fmt.Sprintf("Error deduplicating media:\n  %s", err.Error()), false, 1)
+	}
+	happy_exit(fmt.Sprintf(
+		"Checked %d media files (%d missing); removed %d duplicates, reclaiming %.1f MB",
+		result.FilesChecked, result.FilesMissing, result.DuplicatesRemoved, float64(result.BytesReclaimed)/1e6,
+	), nil)
+}
+
+// Delete downloaded tweet media according to a retention policy, and print a size report
+func prune_media(policy MediaRetentionPolicy, is_dry_run bool) {
+	if policy.ImagesPostedBefore.IsZero() && policy.VideosPostedBefore.IsZero() && policy.MaxMediaSize == 0 {
+		die("At least one of `--images-older-than`, `--videos-older-than` or `--max-size` must be given", true, 1)
+	}
+	result, err := profile.PruneMedia(policy, is_dry_run)
+	if err != nil {
+		die(fmt.Sprintf("Error pruning media:\n  %s", err.Error()), false, 1)
+	}
+
+	verb := "Pruned"
+	if is_dry_run {
+		verb = "Would prune"
+	}
+	fmt.Printf("Tweet media before:  %.1f MB\n", float64(result.TotalSizeBefore)/1e6)
+	fmt.Printf("Tweet media after:   %.1f MB\n", float64(result.TotalSizeAfter)/1e6)
+	happy_exit(fmt.Sprintf(
+		"%s %d images and %d videos from %d tweets; %d files deleted, freeing %.1f MB",
+		verb, result.ImagesPruned, result.VideosPruned, result.TweetsAffected, result.FilesDeleted,
+		float64(result.BytesFreed)/1e6,
+	), nil)
+}
+
+// Import everything from another profile into this one
+func merge_profile(other_dir string) {
+	result, err := profile.MergeProfile(other_dir)
+	if err != nil {
+		die(fmt.Sprintf("Error merging profile %q:\n  %s", other_dir, err.Error()), false, 1)
+	}
+	for _, u_id := range result.ConflictingUserIDs {
+		fmt.Printf("Conflicting user handle: user ID %d was marked as deleted\n", u_id)
+	}
+	happy_exit(fmt.Sprintf(
+		"Merged %d users, %d tweets, %d DMs and %d new lists (%d fake user IDs changed, %d media files copied)",
+		result.NumUsers, result.NumTweets, result.NumMessages, result.NumLists, result.NumFakeUserIDs, result.NumMediaFiles,
+	), nil)
+}
+
+// Migrate the profile's database to a schema version, or print the SQL that would be run
+func migrate(profile_dir string, version int, is_dry_run bool) {
+	result, err := MigrateProfile(profile_dir, version, is_dry_run)
+	if err != nil {
+		die(fmt.Sprintf("Error migrating profile:\n  %s", err.Error()), false, 1)
+	}
+	if result.FromVersion == result.ToVersion {
+		happy_exit(fmt.Sprintf("Already at schema version %d", version), nil)
+	}
+	if is_dry_run {
+		for _, sql := range result.SQL {
+			fmt.Println(sql)
+			fmt.Println()
+		}
+		happy_exit(fmt.Sprintf("Would migrate from schema version %d to %d", result.FromVersion, result.ToVersion), nil)
+	}
+
+	fmt.Printf("Backed up the profile to %s\n", result.BackupDir)
+	if len(result.SchemaDifferences) != 0 {
+		fmt.Printf(terminal_utils.COLOR_YELLOW + "The migrated schema doesn't match what it should be:\n" + terminal_utils.COLOR_RESET)
+		for _, d := range result.SchemaDifferences {
+			fmt.Printf("    %s\n", d)
+		}
+		die(fmt.Sprintf("Migrated to schema version %d, but the schema is wrong", result.ToVersion), false, 1)
+	}
+	happy_exit(fmt.Sprintf("Migrated from schema version %d to %d", result.FromVersion, result.ToVersion), nil)
+}
+
+// Back up the profile to a new snapshot in the backup directory
+func backup(backup_dir string, opts BackupOptions) {
+	result, err := profile.Backup(backup_dir, opts)
+	if err != nil {
+		die(fmt.Sprintf("Error backing up profile:\n  %s", err.Error()), false, 1)
+	}
+	for _, snapshot := range result.SnapshotsDeleted {
+		fmt.Printf("Deleted old snapshot: %s\n", snapshot)
+	}
+	happy_exit(fmt.Sprintf(
+		"Backed up to %s (%d files copied, %d unchanged files linked, %.1f MB)",
+		result.SnapshotDir, result.FilesCopied, result.FilesLinked, float64(result.BytesCopied)/1e6,
+	), nil)
+}
+
+// Restore a backup snapshot to the profile directory, and upgrade it if it's from an older version
+func restore(snapshot_dir string, profile_dir string) {
+	result, err := RestoreBackup(snapshot_dir, profile_dir)
+	if err != nil {
+		die(fmt.Sprintf("Error restoring backup:\n  %s", err.Error()), false, 1)
+	}
+	if result.PreviousDatabaseFile != "" {
+		fmt.Printf("The previous database was moved to %s\n", result.PreviousDatabaseFile)
+	}
+	restored, err := LoadProfile(profile_dir)
+	if err != nil {
+		die(fmt.Sprintf("Error loading restored profile:\n  %s", err.Error()), false, 1)
+	}
+	version, err := restored.GetDatabaseVersion()
+	if err != nil {
+		die(err.Error(), false, 1)
+	}
+	happy_exit(fmt.Sprintf(
+		"Restored %s to %s (schema version %d, now %d; %d media files restored)",
+		snapshot_dir, profile_dir, result.DatabaseVersion, version, result.FilesRestored,
+	), nil)
+}
+
+// Render a static site from a user feed, a List or a search
+func render_static(output_dir string, handle UserHandle, list_id ListID, query string, page_size int) {
+	num_feeds := 0
+	for _, is_set := range []bool{handle != "", list_id != 0, query != ""} {
+		if is_set {
+			num_feeds += 1
+		}
+	}
+	if num_feeds != 1 {
+		die("Exactly one of `--user`, `--list` or `--query` must be given", true, 1)
+	}
+
+	site := webserver.NewStaticSite(profile, output_dir)
+	site.PageSize = page_size
+	var err error
+	if handle != "" {
+		err = site.RenderUserFeed(handle)
+	} else if list_id != 0 {
+		err = site.RenderListFeed(list_id)
+	} else {
+		err = site.RenderSearch(query)
+	}
+	if err != nil {
+		die(fmt.Sprintf("Error rendering static site:\n  %s", err.Error()), false, 1)
+	}
+	happy_exit(fmt.Sprintf("Rendered static site to %s", output_dir), nil)
+}
+
 func fetch_inbox(how_many int) {
 	trove, _, err := api.GetInbox(how_many)
 	if err != nil {
@@ -710,3 +1247,140 @@ func mark_notification_as_read() {
 	}
 	happy_exit("Notifications marked as read", nil)
 }
+
+func parse_job_id(s string) ScrapeJobID {
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		die(fmt.Sprintf("Invalid job ID: %q", s), false, 1)
+	}
+	return ScrapeJobID(id)
+}
+
+// Add a scrape job to the queue.  It runs the next time jobs are run (`run_jobs`, or the webserver).
+func queue_job(job ScrapeJob) {
+	if err := profile.SaveScrapeJob(&job); err != nil {
+		die(err.Error(), false, 1)
+	}
+	happy_exit(fmt.Sprintf("Queued job %d: %s %q", job.ID, job.Type, job.Target), nil)
+}
+
+func list_jobs() {
+	for _, job := range profile.GetAllScrapeJobs() {
+		fmt.Printf("%5d  %-9s  %-11s  %-30q  priority %-3d  %d pages", job.ID, job.Status, job.Type, job.Target,
+			job.Priority, job.NumPages)
+		if job.MaxPages != 0 {
+			fmt.Printf(" (max %d)", job.MaxPages)
+		}
+		if job.IsWaitingToRetry() {
+			fmt.Printf("  retrying at %s", job.RetryAt.Format(time.DateTime))
+		}
+		fmt.Println()
+		if job.LastError != "" {
+			fmt.Printf(terminal_utils.COLOR_YELLOW+"       %s"+terminal_utils.COLOR_RESET+"\n", job.LastError)
+		}
+	}
+}
+
+func cancel_job(id string) {
+	if err := profile.CancelScrapeJob(parse_job_id(id)); err != nil {
+		die(err.Error(), false, 1)
+	}
+	happy_exit("Cancelled job "+id, nil)
+}
+
+func retry_job(id string) {
+	if err := profile.RetryScrapeJob(parse_job_id(id)); err != nil {
+		die(err.Error(), false, 1)
+	}
+	happy_exit("Re-queued job "+id, nil)
+}
+
+func prioritize_job(id string, priority int) {
+	if err := profile.SetScrapeJobPriority(parse_job_id(id), priority); err != nil {
+		die(err.Error(), false, 1)
+	}
+	happy_exit(fmt.Sprintf("Set job %s to priority %d", id, priority), nil)
+}
+
+// Run queued jobs until there are none left that are ready to run.  Jobs waiting to be retried are
+// left for next time.
+func run_jobs() {
+	// Jobs still marked as running that haven't saved any progress for a while were interrupted.  Ones
+	// that have might be running right now (e.g., in a webserver), so they're left alone.
+	if num_resumed := profile.RequeueInterruptedScrapeJobs(scraper.SCRAPE_JOB_STALE_TIMEOUT); num_resumed != 0 {
+		fmt.Printf("Resuming %d interrupted jobs\n", num_resumed)
+	}
+
+	num_ok := 0
+	num_failed := 0
+	for {
+		job, err := profile.ClaimNextScrapeJob()
+		if errors.Is(err, ErrNotInDatabase) {
+			break
+		}
+		fmt.Printf("Running job %d: %s %q (from page %d)\n", job.ID, job.Type, job.Target, job.NumPages+1)
+		err = api.RunScrapeJob(profile, &job, full_save_tweet_trove)
+		if err != nil {
+			fmt.Printf(terminal_utils.COLOR_YELLOW+"%s"+terminal_utils.COLOR_RESET+"\n", err.Error())
+			num_failed += 1
+		} else {
+			fmt.Printf("Job %d %s after %d pages\n", job.ID, job.Status, job.NumPages)
+			num_ok += 1
+		}
+	}
+	happy_exit(fmt.Sprintf("Ran %d jobs (%d failed)", num_ok+num_failed, num_failed), nil)
+}
+
+// Download whatever is in the media download queue, e.g., after a scrape was interrupted
+func download_queued_media_op(should_retry_failed bool) {
+	if should_retry_failed {
+		fmt.Printf("Retrying %d failed downloads\n", profile.RetryFailedMediaDownloads())
+	}
+	download_queued_media(DefaultDownloader{Download: api.DownloadMedia})
+	for _, d := range profile.GetFailedMediaDownloads() {
+		fmt.Printf(terminal_utils.COLOR_YELLOW+"Failed: %s %d: %s"+terminal_utils.COLOR_RESET+"\n", d.Type, d.ItemID, d.LastError)
+	}
+	happy_exit("Done", nil)
+}
+
+// Format a video policy's limits, e.g., "max height 720p, max bitrate 2000 kbps"
+func format_video_policy_limits(policy VideoPolicy) string {
+	limits := []string{}
+	if policy.MaxHeight != 0 {
+		limits = append(limits, fmt.Sprintf("max height %dp", policy.MaxHeight))
+	}
+	if policy.MaxBitrate != 0 {
+		limits = append(limits, fmt.Sprintf("max bitrate %d kbps", policy.MaxBitrate/1000))
+	}
+	if len(limits) == 0 {
+		return "no limits"
+	}
+	return strings.Join(limits, ", ")
+}
+
+func show_video_policy() {
+	policy := profile.GetVideoPolicy()
+	happy_exit(fmt.Sprintf("Video policy: %s (%s)", policy.Mode, format_video_policy_limits(policy)), nil)
+}
+
+func set_video_policy(policy VideoPolicy) {
+	if err := profile.SetVideoPolicy(policy); err != nil {
+		die(err.Error(), false, 1)
+	}
+	show_video_policy()
+}
+
+// Re-download a tweet's videos, if a better version is available within the limits
+func upgrade_videos(tweet_identifier string, policy VideoPolicy) {
+	tweet_id, err := extract_id_from(tweet_identifier)
+	if err != nil {
+		die(err.Error(), false, -1)
+	}
+	num_upgraded, err := profile.UpgradeTweetVideos(tweet_id, policy, DefaultDownloader{Download: api.DownloadMedia})
+	if errors.Is(err, ErrNotInDatabase) {
+		die(fmt.Sprintf("Tweet %d isn't in the database", tweet_id), false, 1)
+	} else if err != nil && !errors.Is(err, scraper.ErrRateLimited) {
+		die(err.Error(), false, 1)
+	}
+	happy_exit(fmt.Sprintf("Upgraded %d videos (%s)", num_upgraded, format_video_policy_limits(policy)), err)
+}
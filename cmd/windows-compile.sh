@@ -7,6 +7,7 @@ export CGO_ENABLED=1
 export CC=x86_64-w64-mingw32-gcc
 export GOOS=windows
 export GOARCH=amd64
+export GOFLAGS="-tags=sqlite_fts5" # For full-text search (FTS5)
 
 if [[ -z "$1" ]]; then
 	echo "No version number given!  Exiting..."
@@ -0,0 +1,326 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backups are stored as snapshot directories in a backup directory.  Each snapshot has a copy of
+// `twitter.db`, and (optionally) the media directories, laid out the same as in a Profile.
+const BACKUP_SNAPSHOT_PREFIX = "snapshot_"
+const backup_snapshot_time_format = "2006-01-02_15-04-05.000"
+
+// Directories in a Profile that are included in a backup if media is included
+var backup_media_dirs = []string{"profile_images", "link_preview_images", "images", "videos", "video_thumbnails"}
+
+var ErrNotABackupSnapshot = errors.New("not a backup snapshot")
+
+type BackupOptions struct {
+	IncludeMedia bool
+
+	// Delete the oldest snapshots after backing up, so at most this many are left.  Zero means keep all of them.
+	NumToKeep int
+}
+
+// Result of backing up a Profile
+type BackupResult struct {
+	SnapshotDir      string
+	FilesCopied      int   // Media files that weren't in the previous snapshot
+	FilesLinked      int   // Media files that were (hard-linked from the previous snapshot instead of copied)
+	BytesCopied      int64 // Including the database
+	SnapshotsDeleted []string
+}
+
+// Back up the Profile to a new snapshot in `backup_dir`.  This is safe to do while the Profile is in use
+// (e.g., by the webserver), since the database is copied with SQLite's online backup API.
+//
+// Media is backed up incrementally: files that are unchanged since the previous snapshot are
+// hard-linked from it, so only new files are copied.  Each snapshot is still complete by itself, so
+// old ones can be deleted freely.  If it fails, the partial snapshot is deleted.
+func (p Profile) Backup(backup_dir string, opts BackupOptions) (ret BackupResult, err error) {
+	if err := os.MkdirAll(backup_dir, 0755); err != nil {
+		return ret, fmt.Errorf("Error creating backup directory %q:\n  %w", backup_dir, err)
+	}
+	snapshots, err := ListBackupSnapshots(backup_dir)
+	if err != nil {
+		return ret, err
+	}
+
+	// Build the snapshot under a temporary name, so an interrupted backup doesn't look like a snapshot
+	name := BACKUP_SNAPSHOT_PREFIX + time.Now().UTC().Format(backup_snapshot_time_format)
+	ret.SnapshotDir = filepath.Join(backup_dir, name)
+	partial_dir := ret.SnapshotDir + ".partial"
+	if err := os.Mkdir(partial_dir, 0755); err != nil {
+		return ret, fmt.Errorf("Error creating snapshot directory %q:\n  %w", partial_dir, err)
+	}
+	defer func() {
+		if err != nil {
+			// Does nothing if it was already renamed
+			_ = os.RemoveAll(partial_dir)
+		}
+	}()
+
+	db_file := filepath.Join(partial_dir, "twitter.db")
+	if err := p.backup_database(db_file); err != nil {
+		return ret, err
+	}
+	info, err := os.Stat(db_file)
+	if err != nil {
+		return ret, fmt.Errorf("Error checking backed up database %q:\n  %w", db_file, err)
+	}
+	ret.BytesCopied += info.Size()
+
+	if opts.IncludeMedia {
+		prev_snapshot := ""
+		if len(snapshots) > 0 {
+			prev_snapshot = snapshots[len(snapshots)-1]
+		}
+		for _, dir := range backup_media_dirs {
+			if err := p.backup_media_dir(dir, partial_dir, prev_snapshot, &ret); err != nil {
+				return ret, err
+			}
+		}
+	}
+
+	if err := os.Rename(partial_dir, ret.SnapshotDir); err != nil {
+		return ret, fmt.Errorf("Error renaming snapshot %q:\n  %w", partial_dir, err)
+	}
+
+	// Rotate old snapshots
+	snapshots = append(snapshots, ret.SnapshotDir)
+	if opts.NumToKeep > 0 && len(snapshots) > opts.NumToKeep {
+		for _, old_snapshot := range snapshots[:len(snapshots)-opts.NumToKeep] {
+			if err := os.RemoveAll(old_snapshot); err != nil {
+				return ret, fmt.Errorf("Error deleting old snapshot %q:\n  %w", old_snapshot, err)
+			}
+			ret.SnapshotsDeleted = append(ret.SnapshotsDeleted, old_snapshot)
+		}
+	}
+	return ret, nil
+}
+
+// Copy the database to a new file with SQLite's online backup API, which produces a consistent
+// snapshot even if something else is writing to it.
+func (p Profile) backup_database(dest_file string) error {
+	ctx := context.Background()
+	src_conn, err := p.DB.Conn(ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer src_conn.Close()
+
+	dest_db, err := sql.Open(SQLITE_DRIVER_NAME, dest_file)
+	if err != nil {
+		return fmt.Errorf("Error creating backup database %q:\n  %w", dest_file, err)
+	}
+	defer dest_db.Close()
+	dest_conn, err := dest_db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("Error opening backup database %q:\n  %w", dest_file, err)
+	}
+	defer dest_conn.Close()
+
+	err = dest_conn.Raw(func(dest_driver_conn any) error {
+		return src_conn.Raw(func(src_driver_conn any) error {
+			backup, err := dest_driver_conn.(*sqlite3.SQLiteConn).Backup("main", src_driver_conn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			// Copy all the pages in one step, so it's all from the same read transaction
+			if _, err := backup.Step(-1); err != nil {
+				_ = backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("Error backing up database to %q:\n  %w", dest_file, err)
+	}
+	return nil
+}
+
+// Back up one of the media directories into a snapshot.  Files that are also in the previous
+// snapshot (same path and size) are linked from there instead of copied.
+func (p Profile) backup_media_dir(dir string, snapshot_dir string, prev_snapshot_dir string, result *BackupResult) error {
+	src_root := filepath.Join(p.ProfileDir, dir)
+	if !file_exists(src_root) {
+		return nil
+	}
+	err := filepath.WalkDir(src_root, func(src string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel_path, err := filepath.Rel(p.ProfileDir, src)
+		if err != nil {
+			panic(err)
+		}
+		dest := filepath.Join(snapshot_dir, rel_path)
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if prev_snapshot_dir != "" {
+			prev_info, err := os.Stat(filepath.Join(prev_snapshot_dir, rel_path))
+			if err == nil && prev_info.Size() == info.Size() && os.Link(filepath.Join(prev_snapshot_dir, rel_path), dest) == nil {
+				result.FilesLinked += 1
+				return nil
+			}
+		}
+		if err := copy_file(src, dest); err != nil {
+			return err
+		}
+		result.FilesCopied += 1
+		result.BytesCopied += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error backing up %q:\n  %w", src_root, err)
+	}
+	return nil
+}
+
+// Get the snapshots in a backup directory, oldest first
+func ListBackupSnapshots(backup_dir string) ([]string, error) {
+	entries, err := os.ReadDir(backup_dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading backup directory %q:\n  %w", backup_dir, err)
+	}
+	ret := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), BACKUP_SNAPSHOT_PREFIX) && filepath.Ext(entry.Name()) != ".partial" {
+			ret = append(ret, filepath.Join(backup_dir, entry.Name()))
+		}
+	}
+	// Names are timestamps, so sorting them puts them in order
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Result of restoring a backup snapshot
+type RestoreResult struct {
+	DatabaseVersion      int
+	FilesRestored        int
+	PreviousDatabaseFile string // Where the database that was replaced was moved to; empty if there wasn't one
+}
+
+// Restore a backup snapshot to `profile_dir`.  Nothing else should be using the profile while it's
+// being restored.
+//
+// The snapshot's schema version is checked first; it can't be newer than this application's.  (If
+// it's older, the Profile is upgraded the next time it's loaded, as usual.)  If there's already a
+// database in `profile_dir`, it's kept as "twitter.db.before-restore.<timestamp>" (see
+// `RestoreResult.PreviousDatabaseFile`), so restoring again doesn't overwrite it.  Media files from the snapshot
+// are restored if they're missing; other files in the profile are left alone.
+func RestoreBackup(snapshot_dir string, profile_dir string) (RestoreResult, error) {
+	ret := RestoreResult{}
+	snapshot_db_file := filepath.Join(snapshot_dir, "twitter.db")
+	if !file_exists(snapshot_db_file) {
+		return ret, fmt.Errorf("Error restoring %q:\n  %w", snapshot_dir, ErrNotABackupSnapshot)
+	}
+
+	// Check the snapshot before touching anything
+	snapshot := Profile{ProfileDir: snapshot_dir, DB: sqlx.MustOpen(SQLITE_DRIVER_NAME, "file:"+snapshot_db_file+"?mode=ro")}
+	defer snapshot.DB.Close()
+	version, err := snapshot.GetDatabaseVersion()
+	if err != nil {
+		return ret, fmt.Errorf("Error restoring %q:\n  %w", snapshot_dir, err)
+	}
+	if version > ENGINE_DATABASE_VERSION {
+		return ret, VersionMismatchError{ENGINE_DATABASE_VERSION, version}
+	}
+	ret.DatabaseVersion = version
+	var integrity_check_result string
+	if err := snapshot.DB.Get(&integrity_check_result, `pragma quick_check`); err != nil {
+		return ret, fmt.Errorf("Error checking snapshot database %q:\n  %w", snapshot_db_file, err)
+	}
+	if integrity_check_result != "ok" {
+		return ret, fmt.Errorf("Snapshot database %q is corrupted: %s", snapshot_db_file, integrity_check_result)
+	}
+
+	for _, dir := range append([]string{""}, backup_media_dirs...) {
+		if err := os.MkdirAll(filepath.Join(profile_dir, dir), 0755); err != nil {
+			return ret, fmt.Errorf("Error creating directory %q:\n  %w", filepath.Join(profile_dir, dir), err)
+		}
+	}
+
+	// Keep the current database (with its WAL files, if any) out of the way
+	db_file := filepath.Join(profile_dir, "twitter.db")
+	if file_exists(db_file) {
+		ret.PreviousDatabaseFile = db_file + ".before-restore." + time.Now().UTC().Format(backup_snapshot_time_format)
+		for i := 2; file_exists(ret.PreviousDatabaseFile); i++ {
+			// Restored twice in the same millisecond
+			ret.PreviousDatabaseFile = fmt.Sprintf("%s.before-restore.%s-%d", db_file,
+				time.Now().UTC().Format(backup_snapshot_time_format), i)
+		}
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if file_exists(db_file + suffix) {
+			if err := os.Rename(db_file+suffix, ret.PreviousDatabaseFile+suffix); err != nil {
+				return ret, fmt.Errorf("Error moving %q out of the way:\n  %w", db_file+suffix, err)
+			}
+		}
+	}
+	// Copy, rather than link: the restored database will be modified, and the snapshot shouldn't be
+	if err := copy_file(snapshot_db_file, db_file); err != nil {
+		return ret, err
+	}
+
+	for _, dir := range backup_media_dirs {
+		src_root := filepath.Join(snapshot_dir, dir)
+		if !file_exists(src_root) {
+			continue
+		}
+		err := filepath.WalkDir(src_root, func(src string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel_path, err := filepath.Rel(snapshot_dir, src)
+			if err != nil {
+				panic(err)
+			}
+			dest := filepath.Join(profile_dir, rel_path)
+			if d.IsDir() {
+				return os.MkdirAll(dest, 0755)
+			}
+			if !d.Type().IsRegular() || file_exists(dest) {
+				return nil
+			}
+			if err := link_or_copy(src, dest); err != nil {
+				return err
+			}
+			ret.FilesRestored += 1
+			return nil
+		})
+		if err != nil {
+			return ret, fmt.Errorf("Error restoring %q:\n  %w", src_root, err)
+		}
+	}
+
+	// In case the snapshot doesn't include media
+	default_profile_image_file := filepath.Join(profile_dir, "profile_images/default_profile.png")
+	if !file_exists(default_profile_image_file) {
+		if err := os.WriteFile(default_profile_image_file, default_profile_image, 0644); err != nil {
+			return ret, fmt.Errorf("Error creating default profile image file %q:\n  %w", default_profile_image_file, err)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,99 @@
+package persistence_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestBackup"
+	backup_dir := "test_profiles/TestBackupSnapshots"
+	restore_path := "test_profiles/TestBackupRestored"
+	for _, path := range []string{profile_path, backup_dir, restore_path} {
+		if file_exists(path) {
+			require.NoError(os.RemoveAll(path))
+		}
+	}
+	profile := create_or_load_profile(profile_path)
+
+	tweet := create_dummy_tweet()
+	tweet.Images = tweet.Images[:1]
+	tweet.Images[0].IsDownloaded = true
+	require.NoError(profile.SaveTweet(tweet))
+	image_path := filepath.Join("images", tweet.Images[0].LocalFilename)
+	require.NoError(os.WriteFile(filepath.Join(profile_path, image_path), []byte("some image"), 0644))
+
+	// First backup copies everything
+	result, err := profile.Backup(backup_dir, BackupOptions{IncludeMedia: true, NumToKeep: 2})
+	require.NoError(err)
+	first_snapshot := result.SnapshotDir
+	assert.Equal(2, result.FilesCopied) // The image and the default profile image
+	assert.Equal(0, result.FilesLinked)
+	assert.True(file_exists(filepath.Join(first_snapshot, "twitter.db")))
+	assert.True(file_exists(filepath.Join(first_snapshot, image_path)))
+
+	// Second backup only copies new files
+	require.NoError(os.WriteFile(filepath.Join(profile_path, "images", "new_image.jpg"), []byte("another image"), 0644))
+	result, err = profile.Backup(backup_dir, BackupOptions{IncludeMedia: true, NumToKeep: 2})
+	require.NoError(err)
+	assert.Equal(1, result.FilesCopied)
+	assert.Equal(2, result.FilesLinked)
+	assert.Len(result.SnapshotsDeleted, 0)
+
+	// Third backup rotates out the first one
+	result, err = profile.Backup(backup_dir, BackupOptions{NumToKeep: 2})
+	require.NoError(err)
+	assert.Equal(0, result.FilesCopied)
+	assert.Equal([]string{first_snapshot}, result.SnapshotsDeleted)
+	assert.False(file_exists(first_snapshot))
+	snapshots, err := ListBackupSnapshots(backup_dir)
+	require.NoError(err)
+	require.Len(snapshots, 2)
+	assert.Equal(result.SnapshotDir, snapshots[1])
+
+	// Restore the one with media to a new profile
+	restore_result, err := RestoreBackup(snapshots[0], restore_path)
+	require.NoError(err)
+	assert.Equal(ENGINE_DATABASE_VERSION, restore_result.DatabaseVersion)
+	assert.Equal(3, restore_result.FilesRestored)
+	restored, err := LoadProfile(restore_path)
+	require.NoError(err)
+	new_tweet, err := restored.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.Equal(tweet.Text, new_tweet.Text)
+	assert.True(file_exists(filepath.Join(restore_path, image_path)))
+
+	// Restoring over an existing profile keeps the old database, every time
+	require.NoError(restored.DB.Close())
+	restore_result, err = RestoreBackup(snapshots[1], restore_path)
+	require.NoError(err)
+	assert.True(file_exists(restore_result.PreviousDatabaseFile))
+	assert.Contains(restore_result.PreviousDatabaseFile, "twitter.db.before-restore.")
+	first_previous_db_file := restore_result.PreviousDatabaseFile
+	restore_result, err = RestoreBackup(snapshots[1], restore_path)
+	require.NoError(err)
+	assert.NotEqual(first_previous_db_file, restore_result.PreviousDatabaseFile)
+	assert.True(file_exists(first_previous_db_file))
+	assert.True(file_exists(restore_result.PreviousDatabaseFile))
+
+	// Snapshots from a newer version can't be restored
+	db := sqlx.MustOpen("sqlite3", filepath.Join(snapshots[1], "twitter.db"))
+	db.MustExec(`update database_version set version_number = ?`, ENGINE_DATABASE_VERSION+1)
+	require.NoError(db.Close())
+	_, err = RestoreBackup(snapshots[1], restore_path)
+	var version_err VersionMismatchError
+	assert.True(errors.As(err, &version_err))
+
+	_, err = RestoreBackup(profile_path+"/images", restore_path)
+	assert.ErrorIs(err, ErrNotABackupSnapshot)
+}
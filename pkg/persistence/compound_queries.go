@@ -19,7 +19,7 @@ const TWEETS_ALL_SQL_FIELDS = `
 		quoted_tweet_id, mentions, reply_mentions, hashtags, ifnull(space_id, '') space_id,
 		ifnull(tombstone_types.short_name, '') tombstone_type, ifnull(tombstone_types.tombstone_text, '') tombstone_text,
 		case when likes.user_id is null then 0 else 1 end is_liked_by_current_user,
-		is_expandable, is_stub, is_content_downloaded, is_conversation_scraped, last_scraped_at`
+		is_expandable, is_stub, is_content_downloaded, is_conversation_scraped, last_scraped_at, editable_until`
 
 func tweet_select_query(u_id UserID) (query string, bind_values []interface{}) {
 	return `
@@ -168,7 +168,7 @@ func (p Profile) fill_content(trove *TweetTrove, current_user_id UserID) {
 	var videos []Video
 	err = p.DB.Select(&videos, `
         select id, tweet_id, width, height, remote_url, local_filename, thumbnail_remote_url, thumbnail_local_filename, duration,
-		       view_count, is_downloaded, is_blocked_by_dmca, is_gif
+		       view_count, is_downloaded, is_blocked_by_dmca, is_gif, downloaded_height, downloaded_bitrate, is_audio_only
 		  from videos
 		 where tweet_id in (`+in_clause+`)`, tweet_ids...)
 	if err != nil {
@@ -239,8 +239,9 @@ func NewTweetDetailView() TweetDetailView {
 	}
 }
 
-// Return the given tweet, all its parent tweets, and a list of conversation threads
-func (p Profile) GetTweetDetail(id TweetID, current_user_id UserID) (TweetDetailView, error) {
+// Return the given tweet, all its parent tweets, and a list of conversation threads.  Replies
+// hidden by mute rules are left out, unless `show_muted` is true.
+func (p Profile) GetTweetDetail(id TweetID, current_user_id UserID, show_muted bool) (TweetDetailView, error) {
 	// TODO: compound-query-structs
 	ret := NewTweetDetailView()
 	ret.MainTweetID = id
@@ -298,6 +299,17 @@ func (p Profile) GetTweetDetail(id TweetID, current_user_id UserID) (TweetDetail
 		}
 	}
 
+	// Replies are filtered by mute rules
+	mutes := []Mute{}
+	if !show_muted {
+		mutes = p.GetAllMutes()
+	}
+	mute_clauses, mute_bind_values := mute_where_clauses(mutes, false)
+	mute_where_clause := ""
+	if len(mute_clauses) > 0 {
+		mute_where_clause = " and " + strings.Join(mute_clauses, " and ")
+	}
+
 	// Replies (1st level)
 	var replies []Tweet
 	thread_top_id := TweetID(0)
@@ -307,9 +319,10 @@ func (p Profile) GetTweetDetail(id TweetID, current_user_id UserID) (TweetDetail
 	err = p.DB.Select(&replies, q+`
 	      where in_reply_to_id = ?
 	        and id != ? -- skip the main Thread if there is one
+	        `+mute_where_clause+`
 	      order by num_likes desc
 	      limit 50
-	`, append(bind_values, id, thread_top_id)...)
+	`, append(append(bind_values, id, thread_top_id), mute_bind_values...)...)
 	if err != nil {
 		panic(err)
 	}
@@ -329,6 +342,7 @@ func (p Profile) GetTweetDetail(id TweetID, current_user_id UserID) (TweetDetail
 		               select tweets.id, tweets.in_reply_to_id, num_likes
 		                 from parent_ids
 		                 left join tweets on tweets.in_reply_to_id = parent_ids.id
+		                where 1 ` + mute_where_clause + `
 		           ),
 		           top_ids_by_parent(id, parent_id) as (
 		               select id, parent_id outer_parent_id
@@ -340,7 +354,8 @@ func (p Profile) GetTweetDetail(id TweetID, current_user_id UserID) (TweetDetail
 		                )
 		           )` + q + `
 		      right join top_ids_by_parent on tweets.id = top_ids_by_parent.id`
-		err = p.DB.Select(&replies, reply2_query, append(reply_1_ids, bind_values...)...)
+		reply2_bind_values := append(append(reply_1_ids, mute_bind_values...), bind_values...)
+		err = p.DB.Select(&replies, reply2_query, reply2_bind_values...)
 		if err != nil {
 			panic(err)
 		}
@@ -380,7 +395,9 @@ func NewFeed() Feed {
 	}
 }
 
-func (p Profile) GetNotificationsForUser(u_id UserID, cursor int64, count int64) Feed {
+// Get a page of a user's notifications, newest first.  Notifications about tweets or retweets hidden
+// by mute rules are left out, unless `show_muted` is true.
+func (p Profile) GetNotificationsForUser(u_id UserID, cursor int64, count int64, show_muted bool) Feed {
 	// Get the notifications
 	var notifications []Notification
 	err := p.DB.Select(&notifications,
@@ -475,14 +492,30 @@ func (p Profile) GetNotificationsForUser(u_id UserID, cursor int64, count int64)
 		}
 	}
 
+	// Apply mute rules
+	is_muted := map[TweetID]bool{}
+	if !show_muted {
+		is_muted = p.get_muted_tweet_and_retweet_ids(tweet_ids, retweets, p.GetAllMutes())
+	}
+
 	ret := NewFeed()
 	for _, t := range tweets {
-		ret.TweetTrove.Tweets[t.ID] = t
+		if !is_muted[t.ID] {
+			ret.TweetTrove.Tweets[t.ID] = t
+		}
 	}
 	for _, r := range retweets {
-		ret.TweetTrove.Retweets[r.RetweetID] = r
+		if !is_muted[r.RetweetID] {
+			ret.TweetTrove.Retweets[r.RetweetID] = r
+		}
 	}
 	for _, n := range notifications {
+		if is_muted[n.ActionTweetID] || is_muted[n.ActionRetweetID] {
+			continue
+		}
+		n.TweetIDs = remove_muted_ids(n.TweetIDs, is_muted)
+		n.RetweetIDs = remove_muted_ids(n.RetweetIDs, is_muted)
+
 		// Add to tweet trove
 		ret.TweetTrove.Notifications[n.ID] = n
 
@@ -502,18 +535,25 @@ func (p Profile) GetNotificationsForUser(u_id UserID, cursor int64, count int64)
 
 	p.fill_content(&ret.TweetTrove, u_id)
 
-	// Set the bottom cursor value
+	// Set the bottom cursor value.  Muted notifications still count, so the page can end up short
+	// without it being the end of the feed.
 	ret.CursorBottom = Cursor{}
-	if len(ret.Items) < int(count) {
+	if len(notifications) < int(count) {
 		ret.CursorBottom.CursorPosition = CURSOR_END
 	} else {
 		ret.CursorBottom.CursorPosition = CURSOR_MIDDLE
-		last_item := ret.Items[len(ret.Items)-1]
-		last_notif, is_ok := ret.Notifications[last_item.NotificationID]
-		if !is_ok {
-			panic("last item isn't a notification???")
-		}
+		last_notif := notifications[len(notifications)-1]
 		ret.CursorBottom.CursorValue = int(last_notif.SortIndex) // TODO: CursorValue should be int64
 	}
 	return ret
 }
+
+func remove_muted_ids(ids []TweetID, is_muted map[TweetID]bool) []TweetID {
+	ret := []TweetID{}
+	for _, id := range ids {
+		if !is_muted[id] {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
@@ -201,7 +201,7 @@ func TestTweetDetailWithReplies(t *testing.T) {
 	profile, err := LoadProfile("../../sample_data/profile")
 	require.NoError(err)
 
-	tweet_detail, err := profile.GetTweetDetail(TweetID(1413646595493568516), UserID(1178839081222115328))
+	tweet_detail, err := profile.GetTweetDetail(TweetID(1413646595493568516), UserID(1178839081222115328), false)
 	require.NoError(err)
 
 	assert.Len(tweet_detail.Retweets, 0)
@@ -254,7 +254,7 @@ func TestTweetDetailWithParents(t *testing.T) {
 	profile, err := LoadProfile("../../sample_data/profile")
 	require.NoError(err)
 
-	tweet_detail, err := profile.GetTweetDetail(TweetID(1413773185296650241), UserID(1178839081222115328))
+	tweet_detail, err := profile.GetTweetDetail(TweetID(1413773185296650241), UserID(1178839081222115328), false)
 	require.NoError(err)
 
 	assert.Len(tweet_detail.Retweets, 0)
@@ -292,7 +292,7 @@ func TestTweetDetailWithThread(t *testing.T) {
 	profile, err := LoadProfile("../../sample_data/profile")
 	require.NoError(err)
 
-	tweet_detail, err := profile.GetTweetDetail(TweetID(1698762403163304110), UserID(1488963321701171204))
+	tweet_detail, err := profile.GetTweetDetail(TweetID(1698762403163304110), UserID(1488963321701171204), false)
 	require.NoError(err)
 
 	assert.Len(tweet_detail.Retweets, 0)
@@ -331,7 +331,7 @@ func TestNotificationsFeed(t *testing.T) {
 	profile, err := LoadProfile("../../sample_data/profile")
 	require.NoError(err)
 
-	feed := profile.GetNotificationsForUser(UserID(1488963321701171204), 0, 6)
+	feed := profile.GetNotificationsForUser(UserID(1488963321701171204), 0, 6, false)
 	assert.Len(feed.TweetTrove.Notifications, 6)
 	assert.Len(feed.TweetTrove.Tweets, 3)
 	assert.Len(feed.TweetTrove.Retweets, 1)
@@ -378,7 +378,7 @@ func TestNotificationsFeed(t *testing.T) {
 	// -----------------
 
 	// Limit 3, after sort_index of the 1st one above
-	feed = profile.GetNotificationsForUser(UserID(1488963321701171204), 1726604756351, 3)
+	feed = profile.GetNotificationsForUser(UserID(1488963321701171204), 1726604756351, 3, false)
 	assert.Len(feed.TweetTrove.Notifications, 3)
 
 	assert.Len(feed.Items, 3)
@@ -393,7 +393,7 @@ func TestNotificationsFeed(t *testing.T) {
 	// --------------
 
 	// cursor = last notification's sort index
-	feed = profile.GetNotificationsForUser(UserID(1488963321701171204), 1723494244885, 3)
+	feed = profile.GetNotificationsForUser(UserID(1488963321701171204), 1723494244885, 3, false)
 	assert.Len(feed.Items, 0)
 	assert.Equal(feed.CursorBottom.CursorPosition, CURSOR_END)
 }
@@ -17,10 +17,11 @@ const (
 	SORT_ORDER_MOST_RETWEETS
 	SORT_ORDER_LIKED_AT
 	SORT_ORDER_BOOKMARKED_AT
+	SORT_ORDER_RELEVANCE
 )
 
 func (o SortOrder) String() string {
-	return []string{"newest", "oldest", "most likes", "most retweets", "liked at", "bookmarked at"}[o]
+	return []string{"newest", "oldest", "most likes", "most retweets", "liked at", "bookmarked at", "relevance"}[o]
 }
 
 func SortOrderFromString(s string) (SortOrder, bool) {
@@ -31,10 +32,16 @@ func SortOrderFromString(s string) (SortOrder, bool) {
 		"most retweets": SORT_ORDER_MOST_RETWEETS,
 		"liked at":      SORT_ORDER_LIKED_AT,
 		"bookmarked at": SORT_ORDER_BOOKMARKED_AT,
+		"relevance":     SORT_ORDER_RELEVANCE,
 	}[s]
 	return result, is_ok // Have to store as temporary variable b/c otherwise it interprets it as single-value and compile fails
 }
 
+// Whether it's one of the sort orders above, e.g., when it comes from user input
+func (o SortOrder) IsValid() bool {
+	return o >= SORT_ORDER_NEWEST && o <= SORT_ORDER_RELEVANCE
+}
+
 func (o SortOrder) OrderByClause() string {
 	switch o {
 	case SORT_ORDER_NEWEST:
@@ -49,6 +56,8 @@ func (o SortOrder) OrderByClause() string {
 		return "order by likes_sort_order desc"
 	case SORT_ORDER_BOOKMARKED_AT:
 		return "order by bookmarks_sort_order desc"
+	case SORT_ORDER_RELEVANCE:
+		return "order by relevance desc, id desc" // Tweets with the same relevance are ordered by ID
 	default:
 		panic(fmt.Sprintf("Invalid sort order: %d", o))
 	}
@@ -67,6 +76,8 @@ func (o SortOrder) PaginationWhereClause() string {
 		return "likes_sort_order < ?"
 	case SORT_ORDER_BOOKMARKED_AT:
 		return "bookmarks_sort_order < ?"
+	case SORT_ORDER_RELEVANCE:
+		return "(relevance < ? or (relevance = ? and tweets.id < ?))"
 	default:
 		panic(fmt.Sprintf("Invalid sort order: %d", o))
 	}
@@ -85,6 +96,8 @@ func (o SortOrder) NextCursorValue(r CursorResult) int {
 		return r.LikeSortOrder
 	case SORT_ORDER_BOOKMARKED_AT:
 		return r.BookmarkSortOrder
+	case SORT_ORDER_RELEVANCE:
+		return r.Relevance
 	default:
 		panic(fmt.Sprintf("Invalid sort order: %d", o))
 	}
@@ -134,12 +147,14 @@ type CursorResult struct {
 	Chrono            int    `db:"chrono"`
 	LikeSortOrder     int    `db:"likes_sort_order"`
 	BookmarkSortOrder int    `db:"bookmarks_sort_order"`
+	Relevance         int    `db:"relevance"` // Scaled BM25 score; 0 if there are no keywords
 	ByUserID          UserID `db:"by_user_id"`
 }
 
 type Cursor struct {
 	CursorPosition
-	CursorValue int
+	CursorValue      int
+	CursorTiebreaker TweetID // Last result's tweet ID, for sort orders with ties (i.e., relevance)
 	SortOrder
 	PageSize int
 
@@ -156,6 +171,7 @@ type Cursor struct {
 	SinceTimestamp         Timestamp
 	UntilTimestamp         Timestamp
 	TombstoneType          string
+	DeletedSinceTimestamp  Timestamp // Archived, then found to be deleted (or suspended or hidden) since this time
 	FilterLinks            Filter
 	FilterImages           Filter
 	FilterVideos           Filter
@@ -166,6 +182,12 @@ type Cursor struct {
 	FilterRetweets         Filter
 	FilterOfflineFollowed  Filter
 	QuotedTweetID          TweetID
+
+	// Boolean search expressions (negations, "OR"s and groups), which get AND'ed with the fields above
+	QueryExpressions []QueryNode
+
+	// Include tweets that would be hidden by mute rules
+	ShowMuted bool
 }
 
 // Generate a cursor with some reasonable defaults
@@ -280,51 +302,44 @@ func NewUserFeedBookmarksCursor(h UserHandle) Cursor {
 	}
 }
 
+// Parse a search query into a Cursor.  Top-level search terms (ones that aren't negated, "OR"'d or
+// in a group) are set as Cursor fields; anything else is kept in `QueryExpressions`.
 func NewCursorFromSearchQuery(q string) (Cursor, error) {
 	ret := NewCursor()
-	is_in_quotes := false
-	current_token := ""
-
-	for _, char := range q {
-		if char == ' ' && !is_in_quotes {
-			// Token is finished
-			if current_token == "" {
-				// Ignore empty tokens
-				continue
-			}
-			// Add the completed token
-			if err := ret.apply_token(current_token); err != nil {
+	root, err := ParseSearchQuery(q)
+	if err != nil {
+		return Cursor{}, err
+	}
+	if root == nil {
+		// Empty query
+		return ret, nil
+	}
+
+	top_level_nodes := []QueryNode{root}
+	if and_node, is_ok := root.(QueryAnd); is_ok {
+		top_level_nodes = and_node.Operands
+	}
+	for _, node := range top_level_nodes {
+		switch n := node.(type) {
+		case QueryTerm:
+			if n.IsPhrase {
+				ret.Keywords = append(ret.Keywords, n.Text)
+			} else if err := ret.apply_token(n.Text); err != nil {
 				return Cursor{}, err
 			}
-			current_token = ""
 			continue
-		}
-
-		if char == '"' {
-			if is_in_quotes {
-				is_in_quotes = false
-				if err := ret.apply_token(current_token); err != nil {
+		case QueryNot:
+			// "-filter:xyz" can be set as a cursor field
+			if term, is_ok := n.Operand.(QueryTerm); is_ok && !term.IsPhrase && strings.HasPrefix(term.Text, "filter:") {
+				if err := ret.apply_token("-" + term.Text); err != nil {
 					return Cursor{}, err
 				}
-				current_token = ""
-				continue
-			} else {
-				is_in_quotes = true
 				continue
 			}
 		}
-
-		// current_token = fmt.Sprintf("%s%s", current_token, char)
-		current_token += string(char)
-	}
-
-	// End of query string is reached
-	if is_in_quotes {
-		return Cursor{}, ErrUnmatchedQuotes
-	}
-	if current_token != "" {
-		if err := ret.apply_token(current_token); err != nil {
-			return Cursor{}, err
+		ret.QueryExpressions = append(ret.QueryExpressions, node)
+		if query_includes_retweets(node) {
+			ret.FilterRetweets = NONE // Clear the "exclude retweets" filter set by default in NewCursor
 		}
 	}
 	return ret, nil
@@ -343,6 +358,9 @@ func (c *Cursor) apply_token(token string) error {
 	switch parts[0] {
 	case "from":
 		c.FromUserHandle = UserHandle(parts[1])
+	case "by":
+		c.ByUserHandle = UserHandle(parts[1])
+		c.FilterRetweets = NONE // "By" includes retweets
 	case "to":
 		c.ToUserHandles = append(c.ToUserHandles, UserHandle(parts[1]))
 	case "retweeted_by":
@@ -372,6 +390,8 @@ func (c *Cursor) apply_token(token string) error {
 		c.UntilTimestamp.Time, err = time.Parse("2006-01-02", parts[1])
 	case "tombstone":
 		c.TombstoneType = parts[1]
+	case "deleted_since":
+		c.DeletedSinceTimestamp.Time, err = time.Parse("2006-01-02", parts[1])
 	case "filter":
 		switch parts[1] {
 		case "links":
@@ -418,20 +438,18 @@ func (c *Cursor) apply_token(token string) error {
 	return nil
 }
 
-func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
-	where_clauses := []string{}
-	bind_values := []interface{}{}
+// Compile the cursor's search filters (i.e., everything except indexed keywords, "liked by" and
+// "bookmarked by", which require joins) into SQL "where" clauses, with their bind values
+func (c Cursor) filter_where_clauses() ([]string, []interface{}) {
+	// Keywords too short for the search index
+	where_clauses, bind_values := short_keyword_where_clauses(c.Keywords)
 
-	// Keywords
-	for _, kw := range c.Keywords {
-		where_clauses = append(where_clauses, "text like ?")
-		bind_values = append(bind_values, fmt.Sprintf("%%%s%%", kw))
-	}
-
-	// From, to, by, and RT'd by user handles
+	// From, to, by, and RT'd by user handles.  "From" and "by" also match users who formerly had the handle
+	matching_users := `(select id from users_by_handle where handle like ?
+	                     union select user_id from user_profile_history where handle like ?)`
 	if c.FromUserHandle != "" {
-		where_clauses = append(where_clauses, "tweets.user_id = (select id from users_by_handle where handle like ?)")
-		bind_values = append(bind_values, c.FromUserHandle)
+		where_clauses = append(where_clauses, "tweets.user_id in "+matching_users)
+		bind_values = append(bind_values, c.FromUserHandle, c.FromUserHandle)
 	}
 	for _, to_user := range c.ToUserHandles {
 		where_clauses = append(where_clauses, "reply_mentions like ?")
@@ -442,8 +460,8 @@ func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
 		bind_values = append(bind_values, c.RetweetedByUserHandle)
 	}
 	if c.ByUserHandle != "" {
-		where_clauses = append(where_clauses, "by_user_id = (select id from users_by_handle where handle like ?)")
-		bind_values = append(bind_values, c.ByUserHandle)
+		where_clauses = append(where_clauses, "by_user_id in "+matching_users)
+		bind_values = append(bind_values, c.ByUserHandle, c.ByUserHandle)
 	}
 	if c.ListID != 0 {
 		where_clauses = append(where_clauses, "by_user_id in (select user_id from list_users where list_id = ?)")
@@ -476,6 +494,10 @@ func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
 		where_clauses = append(where_clauses, "tombstone_type = (select rowid from tombstone_types where short_name like ?)")
 		bind_values = append(bind_values, c.TombstoneType)
 	}
+	if !c.DeletedSinceTimestamp.IsZero() {
+		where_clauses = append(where_clauses, "tweets.id in (select tweet_id from tweet_deletions where first_seen_at >= ?)")
+		bind_values = append(bind_values, c.DeletedSinceTimestamp)
+	}
 
 	// Media filters
 	switch c.FilterLinks {
@@ -537,6 +559,42 @@ func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
 		where_clauses = append(where_clauses, "retweet_id = 0")
 	}
 
+	return where_clauses, bind_values
+}
+
+// Build the SQL query for the next page of results, with its bind values
+func (c Cursor) next_page_query(current_user_id UserID, mutes []Mute) (string, []interface{}, error) {
+	// Keywords are matched using the full-text search index, which also provides the relevance score
+	keywords_join_clause := ""
+	keywords_bind_values := []interface{}{}
+	relevance_field := ", 0 relevance"
+	if match_expr := keywords_to_match_expression(c.Keywords); match_expr != "" {
+		keywords_join_clause = fmt.Sprintf(`
+		    join (select rowid, %s relevance
+		            from tweets_fts
+		           where tweets_fts match ?
+		         ) keyword_matches on keyword_matches.rowid = tweets.id `, RELEVANCE_SQL)
+		keywords_bind_values = append(keywords_bind_values, match_expr)
+		relevance_field = ", keyword_matches.relevance relevance"
+	}
+
+	// Search filters
+	where_clauses, bind_values := c.filter_where_clauses()
+	for _, expr := range c.QueryExpressions {
+		clause, binds, err := expr.where_clause()
+		if err != nil {
+			return "", nil, err
+		}
+		if clause == "" {
+			continue
+		}
+		where_clauses = append(where_clauses, clause)
+		bind_values = append(bind_values, binds...)
+	}
+	mute_clauses, mute_bind_values := mute_where_clauses(mutes, true)
+	where_clauses = append(where_clauses, mute_clauses...)
+	bind_values = append(bind_values, mute_bind_values...)
+
 	liked_by_filter_join_clause := ""
 	likes_sort_order_field := ""
 	if c.LikedByUserHandle != "" {
@@ -567,6 +625,9 @@ func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
 	if c.CursorPosition != CURSOR_START {
 		where_clauses = append(where_clauses, c.SortOrder.PaginationWhereClause())
 		bind_values = append(bind_values, c.CursorValue)
+		if c.SortOrder == SORT_ORDER_RELEVANCE {
+			bind_values = append(bind_values, c.CursorValue, c.CursorTiebreaker)
+		}
 	}
 
 	// Assemble the full where-clause
@@ -579,19 +640,21 @@ func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
 	//   1. Base query:
 	//     a. Include "likes_sort_order" and "bookmarks_sort_order" fields, if they're in the filters
 	//     b. Left join on "likes" table to get whether logged-in user has liked the tweet
-	//     c. Left join on "likes" and "bookmarks" tables, if needed (i.e., if in the filters)
-	//     d. Add 'where', 'order by', and (mildly unnecessary) 'limit' clauses
+	//     c. Join on the full-text search index, if there are keywords
+	//     d. Left join on "likes" and "bookmarks" tables, if needed (i.e., if in the filters)
+	//     e. Add 'where', 'order by', and (mildly unnecessary) 'limit' clauses
 	//   2. Two copies of the base query, one for "tweets" and one for "retweets", joined with "union"
 	//   3. Actual "limit" clause
 	q := `select * from (
 	select ` + TWEETS_ALL_SQL_FIELDS + `,
 	       exists (select 1 from retweets where tweet_id = tweets.id and retweeted_by = ?) is_retweeted_by_current_user` +
-		likes_sort_order_field + bookmarks_sort_order_field + `,
+		likes_sort_order_field + bookmarks_sort_order_field + relevance_field + `,
            0 tweet_id, 0 retweet_id, 0 retweeted_by, 0 retweeted_at,
            posted_at chrono, tweets.user_id by_user_id
       from tweets
  left join tombstone_types on tweets.tombstone_type = tombstone_types.rowid
  left join likes on tweets.id = likes.tweet_id and likes.user_id = ?
+     ` + keywords_join_clause + `
      ` + liked_by_filter_join_clause + `
      ` + bookmarked_by_filter_join_clause + `
      ` + where_clause + ` ` + c.SortOrder.OrderByClause() + ` limit ?
@@ -602,27 +665,40 @@ func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
     select * from (
     select ` + TWEETS_ALL_SQL_FIELDS + `,
            exists (select 1 from retweets where tweet_id = tweets.id and retweeted_by = ?) is_retweeted_by_current_user` +
-		likes_sort_order_field + bookmarks_sort_order_field + `,
+		likes_sort_order_field + bookmarks_sort_order_field + relevance_field + `,
            retweets.tweet_id, retweet_id, retweeted_by, retweeted_at,
            retweeted_at chrono, retweeted_by by_user_id
       from retweets
  left join tweets on retweets.tweet_id = tweets.id
  left join tombstone_types on tweets.tombstone_type = tombstone_types.rowid
  left join likes on tweets.id = likes.tweet_id and likes.user_id = ?
+     ` + keywords_join_clause + `
      ` + liked_by_filter_join_clause + `
      ` + bookmarked_by_filter_join_clause + `
      ` + where_clause + ` ` + c.SortOrder.OrderByClause() + ` limit ?
    )
    ` + c.SortOrder.OrderByClause() + ` limit ?`
 
-	bind_values = append([]interface{}{current_user_id, current_user_id}, bind_values...)
+	bind_values = append(append([]interface{}{current_user_id, current_user_id}, keywords_bind_values...), bind_values...)
 	bind_values = append(bind_values, c.PageSize)
 	bind_values = append(bind_values, bind_values...)
 	bind_values = append(bind_values, c.PageSize)
+	return q, bind_values, nil
+}
+
+func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
+	mutes := []Mute{}
+	if !c.ShowMuted {
+		mutes = p.GetAllMutes()
+	}
+	q, bind_values, err := c.next_page_query(current_user_id, mutes)
+	if err != nil {
+		return Feed{}, err
+	}
 
 	// Run the query
 	var results []CursorResult
-	err := p.DB.Select(&results, q, bind_values...)
+	err = p.DB.Select(&results, q, bind_values...)
 	if err != nil {
 		panic(err)
 	}
@@ -648,6 +724,7 @@ func (p Profile) NextPage(c Cursor, current_user_id UserID) (Feed, error) {
 		ret.CursorBottom.CursorPosition = CURSOR_MIDDLE
 		last_item := results[len(results)-1]
 		ret.CursorBottom.CursorValue = c.SortOrder.NextCursorValue(last_item)
+		ret.CursorBottom.CursorTiebreaker = last_item.Tweet.ID
 	}
 
 	return ret, nil
@@ -1,6 +1,7 @@
 package persistence_test
 
 import (
+	"fmt"
 	"testing"
 
 	"time"
@@ -84,6 +85,10 @@ func TestTokenizeSearchWithDates(t *testing.T) {
 	require.NoError(err)
 	assert.Equal(c.SinceTimestamp.Time, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 	assert.Equal(c.UntilTimestamp.Time, time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC))
+
+	c, err = NewCursorFromSearchQuery("deleted_since:2026-01-01")
+	require.NoError(err)
+	assert.Equal(c.DeletedSinceTimestamp.Time, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
 }
 
 func TestTokenizeSearchWithInvalidDates(t *testing.T) {
@@ -119,3 +124,124 @@ func TestTokenizeSearchQuoteTweets(t *testing.T) {
 	c, err = NewCursorFromSearchQuery("quoted_tweet_id:1234d5")
 	require.Error(err)
 }
+
+func TestParseSearchQueryBooleanOperators(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	node, err := ParseSearchQuery(`(from:a OR from:b) -filter:replies "exact phrase" -keyword`)
+	require.NoError(err)
+	assert.Equal(QueryAnd{Operands: []QueryNode{
+		QueryOr{Operands: []QueryNode{
+			QueryTerm{Text: "from:a", Position: 2},
+			QueryTerm{Text: "from:b", Position: 12},
+		}},
+		QueryNot{Operand: QueryTerm{Text: "filter:replies", Position: 21}},
+		QueryTerm{Text: "exact phrase", IsPhrase: true, Position: 36},
+		QueryNot{Operand: QueryTerm{Text: "keyword", Position: 52}},
+	}}, node)
+
+	// "OR" binds more tightly than AND
+	node, err = ParseSearchQuery(`a b OR c`)
+	require.NoError(err)
+	assert.Equal(QueryAnd{Operands: []QueryNode{
+		QueryTerm{Text: "a", Position: 1},
+		QueryOr{Operands: []QueryNode{QueryTerm{Text: "b", Position: 3}, QueryTerm{Text: "c", Position: 8}}},
+	}}, node)
+
+	// Lowercase "or" and quoted "OR" are keywords
+	node, err = ParseSearchQuery(`a or "OR"`)
+	require.NoError(err)
+	assert.Equal(QueryAnd{Operands: []QueryNode{
+		QueryTerm{Text: "a", Position: 1},
+		QueryTerm{Text: "or", Position: 3},
+		QueryTerm{Text: "OR", IsPhrase: true, Position: 6},
+	}}, node)
+
+	// Empty query
+	node, err = ParseSearchQuery("   ")
+	require.NoError(err)
+	assert.Nil(node)
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	test_cases := []struct {
+		query    string
+		position int
+	}{
+		{"(a OR b", 1},
+		{"a b)", 4},
+		{"a ()", 3},
+		{"OR a", 1},
+		{"a OR", 3},
+		{"(a OR) b", 4},
+		{"a -OR b", 3},
+		{"a -(", 4},
+		{"a -)", 4},
+		{"a \"bc", 3},
+		{"a since:asdf", 3},
+	}
+	for _, tc := range test_cases {
+		_, err := ParseSearchQuery(tc.query)
+		if assert.Error(err, tc.query) {
+			assert.ErrorIs(err, ErrInvalidQuery, tc.query)
+			assert.Contains(err.Error(), fmt.Sprintf("at position %d", tc.position), tc.query)
+		}
+	}
+}
+
+func TestToTwitterSearchQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	test_cases := []struct {
+		query    string
+		expected string
+	}{
+		{`think tank`, `think tank`},
+		{`"think tank" -filter:replies since:2020-01-01`, `"think tank" -filter:replies since:2020-01-01`},
+		{`by:elonmusk filter:retweets`, `from:elonmusk filter:nativeretweets`},
+		{`(from:a OR from:b) -keyword`, `(from:a OR from:b) -keyword`},
+		// Local-only operators are left out
+		{`keyword liked_by:somebody -tombstone:deleted filter:polls`, `keyword`},
+		{`a (b liked_by:somebody)`, `a b`},
+		// ... including whole "OR"s that use them
+		{`a (from:b OR liked_by:c)`, `a`},
+		{`liked_by:somebody`, ``},
+		// Negations of anything with a left-out part are left out too, since they'd be narrower
+		{`-(a liked_by:somebody)`, ``},
+		{`b -(a liked_by:somebody)`, `b`},
+		{`b -(a -(c liked_by:somebody))`, `b`},
+		{`b -(a c)`, `b -(a c)`},
+		{``, ``},
+	}
+	for _, tc := range test_cases {
+		result, err := ToTwitterSearchQuery(tc.query)
+		if assert.NoError(err, tc.query) {
+			assert.Equal(tc.expected, result, tc.query)
+		}
+	}
+
+	_, err := ToTwitterSearchQuery(`(a OR b`)
+	assert.ErrorIs(err, ErrInvalidQuery)
+}
+
+func TestTokenizeSearchStringWithBooleanOperators(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	// Top-level terms are still set as cursor fields
+	c, err := NewCursorFromSearchQuery(`think -filter:replies (from:a OR from:b) -keyword`)
+	require.NoError(err)
+	assert.Equal(c.Keywords, []string{"think"})
+	assert.Equal(c.FilterReplies, EXCLUDE)
+	assert.Len(c.QueryExpressions, 2)
+	assert.Equal(c.FilterRetweets, EXCLUDE)
+
+	// Retweets aren't excluded if the expression can match them
+	c, err = NewCursorFromSearchQuery(`retweeted_by:a OR from:a`)
+	require.NoError(err)
+	assert.Len(c.QueryExpressions, 1)
+	assert.Equal(c.FilterRetweets, NONE)
+}
@@ -306,3 +306,57 @@ func TestSearchQuoteTweets(t *testing.T) {
 	assert.Len(feed.Items, 1)
 	assert.Equal(feed.Items[0].TweetID, TweetID(1413664406995566593))
 }
+
+// Search with negation, "OR" and groups
+func TestSearchBooleanQuery(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+
+	get_ids := func(q string) []TweetID {
+		c, err := NewCursorFromSearchQuery(q)
+		require.NoError(err)
+		feed, err := profile.NextPage(c, UserID(0))
+		require.NoError(err)
+		ret := []TweetID{}
+		for _, item := range feed.Items {
+			ret = append(ret, item.TweetID)
+		}
+		return ret
+	}
+
+	// Negated operator
+	assert.Equal(get_ids("think -from:cernovich"), []TweetID{1428939163961790466, 1413772782358433792, 1343633011364016128})
+	// Negated keyword
+	assert.Equal(get_ids("who -are"), get_ids("who -\"are\""))
+	assert.NotContains(get_ids("who -are"), TweetID(1261483383483293700))
+	assert.Contains(get_ids("who"), TweetID(1261483383483293700))
+	// "OR" between operators
+	assert.Equal(get_ids("think (from:kwamurai OR from:germany12343)"), []TweetID{1413772782358433792, 1343633011364016128})
+	// Negated group
+	assert.Equal(get_ids("think -(from:kwamurai OR from:germany12343) -filter:replies"),
+		[]TweetID{1439067163508150272, 1439027915404939265})
+	// "OR" between keywords
+	assert.Len(get_ids("think OR fasdfjkafsldfjsff"), 5)
+
+	// Negating a filter that's ignored (unknown value) doesn't filter anything out
+	assert.Equal(get_ids("think"), get_ids("think -filter:asdf"))
+	// ...and neither does an "OR" with one in it, since it matches everything
+	assert.Equal(get_ids("think"), get_ids("think (from:asdf OR -filter:asdf)"))
+	assert.NotEqual(get_ids("think"), get_ids("think from:asdf"))
+
+	// Retweets are included if the query can match them
+	c, err := NewCursorFromSearchQuery("retweeted_by:cernovich OR retweeted_by:michaelmalice")
+	require.NoError(err)
+	feed, err := profile.NextPage(c, UserID(0))
+	require.NoError(err)
+	assert.Len(feed.Retweets, 4)
+
+	// Invalid terms in an expression are an error, not a panic
+	c = NewCursor()
+	c.QueryExpressions = []QueryNode{QueryNot{Operand: QueryTerm{Text: "since:asdf"}}}
+	_, err = profile.NextPage(c, UserID(0))
+	assert.ErrorIs(err, ErrInvalidQuery)
+}
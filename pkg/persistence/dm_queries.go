@@ -647,3 +647,19 @@ func (p Profile) GetUnreadConversations(user_id UserID) (ret []DMChatRoomID) {
 	}
 	return
 }
+
+// Return `true` if any of a chat message's images, videos or link thumbnails haven't been downloaded yet
+func (p Profile) CheckChatMessageContentDownloadNeeded(m DMMessage) bool {
+	var ret bool
+	err := p.DB.Get(&ret, `
+		select exists (select 1 from chat_message_images where chat_message_id = ?1 and is_downloaded = 0)
+		    or exists (select 1 from chat_message_videos
+		                where chat_message_id = ?1 and is_downloaded = 0 and is_blocked_by_dmca = 0)
+		    or exists (select 1 from chat_message_urls
+		                where chat_message_id = ?1 and is_content_downloaded = 0 and has_card = 1 and has_thumbnail = 1)
+	`, m.ID)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
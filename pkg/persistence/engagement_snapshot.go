@@ -0,0 +1,25 @@
+package persistence
+
+// A Tweet's engagement counts at a point in time
+type TweetEngagementSnapshot struct {
+	TweetID        TweetID   `db:"tweet_id"`
+	RecordedAt     Timestamp `db:"recorded_at"`
+	NumLikes       int       `db:"num_likes"`
+	NumRetweets    int       `db:"num_retweets"`
+	NumReplies     int       `db:"num_replies"`
+	NumQuoteTweets int       `db:"num_quote_tweets"`
+}
+
+// A Poll's vote counts at a point in time
+type PollVoteSnapshot struct {
+	PollID        PollID    `db:"poll_id"`
+	RecordedAt    Timestamp `db:"recorded_at"`
+	Choice1_Votes int       `db:"choice1_votes"`
+	Choice2_Votes int       `db:"choice2_votes"`
+	Choice3_Votes int       `db:"choice3_votes"`
+	Choice4_Votes int       `db:"choice4_votes"`
+}
+
+func (s PollVoteSnapshot) TotalVotes() int {
+	return s.Choice1_Votes + s.Choice2_Votes + s.Choice3_Votes + s.Choice4_Votes
+}
@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"fmt"
+)
+
+// Record a snapshot of a Tweet's engagement counts, as of when it was scraped, if they're different
+// from the snapshot before then.  The counts and time are the ones in `t`, rather than the saved row,
+// since an older copy of a Tweet doesn't overwrite the newer counts.  Stubs are skipped, since their
+// counts aren't real.
+func (p Profile) save_tweet_engagement_snapshot(t Tweet) error {
+	_, err := p.DB.NamedExec(`
+		insert into tweet_engagement_snapshots (tweet_id, recorded_at, num_likes, num_retweets, num_replies, num_quote_tweets)
+		     select :id, :last_scraped_at, :num_likes, :num_retweets, :num_replies, :num_quote_tweets
+		      where not :is_stub
+		        and not exists (
+		                select 1
+		                  from (select * from tweet_engagement_snapshots
+		                         where tweet_id = :id
+		                           and recorded_at <= :last_scraped_at
+		                      order by recorded_at desc
+		                         limit 1) previous
+		                 where previous.num_likes = :num_likes
+		                   and previous.num_retweets = :num_retweets
+		                   and previous.num_replies = :num_replies
+		                   and previous.num_quote_tweets = :num_quote_tweets
+		            )
+	`, t)
+	if err != nil {
+		return fmt.Errorf("Error saving engagement snapshot for tweet ID %d:\n  %w", t.ID, err)
+	}
+	return nil
+}
+
+// Record a snapshot of a Poll's vote counts, as of when it was scraped, if they're different from
+// the snapshot before then
+func (p Profile) save_poll_vote_snapshot(poll Poll) error {
+	_, err := p.DB.NamedExec(`
+		insert into poll_vote_snapshots (poll_id, recorded_at, choice1_votes, choice2_votes, choice3_votes, choice4_votes)
+		     select :id, :last_scraped_at, :choice1_votes, :choice2_votes, :choice3_votes, :choice4_votes
+		      where not exists (
+		                select 1
+		                  from (select * from poll_vote_snapshots
+		                         where poll_id = :id
+		                           and recorded_at <= :last_scraped_at
+		                      order by recorded_at desc
+		                         limit 1) previous
+		                 where previous.choice1_votes is :choice1_votes
+		                   and previous.choice2_votes is :choice2_votes
+		                   and previous.choice3_votes is :choice3_votes
+		                   and previous.choice4_votes is :choice4_votes
+		            )
+	`, poll)
+	if err != nil {
+		return fmt.Errorf("Error saving vote snapshot for poll ID %d:\n  %w", poll.ID, err)
+	}
+	return nil
+}
+
+// Get the history of a Tweet's engagement counts, oldest first
+func (p Profile) GetTweetEngagementHistory(id TweetID) []TweetEngagementSnapshot {
+	ret := []TweetEngagementSnapshot{}
+	err := p.DB.Select(&ret, `
+		select tweet_id, recorded_at, num_likes, num_retweets, num_replies, num_quote_tweets
+		  from tweet_engagement_snapshots
+		 where tweet_id = ?
+	  order by recorded_at asc
+	`, id)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Get the history of a Poll's vote counts, oldest first
+func (p Profile) GetPollVoteHistory(id PollID) []PollVoteSnapshot {
+	ret := []PollVoteSnapshot{}
+	err := p.DB.Select(&ret, `
+		select poll_id, recorded_at, ifnull(choice1_votes, 0) choice1_votes, ifnull(choice2_votes, 0) choice2_votes,
+		       ifnull(choice3_votes, 0) choice3_votes, ifnull(choice4_votes, 0) choice4_votes
+		  from poll_vote_snapshots
+		 where poll_id = ?
+	  order by recorded_at asc
+	`, id)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
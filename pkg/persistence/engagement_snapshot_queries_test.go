@@ -0,0 +1,108 @@
+package persistence_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Re-saving a Tweet should record a new engagement snapshot only if the counts have changed
+func TestTweetEngagementHistory(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestEngagementSnapshotQueries"
+	profile := create_or_load_profile(profile_path)
+
+	tweet := create_dummy_tweet()
+	tweet.LastScrapedAt = TimestampFromUnix(1000)
+	require.NoError(profile.SaveTweet(tweet))
+
+	history := profile.GetTweetEngagementHistory(tweet.ID)
+	require.Len(history, 1)
+	assert.Equal(tweet.NumLikes, history[0].NumLikes)
+	assert.Equal(tweet.NumQuoteTweets, history[0].NumQuoteTweets)
+	assert.Equal(TimestampFromUnix(1000), history[0].RecordedAt)
+
+	// Re-scrape with the same counts
+	tweet.LastScrapedAt = TimestampFromUnix(2000)
+	require.NoError(profile.SaveTweet(tweet))
+	assert.Len(profile.GetTweetEngagementHistory(tweet.ID), 1)
+
+	// Re-scrape with new counts
+	tweet.LastScrapedAt = TimestampFromUnix(3000)
+	tweet.NumLikes += 100
+	tweet.NumRetweets += 10
+	require.NoError(profile.SaveTweet(tweet))
+	history = profile.GetTweetEngagementHistory(tweet.ID)
+	require.Len(history, 2)
+	assert.Equal(tweet.NumLikes, history[1].NumLikes)
+	assert.Equal(tweet.NumRetweets, history[1].NumRetweets)
+	assert.Equal(TimestampFromUnix(3000), history[1].RecordedAt)
+
+	// Stubs don't have real counts
+	stub := tweet
+	stub.IsStub = true
+	stub.NumLikes = 0
+	stub.LastScrapedAt = TimestampFromUnix(4000)
+	require.NoError(profile.SaveTweet(stub))
+	assert.Len(profile.GetTweetEngagementHistory(tweet.ID), 2)
+}
+
+// Re-saving a Poll should record a new vote snapshot only if the counts have changed
+func TestPollVoteHistory(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestEngagementSnapshotQueries"
+	profile := create_or_load_profile(profile_path)
+
+	tweet := create_dummy_tweet()
+	require.NoError(profile.SaveTweet(tweet))
+	poll := tweet.Polls[0]
+
+	history := profile.GetPollVoteHistory(poll.ID)
+	require.Len(history, 1)
+	assert.Equal(poll.Choice1_Votes, history[0].Choice1_Votes)
+	assert.Equal(poll.TotalVotes(), history[0].TotalVotes())
+
+	require.NoError(profile.SavePoll(poll))
+	assert.Len(profile.GetPollVoteHistory(poll.ID), 1)
+
+	poll.Choice2_Votes += 50
+	poll.LastUpdatedAt = TimestampFromUnix(poll.LastUpdatedAt.Unix() + 1000)
+	require.NoError(profile.SavePoll(poll))
+	history = profile.GetPollVoteHistory(poll.ID)
+	require.Len(history, 2)
+	assert.Equal(poll.Choice2_Votes, history[1].Choice2_Votes)
+	assert.Equal(poll.LastUpdatedAt, history[1].RecordedAt)
+}
+
+// Saving an older copy of a Tweet (e.g., from an earlier trove) should record its counts at the time
+// it was scraped, not at the latest scrape time
+func TestTweetEngagementHistoryOutOfOrder(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestEngagementSnapshotQueries"
+	profile := create_or_load_profile(profile_path)
+
+	tweet := create_dummy_tweet()
+	tweet.LastScrapedAt = TimestampFromUnix(3000)
+	require.NoError(profile.SaveTweet(tweet))
+
+	old_tweet := tweet
+	old_tweet.LastScrapedAt = TimestampFromUnix(1000)
+	old_tweet.NumLikes -= 10
+	require.NoError(profile.SaveTweet(old_tweet))
+
+	history := profile.GetTweetEngagementHistory(tweet.ID)
+	require.Len(history, 2)
+	assert.Equal(TimestampFromUnix(1000), history[0].RecordedAt)
+	assert.Equal(old_tweet.NumLikes, history[0].NumLikes)
+	assert.Equal(TimestampFromUnix(3000), history[1].RecordedAt)
+	assert.Equal(tweet.NumLikes, history[1].NumLikes)
+}
@@ -1,14 +1,19 @@
 package persistence
 
-func (p Profile) SaveFollow(follower_id UserID, followee_id UserID) {
+import (
+	"fmt"
+)
+
+func (p Profile) SaveFollow(follower_id UserID, followee_id UserID) error {
 	_, err := p.DB.Exec(`
 		insert into follows (follower_id, followee_id)
 		     values (?, ?)
 		on conflict do nothing
 	`, follower_id, followee_id)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("Error saving follow (follower ID %d, followee ID %d):\n  %w", follower_id, followee_id, err)
 	}
+	return nil
 }
 func (p Profile) DeleteFollow(follower_id UserID, followee_id UserID) {
 	_, err := p.DB.Exec(`delete from follows where follower_id = ? and followee_id = ?`, follower_id, followee_id)
@@ -19,13 +24,17 @@ func (p Profile) DeleteFollow(follower_id UserID, followee_id UserID) {
 
 func (p Profile) SaveAsFollowersList(followee_id UserID, trove TweetTrove) {
 	for follower_id := range trove.Users {
-		p.SaveFollow(follower_id, followee_id)
+		if err := p.SaveFollow(follower_id, followee_id); err != nil {
+			panic(err)
+		}
 	}
 }
 
 func (p Profile) SaveAsFolloweesList(follower_id UserID, trove TweetTrove) {
 	for followee_id := range trove.Users {
-		p.SaveFollow(follower_id, followee_id)
+		if err := p.SaveFollow(follower_id, followee_id); err != nil {
+			panic(err)
+		}
 	}
 }
 
@@ -69,7 +69,7 @@ func TestFollowUnfollow(t *testing.T) {
 	assert.False(profile.IsXFollowingY(u1.ID, u2.ID))
 
 	// Follow them
-	profile.SaveFollow(u1.ID, u2.ID)
+	require.NoError(profile.SaveFollow(u1.ID, u2.ID))
 	assert.True(profile.IsXFollowingY(u1.ID, u2.ID))
 
 	// Unfollow-- should be gone
@@ -96,8 +96,8 @@ func TestGetFollowersYouKnow(t *testing.T) {
 		intermediates = append(intermediates, u)
 
 		// Create the follows
-		profile.SaveFollow(u1.ID, u.ID)
-		profile.SaveFollow(u.ID, u2.ID)
+		require.NoError(profile.SaveFollow(u1.ID, u.ID))
+		require.NoError(profile.SaveFollow(u.ID, u2.ID))
 	}
 
 	followers_you_know := profile.GetFollowersYouKnow(u1.ID, u2.ID)
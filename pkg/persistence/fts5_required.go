@@ -0,0 +1,12 @@
+//go:build !sqlite_fts5
+
+package persistence
+
+// The search index is an FTS5 table (see `update_tweet_search_index`), and go-sqlite3 only compiles
+// FTS5 in with the `sqlite_fts5` build tag.  Without it, creating or opening a profile would fail
+// at runtime with "no such module: fts5", so refuse to build instead.  Build with:
+//
+//	go build -tags sqlite_fts5 ./...
+//
+// or set `GOFLAGS=-tags=sqlite_fts5`.
+var _ = BUILD_WITH_TAG_sqlite_fts5_FOR_FULL_TEXT_SEARCH
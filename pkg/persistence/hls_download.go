@@ -0,0 +1,527 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Twitter serves some videos as HLS: a "master" playlist listing the available renditions (each one a
+// "media" playlist of short segments), with the audio in a separate rendition.  The segments are
+// fragmented MP4 ("fMP4"): an initialization segment with the track info, then a series of fragments
+// (a "moof" box, followed by an "mdat" box with the media data).
+//
+// To save one, the video and audio fragments are combined into a single fragmented MP4 file with two
+// tracks, which browsers can play like any other MP4.  Old-style MPEG-TS segments aren't supported.
+
+var (
+	ErrInvalidHLSPlaylist = errors.New("invalid HLS playlist")
+	ErrUnsupportedHLS     = errors.New("unsupported HLS stream (only fragmented MP4 segments are supported)")
+	ErrInvalidMP4         = errors.New("invalid MP4 data")
+)
+
+// A rendition in an HLS master playlist
+type hls_stream struct {
+	VideoVariant
+	AudioGroup string
+}
+
+type hls_master_playlist struct {
+	Streams []hls_stream
+	Audio   map[string]string // Audio group ID => URL of its media playlist
+}
+
+type hls_media_playlist struct {
+	InitURL     string // The initialization segment (`#EXT-X-MAP`)
+	SegmentURLs []string
+}
+
+var hls_attribute_regex = regexp.MustCompile(`([A-Z0-9-]+)=("[^"]*"|[^,]*)`)
+
+// Parse the attribute list of an HLS tag, e.g., `BANDWIDTH=369011,RESOLUTION=480x270,CODECS="..."`
+func parse_hls_attributes(s string) map[string]string {
+	ret := make(map[string]string)
+	for _, match := range hls_attribute_regex.FindAllStringSubmatch(s, -1) {
+		ret[match[1]] = strings.Trim(match[2], `"`)
+	}
+	return ret
+}
+
+// Resolve a URL in a playlist, which can be relative to the playlist's URL
+func resolve_hls_url(base string, ref string) (string, error) {
+	base_url, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad URL %q", ErrInvalidHLSPlaylist, base)
+	}
+	ref_url, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad URL %q", ErrInvalidHLSPlaylist, ref)
+	}
+	return base_url.ResolveReference(ref_url).String(), nil
+}
+
+// Whether a playlist is a master playlist (a list of renditions), rather than a media playlist
+func is_hls_master_playlist(content []byte) bool {
+	return bytes.Contains(content, []byte("#EXT-X-STREAM-INF"))
+}
+
+func parse_hls_master_playlist(content []byte, playlist_url string) (hls_master_playlist, error) {
+	ret := hls_master_playlist{Audio: make(map[string]string)}
+	var pending *hls_stream // The last `#EXT-X-STREAM-INF` tag; its URL is on the next line
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attrs := parse_hls_attributes(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if attrs["TYPE"] != "AUDIO" || attrs["URI"] == "" {
+				continue
+			}
+			audio_url, err := resolve_hls_url(playlist_url, attrs["URI"])
+			if err != nil {
+				return ret, err
+			}
+			ret.Audio[attrs["GROUP-ID"]] = audio_url
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := parse_hls_attributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			stream := hls_stream{VideoVariant: VideoVariant{ContentType: VIDEO_CONTENT_TYPE_HLS}, AudioGroup: attrs["AUDIO"]}
+			stream.Bitrate, _ = strconv.Atoi(attrs["BANDWIDTH"]) //nolint:errcheck // Missing bandwidth => 0
+			if w, h, is_ok := strings.Cut(attrs["RESOLUTION"], "x"); is_ok {
+				stream.Width, _ = strconv.Atoi(w)  //nolint:errcheck // Missing resolution => 0
+				stream.Height, _ = strconv.Atoi(h) //nolint:errcheck // Missing resolution => 0
+			}
+			pending = &stream
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			if pending == nil {
+				continue
+			}
+			stream_url, err := resolve_hls_url(playlist_url, line)
+			if err != nil {
+				return ret, err
+			}
+			pending.URL = stream_url
+			ret.Streams = append(ret.Streams, *pending)
+			pending = nil
+		}
+	}
+	if len(ret.Streams) == 0 {
+		return ret, fmt.Errorf("%w: no streams in master playlist %q", ErrInvalidHLSPlaylist, playlist_url)
+	}
+	return ret, nil
+}
+
+func parse_hls_media_playlist(content []byte, playlist_url string) (hls_media_playlist, error) {
+	ret := hls_media_playlist{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			init_url, err := resolve_hls_url(playlist_url, parse_hls_attributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))["URI"])
+			if err != nil {
+				return ret, err
+			}
+			ret.InitURL = init_url
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			segment_url, err := resolve_hls_url(playlist_url, line)
+			if err != nil {
+				return ret, err
+			}
+			ret.SegmentURLs = append(ret.SegmentURLs, segment_url)
+		}
+	}
+	if len(ret.SegmentURLs) == 0 {
+		return ret, fmt.Errorf("%w: no segments in media playlist %q", ErrInvalidHLSPlaylist, playlist_url)
+	}
+	if ret.InitURL == "" {
+		// No initialization segment means MPEG-TS segments
+		return ret, fmt.Errorf("%w: %q", ErrUnsupportedHLS, playlist_url)
+	}
+	return ret, nil
+}
+
+// Download a file into memory, using a MediaDownloader (which can only save to files)
+func fetch_with_downloader(downloader MediaDownloader, remote_url string, tmp_dir string) ([]byte, error) {
+	tmp_file, err := os.CreateTemp(tmp_dir, "hls-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating temporary file:\n  %w", err)
+	}
+	tmp_path := tmp_file.Name()
+	tmp_file.Close()
+	defer os.Remove(tmp_path)
+
+	if err := downloader.Curl(remote_url, tmp_path); err != nil {
+		return nil, fmt.Errorf("Error downloading HLS file %q:\n  %w", remote_url, err)
+	}
+	ret, err := os.ReadFile(tmp_path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading downloaded file %q:\n  %w", tmp_path, err)
+	}
+	return ret, nil
+}
+
+// Download an HLS video (or audio) and save it as a fragmented MP4 file.
+//
+// If it's a master playlist, the rendition is chosen according to the policy: for "audio only", the
+// audio rendition is saved by itself.  Returns the chosen rendition's info (URL, bitrate, resolution).
+//
+// Segments are downloaded one at a time and appended to the output file, so only one is in memory at
+// once.  They're downloaded into a temporary directory outside the profile, so they can't be mistaken
+// for orphaned media files (see `CheckProfile`).
+func download_hls(downloader MediaDownloader, playlist_url string, outpath string, policy VideoPolicy) (VideoVariant, bool, error) {
+	tmp_dir, err := os.MkdirTemp("", "offline-twitter-hls-")
+	if err != nil {
+		return VideoVariant{}, false, fmt.Errorf("Error creating temporary directory:\n  %w", err)
+	}
+	defer os.RemoveAll(tmp_dir)
+
+	content, err := fetch_with_downloader(downloader, playlist_url, tmp_dir)
+	if err != nil {
+		return VideoVariant{}, false, err
+	}
+
+	chosen := VideoVariant{URL: playlist_url, ContentType: VIDEO_CONTENT_TYPE_HLS}
+	is_audio_only := false
+	audio_url := ""
+	if is_hls_master_playlist(content) {
+		master, err := parse_hls_master_playlist(content, playlist_url)
+		if err != nil {
+			return VideoVariant{}, false, err
+		}
+		variants := make([]VideoVariant, len(master.Streams))
+		for i := range master.Streams {
+			variants[i] = master.Streams[i].VideoVariant
+		}
+		stream := master.Streams[policy.choose_variant_index(variants)]
+		chosen = stream.VideoVariant
+		audio_url = master.Audio[stream.AudioGroup]
+		if policy.Mode == VIDEO_POLICY_AUDIO_ONLY && audio_url != "" {
+			chosen = VideoVariant{URL: audio_url, ContentType: VIDEO_CONTENT_TYPE_HLS}
+			is_audio_only = true
+			audio_url = ""
+		}
+		if content, err = fetch_with_downloader(downloader, chosen.URL, tmp_dir); err != nil {
+			return VideoVariant{}, false, err
+		}
+	}
+
+	// Get the media playlists (one per track) and their initialization segments
+	tracks := []hls_media_playlist{}
+	init_segments := [][]byte{}
+	for _, media_url := range []string{chosen.URL, audio_url} {
+		if media_url == "" {
+			continue
+		}
+		if media_url != chosen.URL {
+			if content, err = fetch_with_downloader(downloader, media_url, tmp_dir); err != nil {
+				return VideoVariant{}, false, err
+			}
+		}
+		media, err := parse_hls_media_playlist(content, media_url)
+		if err != nil {
+			return VideoVariant{}, false, err
+		}
+		data, err := fetch_with_downloader(downloader, media.InitURL, tmp_dir)
+		if err != nil {
+			return VideoVariant{}, false, err
+		}
+		tracks = append(tracks, media)
+		init_segments = append(init_segments, data)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outpath), 0755); err != nil {
+		panic(err)
+	}
+	err = write_hls_fmp4(downloader, tracks, init_segments, outpath, tmp_dir)
+	if err != nil {
+		os.Remove(outpath)
+		return VideoVariant{}, false, fmt.Errorf("Error saving HLS video %q to %s:\n  %w", playlist_url, outpath, err)
+	}
+	return chosen, is_audio_only, nil
+}
+
+// Combine the tracks' segments into one fragmented MP4 file (see `mux_fmp4_init_segments` and
+// `rewrite_fmp4_fragments`).  The fragments are interleaved, segment by segment.
+func write_hls_fmp4(downloader MediaDownloader, tracks []hls_media_playlist, init_segments [][]byte, outpath string, tmp_dir string) error {
+	header, err := mux_fmp4_init_segments(init_segments)
+	if err != nil {
+		return err
+	}
+	outfile, err := os.Create(outpath)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := outfile.Write(header); err != nil {
+		return err
+	}
+
+	sequence_number := uint32(1)
+	for segment_num := 0; ; segment_num++ {
+		is_done := true
+		for i, track := range tracks {
+			if segment_num >= len(track.SegmentURLs) {
+				continue
+			}
+			is_done = false
+			data, err := fetch_with_downloader(downloader, track.SegmentURLs[segment_num], tmp_dir)
+			if err != nil {
+				return err
+			}
+			fragments, err := rewrite_fmp4_fragments(data, uint32(i+1), &sequence_number)
+			if err != nil {
+				return err
+			}
+			if _, err := outfile.Write(fragments); err != nil {
+				return err
+			}
+		}
+		if is_done {
+			break
+		}
+	}
+	return outfile.Close()
+}
+
+// MP4 boxes
+// ---------
+
+type mp4_box struct {
+	Type         string
+	Payload      []byte
+	HasLargeSize bool // Whether the header has a 64-bit size ("largesize")
+}
+
+// Encode a box, with the same size of header it was parsed with (so data offsets in "trun" boxes,
+// which are relative to the start of the "moof" box, stay correct)
+func (b mp4_box) encode() []byte {
+	size := uint64(8 + len(b.Payload))
+	if !b.HasLargeSize && size <= math.MaxUint32 {
+		ret := make([]byte, 8, size)
+		binary.BigEndian.PutUint32(ret, uint32(size))
+		copy(ret[4:], b.Type)
+		return append(ret, b.Payload...)
+	}
+	ret := make([]byte, 16, size+8)
+	binary.BigEndian.PutUint32(ret, 1)
+	copy(ret[4:], b.Type)
+	binary.BigEndian.PutUint64(ret[8:], size+8)
+	return append(ret, b.Payload...)
+}
+
+func parse_mp4_boxes(data []byte) ([]mp4_box, error) {
+	ret := []mp4_box{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: truncated box header", ErrInvalidMP4)
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		header_size := uint64(8)
+		switch size {
+		case 0: // Extends to the end
+			size = uint64(len(data))
+		case 1: // 64-bit size
+			if len(data) < 16 {
+				return nil, fmt.Errorf("%w: truncated box header", ErrInvalidMP4)
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header_size = 16
+		}
+		if size < header_size || size > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: bad box size %d", ErrInvalidMP4, size)
+		}
+		ret = append(ret, mp4_box{Type: string(data[4:8]), Payload: data[header_size:size], HasLargeSize: header_size == 16})
+		data = data[size:]
+	}
+	return ret, nil
+}
+
+func encode_mp4_boxes(boxes []mp4_box) []byte {
+	ret := []byte{}
+	for _, b := range boxes {
+		ret = append(ret, b.encode()...)
+	}
+	return ret
+}
+
+func find_mp4_box(boxes []mp4_box, box_type string) (mp4_box, bool) {
+	for _, b := range boxes {
+		if b.Type == box_type {
+			return b, true
+		}
+	}
+	return mp4_box{}, false
+}
+
+// Rewrite the boxes at a path of nested container boxes (e.g., "trak/tkhd"), in place
+func edit_mp4_boxes(boxes []mp4_box, path []string, edit func(payload []byte) error) error {
+	for i := range boxes {
+		if boxes[i].Type != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			if err := edit(boxes[i].Payload); err != nil {
+				return err
+			}
+			continue
+		}
+		children, err := parse_mp4_boxes(boxes[i].Payload)
+		if err != nil {
+			return err
+		}
+		if err := edit_mp4_boxes(children, path[1:], edit); err != nil {
+			return err
+		}
+		boxes[i].Payload = encode_mp4_boxes(children)
+	}
+	return nil
+}
+
+// Overwrite a 32-bit field in a box's payload
+func set_mp4_uint32(payload []byte, offset int, value uint32) error {
+	if len(payload) < offset+4 {
+		return fmt.Errorf("%w: box is too short", ErrInvalidMP4)
+	}
+	binary.BigEndian.PutUint32(payload[offset:], value)
+	return nil
+}
+
+// Combine the initialization segments of several fragmented MP4 streams (each with one track) into
+// one, with all the tracks: the first stream's "ftyp" and "moov", with every stream's "trak" and
+// "trex" boxes.  The track IDs are renumbered (1, 2, ...).
+func mux_fmp4_init_segments(init_segments [][]byte) ([]byte, error) {
+	if len(init_segments) == 0 {
+		return nil, fmt.Errorf("%w: nothing to combine", ErrInvalidMP4)
+	}
+
+	var ftyp mp4_box
+	var moov_children []mp4_box
+	for i, init_segment := range init_segments {
+		track_id := uint32(i + 1)
+		boxes, err := parse_mp4_boxes(init_segment)
+		if err != nil {
+			return nil, err
+		}
+		moov, is_ok := find_mp4_box(boxes, "moov")
+		if !is_ok {
+			return nil, fmt.Errorf("%w: no \"moov\" box in initialization segment", ErrInvalidMP4)
+		}
+		children, err := parse_mp4_boxes(moov.Payload)
+		if err != nil {
+			return nil, err
+		}
+		err = edit_mp4_boxes(children, []string{"trak", "tkhd"}, func(payload []byte) error {
+			if len(payload) > 0 && payload[0] == 1 { // Version 1 has 64-bit times
+				return set_mp4_uint32(payload, 20, track_id)
+			}
+			return set_mp4_uint32(payload, 12, track_id)
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = edit_mp4_boxes(children, []string{"mvex", "trex"}, func(payload []byte) error {
+			return set_mp4_uint32(payload, 4, track_id)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			ftyp, _ = find_mp4_box(boxes, "ftyp")
+			moov_children = children
+			continue
+		}
+		// Add this stream's track to the first one's
+		for _, child := range children {
+			switch child.Type {
+			case "trak":
+				moov_children = append(moov_children, child)
+			case "mvex":
+				mvex_children, err := parse_mp4_boxes(child.Payload)
+				if err != nil {
+					return nil, err
+				}
+				trex, is_ok := find_mp4_box(mvex_children, "trex")
+				if !is_ok {
+					return nil, fmt.Errorf("%w: no \"trex\" box in initialization segment", ErrInvalidMP4)
+				}
+				for j := range moov_children {
+					if moov_children[j].Type == "mvex" {
+						moov_children[j].Payload = append(moov_children[j].Payload, trex.encode()...)
+					}
+				}
+			}
+		}
+	}
+	err := edit_mp4_boxes(moov_children, []string{"mvhd"}, func(payload []byte) error {
+		return set_mp4_uint32(payload, len(payload)-4, uint32(len(init_segments)+1)) // next_track_ID
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := []byte{}
+	if ftyp.Type != "" {
+		ret = append(ret, ftyp.encode()...)
+	}
+	return append(ret, mp4_box{Type: "moov", Payload: encode_mp4_boxes(moov_children)}.encode()...), nil
+}
+
+// Rewrite a media segment's fragments for the combined file: they get the new track ID, and the
+// next sequence numbers.  Only "moof" and "mdat" boxes are kept; the others (e.g., "styp" and
+// "sidx") describe the original segment.
+func rewrite_fmp4_fragments(segment []byte, track_id uint32, sequence_number *uint32) ([]byte, error) {
+	boxes, err := parse_mp4_boxes(segment)
+	if err != nil {
+		return nil, err
+	}
+	ret := []byte{}
+	for _, b := range boxes {
+		switch b.Type {
+		case "moof":
+			children, err := parse_mp4_boxes(b.Payload)
+			if err != nil {
+				return nil, err
+			}
+			err = edit_mp4_boxes(children, []string{"mfhd"}, func(payload []byte) error {
+				return set_mp4_uint32(payload, 4, *sequence_number)
+			})
+			if err != nil {
+				return nil, err
+			}
+			*sequence_number += 1
+			err = edit_mp4_boxes(children, []string{"traf", "tfhd"}, func(payload []byte) error {
+				if len(payload) >= 4 && payload[3]&0x01 != 0 {
+					// Data offsets are relative to the start of the file, which is different now
+					return fmt.Errorf("%w: explicit base data offsets aren't supported", ErrInvalidMP4)
+				}
+				return set_mp4_uint32(payload, 4, track_id)
+			})
+			if err != nil {
+				return nil, err
+			}
+			// The sizes don't change, so data offsets (relative to the "moof") are still correct
+			b.Payload = encode_mp4_boxes(children)
+			ret = append(ret, b.encode()...)
+		case "mdat":
+			ret = append(ret, b.encode()...)
+		}
+	}
+	return ret, nil
+}
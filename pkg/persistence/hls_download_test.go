@@ -0,0 +1,256 @@
+package persistence_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Make an MP4 box
+func mp4_box(box_type string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	ret := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	return append(append(ret, box_type...), content...)
+}
+
+// A full box's version and flags, followed by some 32-bit fields
+func mp4_full_box_payload(fields ...uint32) []byte {
+	ret := []byte{0, 0, 0, 0}
+	for _, f := range fields {
+		ret = binary.BigEndian.AppendUint32(ret, f)
+	}
+	return ret
+}
+
+// A fake fragmented MP4 initialization segment, with one track
+func fake_fmp4_init_segment(track_id uint32) []byte {
+	return bytes.Join([][]byte{
+		mp4_box("ftyp", []byte("iso6")),
+		mp4_box("moov",
+			mp4_box("mvhd", mp4_full_box_payload(0, 0, 1000, 0, track_id+1)),
+			mp4_box("trak", mp4_box("tkhd", mp4_full_box_payload(0, 0, track_id, 0, 0))),
+			mp4_box("mvex", mp4_box("trex", mp4_full_box_payload(track_id, 1, 0, 0, 0))),
+		),
+	}, nil)
+}
+
+// A fake fragmented MP4 media segment
+func fake_fmp4_segment(track_id uint32, sequence_number uint32, data string) []byte {
+	return bytes.Join([][]byte{
+		mp4_box("styp", []byte("msdh")),
+		mp4_box("moof",
+			mp4_box("mfhd", mp4_full_box_payload(sequence_number)),
+			mp4_box("traf", mp4_box("tfhd", mp4_full_box_payload(track_id))),
+		),
+		mp4_box("mdat", []byte(data)),
+	}, nil)
+}
+
+// Serve a fake HLS video: a master playlist with 2 renditions, with audio in a separate rendition
+func fake_hls_download(url string) ([]byte, error) {
+	host := "https://video.example.com"
+	playlists := map[string]string{
+		"/master.m3u8": `#EXTM3U
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MEDIA:NAME="Audio",TYPE=AUDIO,GROUP-ID="audio",AUTOSELECT=YES,URI="/audio/playlist.m3u8"
+#EXT-X-STREAM-INF:AVERAGE-BANDWIDTH=300000,BANDWIDTH=400000,RESOLUTION=480x270,CODECS="mp4a.40.2,avc1.4d001e",AUDIO="audio"
+/270p/playlist.m3u8
+#EXT-X-STREAM-INF:AVERAGE-BANDWIDTH=1500000,BANDWIDTH=2000000,RESOLUTION=1280x720,CODECS="mp4a.40.2,avc1.640020",AUDIO="audio"
+/720p/playlist.m3u8
+`,
+	}
+	for _, name := range []string{"270p", "720p", "audio"} {
+		playlists["/"+name+"/playlist.m3u8"] = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-TARGETDURATION:3
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:3.000,
+0.m4s
+#EXTINF:2.000,
+1.m4s
+#EXT-X-ENDLIST
+`
+	}
+
+	if !strings.HasPrefix(url, host) {
+		return []byte(url), nil // Images and thumbnails
+	}
+	path := strings.TrimPrefix(url, host)
+	if playlist, is_ok := playlists[path]; is_ok {
+		return []byte(playlist), nil
+	}
+	name, segment, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	track_id := uint32(1) // Both streams have track ID 1 originally
+	switch segment {
+	case "init.mp4":
+		return fake_fmp4_init_segment(track_id), nil
+	case "0.m4s", "1.m4s":
+		return fake_fmp4_segment(track_id, 1, name+"-"+segment), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMediaDownload404, url)
+}
+
+func TestDownloadHLSVideo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestDownloadHLSVideo"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+	downloader := DefaultDownloader{Download: fake_hls_download}
+	require.NoError(profile.SetVideoPolicy(VideoPolicy{Mode: VIDEO_POLICY_VIDEO, MaxHeight: 720}))
+
+	tweet := create_dummy_tweet()
+	tweet.Videos[0].Variants = []VideoVariant{
+		{ContentType: VIDEO_CONTENT_TYPE_HLS, URL: "https://video.example.com/master.m3u8"},
+	}
+	tweet.Videos[0].LocalFilename = fmt.Sprintf("%d.m3u8", tweet.Videos[0].ID)
+	require.NoError(profile.SaveTweet(tweet))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+
+	vid := tweet.Videos[0]
+	assert.True(vid.IsDownloaded)
+	assert.False(vid.IsAudioOnly)
+	assert.Equal(720, vid.DownloadedHeight)
+	assert.Equal(2000000, vid.DownloadedBitrate)
+	assert.Regexp(`\.mp4$`, vid.LocalFilename)
+	data, err := os.ReadFile(filepath.Join(profile_path, "videos", vid.LocalFilename))
+	require.NoError(err)
+
+	// One file, with the init segments combined into 2 tracks
+	assert.True(bytes.HasPrefix(data[4:], []byte("ftyp")))
+	assert.Equal(1, bytes.Count(data, []byte("moov")))
+	assert.Equal(2, bytes.Count(data, []byte("trak")))
+	assert.Equal(2, bytes.Count(data, []byte("trex")))
+	assert.Contains(string(data), string(mp4_box("tkhd", mp4_full_box_payload(0, 0, 2, 0, 0))))
+	assert.Contains(string(data), string(mp4_box("mvhd", mp4_full_box_payload(0, 0, 1000, 0, 3))))
+
+	// The segments are interleaved, and the audio's fragments are for track 2
+	assert.Equal(0, bytes.Count(data, []byte("styp")))
+	assert.Equal(4, bytes.Count(data, []byte("moof")))
+	index := 0
+	for i, segment := range []string{"720p-0.m4s", "audio-0.m4s", "720p-1.m4s", "audio-1.m4s"} {
+		sequence_number := uint32(i + 1)
+		track_id := uint32(i%2 + 1)
+		fragment := fake_fmp4_segment(track_id, sequence_number, segment)
+		fragment = fragment[bytes.Index(fragment, []byte("moof"))-4:] // Without the "styp"
+		next_index := bytes.Index(data, fragment)
+		assert.Greater(next_index, index, segment)
+		index = next_index
+	}
+
+	// Audio only
+	require.NoError(profile.SetVideoPolicy(VideoPolicy{Mode: VIDEO_POLICY_AUDIO_ONLY}))
+	tweet = create_dummy_tweet()
+	tweet.Videos[0].Variants = []VideoVariant{
+		{ContentType: VIDEO_CONTENT_TYPE_HLS, URL: "https://video.example.com/master.m3u8"},
+		{ContentType: VIDEO_CONTENT_TYPE_MP4, URL: "https://video.example.com/video.mp4"},
+	}
+	require.NoError(profile.SaveTweet(tweet))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+	vid = tweet.Videos[0]
+	assert.True(vid.IsDownloaded)
+	assert.True(vid.IsAudioOnly)
+	assert.Equal(0, vid.DownloadedHeight)
+	data, err = os.ReadFile(filepath.Join(profile_path, "videos", vid.LocalFilename))
+	require.NoError(err)
+	assert.Equal(1, bytes.Count(data, []byte("trak")))
+	assert.Contains(string(data), "audio-1.m4s")
+	assert.NotContains(string(data), "270p")
+
+	// Old-style MPEG-TS segments aren't supported
+	tweet = create_dummy_tweet()
+	tweet.Videos[0].Variants = []VideoVariant{{ContentType: VIDEO_CONTENT_TYPE_HLS, URL: "https://video.example.com/ts.m3u8"}}
+	require.NoError(profile.SaveTweet(tweet))
+	err = profile.DownloadTweetContentWithInjector(&tweet, DefaultDownloader{Download: func(url string) ([]byte, error) {
+		return []byte("#EXTM3U\n#EXTINF:3.000,\n0.ts\n#EXT-X-ENDLIST\n"), nil
+	}})
+	assert.ErrorIs(err, ErrUnsupportedHLS)
+}
+
+// Make an MP4 box with a 64-bit size ("largesize")
+func mp4_large_box(box_type string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	ret := binary.BigEndian.AppendUint32(nil, 1)
+	ret = append(ret, box_type...)
+	ret = binary.BigEndian.AppendUint64(ret, uint64(16+len(content)))
+	return append(ret, content...)
+}
+
+// Records where each file was downloaded to
+type outpath_recording_downloader struct {
+	DefaultDownloader
+	outpaths []string
+}
+
+func (d *outpath_recording_downloader) Curl(url string, outpath string) error {
+	d.outpaths = append(d.outpaths, outpath)
+	return d.DefaultDownloader.Curl(url, outpath)
+}
+
+func TestDownloadHLSVideoWithLargeBoxes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestDownloadHLSVideoWithLargeBoxes"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// A video with no separate audio, whose fragments have 64-bit box sizes
+	large_fragment := func(sequence_number uint32, data string) []byte {
+		return bytes.Join([][]byte{
+			mp4_large_box("moof",
+				mp4_box("mfhd", mp4_full_box_payload(sequence_number)),
+				mp4_box("traf", mp4_box("tfhd", mp4_full_box_payload(1))),
+			),
+			mp4_large_box("mdat", []byte(data)),
+		}, nil)
+	}
+	downloader := &outpath_recording_downloader{DefaultDownloader: DefaultDownloader{Download: func(url string) ([]byte, error) {
+		switch url {
+		case "https://video.example.com/video.m3u8":
+			return []byte("#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:3.000,\n0.m4s\n#EXTINF:3.000,\n1.m4s\n#EXT-X-ENDLIST\n"), nil
+		case "https://video.example.com/init.mp4":
+			return fake_fmp4_init_segment(1), nil
+		case "https://video.example.com/0.m4s":
+			return large_fragment(1, "segment 0"), nil
+		case "https://video.example.com/1.m4s":
+			return large_fragment(1, "segment 1"), nil
+		}
+		return []byte(url), nil // Thumbnail
+	}}}
+
+	tweet := create_dummy_tweet()
+	tweet.Videos[0].Variants = []VideoVariant{{ContentType: VIDEO_CONTENT_TYPE_HLS, URL: "https://video.example.com/video.m3u8"}}
+	require.NoError(profile.SaveTweet(tweet))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+	data, err := os.ReadFile(filepath.Join(profile_path, "videos", tweet.Videos[0].LocalFilename))
+	require.NoError(err)
+
+	// The box headers keep their size, so data offsets in the fragments are still correct
+	assert.Contains(string(data), string(large_fragment(1, "segment 0")))
+	assert.Contains(string(data), string(large_fragment(2, "segment 1")))
+
+	// Playlists and segments aren't downloaded into the profile directory
+	abs_profile_path, err := filepath.Abs(profile_path)
+	require.NoError(err)
+	num_hls_files := 0
+	for _, outpath := range downloader.outpaths {
+		if strings.HasSuffix(outpath, ".tmp") {
+			num_hls_files += 1
+			assert.False(strings.HasPrefix(outpath, abs_profile_path+string(filepath.Separator)), outpath)
+		}
+	}
+	assert.Equal(4, num_hls_files) // Playlist, init segment, 2 segments
+}
@@ -0,0 +1,197 @@
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// Downloaded tweet media is stored content-addressed: the file name is the SHA-256 of the file's
+// contents (plus the original extension), with the same 2-letter prefix directory layout as the
+// scraped filenames.  Images and Videos with identical content point to the same file.
+var content_addressed_filename_regex = regexp.MustCompile(`^([0-9a-f]{2})/([0-9a-f]{64})(\.\w+)?$`)
+
+func is_content_addressed(filename string) bool {
+	return content_addressed_filename_regex.MatchString(filename)
+}
+
+// Compute the SHA-256 of a file's contents, as a hex string
+func hash_file(full_path string) (string, error) {
+	f, err := os.Open(full_path)
+	if err != nil {
+		return "", fmt.Errorf("Error opening file %q:\n  %w", full_path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("Error reading file %q:\n  %w", full_path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Get the content-addressed filename for a file with the given hash.  Keeps the original file extension.
+func content_addressed_filename(hash string, original_filename string) string {
+	return path.Join(hash[:2], hash+path.Ext(original_filename))
+}
+
+// Hard-link a file to a new path, falling back to copying it (e.g., if the filesystem doesn't
+// support hard links)
+func link_or_copy(src string, dest string) error {
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+	return copy_file(src, dest)
+}
+
+// Copy a file's contents to a new file
+func copy_file(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("Error opening file %q:\n  %w", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("Error creating file %q:\n  %w", dest, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("Error copying %q to %q:\n  %w", src, dest, err)
+	}
+	return out.Close()
+}
+
+// Move a freshly downloaded media file (in `<profile>/<subdir>/<filename>`) to its content-addressed
+// location, and return the new filename.  If a file with the same content is already stored, the
+// downloaded copy is deleted instead.
+//
+// If the file doesn't exist (e.g., nothing was actually downloaded), the filename is returned unchanged.
+func (p Profile) store_content_addressed(subdir string, filename string) (string, error) {
+	if filename == "" || is_content_addressed(filename) {
+		return filename, nil
+	}
+	full_path := filepath.Join(p.ProfileDir, subdir, filename)
+	if !file_exists(full_path) {
+		return filename, nil
+	}
+
+	hash, err := hash_file(full_path)
+	if err != nil {
+		return "", err
+	}
+	new_filename := content_addressed_filename(hash, filename)
+	new_full_path := filepath.Join(p.ProfileDir, subdir, new_filename)
+	if file_exists(new_full_path) {
+		// Already have this content
+		err = os.Remove(full_path)
+	} else {
+		if err = os.MkdirAll(filepath.Dir(new_full_path), 0755); err != nil {
+			return "", fmt.Errorf("Error creating directory for %q:\n  %w", new_full_path, err)
+		}
+		err = os.Rename(full_path, new_full_path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error storing %q as %q:\n  %w", full_path, new_full_path, err)
+	}
+	return new_filename, nil
+}
+
+// Result of deduplicating a Profile's media files
+type MediaDedupeResult struct {
+	FilesChecked      int
+	FilesMissing      int
+	DuplicatesRemoved int
+	BytesReclaimed    int64
+}
+
+// Media files that can be deduplicated: the directory they're in, the column that refers to them,
+// and the column in the DM tables that might refer to the same file (DM media isn't deduplicated)
+var media_dedupe_targets = []struct {
+	subdir    string
+	table     string
+	column    string
+	dm_table  string
+	dm_column string
+}{
+	{"images", "images", "local_filename", "chat_message_images", "local_filename"},
+	{"videos", "videos", "local_filename", "chat_message_videos", "local_filename"},
+	{"video_thumbnails", "videos", "thumbnail_local_filename", "chat_message_videos", "thumbnail_local_filename"},
+}
+
+// Move all of a Profile's downloaded tweet images, videos and video thumbnails into the
+// content-addressed layout, deleting duplicate files.  Safe to run more than once.
+func (p Profile) DedupeMedia() (MediaDedupeResult, error) {
+	ret := MediaDedupeResult{}
+	for _, target := range media_dedupe_targets {
+		var filenames []string
+		err := p.DB.Select(&filenames, `select distinct `+target.column+` from `+target.table+` where is_downloaded = 1`)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, filename := range filenames {
+			if filename == "" || filename == "missing" || is_content_addressed(filename) {
+				continue
+			}
+			full_path := filepath.Join(p.ProfileDir, target.subdir, filename)
+			if !file_exists(full_path) {
+				ret.FilesMissing += 1
+				continue
+			}
+			ret.FilesChecked += 1
+
+			// DM media keeps its original filenames, so a file used by a DM can't be moved
+			var is_used_by_dm bool
+			err := p.DB.Get(&is_used_by_dm,
+				`select exists(select 1 from `+target.dm_table+` where `+target.dm_column+` = ?)`, filename)
+			if err != nil {
+				panic(err)
+			}
+
+			hash, err := hash_file(full_path)
+			if err != nil {
+				return ret, err
+			}
+			new_filename := content_addressed_filename(hash, filename)
+			new_full_path := filepath.Join(p.ProfileDir, target.subdir, new_filename)
+			if file_exists(new_full_path) {
+				if !is_used_by_dm {
+					info, err := os.Stat(full_path)
+					if err != nil {
+						return ret, fmt.Errorf("Error checking file %q:\n  %w", full_path, err)
+					}
+					if err := os.Remove(full_path); err != nil {
+						return ret, fmt.Errorf("Error deleting duplicate file %q:\n  %w", full_path, err)
+					}
+					ret.DuplicatesRemoved += 1
+					ret.BytesReclaimed += info.Size()
+				}
+			} else {
+				if err := os.MkdirAll(filepath.Dir(new_full_path), 0755); err != nil {
+					return ret, fmt.Errorf("Error creating directory for %q:\n  %w", new_full_path, err)
+				}
+				if is_used_by_dm {
+					err = link_or_copy(full_path, new_full_path)
+				} else {
+					err = os.Rename(full_path, new_full_path)
+				}
+				if err != nil {
+					return ret, fmt.Errorf("Error storing %q as %q:\n  %w", full_path, new_full_path, err)
+				}
+			}
+
+			_, err = p.DB.Exec(`update `+target.table+` set `+target.column+` = ? where `+target.column+` = ?`,
+				new_filename, filename)
+			if err != nil {
+				return ret, fmt.Errorf("Error updating %s.%s for %q:\n  %w", target.table, target.column, filename, err)
+			}
+		}
+	}
+	return ret, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type MediaDownloader interface {
@@ -45,7 +47,8 @@ func (d DefaultDownloader) Curl(url string, outpath string) error {
 	return nil
 }
 
-// Downloads an Image, and if successful, marks it as downloaded in the DB
+// Downloads an Image, and if successful, marks it as downloaded in the DB.  The file is moved to its
+// content-addressed location (see `store_content_addressed`).
 // DUPE: download-image
 func (p Profile) download_tweet_image(img *Image, downloader MediaDownloader) error {
 	outfile := filepath.Join(p.ProfileDir, "images", img.LocalFilename)
@@ -53,37 +56,196 @@ func (p Profile) download_tweet_image(img *Image, downloader MediaDownloader) er
 	if err != nil {
 		return fmt.Errorf("Error downloading tweet image (TweetID %d):\n  %w", img.TweetID, err)
 	}
+	img.LocalFilename, err = p.store_content_addressed("images", img.LocalFilename)
+	if err != nil {
+		return fmt.Errorf("Error storing tweet image (TweetID %d):\n  %w", img.TweetID, err)
+	}
 	img.IsDownloaded = true
 	return p.SaveImage(*img)
 }
 
-// Downloads a Video and its thumbnail, and if successful, marks it as downloaded in the DB
+// Downloads a Video (the version chosen by the profile's video policy) and its thumbnail, and if
+// successful, marks it as downloaded in the DB.  If the policy is "thumbnail only", just the thumbnail
+// is downloaded, and the video stays marked as not downloaded.
 // DUPE: download-video
 func (p Profile) download_tweet_video(v *Video, downloader MediaDownloader) error {
+	return p.download_tweet_video_with_policy(v, p.GetVideoPolicy(), downloader)
+}
+
+func (p Profile) download_tweet_video_with_policy(v *Video, policy VideoPolicy, downloader MediaDownloader) error {
 	// Download the video
-	outfile := filepath.Join(p.ProfileDir, "videos", v.LocalFilename)
-	err := downloader.Curl(v.RemoteURL, outfile)
+	var err error
+	if policy.Mode != VIDEO_POLICY_THUMBNAIL_ONLY {
+		err = p.download_video_variant(v, policy, downloader)
+	}
 
 	if errors.Is(err, ErrorDMCA) {
 		v.IsDownloaded = false
 		v.IsBlockedByDMCA = true
 	} else if err != nil {
 		return fmt.Errorf("Error downloading video (TweetID %d):\n  %w", v.TweetID, err)
-	} else {
+	} else if policy.Mode != VIDEO_POLICY_THUMBNAIL_ONLY {
+		v.LocalFilename, err = p.store_content_addressed("videos", v.LocalFilename)
+		if err != nil {
+			return fmt.Errorf("Error storing video (TweetID %d):\n  %w", v.TweetID, err)
+		}
 		v.IsDownloaded = true
 	}
 
 	// Download the thumbnail
-	outfile = filepath.Join(p.ProfileDir, "video_thumbnails", v.ThumbnailLocalPath)
+	outfile := filepath.Join(p.ProfileDir, "video_thumbnails", v.ThumbnailLocalPath)
 	err = downloader.Curl(v.ThumbnailRemoteUrl, outfile)
 	if err != nil {
 		v.IsDownloaded = false
 		return fmt.Errorf("Error downloading video thumbnail (TweetID %d):\n  %w", v.TweetID, err)
 	}
+	if v.IsDownloaded {
+		// Only update the thumbnail's filename if the video is saved as downloaded (see `SaveVideo`)
+		v.ThumbnailLocalPath, err = p.store_content_addressed("video_thumbnails", v.ThumbnailLocalPath)
+		if err != nil {
+			v.IsDownloaded = false
+			return fmt.Errorf("Error storing video thumbnail (TweetID %d):\n  %w", v.TweetID, err)
+		}
+	}
 
 	return p.SaveVideo(*v)
 }
 
+// Get the available versions of a video.  Videos scraped before variants were saved only have their
+// remote URL.
+func (p Profile) get_video_variants(v Video) []VideoVariant {
+	ret := v.Variants
+	if len(ret) == 0 {
+		ret = p.GetVideoVariants(v.ID)
+	}
+	if len(ret) == 0 {
+		content_type := VIDEO_CONTENT_TYPE_MP4
+		if strings.Contains(v.RemoteURL, ".m3u8") {
+			content_type = VIDEO_CONTENT_TYPE_HLS
+		}
+		ret = []VideoVariant{{VideoID: v.ID, ContentType: content_type, URL: v.RemoteURL}}
+	}
+	return ret
+}
+
+// Split a video's variants into MP4 files and HLS playlists
+func split_video_variants(variants []VideoVariant) (mp4s []VideoVariant, hls []VideoVariant) {
+	for _, variant := range variants {
+		if variant.IsHLS() {
+			hls = append(hls, variant)
+		} else {
+			mp4s = append(mp4s, variant)
+		}
+	}
+	return
+}
+
+// Download the version of a video chosen by the policy, to its LocalFilename.  MP4 files are
+// preferred over HLS, except for "audio only", which needs HLS (MP4 files don't have a separate audio
+// track).  If there's no way to get just the audio, the smallest video is downloaded instead.
+//
+// Records which version was downloaded in the Video; it isn't saved.
+func (p Profile) download_video_variant(v *Video, policy VideoPolicy, downloader MediaDownloader) error {
+	mp4s, hls := split_video_variants(p.get_video_variants(*v))
+
+	// HLS videos are saved as MP4 files
+	filename := strings.TrimSuffix(v.LocalFilename, ".m3u8")
+	if filename != v.LocalFilename {
+		filename += ".mp4"
+	}
+	if is_content_addressed(filename) {
+		// Already downloaded (this is an upgrade); download it under a new name first
+		filename = fmt.Sprintf("video-%d.mp4", v.ID)
+	}
+	outfile := filepath.Join(p.ProfileDir, "videos", filename)
+
+	var chosen VideoVariant
+	is_audio_only := false
+	if len(hls) != 0 && (len(mp4s) == 0 || policy.Mode == VIDEO_POLICY_AUDIO_ONLY) {
+		var err error
+		chosen, is_audio_only, err = download_hls(downloader, hls[0].URL, outfile, policy)
+		if err != nil {
+			return err
+		}
+	} else {
+		chosen = mp4s[policy.choose_variant_index(mp4s)]
+		if err := downloader.Curl(chosen.URL, outfile); err != nil {
+			return fmt.Errorf("Error downloading video variant %q:\n  %w", chosen.URL, err)
+		}
+	}
+
+	v.LocalFilename = filename
+	v.IsAudioOnly = is_audio_only
+	v.DownloadedBitrate = chosen.Bitrate
+	v.DownloadedHeight = chosen.Height
+	if chosen.Height == 0 && !is_audio_only {
+		v.DownloadedHeight = v.Height
+	}
+	return nil
+}
+
+// Whether a better version of a downloaded video is available, under the given policy.  For HLS
+// videos, the versions aren't known until the playlist is downloaded, so it's assumed there might be.
+func (p Profile) is_video_upgrade_available(v Video, policy VideoPolicy) bool {
+	if !v.IsDownloaded || v.IsAudioOnly {
+		return true
+	}
+	mp4s, _ := split_video_variants(p.get_video_variants(v))
+	if len(mp4s) == 0 {
+		return true
+	}
+	chosen := mp4s[policy.choose_variant_index(mp4s)]
+	return is_better_variant(chosen, VideoVariant{Height: v.DownloadedHeight, Bitrate: v.DownloadedBitrate})
+}
+
+// Re-download a tweet's videos at a better quality, if one is available within the given limits (the
+// policy's mode is ignored; the full video is always downloaded).  The previously downloaded files
+// aren't deleted, since other videos can point to the same file (see `store_content_addressed`); they're
+// recorded as superseded instead.
+//
+// Returns the number of videos that were upgraded.
+func (p Profile) UpgradeTweetVideos(tweet_id TweetID, policy VideoPolicy, downloader MediaDownloader) (int, error) {
+	tweet, err := p.GetTweetById(tweet_id)
+	if err != nil {
+		return 0, err
+	}
+	policy.Mode = VIDEO_POLICY_VIDEO
+
+	ret := 0
+	for i := range tweet.Videos {
+		v := &tweet.Videos[i]
+		if v.IsGeoblocked || v.IsBlockedByDMCA || !p.is_video_upgrade_available(*v, policy) {
+			continue
+		}
+		old_video, old_thumbnail := *v, v.ThumbnailLocalPath
+		if err := p.download_tweet_video_with_policy(v, policy, downloader); err != nil {
+			return ret, err
+		}
+		if !v.IsDownloaded {
+			continue
+		}
+		ret += 1
+		if old_video.IsDownloaded && old_video.LocalFilename != v.LocalFilename {
+			p.save_superseded_media_file("videos", old_video.LocalFilename)
+		}
+		if old_video.IsDownloaded && old_thumbnail != v.ThumbnailLocalPath {
+			p.save_superseded_media_file("video_thumbnails", old_thumbnail)
+		}
+	}
+	return ret, nil
+}
+
+// Record that a media file was replaced by a better version, so it isn't deleted as orphaned
+func (p Profile) save_superseded_media_file(subdir string, local_filename string) {
+	_, err := p.DB.Exec(`
+		insert into superseded_media_files (subdir, local_filename, superseded_at) values (?, ?, ?)
+		    on conflict do nothing
+	`, subdir, local_filename, Timestamp{time.Now()})
+	if err != nil {
+		panic(err)
+	}
+}
+
 // Downloads an URL thumbnail image, and if successful, marks it as downloaded in the DB
 // DUPE: download-link-thumbnail
 func (p Profile) download_link_thumbnail(url *Url, downloader MediaDownloader) error {
@@ -187,16 +349,112 @@ func (p Profile) DownloadUserContentWithInjector(u *User, downloader MediaDownlo
 // If it has been downloaded, do nothing.
 // If this user should have a big profile picture, defer to the regular `DownloadUserContentFor` method.
 func (p Profile) DownloadUserProfileImageTiny(u *User, download DownloadFunc) error {
+	return p.DownloadUserProfileImageTinyWithInjector(u, DefaultDownloader{Download: download})
+}
+
+// Enable injecting a custom MediaDownloader (i.e., for testing)
+func (p Profile) DownloadUserProfileImageTinyWithInjector(u *User, downloader MediaDownloader) error {
 	if p.IsFollowing(*u) {
-		return p.DownloadUserContentFor(u, download)
+		return p.DownloadUserContentWithInjector(u, downloader)
 	}
 
-	d := DefaultDownloader{Download: download}
-
 	outfile := filepath.Join(p.ProfileDir, "profile_images", u.GetTinyProfileImageLocalPath())
 	if file_exists(outfile) {
 		return nil
 	}
-	err := d.Curl(u.GetTinyProfileImageUrl(), outfile)
+	err := downloader.Curl(u.GetTinyProfileImageUrl(), outfile)
 	return err
 }
+
+// Download a chat message's images, videos and link thumbnails, marking each one as downloaded in the DB.
+// Ones that are already downloaded are skipped.
+func (p Profile) DownloadChatMessageContentWithInjector(m *DMMessage, downloader MediaDownloader) error {
+	for i := range m.Images {
+		img := &m.Images[i]
+		// Check if it's already downloaded
+		err := p.DB.Get(&img.IsDownloaded, `select is_downloaded from chat_message_images where id = ?`, img.ID)
+		if err != nil {
+			panic(err)
+		}
+		if img.IsDownloaded {
+			continue
+		}
+
+		// DUPE: download-image
+		outfile := filepath.Join(p.ProfileDir, "images", img.LocalFilename)
+		err = downloader.Curl(img.RemoteURL, outfile)
+		if err != nil {
+			return fmt.Errorf("Error downloading image %q on DM message %d:\n  %w", img.RemoteURL, m.ID, err)
+		}
+		img.IsDownloaded = true
+		_, err = p.DB.NamedExec(`update chat_message_images set is_downloaded = 1 where id = :id`, img)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for i := range m.Videos {
+		vid := &m.Videos[i]
+		// Videos can be geoblocked, and the HTTP response isn't in JSON so it's hard to capture
+		if vid.IsGeoblocked {
+			continue
+		}
+
+		// Check if it's already downloaded
+		err := p.DB.Get(&vid.IsDownloaded, `select is_downloaded from chat_message_videos where id = ?`, vid.ID)
+		if err != nil {
+			panic(err)
+		}
+		if vid.IsDownloaded {
+			continue
+		}
+
+		// DUPE: download-video
+		outfile := filepath.Join(p.ProfileDir, "videos", vid.LocalFilename)
+		err = downloader.Curl(vid.RemoteURL, outfile)
+		if errors.Is(err, ErrorDMCA) {
+			vid.IsBlockedByDMCA = true
+		} else if err != nil {
+			return fmt.Errorf("Error downloading video %q on DM message %d:\n  %w", vid.RemoteURL, m.ID, err)
+		} else {
+			vid.IsDownloaded = true
+		}
+
+		// Download the thumbnail.  Videos imported from an account archive don't have one
+		if vid.ThumbnailRemoteUrl != "" {
+			outfile = filepath.Join(p.ProfileDir, "video_thumbnails", vid.ThumbnailLocalPath)
+			err = downloader.Curl(vid.ThumbnailRemoteUrl, outfile)
+			if err != nil {
+				vid.IsDownloaded = false
+				return fmt.Errorf("Error downloading video thumbnail (DMMessageID %d):\n  %w", vid.DMMessageID, err)
+			}
+		}
+
+		_, err = p.DB.NamedExec(`
+			update chat_message_videos set is_downloaded = :is_downloaded, is_blocked_by_dmca = :is_blocked_by_dmca where id = :id
+		`, vid)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for i := range m.Urls {
+		url := &m.Urls[i]
+		// DUPE: download-link-thumbnail
+		if url.HasCard && url.HasThumbnail {
+			outfile := filepath.Join(p.ProfileDir, "link_preview_images", url.ThumbnailLocalPath)
+			err := downloader.Curl(url.ThumbnailRemoteUrl, outfile)
+			if err != nil {
+				return fmt.Errorf("Error downloading link thumbnail %q on DM message %d:\n  %w", url.ThumbnailRemoteUrl, m.ID, err)
+			}
+		}
+		url.IsContentDownloaded = true
+		_, err := p.DB.NamedExec(`
+			update chat_message_urls set is_content_downloaded = :is_content_downloaded where chat_message_id = :chat_message_id
+		`, url)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return nil
+}
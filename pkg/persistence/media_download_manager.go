@@ -0,0 +1,213 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Media is downloaded in the background from a persistent queue (see `QueueMediaDownloads`), by a
+// fixed number of workers.  Each remote host gets a limited number of simultaneous downloads.
+//
+// Failed downloads are retried with exponential backoff (30 seconds, 1 minute, 2 minutes, ...), until
+// they've failed too many times or can't succeed by retrying (e.g., a 404).
+
+const (
+	DEFAULT_MEDIA_DOWNLOAD_WORKERS   = 4
+	DEFAULT_MEDIA_DOWNLOADS_PER_HOST = 2
+
+	MAX_MEDIA_DOWNLOAD_FAILURES   = 5
+	MEDIA_DOWNLOAD_RETRY_DELAY    = 30 * time.Second
+	MEDIA_DOWNLOAD_MAX_RETRY_WAIT = time.Hour
+
+	// How often idle workers check for items that are done waiting to retry
+	MEDIA_DOWNLOAD_POLL_INTERVAL = 10 * time.Second
+)
+
+type MediaDownloadProgress struct {
+	NumQueued         int `json:"num_queued"` // Ready to download, including the ones in progress
+	NumWaitingToRetry int `json:"num_waiting_to_retry"`
+	NumFailed         int `json:"num_failed"` // Gave up
+	NumInProgress     int `json:"num_in_progress"`
+
+	// Since the manager was created
+	NumDownloaded int `json:"num_downloaded"`
+	NumErrors     int `json:"num_errors"`
+}
+
+type MediaDownloadManager struct {
+	Profile    Profile
+	NumWorkers int
+	MaxPerHost int
+
+	mutex          sync.Mutex
+	in_progress    map[int64]bool
+	hosts          map[string]chan struct{} // A semaphore for each remote host
+	num_downloaded int
+	num_errors     int
+	changed        chan struct{} // Closed (and replaced) when new items are queued, to wake up idle workers
+}
+
+func NewMediaDownloadManager(profile Profile) *MediaDownloadManager {
+	return &MediaDownloadManager{
+		Profile:     profile,
+		NumWorkers:  DEFAULT_MEDIA_DOWNLOAD_WORKERS,
+		MaxPerHost:  DEFAULT_MEDIA_DOWNLOADS_PER_HOST,
+		in_progress: make(map[int64]bool),
+		hosts:       make(map[string]chan struct{}),
+		changed:     make(chan struct{}),
+	}
+}
+
+// Start the workers in the background.  They keep downloading whatever gets queued, until the
+// program exits.
+func (m *MediaDownloadManager) Start(downloader MediaDownloader) {
+	for i := 0; i < m.NumWorkers; i++ {
+		go m.work(downloader, false, nil)
+	}
+}
+
+// Wake up idle workers, e.g., after queueing new items
+func (m *MediaDownloadManager) Notify() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// Download everything in the queue that's ready, and return once it's done.  Items that fail are
+// left in the queue to be retried later.  `on_progress` (if not nil) is called after each item.
+func (m *MediaDownloadManager) DownloadAll(downloader MediaDownloader, on_progress func(MediaDownloadProgress)) {
+	var wg sync.WaitGroup
+	for i := 0; i < m.NumWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(downloader, true, on_progress)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *MediaDownloadManager) Progress() MediaDownloadProgress {
+	ret := MediaDownloadProgress{}
+	ret.NumQueued, ret.NumWaitingToRetry, ret.NumFailed = m.Profile.CountQueuedMediaDownloads()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ret.NumInProgress = len(m.in_progress)
+	ret.NumDownloaded = m.num_downloaded
+	ret.NumErrors = m.num_errors
+	return ret
+}
+
+// Keep downloading items from the queue.  If `should_stop_when_empty` is false, wait for more when
+// there's nothing left; otherwise, return.
+func (m *MediaDownloadManager) work(downloader MediaDownloader, should_stop_when_empty bool, on_progress func(MediaDownloadProgress)) {
+	limited_downloader := host_limited_downloader{m, downloader}
+	for {
+		item, is_ok := m.claim_next()
+		if !is_ok {
+			if should_stop_when_empty {
+				return
+			}
+			m.mutex.Lock()
+			changed := m.changed
+			m.mutex.Unlock()
+			timer := time.NewTimer(MEDIA_DOWNLOAD_POLL_INTERVAL)
+			select {
+			case <-timer.C:
+			case <-changed:
+			}
+			timer.Stop()
+			continue
+		}
+
+		m.finish(item, m.download(item, limited_downloader))
+		if on_progress != nil {
+			on_progress(m.Progress())
+		}
+	}
+}
+
+// Take the next item that's ready and not already being downloaded by another worker
+func (m *MediaDownloadManager) claim_next() (QueuedMediaDownload, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, item := range m.Profile.GetReadyMediaDownloads(len(m.in_progress) + 1) {
+		if !m.in_progress[item.ID] {
+			m.in_progress[item.ID] = true
+			return item, true
+		}
+	}
+	return QueuedMediaDownload{}, false
+}
+
+// Download an item.  A panic is treated as a failed download, so it doesn't crash the worker.
+func (m *MediaDownloadManager) download(item QueuedMediaDownload, downloader MediaDownloader) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return m.Profile.DownloadQueuedMedia(item, downloader)
+}
+
+// Remove a downloaded item from the queue, or record its failure
+func (m *MediaDownloadManager) finish(item QueuedMediaDownload, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.in_progress, item.ID)
+
+	if err == nil {
+		m.Profile.DeleteQueuedMediaDownload(item)
+		m.num_downloaded += 1
+		return
+	}
+
+	m.num_errors += 1
+	item.NumFailures += 1
+	item.LastError = err.Error()
+	if item.NumFailures >= MAX_MEDIA_DOWNLOAD_FAILURES || errors.Is(err, ErrMediaDownload404) {
+		item.IsFailed = true
+	} else {
+		retry_wait := MEDIA_DOWNLOAD_RETRY_DELAY << (item.NumFailures - 1)
+		if retry_wait > MEDIA_DOWNLOAD_MAX_RETRY_WAIT {
+			retry_wait = MEDIA_DOWNLOAD_MAX_RETRY_WAIT
+		}
+		item.RetryAt = Timestamp{time.Now().Add(retry_wait)}
+	}
+	m.Profile.SaveMediaDownloadFailure(item)
+}
+
+// Wait for the remote host to have a free download slot
+func (m *MediaDownloadManager) acquire_host(host string) chan struct{} {
+	m.mutex.Lock()
+	semaphore, is_ok := m.hosts[host]
+	if !is_ok {
+		semaphore = make(chan struct{}, max(m.MaxPerHost, 1))
+		m.hosts[host] = semaphore
+	}
+	m.mutex.Unlock()
+
+	semaphore <- struct{}{}
+	return semaphore
+}
+
+// Limits how many files are downloaded from each host at once
+type host_limited_downloader struct {
+	manager    *MediaDownloadManager
+	downloader MediaDownloader
+}
+
+func (d host_limited_downloader) Curl(remote_url string, outpath string) error {
+	host := ""
+	if parsed, err := url.Parse(remote_url); err == nil {
+		host = parsed.Host
+	}
+	semaphore := d.manager.acquire_host(host)
+	defer func() { <-semaphore }()
+	return d.downloader.Curl(remote_url, outpath)
+}
@@ -0,0 +1,114 @@
+package persistence_test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestMediaDownloadQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestMediaDownloadQueue"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// Queue a user and some tweets
+	trove := NewTweetTrove()
+	user := create_dummy_user()
+	require.NoError(profile.SaveUser(&user))
+	trove.Users[user.ID] = user
+	tweet_ok := create_dummy_tweet()
+	tweet_timeout := create_dummy_tweet()
+	tweet_404 := create_dummy_tweet()
+	for _, tweet := range []Tweet{tweet_ok, tweet_timeout, tweet_404} {
+		require.NoError(profile.SaveTweet(tweet))
+		trove.Tweets[tweet.ID] = tweet
+	}
+	assert.Equal(4, profile.QueueMediaDownloads(trove))
+	assert.Equal(0, profile.QueueMediaDownloads(trove)) // Already queued
+
+	// Spy on the downloads, and make some of them fail
+	var mutex sync.Mutex
+	num_downloading := 0
+	max_num_downloading := 0
+	downloader := DefaultDownloader{Download: func(url string) ([]byte, error) {
+		mutex.Lock()
+		num_downloading += 1
+		max_num_downloading = max(max_num_downloading, num_downloading)
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mutex.Lock()
+		num_downloading -= 1
+		mutex.Unlock()
+
+		switch url {
+		case tweet_timeout.Images[0].RemoteURL:
+			return nil, fmt.Errorf("%w: pretend it timed out", ErrRequestTimeout)
+		case tweet_404.Images[0].RemoteURL:
+			return nil, ErrMediaDownload404
+		}
+		return []byte(url), nil
+	}}
+
+	manager := NewMediaDownloadManager(profile)
+	manager.NumWorkers = 4
+	manager.MaxPerHost = 1
+	num_progress_updates := 0
+	manager.DownloadAll(downloader, func(progress MediaDownloadProgress) {
+		mutex.Lock()
+		num_progress_updates += 1
+		mutex.Unlock()
+	})
+	assert.Equal(4, num_progress_updates)
+	assert.Equal(1, max_num_downloading) // The fake URLs are all on the same (empty) host
+
+	// Successful ones are removed from the queue; failed ones are retried later, or given up on
+	assert.Equal(MediaDownloadProgress{
+		NumQueued:         0,
+		NumWaitingToRetry: 1,
+		NumFailed:         1,
+		NumInProgress:     0,
+		NumDownloaded:     2,
+		NumErrors:         2,
+	}, manager.Progress())
+	new_tweet, err := profile.GetTweetById(tweet_ok.ID)
+	require.NoError(err)
+	assert.True(new_tweet.IsContentDownloaded)
+	new_tweet, err = profile.GetTweetById(tweet_timeout.ID)
+	require.NoError(err)
+	assert.False(new_tweet.IsContentDownloaded)
+	failed := profile.GetFailedMediaDownloads()
+	require.Len(failed, 1)
+	assert.Equal(MEDIA_DOWNLOAD_TWEET, failed[0].Type)
+	assert.Equal(int64(tweet_404.ID), failed[0].ItemID)
+	assert.Equal(1, failed[0].NumFailures)
+	assert.Contains(failed[0].LastError, ErrMediaDownload404.Error())
+
+	// Nothing is ready, so nothing gets downloaded
+	manager.DownloadAll(downloader, nil)
+	assert.Equal(2, manager.Progress().NumDownloaded)
+
+	// Retry the failed one; the queue is persistent, so a new manager picks it up
+	assert.Equal(1, profile.RetryFailedMediaDownloads())
+	manager = NewMediaDownloadManager(profile)
+	manager.DownloadAll(DefaultDownloader{Download: func(url string) ([]byte, error) {
+		return []byte(url), nil
+	}}, nil)
+	progress := manager.Progress()
+	assert.Equal(1, progress.NumDownloaded)
+	assert.Equal(0, progress.NumFailed)
+	assert.Equal(1, progress.NumWaitingToRetry)
+	new_tweet, err = profile.GetTweetById(tweet_404.ID)
+	require.NoError(err)
+	assert.True(new_tweet.IsContentDownloaded)
+}
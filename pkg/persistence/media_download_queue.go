@@ -0,0 +1,33 @@
+package persistence
+
+import (
+	"time"
+)
+
+type MediaDownloadType string
+
+const (
+	MEDIA_DOWNLOAD_TWEET        = MediaDownloadType("tweet")        // ItemID is a TweetID
+	MEDIA_DOWNLOAD_USER         = MediaDownloadType("user")         // ItemID is a UserID
+	MEDIA_DOWNLOAD_CHAT_MESSAGE = MediaDownloadType("chat_message") // ItemID is a DMMessageID
+)
+
+// An item (tweet, user or chat message) whose media content is waiting to be downloaded.  It stays
+// in the queue until it's downloaded, so downloads that didn't finish can be picked up again later.
+type QueuedMediaDownload struct {
+	ID     int64             `db:"rowid"`
+	Type   MediaDownloadType `db:"type"`
+	ItemID int64             `db:"item_id"`
+
+	NumFailures int       `db:"num_failures"`
+	LastError   string    `db:"last_error"`
+	RetryAt     Timestamp `db:"retry_at"`
+	IsFailed    bool      `db:"is_failed"` // Gave up; see `LastError`
+
+	QueuedAt Timestamp `db:"queued_at"`
+}
+
+// Whether it failed, and is waiting until `RetryAt` to try again
+func (d QueuedMediaDownload) IsWaitingToRetry() bool {
+	return !d.IsFailed && d.RetryAt.After(time.Now())
+}
@@ -0,0 +1,176 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+const queued_media_download_fields = `rowid, type, item_id, num_failures, last_error, retry_at, is_failed, queued_at`
+
+// Add everything in a trove that has media content needing to be downloaded to the download queue.
+// The trove should already be saved.  Items that are already in the queue are left as they are.
+//
+// Returns the number of items that were added.
+func (p Profile) QueueMediaDownloads(trove TweetTrove) int {
+	ret := 0
+	for _, u := range trove.Users {
+		if p.is_user_media_download_needed(u) {
+			ret += p.queue_media_download(MEDIA_DOWNLOAD_USER, int64(u.ID))
+		}
+	}
+	for _, t := range trove.Tweets {
+		if p.CheckTweetContentDownloadNeeded(t) {
+			ret += p.queue_media_download(MEDIA_DOWNLOAD_TWEET, int64(t.ID))
+		}
+	}
+	for _, m := range trove.Messages {
+		if p.CheckChatMessageContentDownloadNeeded(m) {
+			ret += p.queue_media_download(MEDIA_DOWNLOAD_CHAT_MESSAGE, int64(m.ID))
+		}
+	}
+	return ret
+}
+
+func (p Profile) queue_media_download(_type MediaDownloadType, item_id int64) int {
+	result, err := p.DB.Exec(`
+		insert or ignore into media_download_queue (type, item_id, queued_at) values (?, ?, ?)
+	`, _type, item_id, Timestamp{time.Now()})
+	if err != nil {
+		panic(err)
+	}
+	num_rows, err := result.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return int(num_rows)
+}
+
+// Followed users get their full-size profile image and banner; everyone else just gets a tiny
+// profile image.  (See `DownloadUserProfileImageTiny`.)
+func (p Profile) is_user_media_download_needed(u User) bool {
+	if p.IsFollowing(u) {
+		return p.CheckUserContentDownloadNeeded(u)
+	}
+	return !file_exists(filepath.Join(p.ProfileDir, "profile_images", u.GetTinyProfileImageLocalPath()))
+}
+
+// Get queued items that are ready to download (i.e., haven't failed, or are done waiting to retry),
+// oldest first
+func (p Profile) GetReadyMediaDownloads(limit int) []QueuedMediaDownload {
+	var ret []QueuedMediaDownload
+	err := p.DB.Select(&ret, `
+		select `+queued_media_download_fields+`
+		  from media_download_queue
+		 where is_failed = 0 and retry_at <= ?
+		 order by rowid
+		 limit ?
+	`, Timestamp{time.Now()}, limit)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Get the items that have been given up on, most recent first
+func (p Profile) GetFailedMediaDownloads() []QueuedMediaDownload {
+	var ret []QueuedMediaDownload
+	err := p.DB.Select(&ret, `
+		select `+queued_media_download_fields+`
+		  from media_download_queue
+		 where is_failed = 1
+		 order by rowid desc
+	`)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Count the items in the queue: how many are ready to download, waiting to retry, and failed
+func (p Profile) CountQueuedMediaDownloads() (num_ready int, num_waiting_to_retry int, num_failed int) {
+	err := p.DB.QueryRow(`
+		select coalesce(sum(is_failed = 0 and retry_at <= ?), 0),
+		       coalesce(sum(is_failed = 0 and retry_at > ?), 0),
+		       coalesce(sum(is_failed = 1), 0)
+		  from media_download_queue
+	`, Timestamp{time.Now()}, Timestamp{time.Now()}).Scan(&num_ready, &num_waiting_to_retry, &num_failed)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// Remove an item from the queue, once it's downloaded
+func (p Profile) DeleteQueuedMediaDownload(d QueuedMediaDownload) {
+	_, err := p.DB.Exec(`delete from media_download_queue where rowid = ?`, d.ID)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Save a failed download's error, and when to retry it (or whether it's been given up on)
+func (p Profile) SaveMediaDownloadFailure(d QueuedMediaDownload) {
+	_, err := p.DB.NamedExec(`
+		update media_download_queue
+		   set num_failures = :num_failures,
+		       last_error = :last_error,
+		       retry_at = :retry_at,
+		       is_failed = :is_failed
+		 where rowid = :rowid
+	`, d)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Put every failed item back in the queue.  Returns how many there were.
+func (p Profile) RetryFailedMediaDownloads() int {
+	result, err := p.DB.Exec(`
+		update media_download_queue set is_failed = 0, num_failures = 0, retry_at = 0 where is_failed = 1
+	`)
+	if err != nil {
+		panic(err)
+	}
+	num_rows, err := result.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return int(num_rows)
+}
+
+// Download the media content of a queued item.  If the item isn't in the DB anymore (e.g., it was
+// deleted), there's nothing to download.
+func (p Profile) DownloadQueuedMedia(d QueuedMediaDownload, downloader MediaDownloader) error {
+	switch d.Type {
+	case MEDIA_DOWNLOAD_TWEET:
+		tweet, err := p.GetTweetById(TweetID(d.ItemID))
+		if errors.Is(err, ErrNotInDatabase) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return p.DownloadTweetContentWithInjector(&tweet, downloader)
+	case MEDIA_DOWNLOAD_USER:
+		user, err := p.GetUserByID(UserID(d.ItemID))
+		if errors.Is(err, ErrNotInDatabase) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return p.DownloadUserProfileImageTinyWithInjector(&user, downloader)
+	case MEDIA_DOWNLOAD_CHAT_MESSAGE:
+		trove, err := p.GetChatMessage(DMMessageID(d.ItemID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		msg := trove.Messages[DMMessageID(d.ItemID)]
+		return p.DownloadChatMessageContentWithInjector(&msg, downloader)
+	default:
+		return fmt.Errorf("Unknown media download type: %q", d.Type)
+	}
+}
@@ -1,6 +1,9 @@
 package persistence_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -151,3 +154,100 @@ func TestDownloadDefaultUserContent(t *testing.T) {
 		"test_profiles/TestMediaQueries/profile_images/default_profile.png",
 	}))
 }
+
+// Downloaded media with identical content should be stored once, and shared
+func TestDownloadTweetContentDeduplicates(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestMediaDedupe"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// Every image has the same content; videos and thumbnails are unique
+	downloader := DefaultDownloader{Download: func(url string) ([]byte, error) {
+		if strings.HasPrefix(url, "image") {
+			return []byte("the same meme"), nil
+		}
+		return []byte(url), nil
+	}}
+
+	tweet := create_dummy_tweet()
+	require.NoError(profile.SaveTweet(tweet))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+
+	// Both images should point to the same content-addressed file
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	test_all_downloaded(new_tweet, true, t)
+	img1 := new_tweet.Images[0]
+	assert.Equal(img1.LocalFilename, new_tweet.Images[1].LocalFilename)
+	assert.NotEqual(tweet.Images[0].RemoteURL, img1.LocalFilename)
+	assert.Regexp(`^[0-9a-f]{2}/[0-9a-f]{64}\.jpg$`, img1.LocalFilename)
+	assert.True(file_exists(filepath.Join(profile_path, "images", img1.LocalFilename)))
+	assert.False(file_exists(filepath.Join(profile_path, "images", tweet.Images[0].RemoteURL)))
+	assert.False(file_exists(filepath.Join(profile_path, "images", tweet.Images[1].RemoteURL)))
+
+	vid := new_tweet.Videos[0]
+	assert.Regexp(`^[0-9a-f]{2}/[0-9a-f]{64}\.jpg$`, vid.LocalFilename)
+	assert.True(file_exists(filepath.Join(profile_path, "videos", vid.LocalFilename)))
+	assert.True(file_exists(filepath.Join(profile_path, "video_thumbnails", vid.ThumbnailLocalPath)))
+
+	// Another tweet with the same image
+	tweet2 := create_dummy_tweet()
+	require.NoError(profile.SaveTweet(tweet2))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet2, downloader))
+	assert.Equal(img1.LocalFilename, tweet2.Images[0].LocalFilename)
+	entries, err := os.ReadDir(filepath.Join(profile_path, "images", img1.LocalFilename[:2]))
+	require.NoError(err)
+	assert.Len(entries, 1)
+}
+
+// Deduplicating an existing Profile's media should move files to the content-addressed layout
+func TestDedupeMedia(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestDedupeMedia"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// Simulate media downloaded the old way
+	tweet := create_dummy_tweet()
+	write_file := func(subdir string, filename string, contents string) {
+		full_path := filepath.Join(profile_path, subdir, filename)
+		require.NoError(os.MkdirAll(filepath.Dir(full_path), 0755))
+		require.NoError(os.WriteFile(full_path, []byte(contents), 0644))
+	}
+	write_file("images", tweet.Images[0].LocalFilename, "the same meme")
+	write_file("images", tweet.Images[1].LocalFilename, "the same meme")
+	write_file("videos", tweet.Videos[0].LocalFilename, "a video")
+	// (The video's thumbnail is missing)
+	for i := range tweet.Images {
+		tweet.Images[i].IsDownloaded = true
+	}
+	tweet.Videos[0].IsDownloaded = true
+	require.NoError(profile.SaveTweet(tweet))
+
+	result, err := profile.DedupeMedia()
+	require.NoError(err)
+	assert.Equal(MediaDedupeResult{FilesChecked: 3, FilesMissing: 1, DuplicatesRemoved: 1, BytesReclaimed: 13}, result)
+
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	img_filename := new_tweet.Images[0].LocalFilename
+	assert.Equal(img_filename, new_tweet.Images[1].LocalFilename)
+	assert.True(file_exists(filepath.Join(profile_path, "images", img_filename)))
+	assert.False(file_exists(filepath.Join(profile_path, "images", tweet.Images[0].LocalFilename)))
+	assert.False(file_exists(filepath.Join(profile_path, "images", tweet.Images[1].LocalFilename)))
+	assert.NotEqual(tweet.Videos[0].LocalFilename, new_tweet.Videos[0].LocalFilename)
+	assert.True(file_exists(filepath.Join(profile_path, "videos", new_tweet.Videos[0].LocalFilename)))
+	assert.Equal(tweet.Videos[0].ThumbnailLocalPath, new_tweet.Videos[0].ThumbnailLocalPath)
+
+	// Running it again should do nothing
+	result, err = profile.DedupeMedia()
+	require.NoError(err)
+	assert.Equal(MediaDedupeResult{FilesMissing: 1}, result)
+}
@@ -0,0 +1,199 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Rules for which downloaded tweet media to delete to free up disk space.  Pruned media is marked as
+// not downloaded, so it can be downloaded again later.
+//
+// Video thumbnails are always kept, since they're small and are shown in place of the video.
+type MediaRetentionPolicy struct {
+	// Never prune media from tweets by users who are followed (offline), or from bookmarked tweets
+	KeepFollowed   bool
+	KeepBookmarked bool
+
+	// Prune images / videos from tweets posted before this time.  Zero means don't prune by age.
+	ImagesPostedBefore Timestamp
+	VideosPostedBefore Timestamp
+
+	// If the tweet media (images and videos) still takes up more than this many bytes, prune the media
+	// from the oldest tweets until it doesn't.  Zero means no limit.
+	MaxMediaSize int64
+}
+
+// Result of pruning media
+type MediaPruneResult struct {
+	ImagesPruned    int
+	VideosPruned    int
+	TweetsAffected  int
+	FilesDeleted    int
+	BytesFreed      int64
+	TotalSizeBefore int64
+	TotalSizeAfter  int64
+}
+
+type prunable_media struct {
+	IsVideo       bool      `db:"is_video"`
+	ID            int64     `db:"id"`
+	TweetID       TweetID   `db:"tweet_id"`
+	LocalFilename string    `db:"local_filename"`
+	PostedAt      Timestamp `db:"posted_at"`
+	IsProtected   bool      `db:"is_protected"`
+}
+
+func (m prunable_media) path() string {
+	if m.IsVideo {
+		return filepath.Join("videos", m.LocalFilename)
+	}
+	return filepath.Join("images", m.LocalFilename)
+}
+
+// Delete downloaded tweet media according to the given policy.  Content-addressed files shared by
+// several tweets (see `DedupeMedia`) are only deleted once nothing downloaded refers to them anymore.
+//
+// If `is_dry_run` is true, nothing is changed; the result shows what would have been pruned.
+func (p Profile) PruneMedia(policy MediaRetentionPolicy, is_dry_run bool) (MediaPruneResult, error) {
+	ret := MediaPruneResult{}
+
+	var candidates []prunable_media
+	err := p.DB.Select(&candidates, `
+		with protected_tweets as (
+		    select id from tweets where ? and user_id in (select id from users where is_followed = 1)
+		     union
+		    select tweet_id from bookmarks where ?
+		)
+		select 0 is_video, images.id, tweet_id, local_filename, posted_at,
+		       tweet_id in (select id from protected_tweets) is_protected
+		  from images join tweets on images.tweet_id = tweets.id
+		 where is_downloaded = 1
+		 union all
+		select 1 is_video, videos.id, tweet_id, local_filename, posted_at,
+		       tweet_id in (select id from protected_tweets) is_protected
+		  from videos join tweets on videos.tweet_id = tweets.id
+		 where is_downloaded = 1
+		 order by posted_at asc`,
+		policy.KeepFollowed, policy.KeepBookmarked)
+	if err != nil {
+		panic(err)
+	}
+
+	// Count how many downloaded items refer to each file, including DM media (which is never pruned)
+	var dm_paths []string
+	err = p.DB.Select(&dm_paths, `
+		select 'images/' || local_filename from chat_message_images where is_downloaded = 1
+		 union all
+		select 'videos/' || local_filename from chat_message_videos where is_downloaded = 1`)
+	if err != nil {
+		panic(err)
+	}
+	ref_counts := map[string]int{}
+	for _, path := range dm_paths {
+		ref_counts[filepath.FromSlash(path)] += 1
+	}
+	file_sizes := map[string]int64{}
+	for _, m := range candidates {
+		path := m.path()
+		ref_counts[path] += 1
+		if _, is_ok := file_sizes[path]; !is_ok {
+			info, err := os.Stat(filepath.Join(p.ProfileDir, path))
+			if err == nil {
+				file_sizes[path] = info.Size()
+			} else if errors.Is(err, os.ErrNotExist) {
+				file_sizes[path] = 0
+			} else {
+				return ret, fmt.Errorf("Error checking media file %q:\n  %w", path, err)
+			}
+		}
+	}
+	for _, size := range file_sizes {
+		ret.TotalSizeBefore += size
+	}
+	ret.TotalSizeAfter = ret.TotalSizeBefore
+
+	// Decide what to prune
+	to_prune := []prunable_media{}
+	files_to_delete := []string{}
+	is_pruned := make([]bool, len(candidates))
+	prune := func(i int) {
+		m := candidates[i]
+		is_pruned[i] = true
+		to_prune = append(to_prune, m)
+		path := m.path()
+		ref_counts[path] -= 1
+		if ref_counts[path] == 0 {
+			files_to_delete = append(files_to_delete, path)
+			ret.BytesFreed += file_sizes[path]
+			ret.TotalSizeAfter -= file_sizes[path]
+		}
+	}
+	for i, m := range candidates {
+		if m.IsProtected {
+			continue
+		}
+		cutoff := policy.ImagesPostedBefore
+		if m.IsVideo {
+			cutoff = policy.VideosPostedBefore
+		}
+		if !cutoff.IsZero() && m.PostedAt.Before(cutoff.Time) {
+			prune(i)
+		}
+	}
+	if policy.MaxMediaSize > 0 {
+		// Candidates are sorted oldest first
+		for i, m := range candidates {
+			if ret.TotalSizeAfter <= policy.MaxMediaSize {
+				break
+			}
+			if m.IsProtected || is_pruned[i] {
+				continue
+			}
+			prune(i)
+		}
+	}
+
+	affected_tweets := map[TweetID]bool{}
+	for _, m := range to_prune {
+		if m.IsVideo {
+			ret.VideosPruned += 1
+		} else {
+			ret.ImagesPruned += 1
+		}
+		affected_tweets[m.TweetID] = true
+	}
+	ret.TweetsAffected = len(affected_tweets)
+	ret.FilesDeleted = len(files_to_delete)
+	if is_dry_run {
+		return ret, nil
+	}
+
+	// Update the DB first, so if deleting files fails partway, nothing points to a deleted file
+	tx, err := p.DB.Beginx()
+	if err != nil {
+		panic(err)
+	}
+	for _, m := range to_prune {
+		if m.IsVideo {
+			tx.MustExec(`update videos set is_downloaded = 0 where id = ?`, m.ID)
+		} else {
+			tx.MustExec(`update images set is_downloaded = 0 where id = ?`, m.ID)
+		}
+	}
+	for id := range affected_tweets {
+		tx.MustExec(`update tweets set is_content_downloaded = 0 where id = ?`, id)
+	}
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+
+	for _, path := range files_to_delete {
+		err := os.Remove(filepath.Join(p.ProfileDir, path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return ret, fmt.Errorf("Error deleting media file %q:\n  %w", path, err)
+		}
+	}
+	return ret, nil
+}
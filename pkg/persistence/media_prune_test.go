@@ -0,0 +1,102 @@
+package persistence_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestPruneMedia(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestPruneMedia"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// Every image has the same content (so they share a file); videos are unique
+	downloader := DefaultDownloader{Download: func(url string) ([]byte, error) {
+		if strings.HasPrefix(url, "image") {
+			return []byte("the same meme"), nil
+		}
+		return []byte(url), nil
+	}}
+	two_years_ago := Timestamp{time.Now().Add(-2 * 365 * 24 * time.Hour).Truncate(time.Second)}
+	one_year_ago := Timestamp{time.Now().Add(-365 * 24 * time.Hour)}
+	save_tweet := func(posted_at Timestamp) Tweet {
+		tweet := create_dummy_tweet()
+		tweet.PostedAt = posted_at
+		require.NoError(profile.SaveTweet(tweet))
+		require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+		return tweet
+	}
+	old_tweet := save_tweet(two_years_ago)
+	old_bookmarked_tweet := save_tweet(two_years_ago)
+	require.NoError(profile.SaveBookmark(Bookmark{SortID: -1, UserID: old_tweet.UserID, TweetID: old_bookmarked_tweet.ID}))
+	new_tweet := save_tweet(Timestamp{time.Now().Truncate(time.Second)})
+	video_path := func(tweet Tweet) string {
+		return filepath.Join(profile_path, "videos", tweet.Videos[0].LocalFilename)
+	}
+
+	// Dry run shouldn't change anything
+	policy := MediaRetentionPolicy{KeepBookmarked: true, VideosPostedBefore: one_year_ago}
+	result, err := profile.PruneMedia(policy, true)
+	require.NoError(err)
+	assert.Equal(0, result.ImagesPruned)
+	assert.Equal(1, result.VideosPruned)
+	assert.Equal(1, result.FilesDeleted)
+	assert.Equal(int64(len(old_tweet.Videos[0].RemoteURL)), result.BytesFreed)
+	assert.Equal(result.TotalSizeBefore-result.BytesFreed, result.TotalSizeAfter)
+	assert.True(file_exists(video_path(old_tweet)))
+
+	// Prune old videos
+	result, err = profile.PruneMedia(policy, false)
+	require.NoError(err)
+	assert.Equal(1, result.VideosPruned)
+	assert.Equal(1, result.TweetsAffected)
+	assert.False(file_exists(video_path(old_tweet)))
+	assert.True(file_exists(video_path(old_bookmarked_tweet)))
+	tweet, err := profile.GetTweetById(old_tweet.ID)
+	require.NoError(err)
+	assert.False(tweet.IsContentDownloaded)
+	assert.False(tweet.Videos[0].IsDownloaded)
+	assert.True(tweet.Images[0].IsDownloaded)
+
+	// Pruning old images shouldn't delete the file, since newer tweets still use it
+	policy.ImagesPostedBefore = one_year_ago
+	result, err = profile.PruneMedia(policy, false)
+	require.NoError(err)
+	assert.Equal(2, result.ImagesPruned)
+	assert.Equal(0, result.VideosPruned)
+	assert.Equal(0, result.FilesDeleted)
+	assert.Equal(int64(0), result.BytesFreed)
+	assert.True(file_exists(filepath.Join(profile_path, "images", new_tweet.Images[0].LocalFilename)))
+
+	// Size cap should prune newer tweets too, but not bookmarked ones
+	result, err = profile.PruneMedia(MediaRetentionPolicy{KeepBookmarked: true, MaxMediaSize: 1}, false)
+	require.NoError(err)
+	assert.Equal(2, result.ImagesPruned)
+	assert.Equal(1, result.VideosPruned)
+	assert.Equal(1, result.FilesDeleted)
+	assert.False(file_exists(video_path(new_tweet)))
+	tweet, err = profile.GetTweetById(old_bookmarked_tweet.ID)
+	require.NoError(err)
+	assert.True(tweet.IsContentDownloaded)
+	assert.True(tweet.Videos[0].IsDownloaded)
+	assert.True(tweet.Images[0].IsDownloaded)
+	assert.True(file_exists(filepath.Join(profile_path, "images", tweet.Images[0].LocalFilename)))
+
+	// Pruned media can be downloaded again
+	tweet, err = profile.GetTweetById(new_tweet.ID)
+	require.NoError(err)
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+	assert.True(file_exists(video_path(tweet)))
+}
@@ -13,7 +13,8 @@ func (p Profile) SaveImage(img Image) error {
 		insert into images (id, tweet_id, width, height, remote_url, local_filename, is_downloaded)
 		            values (:id, :tweet_id, :width, :height, :remote_url, :local_filename, :is_downloaded)
 		       on conflict do update
-		               set is_downloaded=(is_downloaded or :is_downloaded)
+		               set is_downloaded=(is_downloaded or :is_downloaded),
+		                   local_filename=(case when :is_downloaded then :local_filename else local_filename end)
 		`,
 		img,
 	)
@@ -35,14 +36,35 @@ func (p Profile) SaveVideo(vid Video) error {
                             :duration, :view_count, :is_downloaded, :is_blocked_by_dmca, :is_gif)
 		       on conflict do update
 		               set is_downloaded=(is_downloaded or :is_downloaded),
+		                   local_filename=(case when :is_downloaded then :local_filename else local_filename end),
+		                   thumbnail_local_filename=(case when :is_downloaded then :thumbnail_local_filename
+		                                                  else thumbnail_local_filename end),
 		                   view_count=max(view_count, :view_count),
-						   is_blocked_by_dmca = :is_blocked_by_dmca
+						   is_blocked_by_dmca = :is_blocked_by_dmca,
+		                   downloaded_height=(case when :is_downloaded then :downloaded_height else downloaded_height end),
+		                   downloaded_bitrate=(case when :is_downloaded then :downloaded_bitrate else downloaded_bitrate end),
+		                   is_audio_only=(case when :is_downloaded then :is_audio_only else is_audio_only end)
 		`,
 		vid,
 	)
 	if err != nil {
 		return fmt.Errorf("Error saving video (tweet ID %d):\n  %w", vid.TweetID, err)
 	}
+	for _, variant := range vid.Variants {
+		variant.VideoID = vid.ID
+		_, err = p.DB.NamedExec(`
+			insert into video_variants (video_id, content_type, bitrate, width, height, url)
+			                    values (:video_id, :content_type, :bitrate, :width, :height, :url)
+			       on conflict do update
+			               set content_type=:content_type,
+			                   bitrate=:bitrate,
+			                   width=:width,
+			                   height=:height
+		`, variant)
+		if err != nil {
+			return fmt.Errorf("Error saving video variant %q (tweet ID %d):\n  %w", variant.URL, vid.TweetID, err)
+		}
+	}
 	return nil
 }
 
@@ -62,7 +84,7 @@ func (p Profile) SaveUrl(url Url) error {
 	if err != nil {
 		return fmt.Errorf("Error saving Url (tweet ID %d):\n  %w", url.TweetID, err)
 	}
-	return nil
+	return p.update_tweet_search_index(url.TweetID)
 }
 
 // Save a Poll
@@ -84,7 +106,7 @@ func (p Profile) SavePoll(poll Poll) error {
 	if err != nil {
 		return fmt.Errorf("Error saving Poll (tweet ID %d):\n  %w", poll.TweetID, err)
 	}
-	return nil
+	return p.save_poll_vote_snapshot(poll)
 }
 
 // Get the list of images for a tweet
@@ -99,13 +121,28 @@ func (p Profile) GetImagesForTweet(t Tweet) (imgs []Image, err error) {
 func (p Profile) GetVideosForTweet(t Tweet) (vids []Video, err error) {
 	err = p.DB.Select(&vids, `
 		select id, tweet_id, width, height, remote_url, local_filename, thumbnail_remote_url, thumbnail_local_filename, duration,
-		       view_count, is_downloaded, is_blocked_by_dmca, is_gif
+		       view_count, is_downloaded, is_blocked_by_dmca, is_gif, downloaded_height, downloaded_bitrate, is_audio_only
 		  from videos
 		 where tweet_id = ?
 	`, t.ID)
 	return
 }
 
+// Get all the available versions of a video, best first
+func (p Profile) GetVideoVariants(video_id VideoID) []VideoVariant {
+	var ret []VideoVariant
+	err := p.DB.Select(&ret, `
+		select video_id, content_type, bitrate, width, height, url
+		  from video_variants
+		 where video_id = ?
+		 order by height desc, bitrate desc
+	`, video_id)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
 // Get the list of Urls for a Tweet
 func (p Profile) GetUrlsForTweet(t Tweet) (urls []Url, err error) {
 	err = p.DB.Select(&urls, `
@@ -0,0 +1,30 @@
+package persistence
+
+type MuteID int64
+
+type MuteType string
+
+const (
+	MUTE_TYPE_KEYWORD  = MuteType("keyword")  // Tweet text contains this word or phrase (case-insensitive)
+	MUTE_TYPE_REGEX    = MuteType("regex")    // Tweet text matches this regular expression
+	MUTE_TYPE_USER     = MuteType("user")     // Tweets and retweets by this user
+	MUTE_TYPE_RETWEETS = MuteType("retweets") // Retweets by this user (their own tweets aren't muted)
+	MUTE_TYPE_DOMAIN   = MuteType("domain")   // Tweets with links to this domain or its subdomains
+	MUTE_TYPE_HASHTAG  = MuteType("hashtag")  // Tweets with this hashtag
+)
+
+var MUTE_TYPES = []MuteType{
+	MUTE_TYPE_KEYWORD, MUTE_TYPE_REGEX, MUTE_TYPE_USER, MUTE_TYPE_RETWEETS, MUTE_TYPE_DOMAIN, MUTE_TYPE_HASHTAG,
+}
+
+func (t MuteType) IsUserMute() bool {
+	return t == MUTE_TYPE_USER || t == MUTE_TYPE_RETWEETS
+}
+
+// A rule for hiding tweets from local feeds
+type Mute struct {
+	ID     MuteID   `db:"rowid"`
+	Type   MuteType `db:"type"`
+	Text   string   `db:"text"`    // For keyword, regex, domain and hashtag mutes
+	UserID UserID   `db:"user_id"` // For user and retweets mutes
+}
@@ -0,0 +1,217 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrInvalidMute  = errors.New("invalid mute")
+	ErrAlreadyMuted = errors.New("already muted")
+)
+
+// Add a mute rule.  Keywords, domains and hashtags are cleaned up first (e.g., "#" is removed from
+// hashtags, and domains can be given as a URL); regexes have to be valid.
+func (p Profile) SaveMute(m *Mute) error {
+	m.Text = strings.TrimSpace(m.Text)
+	switch m.Type {
+	case MUTE_TYPE_KEYWORD:
+	case MUTE_TYPE_REGEX:
+		if _, err := regexp.Compile(m.Text); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidMute, err.Error())
+		}
+	case MUTE_TYPE_DOMAIN:
+		if strings.Contains(m.Text, "://") {
+			m.Text = Url{Text: m.Text}.GetDomain()
+		}
+		m.Text = normalize_domain(m.Text)
+	case MUTE_TYPE_HASHTAG:
+		m.Text = strings.TrimPrefix(m.Text, "#")
+	case MUTE_TYPE_USER, MUTE_TYPE_RETWEETS:
+		if m.UserID == UserID(0) {
+			return fmt.Errorf("%w: no user given", ErrInvalidMute)
+		}
+		m.Text = ""
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidMute, m.Type)
+	}
+	if !m.Type.IsUserMute() {
+		if m.Text == "" {
+			return fmt.Errorf("%w: no %s given", ErrInvalidMute, m.Type)
+		}
+		m.UserID = UserID(0)
+	}
+
+	result, err := p.DB.NamedExec(`insert into mutes (type, text, user_id) values (:type, :text, :user_id)`, m)
+	var sqlite_err sqlite3.Error
+	if errors.As(err, &sqlite_err) && sqlite_err.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrAlreadyMuted
+	} else if err != nil {
+		panic(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		panic(err)
+	}
+	m.ID = MuteID(id)
+	return nil
+}
+
+func (p Profile) DeleteMute(id MuteID) {
+	_, err := p.DB.Exec(`delete from mutes where rowid = ?`, id)
+	if err != nil {
+		panic(fmt.Errorf("Error executing DeleteMute(%d):\n  %w", id, err))
+	}
+}
+
+func (p Profile) GetAllMutes() []Mute {
+	var ret []Mute
+	err := p.DB.Select(&ret, `select rowid, type, text, user_id from mutes order by type, text, rowid`)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Compile mute rules into SQL "where" clauses that exclude the muted tweets, with their bind values.
+// If `is_feed` is true, they're for a feed query (see `NextPage`), which includes retweets (with
+// `retweet_id` and `by_user_id` fields); otherwise they only apply to tweets.
+//
+// Retweets of tweets that aren't in the database have no `tweets` fields, so those are null-checked.
+func mute_where_clauses(mutes []Mute, is_feed bool) ([]string, []interface{}) {
+	where_clauses := []string{}
+	bind_values := []interface{}{}
+	for _, m := range mutes {
+		switch m.Type {
+		case MUTE_TYPE_KEYWORD:
+			where_clauses = append(where_clauses, "not regexp(?, ifnull(tweets.text, ''))")
+			bind_values = append(bind_values, keyword_mute_regex(m.Text))
+		case MUTE_TYPE_REGEX:
+			where_clauses = append(where_clauses, "not regexp(?, ifnull(tweets.text, ''))")
+			bind_values = append(bind_values, m.Text)
+		case MUTE_TYPE_USER:
+			where_clauses = append(where_clauses, "ifnull(tweets.user_id, 0) != ?")
+			bind_values = append(bind_values, m.UserID)
+			if is_feed {
+				where_clauses = append(where_clauses, "by_user_id != ?")
+				bind_values = append(bind_values, m.UserID)
+			}
+		case MUTE_TYPE_RETWEETS:
+			if is_feed {
+				where_clauses = append(where_clauses, "(retweet_id = 0 or by_user_id != ?)")
+				bind_values = append(bind_values, m.UserID)
+			}
+		case MUTE_TYPE_DOMAIN:
+			where_clauses = append(where_clauses, `not exists (
+			    select 1 from urls
+			     where urls.tweet_id = tweets.id
+			       and (url_domain(urls.domain, urls.text) = ? or url_domain(urls.domain, urls.text) like ?))`)
+			bind_values = append(bind_values, m.Text, "%."+m.Text)
+		case MUTE_TYPE_HASHTAG:
+			where_clauses = append(where_clauses,
+				"not exists (select 1 from hashtags where hashtags.tweet_id = tweets.id and lower(hashtags.text) = lower(?))")
+			bind_values = append(bind_values, m.Text)
+		default:
+			panic(fmt.Sprintf("Invalid mute type: %q", m.Type))
+		}
+	}
+	return where_clauses, bind_values
+}
+
+// Find which of the given tweets and retweets are hidden by the mute rules.  Retweets are hidden if
+// the tweet is, or if the retweeter (or their retweets) is muted.  Returns tweet IDs and retweet IDs
+// together, since they can't collide.
+func (p Profile) get_muted_tweet_and_retweet_ids(tweet_ids []TweetID, retweets []Retweet, mutes []Mute) map[TweetID]bool {
+	ret := map[TweetID]bool{}
+	mute_clauses, mute_bind_values := mute_where_clauses(mutes, false)
+	if len(mute_clauses) == 0 {
+		return ret
+	}
+	if len(tweet_ids) != 0 {
+		q, bind_values, err := sqlx.In(`select id from tweets where id in (?) and not (`+strings.Join(mute_clauses, " and ")+`)`,
+			append([]interface{}{tweet_ids}, mute_bind_values...)...)
+		if err != nil {
+			panic(err)
+		}
+		var muted_ids []TweetID
+		if err := p.DB.Select(&muted_ids, q, bind_values...); err != nil {
+			panic(err)
+		}
+		for _, id := range muted_ids {
+			ret[id] = true
+		}
+	}
+
+	is_retweeter_muted := map[UserID]bool{}
+	for _, m := range mutes {
+		if m.Type == MUTE_TYPE_USER || m.Type == MUTE_TYPE_RETWEETS {
+			is_retweeter_muted[m.UserID] = true
+		}
+	}
+	for _, r := range retweets {
+		if ret[r.TweetID] || is_retweeter_muted[r.RetweetedByID] {
+			ret[r.RetweetID] = true
+		}
+	}
+	return ret
+}
+
+// Keyword mutes match whole words (or phrases), case-insensitively; e.g., muting "cat" doesn't hide
+// "category".  Keywords that start or end with punctuation (e.g., "c++") don't need a word boundary there.
+func keyword_mute_regex(keyword string) string {
+	const non_word_char = `[^\pL\pN_]`
+	is_word_char := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'
+	}
+	ret := regexp.QuoteMeta(keyword)
+	if first, _ := utf8.DecodeRuneInString(keyword); is_word_char(first) {
+		ret = `(?:^|` + non_word_char + `)` + ret
+	}
+	if last, _ := utf8.DecodeLastRuneInString(keyword); is_word_char(last) {
+		ret += `(?:$|` + non_word_char + `)`
+	}
+	return "(?i)" + ret
+}
+
+func normalize_domain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(domain), "www.")
+}
+
+// SQL functions for applying mutes; see `SQLITE_DRIVER_NAME`
+// ----------------------------------------------------------
+
+// Compiled regexes, since the function is called for every row
+var sql_regexp_cache sync.Map
+
+// Whether `s` matches the regex `pattern`.  Invalid regexes don't match anything.
+func sql_regexp(pattern string, s string) bool {
+	re, is_ok := sql_regexp_cache.Load(pattern)
+	if !is_ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return false
+		}
+		re, _ = sql_regexp_cache.LoadOrStore(pattern, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(s)
+}
+
+// The normalized domain of a link (see `Url.GetDomain`)
+func sql_url_domain(domain string, text string) string {
+	if domain == "" {
+		// Avoid panicking in `GetDomain` on an invalid URL
+		if _, err := url.Parse(text); err != nil {
+			return ""
+		}
+	}
+	return normalize_domain(Url{Domain: domain, Text: text}.GetDomain())
+}
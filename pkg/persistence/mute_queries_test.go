@@ -0,0 +1,230 @@
+package persistence_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestSaveMuteValidation(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	profile_path := "test_profiles/TestMutes"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// Hashtags and domains get cleaned up
+	hashtag_mute := Mute{Type: MUTE_TYPE_HASHTAG, Text: " #Spoilers "}
+	require.NoError(profile.SaveMute(&hashtag_mute))
+	assert.NotEqual(MuteID(0), hashtag_mute.ID)
+	assert.Equal("Spoilers", hashtag_mute.Text)
+	domain_mute := Mute{Type: MUTE_TYPE_DOMAIN, Text: "https://www.Example.com/some/page"}
+	require.NoError(profile.SaveMute(&domain_mute))
+	assert.Equal("example.com", domain_mute.Text)
+
+	// Invalid mutes
+	assert.ErrorIs(profile.SaveMute(&Mute{Type: MUTE_TYPE_REGEX, Text: "(asdf"}), ErrInvalidMute)
+	assert.ErrorIs(profile.SaveMute(&Mute{Type: MUTE_TYPE_KEYWORD, Text: "  "}), ErrInvalidMute)
+	assert.ErrorIs(profile.SaveMute(&Mute{Type: MUTE_TYPE_USER}), ErrInvalidMute)
+	assert.ErrorIs(profile.SaveMute(&Mute{Type: MuteType("asdf"), Text: "asdf"}), ErrInvalidMute)
+	assert.ErrorIs(profile.SaveMute(&Mute{Type: MUTE_TYPE_HASHTAG, Text: "#Spoilers"}), ErrAlreadyMuted)
+
+	mutes := profile.GetAllMutes()
+	require.Len(mutes, 2)
+	profile.DeleteMute(hashtag_mute.ID)
+	assert.Len(profile.GetAllMutes(), 1)
+}
+
+func TestMutesInFeed(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	profile_path := "test_profiles/TestMutesInFeed"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	user := create_dummy_user()
+	require.NoError(profile.SaveUser(&user))
+	retweeter := create_dummy_user()
+	require.NoError(profile.SaveUser(&retweeter))
+	make_tweet := func(text string) Tweet {
+		tweet := create_dummy_tweet()
+		tweet.UserID = user.ID
+		tweet.Text = text
+		tweet.Urls = []Url{}
+		tweet.Hashtags = CommaSeparatedList{}
+		return tweet
+	}
+
+	plain := make_tweet("nothing to see here")
+	keyword := make_tweet("I like ANCHOVIES on pizza")
+	regex := make_tweet("it only costs $42")
+	domain := make_tweet("check out this link")
+	link := create_url_from_id(1)
+	link.TweetID = domain.ID
+	link.Domain = ""
+	link.Text = "https://news.example.com/article"
+	domain.Urls = []Url{link}
+	hashtag := make_tweet("no spoilers please")
+	hashtag.Hashtags = CommaSeparatedList{"SpoilerAlert"}
+	for _, tweet := range []Tweet{plain, keyword, regex, domain, hashtag} {
+		require.NoError(profile.SaveTweet(tweet))
+	}
+	retweet := create_dummy_retweet(plain.ID)
+	retweet.RetweetedByID = retweeter.ID
+	require.NoError(profile.SaveRetweet(retweet))
+
+	c := NewCursor()
+	c.FilterRetweets = NONE
+	get_items := func() []FeedItem {
+		feed, err := profile.NextPage(c, UserID(0))
+		require.NoError(err)
+		// Skip the tweets that `create_or_load_profile` adds
+		ret := []FeedItem{}
+		for _, item := range feed.Items {
+			if feed.Tweets[item.TweetID].UserID == user.ID {
+				ret = append(ret, item)
+			}
+		}
+		return ret
+	}
+	require.Len(get_items(), 6)
+
+	for _, m := range []Mute{
+		{Type: MUTE_TYPE_KEYWORD, Text: "anchovies"},
+		{Type: MUTE_TYPE_REGEX, Text: `\$\d+`},
+		{Type: MUTE_TYPE_DOMAIN, Text: "example.com"},
+		{Type: MUTE_TYPE_HASHTAG, Text: "spoileralert"},
+		{Type: MUTE_TYPE_RETWEETS, UserID: retweeter.ID},
+	} {
+		require.NoError(profile.SaveMute(&m))
+	}
+	items := get_items()
+	require.Len(items, 1)
+	assert.Equal(FeedItem{TweetID: plain.ID}, items[0])
+
+	// Muting the user hides everything
+	user_mute := Mute{Type: MUTE_TYPE_USER, UserID: user.ID}
+	require.NoError(profile.SaveMute(&user_mute))
+	assert.Len(get_items(), 0)
+
+	// Unless muted tweets are shown
+	c.ShowMuted = true
+	assert.Len(get_items(), 6)
+}
+
+func TestMutesInTweetDetailReplies(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	profile_path := "test_profiles/TestMutesInFeed"
+	profile := create_or_load_profile(profile_path)
+
+	replier := create_dummy_user()
+	require.NoError(profile.SaveUser(&replier))
+	main_tweet := create_dummy_tweet()
+	require.NoError(profile.SaveTweet(main_tweet))
+	reply := create_dummy_tweet()
+	reply.UserID = replier.ID
+	reply.InReplyToID = main_tweet.ID
+	require.NoError(profile.SaveTweet(reply))
+
+	tweet_detail, err := profile.GetTweetDetail(main_tweet.ID, UserID(0), false)
+	require.NoError(err)
+	assert.Len(tweet_detail.ReplyChains, 1)
+
+	m := Mute{Type: MUTE_TYPE_USER, UserID: replier.ID}
+	require.NoError(profile.SaveMute(&m))
+	tweet_detail, err = profile.GetTweetDetail(main_tweet.ID, UserID(0), false)
+	require.NoError(err)
+	assert.Len(tweet_detail.ReplyChains, 0)
+
+	tweet_detail, err = profile.GetTweetDetail(main_tweet.ID, UserID(0), true)
+	require.NoError(err)
+	assert.Len(tweet_detail.ReplyChains, 1)
+}
+
+func TestMutesInNotifications(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	profile_path := "test_profiles/TestMutesInNotifications"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	me := create_dummy_user()
+	require.NoError(profile.SaveUser(&me))
+	author := create_dummy_user()
+	require.NoError(profile.SaveUser(&author))
+	retweeter := create_dummy_user()
+	require.NoError(profile.SaveUser(&retweeter))
+	make_tweet := func(text string) Tweet {
+		tweet := create_dummy_tweet()
+		tweet.UserID = author.ID
+		tweet.Text = text
+		require.NoError(profile.SaveTweet(tweet))
+		return tweet
+	}
+	plain := make_tweet("nothing to see here")
+	muted := make_tweet("I like anchovies on pizza")
+	not_muted := make_tweet("I like anchoviesque pizza") // Keywords match whole words
+	retweet := create_dummy_retweet(plain.ID)
+	retweet.RetweetedByID = retweeter.ID
+	require.NoError(profile.SaveRetweet(retweet))
+
+	make_notification := func(sort_index int64, tweet_id TweetID, retweet_id TweetID) Notification {
+		n := create_dummy_notification()
+		n.UserID = me.ID
+		n.ActionUserID = author.ID
+		n.SortIndex = sort_index
+		n.ActionTweetID = tweet_id
+		n.ActionRetweetID = retweet_id
+		n.TweetIDs = []TweetID{}
+		n.UserIDs = []UserID{}
+		n.RetweetIDs = []TweetID{}
+		profile.SaveNotification(n)
+		return n
+	}
+	n_plain := make_notification(4, plain.ID, 0)
+	make_notification(3, muted.ID, 0)
+	n_not_muted := make_notification(2, not_muted.ID, 0)
+	n_retweet := make_notification(1, 0, retweet.RetweetID)
+
+	for _, m := range []Mute{
+		{Type: MUTE_TYPE_KEYWORD, Text: "anchovies"},
+		{Type: MUTE_TYPE_RETWEETS, UserID: retweeter.ID},
+	} {
+		require.NoError(profile.SaveMute(&m))
+	}
+	get_notification_ids := func(feed Feed) []NotificationID {
+		ret := []NotificationID{}
+		for _, item := range feed.Items {
+			ret = append(ret, item.NotificationID)
+		}
+		return ret
+	}
+
+	feed := profile.GetNotificationsForUser(me.ID, 0, 10, false)
+	assert.Equal([]NotificationID{n_plain.ID, n_not_muted.ID}, get_notification_ids(feed))
+	assert.NotContains(feed.Tweets, muted.ID)
+	assert.NotContains(feed.Retweets, retweet.RetweetID)
+	assert.Equal(CURSOR_END, feed.CursorBottom.CursorPosition)
+
+	// Muted notifications still count toward the page size, so a short page isn't the end
+	feed = profile.GetNotificationsForUser(me.ID, 0, 2, false)
+	assert.Equal([]NotificationID{n_plain.ID}, get_notification_ids(feed))
+	assert.Equal(CURSOR_MIDDLE, feed.CursorBottom.CursorPosition)
+	assert.Equal(3, feed.CursorBottom.CursorValue)
+
+	// Unless muted tweets are shown
+	feed = profile.GetNotificationsForUser(me.ID, 0, 10, true)
+	assert.Len(feed.Items, 4)
+	assert.Equal(n_retweet.ID, feed.Items[3].NotificationID)
+}
@@ -53,7 +53,7 @@ func NewProfile(target_dir string) (Profile, error) {
 
 	// Create `twitter.db`
 	fmt.Printf("Creating............. %s\n", sqlite_file)
-	db := sqlx.MustOpen("sqlite3", sqlite_file+"?_foreign_keys=on")
+	db := sqlx.MustOpen(SQLITE_DRIVER_NAME, sqlite_file+"?_foreign_keys=on")
 	db.MustExec(sql_init)
 
 	// Create `profile_images`
@@ -108,19 +108,27 @@ func NewProfile(target_dir string) (Profile, error) {
 // returns:
 // - the loaded Profile
 func LoadProfile(profile_dir string) (Profile, error) {
+	ret, err := open_profile(profile_dir)
+	if err != nil {
+		return ret, err
+	}
+	err = ret.check_and_update_version()
+	return ret, err
+}
+
+// Open the profile's database, without checking its version
+func open_profile(profile_dir string) (Profile, error) {
 	sqlite_file := filepath.Join(profile_dir, "twitter.db")
 	if !file_exists(sqlite_file) {
 		return Profile{}, fmt.Errorf("Invalid profile, could not find file: %s", sqlite_file)
 	}
 
-	db := sqlx.MustOpen("sqlite3", fmt.Sprintf("%s?_foreign_keys=on&_journal_mode=WAL", sqlite_file))
+	db := sqlx.MustOpen(SQLITE_DRIVER_NAME, fmt.Sprintf("%s?_foreign_keys=on&_journal_mode=WAL", sqlite_file))
 
-	ret := Profile{
+	return Profile{
 		ProfileDir: profile_dir,
 		DB:         db,
-	}
-	err := ret.check_and_update_version()
-	return ret, err
+	}, nil
 }
 
 func (p Profile) ListSessions() []UserHandle {
@@ -0,0 +1,450 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ProfileIssueKind string
+
+const (
+	// A row is marked as downloaded, but the file isn't there
+	ISSUE_MISSING_MEDIA_FILE = ProfileIssueKind("missing media file")
+	// A file in one of the media directories that no row refers to
+	ISSUE_ORPHANED_MEDIA_FILE = ProfileIssueKind("orphaned media file")
+	// A row refers to a tweet, user, etc. that isn't in the database
+	ISSUE_DANGLING_REFERENCE = ProfileIssueKind("dangling reference")
+	// A user with a fake ID, whose real ID is known because there's a real user with the same handle
+	ISSUE_RESOLVABLE_FAKE_USER_ID = ProfileIssueKind("resolvable fake user ID")
+)
+
+// An inconsistency found in a Profile by `CheckProfile`
+type ProfileIssue struct {
+	Kind        ProfileIssueKind
+	Description string
+	IsRepaired  bool
+}
+
+// Columns that contain a user ID.  Used for re-pointing references from one user to another.
+var user_id_columns = []struct {
+	table  string
+	column string
+}{
+	{"tweets", "user_id"},
+	{"retweets", "retweeted_by"},
+	{"likes", "user_id"},
+	{"bookmarks", "user_id"},
+	{"follows", "follower_id"},
+	{"follows", "followee_id"},
+	{"list_users", "user_id"},
+	{"spaces", "created_by_id"},
+	{"space_participants", "user_id"},
+	{"chat_rooms", "created_by_user_id"},
+	{"chat_room_participants", "user_id"},
+	{"chat_messages", "sender_id"},
+	{"chat_message_reactions", "sender_id"},
+	{"notifications", "user_id"},
+	{"notifications", "action_user_id"},
+	{"notification_users", "user_id"},
+	{"user_profile_history", "user_id"},
+	{"mutes", "user_id"},
+}
+
+// Tables whose rows can be deleted without losing anything important, if they refer to something that
+// doesn't exist.  Other tables' dangling references are only reported.
+//
+// `space_participants` isn't included, since its users are deliberately not required to be downloaded;
+// fetching them is the fix.
+var tables_deletable_if_dangling = map[string]bool{
+	"likes":                      true,
+	"bookmarks":                  true,
+	"retweets":                   true,
+	"follows":                    true,
+	"list_users":                 true,
+	"hashtags":                   true,
+	"images":                     true,
+	"videos":                     true,
+	"urls":                       true,
+	"polls":                      true,
+	"poll_vote_snapshots":        true,
+	"tweet_engagement_snapshots": true,
+	"user_profile_history":       true,
+	"chat_message_reactions":     true,
+	"notification_tweets":        true,
+	"notification_retweets":      true,
+	"notification_users":         true,
+}
+
+// Re-point everything that refers to user `from_id` to user `to_id` instead.  Rows that would become
+// duplicates (e.g., both users liked the same tweet) are dropped.
+func remap_user_id(tx *sqlx.Tx, from_id UserID, to_id UserID) error {
+	for _, c := range user_id_columns {
+		_, err := tx.Exec(`update or ignore `+c.table+` set `+c.column+` = ? where `+c.column+` = ?`, to_id, from_id)
+		if err != nil {
+			return fmt.Errorf("Error updating %s.%s from user %d to %d:\n  %w", c.table, c.column, from_id, to_id, err)
+		}
+		_, err = tx.Exec(`delete from `+c.table+` where `+c.column+` = ?`, from_id)
+		if err != nil {
+			return fmt.Errorf("Error deleting leftover %s.%s for user %d:\n  %w", c.table, c.column, from_id, err)
+		}
+	}
+	return nil
+}
+
+var ErrMediaDownloadsInProgress = errors.New("media downloads are in progress")
+
+// Files modified more recently than this might still be being written (e.g., by a download in
+// another process), so they're never treated as orphaned
+const MIN_ORPHANED_MEDIA_FILE_AGE = time.Hour
+
+// Check a Profile for inconsistencies between the database and the media directories, and within
+// the database.  If `should_repair` is true, fix the ones that can be fixed automatically:
+//
+//   - missing media files are marked as not downloaded, so they'll be downloaded again
+//   - orphaned media files are deleted
+//   - rows with dangling references are deleted, if they're in a "link" table (e.g., likes)
+//   - fake user IDs are replaced with the real ID everywhere
+//
+// Repairing isn't done while there are media downloads queued, since files being downloaded would
+// look orphaned or missing; it returns `ErrMediaDownloadsInProgress` instead.
+func (p Profile) CheckProfile(should_repair bool) ([]ProfileIssue, error) {
+	if should_repair {
+		num_ready, num_waiting_to_retry, _ := p.CountQueuedMediaDownloads()
+		if num_ready+num_waiting_to_retry > 0 {
+			return nil, fmt.Errorf("%w (%d queued); try again once they're finished", ErrMediaDownloadsInProgress,
+				num_ready+num_waiting_to_retry)
+		}
+	}
+	ret := []ProfileIssue{}
+	for _, check := range []func(bool) ([]ProfileIssue, error){
+		p.check_missing_media_files,
+		p.check_orphaned_media_files,
+		p.check_dangling_references,
+		p.check_resolvable_fake_user_ids,
+	} {
+		issues, err := check(should_repair)
+		ret = append(ret, issues...)
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// Media that's supposed to be on disk.  The query selects the subdirectory, filename, rowid and the
+// ID of the tweet or message it belongs to; the `fixes` mark it as not downloaded (given the rowid).
+var downloaded_media_queries = []struct {
+	description string
+	query       string
+	fixes       []string
+}{
+	{"image %q (tweet %d)",
+		`select 'images', local_filename, rowid, tweet_id from images where is_downloaded = 1`,
+		[]string{
+			`update images set is_downloaded = 0 where rowid = ?`,
+			`update tweets set is_content_downloaded = 0 where id = (select tweet_id from images where rowid = ?)`,
+		}},
+	{"video %q (tweet %d)",
+		`select 'videos', local_filename, rowid, tweet_id from videos where is_downloaded = 1
+		 union all
+		select 'video_thumbnails', thumbnail_local_filename, rowid, tweet_id from videos
+		 where is_downloaded = 1 and thumbnail_local_filename not in ('', 'missing')`,
+		[]string{
+			`update videos set is_downloaded = 0 where rowid = ?`,
+			`update tweets set is_content_downloaded = 0 where id = (select tweet_id from videos where rowid = ?)`,
+		}},
+	{"link preview image %q (tweet %d)",
+		`select 'link_preview_images', thumbnail_local_path, rowid, tweet_id from urls
+		 where is_content_downloaded = 1 and has_thumbnail = 1`,
+		[]string{
+			`update urls set is_content_downloaded = 0 where rowid = ?`,
+			`update tweets set is_content_downloaded = 0 where id = (select tweet_id from urls where rowid = ?)`,
+		}},
+	{"DM image %q (message %d)",
+		`select 'images', local_filename, rowid, chat_message_id from chat_message_images where is_downloaded = 1`,
+		[]string{`update chat_message_images set is_downloaded = 0 where rowid = ?`}},
+	{"DM video %q (message %d)",
+		`select 'videos', local_filename, rowid, chat_message_id from chat_message_videos where is_downloaded = 1`,
+		[]string{`update chat_message_videos set is_downloaded = 0 where rowid = ?`}},
+}
+
+// Find things marked as downloaded whose files are missing
+func (p Profile) check_missing_media_files(should_repair bool) ([]ProfileIssue, error) {
+	ret := []ProfileIssue{}
+	for _, q := range downloaded_media_queries {
+		rows, err := p.DB.Query(q.query)
+		if err != nil {
+			panic(err)
+		}
+		type missing_file struct {
+			filename string
+			rowid    int64
+			owner_id int64
+		}
+		missing := []missing_file{}
+		for rows.Next() {
+			var subdir string
+			var m missing_file
+			if err := rows.Scan(&subdir, &m.filename, &m.rowid, &m.owner_id); err != nil {
+				panic(err)
+			}
+			if !file_exists(filepath.Join(p.ProfileDir, subdir, m.filename)) {
+				missing = append(missing, m)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			panic(err)
+		}
+		rows.Close()
+
+		for _, m := range missing {
+			issue := ProfileIssue{Kind: ISSUE_MISSING_MEDIA_FILE, Description: fmt.Sprintf(q.description, m.filename, m.owner_id)}
+			if should_repair {
+				for _, fix := range q.fixes {
+					if _, err := p.DB.Exec(fix, m.rowid); err != nil {
+						return append(ret, issue), fmt.Errorf("Error marking %s as not downloaded:\n  %w", issue.Description, err)
+					}
+				}
+				issue.IsRepaired = true
+			}
+			ret = append(ret, issue)
+		}
+	}
+
+	// Users' profile and banner images
+	var users []User
+	err := p.DB.Select(&users, `select `+USERS_ALL_SQL_FIELDS+` from users where is_content_downloaded = 1`)
+	if err != nil {
+		panic(err)
+	}
+	for _, u := range users {
+		if file_exists(p.get_profile_image_output_path(u)) &&
+			(u.BannerImageLocalPath == "" || file_exists(p.get_banner_image_output_path(u))) {
+			continue
+		}
+		issue := ProfileIssue{Kind: ISSUE_MISSING_MEDIA_FILE, Description: fmt.Sprintf("profile images for user %q", u.Handle)}
+		if should_repair {
+			if _, err := p.DB.Exec(`update users set is_content_downloaded = 0 where id = ?`, u.ID); err != nil {
+				return append(ret, issue), fmt.Errorf("Error marking %s as not downloaded:\n  %w", issue.Description, err)
+			}
+			issue.IsRepaired = true
+		}
+		ret = append(ret, issue)
+	}
+	return ret, nil
+}
+
+// Media directories, and the columns that refer to files in them.  Profile images aren't checked,
+// since some of their filenames (e.g., tiny profile images) aren't stored anywhere.  Superseded video
+// files are kept on purpose (see `UpgradeTweetVideos`), so they count as referenced.
+var media_file_references = map[string]string{
+	"images": `select local_filename from images
+	            union
+	           select local_filename from chat_message_images`,
+	"videos": `select local_filename from videos
+	            union
+	           select local_filename from chat_message_videos
+	            union
+	           select local_filename from superseded_media_files where subdir = 'videos'`,
+	"video_thumbnails": `select thumbnail_local_filename from videos
+	                      union
+	                     select thumbnail_local_filename from chat_message_videos
+	                      union
+	                     select local_filename from superseded_media_files where subdir = 'video_thumbnails'`,
+	"link_preview_images": `select thumbnail_local_path from urls where thumbnail_local_path is not null
+	                         union
+	                        select thumbnail_local_path from chat_message_urls where thumbnail_local_path is not null`,
+}
+
+// Find files in the media directories that nothing refers to.  Temp files and recently modified files
+// are skipped, since they might belong to a download that's still in progress.
+func (p Profile) check_orphaned_media_files(should_repair bool) ([]ProfileIssue, error) {
+	ret := []ProfileIssue{}
+	for _, subdir := range []string{"images", "videos", "video_thumbnails", "link_preview_images"} {
+		var filenames []string
+		if err := p.DB.Select(&filenames, media_file_references[subdir]); err != nil {
+			panic(err)
+		}
+		is_referenced := map[string]bool{}
+		for _, f := range filenames {
+			is_referenced[filepath.Clean(filepath.FromSlash(f))] = true
+		}
+
+		dir := filepath.Join(p.ProfileDir, subdir)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && path == dir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel_path, err := filepath.Rel(dir, path)
+			if err != nil {
+				panic(err)
+			}
+			if is_referenced[rel_path] || strings.HasSuffix(rel_path, ".tmp") {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if time.Since(info.ModTime()) < MIN_ORPHANED_MEDIA_FILE_AGE {
+				return nil
+			}
+			issue := ProfileIssue{Kind: ISSUE_ORPHANED_MEDIA_FILE, Description: filepath.Join(subdir, rel_path)}
+			if should_repair {
+				if err := os.Remove(path); err != nil {
+					ret = append(ret, issue)
+					return fmt.Errorf("Error deleting orphaned file %q:\n  %w", path, err)
+				}
+				issue.IsRepaired = true
+			}
+			ret = append(ret, issue)
+			return nil
+		})
+		if err != nil {
+			return ret, fmt.Errorf("Error checking %s directory:\n  %w", subdir, err)
+		}
+	}
+	return ret, nil
+}
+
+// Find rows that refer to things that aren't in the database
+func (p Profile) check_dangling_references(should_repair bool) ([]ProfileIssue, error) {
+	type dangling_reference struct {
+		Table  string `db:"table"`
+		RowID  int64  `db:"rowid"`
+		Parent string `db:"parent"`
+	}
+	find_dangling_references := func() []dangling_reference {
+		ret := []dangling_reference{}
+		rows, err := p.DB.Query(`pragma foreign_key_check`)
+		if err != nil {
+			panic(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r dangling_reference
+			var fkid int
+			if err := rows.Scan(&r.Table, &r.RowID, &r.Parent, &fkid); err != nil {
+				panic(err)
+			}
+			ret = append(ret, r)
+		}
+		if err := rows.Err(); err != nil {
+			panic(err)
+		}
+
+		// `space_participants` has no foreign key for users
+		var rowids []int64
+		err = p.DB.Select(&rowids, `select rowid from space_participants where user_id not in (select id from users)`)
+		if err != nil {
+			panic(err)
+		}
+		for _, rowid := range rowids {
+			ret = append(ret, dangling_reference{"space_participants", rowid, "users"})
+		}
+		return ret
+	}
+
+	ret := []ProfileIssue{}
+	issue_indexes := map[dangling_reference]int{}
+	add_issues := func(dangling_refs []dangling_reference) {
+		for _, r := range dangling_refs {
+			if _, is_ok := issue_indexes[r]; is_ok {
+				continue
+			}
+			issue_indexes[r] = len(ret)
+			ret = append(ret, ProfileIssue{
+				Kind:        ISSUE_DANGLING_REFERENCE,
+				Description: fmt.Sprintf("%s (rowid %d) refers to a missing row in %s", r.Table, r.RowID, r.Parent),
+			})
+		}
+	}
+	dangling_refs := find_dangling_references()
+	add_issues(dangling_refs)
+	if !should_repair {
+		return ret, nil
+	}
+
+	// Deleting a row can leave other rows dangling (e.g., a notification's retweet), so repeat until
+	// there's nothing else to delete
+	for {
+		num_deleted := 0
+		for _, r := range dangling_refs {
+			issue := &ret[issue_indexes[r]]
+			if !tables_deletable_if_dangling[r.Table] || issue.IsRepaired {
+				continue
+			}
+			if _, err := p.DB.Exec(`delete from `+r.Table+` where rowid = ?`, r.RowID); err != nil {
+				return ret, fmt.Errorf("Error deleting dangling row %d from %s:\n  %w", r.RowID, r.Table, err)
+			}
+			issue.IsRepaired = true
+			num_deleted += 1
+		}
+		if num_deleted == 0 {
+			return ret, nil
+		}
+		dangling_refs = find_dangling_references()
+		add_issues(dangling_refs)
+	}
+}
+
+// Find users with fake IDs, whose real ID is known because a real user has the same handle.  (Handles
+// are compared case-insensitively, so they can end up with both)
+func (p Profile) check_resolvable_fake_user_ids(should_repair bool) ([]ProfileIssue, error) {
+	var pairs []struct {
+		FakeID UserID     `db:"fake_id"`
+		RealID UserID     `db:"real_id"`
+		Handle UserHandle `db:"handle"`
+	}
+	err := p.DB.Select(&pairs, `
+		select fake_users.id fake_id, max(real_users.id) real_id, real_users.handle
+		  from users fake_users
+		  join users real_users on lower(fake_users.handle) = lower(real_users.handle)
+		                       and real_users.is_id_fake = 0
+		 where fake_users.is_id_fake = 1 and fake_users.id != ?
+		 group by fake_users.id`, GetUnknownUser().ID)
+	if err != nil {
+		panic(err)
+	}
+
+	ret := []ProfileIssue{}
+	for _, pair := range pairs {
+		issue := ProfileIssue{
+			Kind:        ISSUE_RESOLVABLE_FAKE_USER_ID,
+			Description: fmt.Sprintf("user %q has fake ID %d; real ID is %d", pair.Handle, pair.FakeID, pair.RealID),
+		}
+		if should_repair {
+			tx, err := p.DB.Beginx()
+			if err != nil {
+				panic(err)
+			}
+			err = remap_user_id(tx, pair.FakeID, pair.RealID)
+			if err == nil {
+				_, err = tx.Exec(`delete from users where id = ?`, pair.FakeID)
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				return append(ret, issue), fmt.Errorf("Error replacing fake user ID %d:\n  %w", pair.FakeID, err)
+			}
+			if err := tx.Commit(); err != nil {
+				panic(err)
+			}
+			issue.IsRepaired = true
+		}
+		ret = append(ret, issue)
+	}
+	return ret, nil
+}
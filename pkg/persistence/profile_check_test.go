@@ -0,0 +1,175 @@
+package persistence_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestCheckProfile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestCheckProfile"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// A new profile should be fine
+	issues, err := profile.CheckProfile(false)
+	require.NoError(err)
+	assert.Len(issues, 0)
+
+	// Media marked as downloaded, but the files aren't there
+	tweet := create_dummy_tweet()
+	tweet.Images = tweet.Images[:1]
+	tweet.Images[0].IsDownloaded = true
+	tweet.Videos = []Video{}
+	tweet.IsContentDownloaded = true
+	require.NoError(profile.SaveTweet(tweet))
+
+	// A file nothing refers to
+	orphan_path := filepath.Join(profile_path, "images", "ab", "abcdefg.jpg")
+	require.NoError(os.MkdirAll(filepath.Dir(orphan_path), 0755))
+	require.NoError(os.WriteFile(orphan_path, []byte("asdf"), 0644))
+	an_hour_ago := time.Now().Add(-MIN_ORPHANED_MEDIA_FILE_AGE)
+	require.NoError(os.Chtimes(orphan_path, an_hour_ago, an_hour_ago))
+
+	// Files that might belong to a download in progress shouldn't count as orphaned
+	recent_path := filepath.Join(profile_path, "images", "ab", "recent.jpg")
+	require.NoError(os.WriteFile(recent_path, []byte("asdf"), 0644))
+	temp_path := filepath.Join(profile_path, "videos", "hls-1234.tmp")
+	require.NoError(os.MkdirAll(filepath.Dir(temp_path), 0755))
+	require.NoError(os.WriteFile(temp_path, []byte("asdf"), 0644))
+	require.NoError(os.Chtimes(temp_path, an_hour_ago, an_hour_ago))
+
+	// A Like of a tweet that doesn't exist (have to turn off foreign keys to create it)
+	conn, err := profile.DB.Conn(context.Background())
+	require.NoError(err)
+	_, err = conn.ExecContext(context.Background(), `pragma foreign_keys = off`)
+	require.NoError(err)
+	_, err = conn.ExecContext(context.Background(), `insert into likes (sort_order, user_id, tweet_id) values (1, -1, 12345)`)
+	require.NoError(err)
+	_, err = conn.ExecContext(context.Background(), `pragma foreign_keys = on`)
+	require.NoError(err)
+	require.NoError(conn.Close())
+
+	// A fake user ID that can be resolved, since there's a real user with the same handle
+	fake_user := GetUnknownUserWithHandle("some_guy")
+	require.NoError(profile.SaveUser(&fake_user))
+	fake_user_tweet := create_dummy_tweet()
+	fake_user_tweet.UserID = fake_user.ID
+	require.NoError(profile.SaveTweet(fake_user_tweet))
+	require.NoError(profile.SaveLike(Like{SortID: 2, UserID: fake_user.ID, TweetID: tweet.ID}))
+	real_user := create_dummy_user()
+	real_user.Handle = "Some_Guy"
+	require.NoError(profile.SaveUser(&real_user))
+
+	count_issues := func(issues []ProfileIssue) map[ProfileIssueKind]int {
+		ret := map[ProfileIssueKind]int{}
+		for _, issue := range issues {
+			ret[issue.Kind] += 1
+		}
+		return ret
+	}
+	issues, err = profile.CheckProfile(false)
+	require.NoError(err)
+	assert.Equal(map[ProfileIssueKind]int{
+		ISSUE_MISSING_MEDIA_FILE:      1,
+		ISSUE_ORPHANED_MEDIA_FILE:     1,
+		ISSUE_DANGLING_REFERENCE:      1,
+		ISSUE_RESOLVABLE_FAKE_USER_ID: 1,
+	}, count_issues(issues))
+	for _, issue := range issues {
+		assert.False(issue.IsRepaired)
+	}
+	assert.True(file_exists(orphan_path))
+
+	// Repair everything
+	issues, err = profile.CheckProfile(true)
+	require.NoError(err)
+	assert.Len(issues, 4)
+	for _, issue := range issues {
+		assert.True(issue.IsRepaired, issue.Description)
+	}
+
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.False(new_tweet.Images[0].IsDownloaded)
+	assert.False(new_tweet.IsContentDownloaded)
+	assert.False(file_exists(orphan_path))
+	assert.True(file_exists(recent_path))
+	assert.True(file_exists(temp_path))
+	new_tweet, err = profile.GetTweetById(fake_user_tweet.ID)
+	require.NoError(err)
+	assert.Equal(real_user.ID, new_tweet.UserID)
+	_, err = profile.GetUserByID(fake_user.ID)
+	assert.ErrorIs(err, ErrNotInDatabase)
+
+	// Should be fine now
+	issues, err = profile.CheckProfile(false)
+	require.NoError(err)
+	assert.Len(issues, 0)
+}
+
+func TestCheckProfileRefusesRepairWhileDownloading(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestCheckProfileRefusesRepairWhileDownloading"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	tweet := create_dummy_tweet()
+	require.NoError(profile.SaveTweet(tweet))
+	require.Equal(1, profile.QueueMediaDownloads(TweetTrove{Tweets: map[TweetID]Tweet{tweet.ID: tweet}}))
+
+	// Checking is fine, but repairing isn't
+	_, err := profile.CheckProfile(false)
+	require.NoError(err)
+	_, err = profile.CheckProfile(true)
+	assert.ErrorIs(err, ErrMediaDownloadsInProgress)
+}
+
+func TestCheckProfileKeepsSupersededVideos(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestCheckProfileKeepsSupersededVideos"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+	downloader := DefaultDownloader{Download: func(url string) ([]byte, error) {
+		return []byte(url), nil
+	}}
+
+	tweet := create_dummy_tweet()
+	tweet.Images = []Image{}
+	add_video_variants(&tweet)
+	require.NoError(profile.SaveTweet(tweet))
+	require.NoError(profile.SetVideoPolicy(VideoPolicy{Mode: VIDEO_POLICY_VIDEO, MaxHeight: 720}))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+	old_path := filepath.Join(profile_path, "videos", tweet.Videos[0].LocalFilename)
+
+	num_upgraded, err := profile.UpgradeTweetVideos(tweet.ID, VideoPolicy{}, downloader)
+	require.NoError(err)
+	require.Equal(1, num_upgraded)
+	an_hour_ago := time.Now().Add(-MIN_ORPHANED_MEDIA_FILE_AGE)
+	require.NoError(os.Chtimes(old_path, an_hour_ago, an_hour_ago))
+
+	// The old version is kept on purpose, so it isn't orphaned
+	issues, err := profile.CheckProfile(true)
+	require.NoError(err)
+	for _, issue := range issues {
+		assert.NotEqual(ISSUE_ORPHANED_MEDIA_FILE, issue.Kind, issue.Description)
+	}
+	assert.True(file_exists(old_path))
+}
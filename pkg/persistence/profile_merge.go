@@ -0,0 +1,302 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Result of merging another Profile into this one
+type ProfileMergeResult struct {
+	NumUsers           int
+	NumTweets          int
+	NumMessages        int
+	NumLists           int
+	NumFakeUserIDs     int // Fake user IDs that had to be changed
+	NumMediaFiles      int // Media files copied
+	ConflictingUserIDs []UserID
+}
+
+// Import everything from another Profile into this one: users, tweets, retweets, likes, bookmarks,
+// Spaces, notifications, DMs, follows, mutes, offline Lists, history tables, and the media files that this
+// Profile doesn't have.  The other Profile isn't modified (except to upgrade its schema version if
+// it's out of date).
+//
+// Conflicts are handled the same way as when scraping, since everything is saved with `SaveTweetTrove`.
+// Fake user IDs (see `NextFakeUserID`) in the other Profile are replaced with this Profile's ID for
+// the same user if it has one, or a new fake ID if not.  Lists are matched up by name (or by their
+// online ID, for online Lists).
+func (p Profile) MergeProfile(other_dir string) (ProfileMergeResult, error) {
+	ret := ProfileMergeResult{}
+	if abs1, abs2 := must_abs(p.ProfileDir), must_abs(other_dir); abs1 == abs2 {
+		return ret, fmt.Errorf("Can't merge a profile into itself (%q)", other_dir)
+	}
+	other, err := LoadProfile(other_dir)
+	if err != nil {
+		return ret, fmt.Errorf("Error loading profile to merge %q:\n  %w", other_dir, err)
+	}
+	defer other.DB.Close()
+
+	// Work on a copy of the other Profile's database, so its user IDs can be changed.  Foreign keys
+	// are off, since a user's ID is changed separately from everything that refers to it.
+	tmp_dir, err := os.MkdirTemp("", "merge_profile")
+	if err != nil {
+		return ret, fmt.Errorf("Error creating temporary directory:\n  %w", err)
+	}
+	defer os.RemoveAll(tmp_dir)
+	staging_db_file := filepath.Join(tmp_dir, "twitter.db")
+	if _, err := other.DB.Exec(`vacuum into ?`, staging_db_file); err != nil {
+		return ret, fmt.Errorf("Error copying database of profile %q:\n  %w", other_dir, err)
+	}
+	staging := Profile{ProfileDir: other_dir, DB: sqlx.MustOpen(SQLITE_DRIVER_NAME, staging_db_file)}
+	defer staging.DB.Close()
+
+	ret.NumFakeUserIDs, err = p.remap_fake_user_ids_for_merge(staging)
+	if err != nil {
+		return ret, err
+	}
+	if err := p.resolve_fake_user_ids_from(staging); err != nil {
+		return ret, err
+	}
+
+	// Import it one batch at a time, so the whole Profile doesn't have to fit in memory.  Batches come
+	// in dependency order, so everything a batch refers to has already been imported.
+	err = staging.for_each_full_export_batch(func(batch TweetTrove) error {
+		// Copy media that this Profile doesn't have yet, so it's marked as downloaded when importing
+		for _, media_path := range batch.MediaPaths() {
+			src := filepath.Join(other_dir, media_path)
+			dest := filepath.Join(p.ProfileDir, media_path)
+			if !file_exists(src) || file_exists(dest) {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return fmt.Errorf("Error creating directory for %q:\n  %w", dest, err)
+			}
+			if err := link_or_copy(src, dest); err != nil {
+				return err
+			}
+			ret.NumMediaFiles += 1
+		}
+
+		ret.ConflictingUserIDs = append(ret.ConflictingUserIDs, p.ImportTweetTrove(batch)...)
+		ret.NumUsers += len(batch.Users)
+		ret.NumTweets += len(batch.Tweets)
+		ret.NumMessages += len(batch.Messages)
+		return nil
+	})
+	if err != nil {
+		return ret, err
+	}
+
+	ret.NumLists, err = p.merge_tables_not_in_trove(staging_db_file)
+	return ret, err
+}
+
+func must_abs(path string) string {
+	ret, err := filepath.Abs(path)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Give the fake users in `staging` the IDs they should have in this Profile: the ID of the user with
+// the same handle if there is one, or a new fake ID.  Returns how many were changed.
+func (p Profile) remap_fake_user_ids_for_merge(staging Profile) (int, error) {
+	var fake_users []User
+	err := staging.DB.Select(&fake_users, `select id, handle from users where is_id_fake = 1 and id != ?`, GetUnknownUser().ID)
+	if err != nil {
+		panic(err)
+	}
+	if len(fake_users) == 0 {
+		return 0, nil
+	}
+
+	tx, err := staging.DB.Beginx()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op if committed
+
+	// Fake IDs are sequential in each Profile, so the new IDs might already be used by other fake users
+	// in `staging`.  Move them all out of the way first.
+	temp_id := func(i int) UserID {
+		return UserID(-0x4000000000000000 - int64(i))
+	}
+	for i, u := range fake_users {
+		if err := change_user_id(tx, u.ID, temp_id(i)); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, u := range fake_users {
+		var existing_id UserID
+		err := p.DB.Get(&existing_id, `select id from users_by_handle where lower(handle) = lower(?)`, u.Handle)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = change_user_id(tx, temp_id(i), p.NextFakeUserID())
+		} else if err != nil {
+			panic(err)
+		} else {
+			// This Profile already has this user.  Don't import the fake one, since it has no real data.
+			err = remap_user_id(tx, temp_id(i), existing_id)
+			if err == nil {
+				_, err = tx.Exec(`delete from users where id = ?`, temp_id(i))
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Error changing fake user ID for %q:\n  %w", u.Handle, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+	return len(fake_users), nil
+}
+
+// Change a user's ID, including everywhere it's referred to
+func change_user_id(tx *sqlx.Tx, from_id UserID, to_id UserID) error {
+	if err := remap_user_id(tx, from_id, to_id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`update users set id = ? where id = ?`, to_id, from_id); err != nil {
+		return fmt.Errorf("Error changing user ID %d to %d:\n  %w", from_id, to_id, err)
+	}
+	return nil
+}
+
+// If this Profile has fake users whose real IDs are in `staging`, give them their real IDs, so they'll
+// be updated instead of conflicting when the users are imported.
+func (p Profile) resolve_fake_user_ids_from(staging Profile) error {
+	var fake_users []User
+	err := p.DB.Select(&fake_users, `select id, handle from users where is_id_fake = 1 and id != ?`, GetUnknownUser().ID)
+	if err != nil {
+		panic(err)
+	}
+	for _, u := range fake_users {
+		var real_id UserID
+		err := staging.DB.Get(&real_id, `select id from users where is_id_fake = 0 and lower(handle) = lower(?)`, u.Handle)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			panic(err)
+		}
+
+		tx, err := p.DB.Beginx()
+		if err != nil {
+			panic(err)
+		}
+		tx.MustExec(`pragma defer_foreign_keys = on`)
+		var is_real_user_present bool
+		if err := tx.Get(&is_real_user_present, `select exists(select 1 from users where id = ?)`, real_id); err != nil {
+			panic(err)
+		}
+		if is_real_user_present {
+			err = remap_user_id(tx, u.ID, real_id)
+			if err == nil {
+				_, err = tx.Exec(`delete from users where id = ?`, u.ID)
+			}
+		} else {
+			err = change_user_id(tx, u.ID, real_id)
+			if err == nil {
+				_, err = tx.Exec(`update users set is_id_fake = 0 where id = ?`, real_id)
+			}
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("Error replacing fake user ID for %q:\n  %w", u.Handle, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("Error replacing fake user ID for %q:\n  %w", u.Handle, err)
+		}
+	}
+	return nil
+}
+
+// Copy the things that aren't part of a TweetTrove from the merged Profile's database, after its
+// TweetTrove has been imported: fake user IDs, follows, offline follows, mutes, Lists, and history tables.  Returns the
+// number of Lists that were created.
+func (p Profile) merge_tables_not_in_trove(staging_db_file string) (int, error) {
+	// Attaching a database only applies to one connection, so everything has to use the same one
+	ctx := context.Background()
+	conn, err := p.DB.Connx(ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `attach database ? as other`, staging_db_file); err != nil {
+		return 0, fmt.Errorf("Error attaching database to merge:\n  %w", err)
+	}
+	defer conn.ExecContext(ctx, `detach database other`) //nolint:errcheck // connection is closed anyway
+
+	for _, q := range []string{
+		// Saving users doesn't set these
+		`update users set is_id_fake = 1 where id in (select id from other.users where is_id_fake = 1)`,
+		`update users set is_followed = 1 where id in (select id from other.users where is_followed = 1)`,
+		`insert or ignore into follows (follower_id, followee_id) select follower_id, followee_id from other.follows`,
+		`insert or ignore into mutes (type, text, user_id) select type, text, user_id from other.mutes`,
+		`insert or ignore into tweet_versions (tweet_id, original_tweet_id) select tweet_id, original_tweet_id from other.tweet_versions`,
+		`insert or ignore into tweet_deletions (tweet_id, tombstone_type, first_seen_at)
+		      select tweet_id, tombstone_type, first_seen_at from other.tweet_deletions`,
+		`insert into user_profile_history (user_id, observed_at, handle, display_name, bio, location, website, profile_image_url)
+		      select user_id, observed_at, handle, display_name, bio, location, website, profile_image_url
+		        from other.user_profile_history h
+		       where not exists (select 1 from user_profile_history
+		                          where user_id = h.user_id and observed_at = h.observed_at)`,
+		`insert into tweet_engagement_snapshots (tweet_id, recorded_at, num_likes, num_retweets, num_replies, num_quote_tweets)
+		      select tweet_id, recorded_at, num_likes, num_retweets, num_replies, num_quote_tweets
+		        from other.tweet_engagement_snapshots s
+		       where not exists (select 1 from tweet_engagement_snapshots
+		                          where tweet_id = s.tweet_id and recorded_at = s.recorded_at)`,
+		`insert into poll_vote_snapshots (poll_id, recorded_at, choice1_votes, choice2_votes, choice3_votes, choice4_votes)
+		      select poll_id, recorded_at, choice1_votes, choice2_votes, choice3_votes, choice4_votes
+		        from other.poll_vote_snapshots s
+		       where not exists (select 1 from poll_vote_snapshots
+		                          where poll_id = s.poll_id and recorded_at = s.recorded_at)`,
+	} {
+		if _, err := conn.ExecContext(ctx, q); err != nil {
+			return 0, fmt.Errorf("Error merging table:\n  %w", err)
+		}
+	}
+
+	// Lists
+	var lists []List
+	if err := conn.SelectContext(ctx, &lists, `select rowid, is_online, online_list_id, name from other.lists`); err != nil {
+		panic(err)
+	}
+	num_created := 0
+	for _, l := range lists {
+		var list_id ListID
+		var err error
+		if l.IsOnline {
+			err = conn.GetContext(ctx, &list_id, `select rowid from lists where is_online = 1 and online_list_id = ?`, l.OnlineID)
+		} else {
+			err = conn.GetContext(ctx, &list_id, `select rowid from lists where is_online = 0 and name = ?`, l.Name)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			result, err := conn.ExecContext(ctx, `insert into lists (is_online, online_list_id, name) values (?, ?, ?)`,
+				l.IsOnline, l.OnlineID, l.Name)
+			if err != nil {
+				return num_created, fmt.Errorf("Error creating list %q:\n  %w", l.Name, err)
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				panic(err)
+			}
+			list_id = ListID(id)
+			num_created += 1
+		} else if err != nil {
+			panic(err)
+		}
+		_, err = conn.ExecContext(ctx, `insert or ignore into list_users (list_id, user_id)
+		                                     select ?, user_id from other.list_users where list_id = ?`, list_id, l.ID)
+		if err != nil {
+			return num_created, fmt.Errorf("Error merging users of list %q:\n  %w", l.Name, err)
+		}
+	}
+	return num_created, nil
+}
@@ -0,0 +1,108 @@
+package persistence_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestMergeProfile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	for _, path := range []string{"test_profiles/TestMergeProfile", "test_profiles/TestMergeProfileOther"} {
+		if file_exists(path) {
+			require.NoError(os.RemoveAll(path))
+		}
+	}
+	profile := create_or_load_profile("test_profiles/TestMergeProfile")
+	other_path := "test_profiles/TestMergeProfileOther"
+	other := create_or_load_profile(other_path)
+
+	// This profile only knows a user by handle (fake ID); the other profile has their real ID
+	real_user := create_dummy_user()
+	fake_user := GetUnknownUserWithHandle(real_user.Handle)
+	require.NoError(profile.SaveUser(&fake_user))
+	fake_user_tweet := create_dummy_tweet()
+	fake_user_tweet.UserID = fake_user.ID
+	require.NoError(profile.SaveTweet(fake_user_tweet))
+	require.NoError(other.SaveUser(&real_user))
+
+	// The other profile also has a fake user, with the same fake ID
+	other_fake_user := GetUnknownUserWithHandle("other_fake_user")
+	require.NoError(other.SaveUser(&other_fake_user))
+	require.Equal(fake_user.ID, other_fake_user.ID)
+	other_fake_user_tweet := create_dummy_tweet()
+	other_fake_user_tweet.UserID = other_fake_user.ID
+	require.NoError(other.SaveTweet(other_fake_user_tweet))
+
+	// A tweet with a downloaded image, liked by the real user
+	tweet := create_dummy_tweet()
+	tweet.UserID = real_user.ID
+	tweet.Images = tweet.Images[:1]
+	tweet.Images[0].IsDownloaded = true
+	require.NoError(os.WriteFile(filepath.Join(other_path, "images", tweet.Images[0].LocalFilename), []byte("asdf"), 0644))
+	require.NoError(other.SaveTweet(tweet))
+	require.NoError(other.SaveLike(Like{SortID: 1, UserID: real_user.ID, TweetID: tweet.ID}))
+
+	// An offline list, and an offline follow
+	list := List{Name: "Some list"}
+	other.SaveList(&list)
+	other.SaveListUser(list.ID, real_user.ID)
+	_, err := other.DB.Exec(`update users set is_followed = 1 where id = ?`, real_user.ID)
+	require.NoError(err)
+
+	result, err := profile.MergeProfile(other_path)
+	require.NoError(err)
+	assert.Equal(1, result.NumLists)
+	assert.Equal(1, result.NumFakeUserIDs)
+	assert.Equal(1, result.NumMediaFiles)
+
+	// The fake user got their real ID
+	new_tweet, err := profile.GetTweetById(fake_user_tweet.ID)
+	require.NoError(err)
+	assert.Equal(real_user.ID, new_tweet.UserID)
+	_, err = profile.GetUserByID(fake_user.ID)
+	assert.ErrorIs(err, ErrNotInDatabase)
+
+	// The other profile's fake user got a new fake ID
+	new_tweet, err = profile.GetTweetById(other_fake_user_tweet.ID)
+	require.NoError(err)
+	new_fake_user, err := profile.GetUserByID(new_tweet.UserID)
+	require.NoError(err)
+	assert.Equal(UserHandle("other_fake_user"), new_fake_user.Handle)
+	assert.NotEqual(fake_user.ID, new_fake_user.ID)
+	var is_id_fake bool
+	require.NoError(profile.DB.Get(&is_id_fake, `select is_id_fake from users where id = ?`, new_fake_user.ID))
+	assert.True(is_id_fake)
+
+	// Tweets, media, likes, lists and follows
+	new_tweet, err = profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.True(new_tweet.Images[0].IsDownloaded)
+	assert.True(file_exists(filepath.Join("test_profiles/TestMergeProfile", "images", tweet.Images[0].LocalFilename)))
+	assert.True(profile.IsFollowing(real_user))
+	lists := profile.GetListsForUser(real_user.ID)
+	require.Len(lists, 1)
+	assert.Equal("Some list", lists[0].Name)
+	var num_likes int
+	require.NoError(profile.DB.Get(&num_likes, `select count(*) from likes where user_id = ? and tweet_id = ?`, real_user.ID, tweet.ID))
+	assert.Equal(1, num_likes)
+
+	// Merging again shouldn't create anything new
+	result, err = profile.MergeProfile(other_path)
+	require.NoError(err)
+	assert.Equal(0, result.NumLists)
+	assert.Equal(0, result.NumMediaFiles)
+	var num_fake_users int
+	require.NoError(profile.DB.Get(&num_fake_users, `select count(*) from users where handle = 'other_fake_user'`))
+	assert.Equal(1, num_fake_users)
+
+	// Can't merge a profile into itself
+	_, err = profile.MergeProfile("test_profiles/TestMergeProfile")
+	assert.Error(err)
+}
@@ -0,0 +1,20 @@
+package persistence
+
+type SavedSearchID int64
+
+// A named search query (see `NewCursorFromSearchQuery`), so it can be re-run without typing it again
+type SavedSearch struct {
+	ID    SavedSearchID `db:"rowid"`
+	Name  string        `db:"name"`
+	Query string        `db:"query"`
+
+	// Whether to periodically run the query on Twitter as well, so the local results stay current
+	IsScrapedInBackground bool `db:"is_scraped_in_background"`
+
+	LastViewedAt Timestamp `db:"last_viewed_at"`
+
+	// Number of results posted since it was last viewed; not stored (see `CountNewSavedSearchResults`)
+	NumNewResults int
+	// Whether the results couldn't be counted, e.g., because the query is no longer valid; not stored
+	IsQueryInvalid bool
+}
@@ -0,0 +1,143 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// New results for a saved search are only counted up to this many
+const MAX_NEW_SAVED_SEARCH_RESULTS = 99
+
+var ErrSavedSearchNameTaken = errors.New("there's already a saved search with that name")
+
+// Create a saved search, or update an existing one.  The query has to be valid.
+func (p Profile) SaveSavedSearch(s *SavedSearch) error {
+	if _, err := NewCursorFromSearchQuery(s.Query); err != nil {
+		return fmt.Errorf("Error saving search %q:\n  %w", s.Name, err)
+	}
+
+	var err error
+	if s.ID == SavedSearchID(0) {
+		// New ones start out with no new results
+		s.LastViewedAt = Timestamp{time.Now()}
+		var result sql.Result
+		result, err = p.DB.NamedExec(`
+			insert into saved_searches (name, query, is_scraped_in_background, last_viewed_at)
+			values (:name, :query, :is_scraped_in_background, :last_viewed_at)
+		`, s)
+		if err == nil {
+			id, err := result.LastInsertId()
+			if err != nil {
+				panic(err)
+			}
+			s.ID = SavedSearchID(id)
+		}
+	} else {
+		_, err = p.DB.NamedExec(`
+			update saved_searches
+			   set name = :name,
+			       query = :query,
+			       is_scraped_in_background = :is_scraped_in_background
+			 where rowid = :rowid
+		`, s)
+	}
+	var sqlite_err sqlite3.Error
+	if errors.As(err, &sqlite_err) && sqlite_err.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return fmt.Errorf("Error saving search %q:\n  %w", s.Name, ErrSavedSearchNameTaken)
+	} else if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func (p Profile) DeleteSavedSearch(id SavedSearchID) {
+	_, err := p.DB.Exec(`delete from saved_searches where rowid = ?`, id)
+	if err != nil {
+		panic(fmt.Errorf("Error executing DeleteSavedSearch(%d):\n  %w", id, err))
+	}
+}
+
+func (p Profile) GetSavedSearchById(id SavedSearchID) (SavedSearch, error) {
+	var ret SavedSearch
+	err := p.DB.Get(&ret, `
+		select rowid, name, query, is_scraped_in_background, last_viewed_at
+		  from saved_searches
+		 where rowid = ?
+	`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SavedSearch{}, ErrNotInDatabase
+	} else if err != nil {
+		panic(err)
+	}
+	return ret, nil
+}
+
+// Find the saved search for a query, if there is one
+func (p Profile) GetSavedSearchByQuery(query string) (SavedSearch, error) {
+	var ret SavedSearch
+	err := p.DB.Get(&ret, `
+		select rowid, name, query, is_scraped_in_background, last_viewed_at
+		  from saved_searches
+		 where query = ?
+		 order by rowid
+		 limit 1
+	`, query)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SavedSearch{}, ErrNotInDatabase
+	} else if err != nil {
+		panic(err)
+	}
+	return ret, nil
+}
+
+// Get all the saved searches, sorted by name
+func (p Profile) GetAllSavedSearches() []SavedSearch {
+	var ret []SavedSearch
+	err := p.DB.Select(&ret, `
+		select rowid, name, query, is_scraped_in_background, last_viewed_at
+		  from saved_searches
+		 order by name collate nocase
+	`)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func (p Profile) MarkSavedSearchViewed(id SavedSearchID) {
+	_, err := p.DB.Exec(`update saved_searches set last_viewed_at = ? where rowid = ?`, Timestamp{time.Now()}, id)
+	if err != nil {
+		panic(fmt.Errorf("Error executing MarkSavedSearchViewed(%d):\n  %w", id, err))
+	}
+}
+
+// Count the results of a saved search that were posted after it was last viewed, up to
+// MAX_NEW_SAVED_SEARCH_RESULTS.
+//
+// Queries are checked when they're saved, but the query syntax might have changed since then; if it
+// doesn't parse anymore, it's an error (wrapping ErrInvalidQuery).
+func (p Profile) CountNewSavedSearchResults(s SavedSearch, current_user_id UserID) (int, error) {
+	c, err := NewCursorFromSearchQuery(s.Query)
+	if err != nil {
+		return 0, fmt.Errorf("Error counting new results for saved search %q:\n  %w", s.Name, err)
+	}
+	if s.LastViewedAt.After(c.SinceTimestamp.Time) {
+		c.SinceTimestamp = s.LastViewedAt
+	}
+	c.PageSize = MAX_NEW_SAVED_SEARCH_RESULTS
+
+	// Muted tweets aren't counted
+	q, bind_values, err := c.next_page_query(current_user_id, p.GetAllMutes())
+	if err != nil {
+		return 0, fmt.Errorf("Error counting new results for saved search %q:\n  %w", s.Name, err)
+	}
+	var ret int
+	if err := p.DB.Get(&ret, `select count(*) from (`+q+`)`, bind_values...); err != nil {
+		panic(err)
+	}
+	return ret, nil
+}
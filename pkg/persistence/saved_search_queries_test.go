@@ -0,0 +1,92 @@
+package persistence_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestSaveAndLoadSavedSearch(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	profile_path := "test_profiles/TestSavedSearches"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	s := SavedSearch{Name: "Cats", Query: "kittens filter:images"}
+	require.NoError(profile.SaveSavedSearch(&s))
+	require.NotEqual(SavedSearchID(0), s.ID)
+
+	new_s, err := profile.GetSavedSearchById(s.ID)
+	require.NoError(err)
+	assert.Equal(s.Name, new_s.Name)
+	assert.Equal(s.Query, new_s.Query)
+	assert.False(new_s.IsScrapedInBackground)
+	assert.Equal(s.LastViewedAt.UnixMilli(), new_s.LastViewedAt.UnixMilli())
+
+	// Update it
+	s.Query = "kittens"
+	s.IsScrapedInBackground = true
+	require.NoError(profile.SaveSavedSearch(&s))
+	new_s, err = profile.GetSavedSearchByQuery("kittens")
+	require.NoError(err)
+	assert.Equal(s.ID, new_s.ID)
+	assert.True(new_s.IsScrapedInBackground)
+
+	// Names must be unique, and queries must be valid
+	assert.ErrorIs(profile.SaveSavedSearch(&SavedSearch{Name: "Cats", Query: "puppies"}), ErrSavedSearchNameTaken)
+	assert.ErrorIs(profile.SaveSavedSearch(&SavedSearch{Name: "Broken", Query: `"kittens`}), ErrInvalidQuery)
+	require.NoError(profile.SaveSavedSearch(&SavedSearch{Name: "Dogs", Query: "puppies"}))
+
+	searches := profile.GetAllSavedSearches()
+	require.Len(searches, 2)
+	assert.Equal("Cats", searches[0].Name)
+	assert.Equal("Dogs", searches[1].Name)
+
+	profile.DeleteSavedSearch(s.ID)
+	_, err = profile.GetSavedSearchById(s.ID)
+	assert.ErrorIs(err, ErrNotInDatabase)
+}
+
+func TestCountNewSavedSearchResults(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	profile_path := "test_profiles/TestSavedSearches"
+	profile := create_or_load_profile(profile_path)
+
+	s := SavedSearch{Name: "Saved search count test", Query: "aardvarks"}
+	require.NoError(profile.SaveSavedSearch(&s))
+	s.LastViewedAt = Timestamp{time.Now().Add(-time.Hour)}
+
+	// One result from before the last view, and one from after
+	old_tweet := create_dummy_tweet()
+	old_tweet.Text = "aardvarks are great"
+	old_tweet.PostedAt = Timestamp{time.Now().Add(-2 * time.Hour)}
+	require.NoError(profile.SaveTweet(old_tweet))
+	new_tweet := create_dummy_tweet()
+	new_tweet.Text = "more aardvarks"
+	require.NoError(profile.SaveTweet(new_tweet))
+	count, err := profile.CountNewSavedSearchResults(s, UserID(0))
+	require.NoError(err)
+	assert.Equal(1, count)
+
+	// Viewing it resets the count
+	profile.MarkSavedSearchViewed(s.ID)
+	s, err = profile.GetSavedSearchById(s.ID)
+	require.NoError(err)
+	count, err = profile.CountNewSavedSearchResults(s, UserID(0))
+	require.NoError(err)
+	assert.Equal(0, count)
+
+	// A query that doesn't parse anymore is an error, not just 0 results
+	s.Query = "since:asdf"
+	_, err = profile.CountNewSavedSearchResults(s, UserID(0))
+	assert.ErrorIs(err, ErrInvalidQuery)
+}
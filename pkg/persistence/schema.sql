@@ -52,6 +52,22 @@ create view users_by_handle as
            )
   group by handle having id = max(id);
 
+-- Every observed version of a user's profile.  A new row is added whenever a re-scrape changes any of
+-- these fields, so it includes former handles.
+create table user_profile_history (rowid integer primary key,
+    user_id integer not null,
+    observed_at integer not null,
+    handle text not null,
+    display_name text not null,
+    bio text not null default '',
+    location text not null default '',
+    website text not null default '',
+    profile_image_url text not null default '',
+
+    foreign key(user_id) references users(id)
+);
+create index if not exists index_user_profile_history_user_id on user_profile_history (user_id, observed_at);
+create index if not exists index_user_profile_history_handle on user_profile_history (handle collate nocase);
 
 create table fake_user_sequence(latest_fake_id integer not null);
 insert into fake_user_sequence values(0x4000000000000000);
@@ -125,6 +141,7 @@ create table tweets (rowid integer primary key,
     is_content_downloaded boolean default 0,
     is_conversation_scraped boolean default 0,
     last_scraped_at integer not null default 0,
+    editable_until integer not null default 0,
     foreign key(user_id) references users(id)
     foreign key(space_id) references spaces(id)
 );
@@ -132,6 +149,41 @@ create index if not exists index_tweets_in_reply_to_id on tweets (in_reply_to_id
 create index if not exists index_tweets_user_id        on tweets (user_id);
 create index if not exists index_tweets_posted_at      on tweets (posted_at);
 
+-- Full-text search index.  `rowid` is the tweet ID; `urls` is the titles and descriptions of its links
+create virtual table tweets_fts using fts5(text, urls, tokenize=trigram);
+
+-- Engagement counts over time.  A new snapshot is recorded whenever a re-scrape changes the counts.
+create table tweet_engagement_snapshots (rowid integer primary key,
+    tweet_id integer not null,
+    recorded_at integer not null,
+    num_likes integer not null,
+    num_retweets integer not null,
+    num_replies integer not null,
+    num_quote_tweets integer not null,
+
+    foreign key(tweet_id) references tweets(id)
+);
+create index if not exists index_tweet_engagement_snapshots_tweet_id on tweet_engagement_snapshots (tweet_id, recorded_at);
+
+-- Edited tweets.  Each version of a tweet has its own ID; they're linked by the ID of the first
+-- version.  Versions don't have to be in the `tweets` table, since they might not be scraped yet.
+create table tweet_versions (rowid integer primary key,
+    tweet_id integer unique not null,
+    original_tweet_id integer not null
+);
+create index if not exists index_tweet_versions_original_tweet_id on tweet_versions (original_tweet_id);
+
+-- Archived tweets that were later found to be deleted, suspended or hidden
+create table tweet_deletions (rowid integer primary key,
+    tweet_id integer unique not null,
+    tombstone_type integer not null,
+    first_seen_at integer not null,
+
+    foreign key(tweet_id) references tweets(id)
+    foreign key(tombstone_type) references tombstone_types(rowid)
+);
+create index if not exists index_tweet_deletions_first_seen_at on tweet_deletions (first_seen_at);
+
 
 -- Tweet content
 -- -------------
@@ -181,6 +233,19 @@ create table polls (rowid integer primary key,
 );
 create index if not exists index_polls_tweet_id on polls (tweet_id);
 
+-- Vote counts over time.  A new snapshot is recorded whenever a re-scrape changes the counts.
+create table poll_vote_snapshots (rowid integer primary key,
+    poll_id integer not null,
+    recorded_at integer not null,
+    choice1_votes integer,
+    choice2_votes integer,
+    choice3_votes integer,
+    choice4_votes integer,
+
+    foreign key(poll_id) references polls(id)
+);
+create index if not exists index_poll_vote_snapshots_poll_id on poll_vote_snapshots (poll_id, recorded_at);
+
 
 create table images (rowid integer primary key,
     id integer unique not null check(typeof(id) = 'integer'),
@@ -188,12 +253,13 @@ create table images (rowid integer primary key,
     width integer not null,
     height integer not null,
     remote_url text not null unique,
-    local_filename text not null unique,
+    local_filename text not null,
     is_downloaded boolean default 0,
 
     foreign key(tweet_id) references tweets(id)
 );
 create index if not exists index_images_tweet_id on images (tweet_id);
+create index if not exists index_images_local_filename on images (local_filename);
 
 create table videos (rowid integer primary key,
     id integer unique not null check(typeof(id) = 'integer'),
@@ -201,7 +267,7 @@ create table videos (rowid integer primary key,
     width integer not null,
     height integer not null,
     remote_url text not null unique,
-    local_filename text not null unique,
+    local_filename text not null,
     thumbnail_remote_url text not null default 'missing',
     thumbnail_local_filename text not null default 'missing',
     duration integer not null default 0,
@@ -209,10 +275,28 @@ create table videos (rowid integer primary key,
     is_gif boolean default 0,
     is_downloaded boolean default 0,
     is_blocked_by_dmca boolean not null default 0,
+    downloaded_height integer not null default 0,
+    downloaded_bitrate integer not null default 0,
+    is_audio_only boolean not null default 0,
 
     foreign key(tweet_id) references tweets(id)
 );
 create index if not exists index_videos_tweet_id on videos (tweet_id);
+create index if not exists index_videos_local_filename on videos (local_filename);
+
+-- Every available version of a video: MP4 files at various bitrates, and HLS playlists
+create table video_variants (rowid integer primary key,
+    video_id integer not null,
+    content_type text not null default 'video/mp4',
+    bitrate integer not null default 0,
+    width integer not null default 0,
+    height integer not null default 0,
+    url text not null,
+
+    unique(video_id, url)
+    foreign key(video_id) references videos(id)
+);
+create index if not exists index_video_variants_video_id on video_variants (video_id);
 
 create table hashtags (rowid integer primary key,
     tweet_id integer not null,
@@ -462,10 +546,96 @@ create table notification_users (rowid integer primary key,
 );
 
 
+-- Saved searches
+-- --------------
+
+create table saved_searches (rowid integer primary key,
+    name text not null unique,
+    query text not null,
+    is_scraped_in_background boolean not null default 0,
+    last_viewed_at integer not null default 0
+);
+
+
+-- Mutes
+-- -----
+
+-- Rules for hiding tweets in local feeds.  Keywords, regexes, domains and hashtags use `text`; users
+-- and "retweets from user" use `user_id`.
+create table mutes (rowid integer primary key,
+    type text not null check(type in ('keyword', 'regex', 'user', 'retweets', 'domain', 'hashtag')),
+    text text not null default '',
+    user_id integer not null default 0,
+    unique(type, text, user_id)
+);
+
+
+-- Scrape jobs
+-- -----------
+
+-- Long-running scrapes (e.g., all of a user's tweets), which are saved after each page so they can be
+-- resumed.  `cursor` is the pagination cursor for the next page; `retry_at` is when a failed job can
+-- be retried.
+create table scrape_jobs (rowid integer primary key,
+    type text not null check(type in ('user_tweets', 'user_likes', 'followers', 'followees', 'search')),
+    target text not null,
+    priority integer not null default 0,
+    status text not null default 'queued' check(status in ('queued', 'running', 'done', 'failed', 'cancelled')),
+    cursor text not null default '',
+    num_pages integer not null default 0,
+    max_pages integer not null default 0,
+    num_failures integer not null default 0,
+    last_error text not null default '',
+    retry_at integer not null default 0,
+    created_at integer not null,
+    updated_at integer not null
+);
+create index if not exists index_scrape_jobs_status on scrape_jobs (status);
+
+
+-- Media download queue
+-- --------------------
+
+-- Items (tweets, users and chat messages) whose media content hasn't been downloaded yet.  Failed
+-- downloads are retried after `retry_at`; `is_failed` means it has been given up on.
+create table media_download_queue (rowid integer primary key,
+    type text not null check(type in ('tweet', 'user', 'chat_message')),
+    item_id integer not null,
+    num_failures integer not null default 0,
+    last_error text not null default '',
+    retry_at integer not null default 0,
+    is_failed boolean not null default 0,
+    queued_at integer not null,
+    unique(type, item_id)
+);
+
+
+-- Video policy
+-- ------------
+
+-- Which version of each video to download (a single row).  `max_height` and `max_bitrate` are
+-- ignored if 0.
+create table video_policy (rowid integer primary key,
+    mode text not null default 'video' check(mode in ('video', 'audio_only', 'thumbnail_only')),
+    max_height integer not null default 0,
+    max_bitrate integer not null default 0
+);
+insert into video_policy (rowid) values (1);
+
+-- Video files that were replaced by a better version (see `UpgradeTweetVideos`).  They're kept on
+-- purpose, so the profile check doesn't treat them as orphaned.
+create table superseded_media_files (rowid integer primary key,
+    subdir text not null,
+    local_filename text not null,
+    superseded_at integer not null,
+    unique(subdir, local_filename)
+);
+
+
 -- Meta
 -- ----
 
 create table database_version(rowid integer primary key,
     version_number integer not null unique
 );
-insert into database_version(version_number) values (34);
+insert into database_version(version_number) values (46);
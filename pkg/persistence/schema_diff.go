@@ -0,0 +1,151 @@
+package persistence
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// A description of a database's schema, for comparing it to another one.  Keys are things like "column
+// tweets.text" or "index index_tweets_user_id", and values describe them.
+//
+// Only what queries depend on is included: tables, columns, indexes, unique constraints, foreign keys,
+// views and triggers.  Column types, defaults, `not null` and `check` constraints aren't, since old
+// profiles were upgraded with `alter table` and don't always match `schema.sql` exactly in those ways.
+type schema_description map[string]string
+
+var whitespace_regex = regexp.MustCompile(`\s+`)
+
+func get_schema_description(db *sqlx.DB) schema_description {
+	ret := schema_description{}
+
+	var objects []struct {
+		Type    string `db:"type"`
+		Name    string `db:"name"`
+		TblName string `db:"tbl_name"`
+	}
+	err := db.Select(&objects, `select type, name, tbl_name from sqlite_schema where name not like 'sqlite_%'`)
+	if err != nil {
+		panic(err)
+	}
+	for _, o := range objects {
+		switch o.Type {
+		case "view", "trigger":
+			ret[o.Type+" "+o.Name] = ""
+		case "table":
+			ret["table "+o.Name] = ""
+
+			var columns []string
+			if err := db.Select(&columns, `select name from pragma_table_info(?)`, o.Name); err != nil {
+				panic(err)
+			}
+			for _, c := range columns {
+				ret[fmt.Sprintf("column %s.%s", o.Name, c)] = ""
+			}
+
+			var foreign_keys []struct {
+				Table    string  `db:"table"`
+				From     string  `db:"from"`
+				To       *string `db:"to"`
+				OnDelete string  `db:"on_delete"`
+			}
+			err := db.Select(&foreign_keys, `select "table", "from", "to", on_delete from pragma_foreign_key_list(?)`, o.Name)
+			if err != nil {
+				panic(err)
+			}
+			for _, fk := range foreign_keys {
+				to := "<primary key>"
+				if fk.To != nil {
+					to = *fk.To
+				}
+				ret[fmt.Sprintf("foreign key %s.%s", o.Name, fk.From)] = fmt.Sprintf("references %s(%s) on delete %s",
+					fk.Table, to, fk.OnDelete)
+			}
+
+			var indexes []struct {
+				Name      string `db:"name"`
+				IsUnique  bool   `db:"unique"`
+				Origin    string `db:"origin"`
+				IsPartial bool   `db:"partial"`
+			}
+			err = db.Select(&indexes, `select name, "unique", origin, partial from pragma_index_list(?)`, o.Name)
+			if err != nil {
+				panic(err)
+			}
+			for _, index := range indexes {
+				var index_columns []string
+				err := db.Select(&index_columns, `
+					select ifnull(name, '<expression>') || case when "desc" then ' desc' else '' end
+					  from pragma_index_xinfo(?)
+					 where key = 1
+					 order by seqno`, index.Name)
+				if err != nil {
+					panic(err)
+				}
+				desc := fmt.Sprintf("on %s(%s)", o.Name, strings.Join(index_columns, ", "))
+				switch index.Origin {
+				case "pk":
+					continue
+				case "u":
+					// Unique constraints are unnamed, so identify them by their columns
+					ret["unique "+desc] = ""
+				default:
+					if index.IsUnique {
+						desc = "unique " + desc
+					}
+					if index.IsPartial {
+						var sql string
+						if err := db.Get(&sql, `select sql from sqlite_schema where type = 'index' and name = ?`, index.Name); err != nil {
+							panic(err)
+						}
+						where_clause := sql[strings.LastIndex(strings.ToLower(sql), " where ")+1:]
+						desc += " " + whitespace_regex.ReplaceAllString(strings.ToLower(where_clause), " ")
+					}
+					ret["index "+index.Name] = desc
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// Get a list of differences between two schema descriptions, sorted
+func (expected schema_description) diff(actual schema_description) []string {
+	ret := []string{}
+	for key, val := range expected {
+		actual_val, is_ok := actual[key]
+		if !is_ok {
+			ret = append(ret, "missing: "+strings.TrimSpace(key+" "+val))
+		} else if actual_val != val {
+			ret = append(ret, fmt.Sprintf("different: %s (expected %q, got %q)", key, val, actual_val))
+		}
+	}
+	for key, val := range actual {
+		if _, is_ok := expected[key]; !is_ok {
+			ret = append(ret, "unexpected: "+strings.TrimSpace(key+" "+val))
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Get what the schema should look like at the given version: a new database created from `schema.sql`,
+// migrated down to that version.
+func get_expected_schema(version int) (schema_description, error) {
+	db := sqlx.MustOpen(SQLITE_DRIVER_NAME, ":memory:?_foreign_keys=on")
+	defer db.Close()
+	// Each connection to ":memory:" is a separate database
+	db.SetMaxOpenConns(1)
+
+	db.MustExec(sql_init)
+	p := Profile{DB: db}
+	for i := ENGINE_DATABASE_VERSION; i > version; i-- {
+		if err := p.run_migration(DOWN_MIGRATIONS[i-1], i-1); err != nil {
+			return nil, fmt.Errorf("Error computing the expected schema for version %d:\n  %w", version, err)
+		}
+	}
+	return get_schema_description(db), nil
+}
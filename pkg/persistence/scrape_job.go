@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"time"
+)
+
+type ScrapeJobID int64
+
+type ScrapeJobType string
+
+const (
+	SCRAPE_JOB_USER_TWEETS = ScrapeJobType("user_tweets") // Target is a user handle
+	SCRAPE_JOB_USER_LIKES  = ScrapeJobType("user_likes")  // Target is a user handle
+	SCRAPE_JOB_FOLLOWERS   = ScrapeJobType("followers")   // Target is a user handle
+	SCRAPE_JOB_FOLLOWEES   = ScrapeJobType("followees")   // Target is a user handle
+	SCRAPE_JOB_SEARCH      = ScrapeJobType("search")      // Target is a search query
+)
+
+var SCRAPE_JOB_TYPES = []ScrapeJobType{
+	SCRAPE_JOB_USER_TWEETS, SCRAPE_JOB_USER_LIKES, SCRAPE_JOB_FOLLOWERS, SCRAPE_JOB_FOLLOWEES, SCRAPE_JOB_SEARCH,
+}
+
+type ScrapeJobStatus string
+
+const (
+	SCRAPE_JOB_QUEUED    = ScrapeJobStatus("queued")  // Waiting to run (or to be retried, after `RetryAt`)
+	SCRAPE_JOB_RUNNING   = ScrapeJobStatus("running") // Claimed by a job runner
+	SCRAPE_JOB_DONE      = ScrapeJobStatus("done")
+	SCRAPE_JOB_FAILED    = ScrapeJobStatus("failed") // Gave up; see `LastError`
+	SCRAPE_JOB_CANCELLED = ScrapeJobStatus("cancelled")
+)
+
+// A long-running paginated scrape.  Its progress is saved after each page, so it can pick up where it
+// left off if it gets interrupted.
+type ScrapeJob struct {
+	ID       ScrapeJobID     `db:"rowid"`
+	Type     ScrapeJobType   `db:"type"`
+	Target   string          `db:"target"`
+	Priority int             `db:"priority"` // Higher priority jobs run first
+	Status   ScrapeJobStatus `db:"status"`
+
+	Cursor   string `db:"cursor"`    // Pagination cursor for the next page; empty before the first page
+	NumPages int    `db:"num_pages"` // Pages scraped so far
+	MaxPages int    `db:"max_pages"` // 0 means no limit
+
+	NumFailures int       `db:"num_failures"` // Failures in a row; reset after a successful page
+	LastError   string    `db:"last_error"`
+	RetryAt     Timestamp `db:"retry_at"`
+
+	CreatedAt Timestamp `db:"created_at"`
+	UpdatedAt Timestamp `db:"updated_at"`
+}
+
+func (j ScrapeJob) IsFinished() bool {
+	return j.Status == SCRAPE_JOB_DONE || j.Status == SCRAPE_JOB_FAILED || j.Status == SCRAPE_JOB_CANCELLED
+}
+
+// Whether it failed, and is waiting until `RetryAt` to try again
+func (j ScrapeJob) IsWaitingToRetry() bool {
+	return j.Status == SCRAPE_JOB_QUEUED && j.RetryAt.After(time.Now())
+}
@@ -0,0 +1,214 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidScrapeJob    = errors.New("invalid scrape job")
+	ErrScrapeJobFinished   = errors.New("scrape job is already finished")
+	ErrScrapeJobNotStopped = errors.New("scrape job hasn't failed or been cancelled")
+)
+
+const scrape_job_fields = `rowid, type, target, priority, status, cursor, num_pages, max_pages, num_failures, last_error,
+	retry_at, created_at, updated_at`
+
+// Create a scrape job, or update an existing one (e.g., to save its progress).
+//
+// A job that's been cancelled stays cancelled, even if it was still running; the runner finds out
+// before its next page.  (Use `RetryScrapeJob` to re-queue it.)
+func (p Profile) SaveScrapeJob(j *ScrapeJob) error {
+	j.Target = strings.TrimSpace(j.Target)
+	if !slices.Contains(SCRAPE_JOB_TYPES, j.Type) {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidScrapeJob, j.Type)
+	}
+	if j.Target == "" {
+		return fmt.Errorf("%w: no target given", ErrInvalidScrapeJob)
+	}
+	if j.MaxPages < 0 {
+		return fmt.Errorf("%w: max pages can't be negative", ErrInvalidScrapeJob)
+	}
+	if j.Status == "" {
+		j.Status = SCRAPE_JOB_QUEUED
+	}
+
+	j.UpdatedAt = Timestamp{time.Now()}
+	if j.ID == ScrapeJobID(0) {
+		j.CreatedAt = j.UpdatedAt
+		result, err := p.DB.NamedExec(`
+			insert into scrape_jobs (type, target, priority, status, cursor, num_pages, max_pages, num_failures,
+			                         last_error, retry_at, created_at, updated_at)
+			values (:type, :target, :priority, :status, :cursor, :num_pages, :max_pages, :num_failures, :last_error,
+			        :retry_at, :created_at, :updated_at)
+		`, j)
+		if err != nil {
+			panic(err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			panic(err)
+		}
+		j.ID = ScrapeJobID(id)
+		return nil
+	}
+
+	_, err := p.DB.NamedExec(`
+		update scrape_jobs
+		   set priority = :priority,
+		       status = case when status = 'cancelled' then status else :status end,
+		       cursor = :cursor,
+		       num_pages = :num_pages,
+		       max_pages = :max_pages,
+		       num_failures = :num_failures,
+		       last_error = :last_error,
+		       retry_at = :retry_at,
+		       updated_at = :updated_at
+		 where rowid = :rowid
+	`, j)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func (p Profile) GetScrapeJobById(id ScrapeJobID) (ScrapeJob, error) {
+	var ret ScrapeJob
+	err := p.DB.Get(&ret, `select `+scrape_job_fields+` from scrape_jobs where rowid = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ScrapeJob{}, ErrNotInDatabase
+	} else if err != nil {
+		panic(err)
+	}
+	return ret, nil
+}
+
+// Get all the scrape jobs: unfinished ones first, in the order they'll run, then finished ones, most
+// recent first
+func (p Profile) GetAllScrapeJobs() []ScrapeJob {
+	var ret []ScrapeJob
+	err := p.DB.Select(&ret, `
+		select `+scrape_job_fields+`
+		  from scrape_jobs
+		 order by status = 'running' desc,
+		          status = 'queued' desc,
+		          case when status = 'queued' then -priority else -updated_at end,
+		          rowid
+	`)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Take the highest priority queued job that's ready to run, and mark it as running.  Returns
+// ErrNotInDatabase if there's nothing to run.
+//
+// Only one job runner can claim a given job, even if there are several (e.g., a webserver and a
+// command line `run_jobs`).
+func (p Profile) ClaimNextScrapeJob() (ScrapeJob, error) {
+	for {
+		var ret ScrapeJob
+		now := Timestamp{time.Now()}
+		err := p.DB.Get(&ret, `
+			select `+scrape_job_fields+`
+			  from scrape_jobs
+			 where status = 'queued' and retry_at <= ?
+			 order by priority desc, rowid
+			 limit 1
+		`, now)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ScrapeJob{}, ErrNotInDatabase
+		} else if err != nil {
+			panic(err)
+		}
+
+		result, err := p.DB.Exec(`
+			update scrape_jobs set status = 'running', updated_at = ? where rowid = ? and status = 'queued'
+		`, now, ret.ID)
+		if err != nil {
+			panic(err)
+		}
+		num_rows, err := result.RowsAffected()
+		if err != nil {
+			panic(err)
+		}
+		if num_rows == 1 {
+			ret.Status = SCRAPE_JOB_RUNNING
+			ret.UpdatedAt = now
+			return ret, nil
+		}
+		// Someone else claimed it first; try the next one
+	}
+}
+
+// Put "running" jobs whose progress hasn't been saved for a while back in the queue, on the assumption
+// that whatever was running them was stopped.  They'll resume from their last saved page.
+func (p Profile) RequeueInterruptedScrapeJobs(not_updated_for time.Duration) int {
+	result, err := p.DB.Exec(`update scrape_jobs set status = 'queued' where status = 'running' and updated_at <= ?`,
+		Timestamp{time.Now().Add(-not_updated_for)})
+	if err != nil {
+		panic(err)
+	}
+	num_rows, err := result.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return int(num_rows)
+}
+
+// Cancel a queued or running job.  A running job stops after the page it's currently on.
+func (p Profile) CancelScrapeJob(id ScrapeJobID) error {
+	job, err := p.GetScrapeJobById(id)
+	if err != nil {
+		return err
+	}
+	if job.IsFinished() {
+		return fmt.Errorf("Error cancelling job %d (%s):\n  %w", id, job.Status, ErrScrapeJobFinished)
+	}
+	_, err = p.DB.Exec(`
+		update scrape_jobs set status = 'cancelled', updated_at = ? where rowid = ? and status in ('queued', 'running')
+	`, Timestamp{time.Now()}, id)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+// Put a failed or cancelled job back in the queue.  It resumes from its last saved page.
+func (p Profile) RetryScrapeJob(id ScrapeJobID) error {
+	job, err := p.GetScrapeJobById(id)
+	if err != nil {
+		return err
+	}
+	if job.Status != SCRAPE_JOB_FAILED && job.Status != SCRAPE_JOB_CANCELLED {
+		return fmt.Errorf("Error retrying job %d (%s):\n  %w", id, job.Status, ErrScrapeJobNotStopped)
+	}
+	_, err = p.DB.Exec(`
+		update scrape_jobs set status = 'queued', num_failures = 0, retry_at = 0, updated_at = ? where rowid = ?
+	`, Timestamp{time.Now()}, id)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func (p Profile) SetScrapeJobPriority(id ScrapeJobID, priority int) error {
+	result, err := p.DB.Exec(`update scrape_jobs set priority = ?, updated_at = ? where rowid = ?`,
+		priority, Timestamp{time.Now()}, id)
+	if err != nil {
+		panic(err)
+	}
+	num_rows, err := result.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	if num_rows == 0 {
+		return ErrNotInDatabase
+	}
+	return nil
+}
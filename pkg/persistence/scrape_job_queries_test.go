@@ -0,0 +1,96 @@
+package persistence_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestScrapeJobQueue(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	profile_path := "test_profiles/TestScrapeJobs"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	_, err := profile.ClaimNextScrapeJob()
+	assert.ErrorIs(err, ErrNotInDatabase)
+
+	// Invalid jobs
+	assert.ErrorIs(profile.SaveScrapeJob(&ScrapeJob{Type: ScrapeJobType("asdf"), Target: "asdf"}), ErrInvalidScrapeJob)
+	assert.ErrorIs(profile.SaveScrapeJob(&ScrapeJob{Type: SCRAPE_JOB_SEARCH, Target: " "}), ErrInvalidScrapeJob)
+
+	low := ScrapeJob{Type: SCRAPE_JOB_USER_TWEETS, Target: "somebody"}
+	require.NoError(profile.SaveScrapeJob(&low))
+	assert.Equal(SCRAPE_JOB_QUEUED, low.Status)
+	high := ScrapeJob{Type: SCRAPE_JOB_SEARCH, Target: "some query", Priority: 5, MaxPages: 10}
+	require.NoError(profile.SaveScrapeJob(&high))
+	later := ScrapeJob{Type: SCRAPE_JOB_FOLLOWERS, Target: "somebody", Priority: 10,
+		RetryAt: Timestamp{time.Now().Add(time.Hour)}}
+	require.NoError(profile.SaveScrapeJob(&later))
+
+	// Highest priority first, unless it's waiting to be retried
+	job, err := profile.ClaimNextScrapeJob()
+	require.NoError(err)
+	assert.Equal(high.ID, job.ID)
+	assert.Equal(SCRAPE_JOB_RUNNING, job.Status)
+
+	// Save its progress
+	job.Cursor = "some cursor"
+	job.NumPages = 1
+	require.NoError(profile.SaveScrapeJob(&job))
+	job, err = profile.GetScrapeJobById(high.ID)
+	require.NoError(err)
+	assert.Equal(SCRAPE_JOB_RUNNING, job.Status)
+	assert.Equal("some cursor", job.Cursor)
+	assert.Equal(1, job.NumPages)
+	assert.Equal(10, job.MaxPages)
+
+	// Bump up the other job
+	require.NoError(profile.SetScrapeJobPriority(low.ID, 100))
+	all_jobs := profile.GetAllScrapeJobs()
+	require.Len(all_jobs, 3)
+	assert.Equal([]ScrapeJobID{high.ID, low.ID, later.ID}, []ScrapeJobID{all_jobs[0].ID, all_jobs[1].ID, all_jobs[2].ID})
+
+	// Interrupted; resume it
+	assert.Equal(0, profile.RequeueInterruptedScrapeJobs(time.Hour))
+	assert.Equal(1, profile.RequeueInterruptedScrapeJobs(0))
+	job, err = profile.ClaimNextScrapeJob()
+	require.NoError(err)
+	assert.Equal(low.ID, job.ID)
+	job, err = profile.ClaimNextScrapeJob()
+	require.NoError(err)
+	assert.Equal(high.ID, job.ID)
+	assert.Equal("some cursor", job.Cursor)
+	_, err = profile.ClaimNextScrapeJob()
+	assert.ErrorIs(err, ErrNotInDatabase)
+
+	// Cancel it while it's running; saving its progress doesn't un-cancel it
+	require.NoError(profile.CancelScrapeJob(job.ID))
+	job.NumPages = 2
+	require.NoError(profile.SaveScrapeJob(&job))
+	job, err = profile.GetScrapeJobById(high.ID)
+	require.NoError(err)
+	assert.Equal(SCRAPE_JOB_CANCELLED, job.Status)
+	assert.Equal(2, job.NumPages)
+	assert.ErrorIs(profile.CancelScrapeJob(job.ID), ErrScrapeJobFinished)
+
+	// Retry it
+	assert.ErrorIs(profile.RetryScrapeJob(low.ID), ErrScrapeJobNotStopped)
+	require.NoError(profile.RetryScrapeJob(job.ID))
+	job, err = profile.ClaimNextScrapeJob()
+	require.NoError(err)
+	assert.Equal(high.ID, job.ID)
+	assert.Equal(2, job.NumPages)
+
+	// Nonexistent jobs
+	assert.ErrorIs(profile.CancelScrapeJob(ScrapeJobID(12345)), ErrNotInDatabase)
+	assert.ErrorIs(profile.SetScrapeJobPriority(ScrapeJobID(12345), 1), ErrNotInDatabase)
+}
@@ -0,0 +1,99 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Name of the SQL driver used to open Profile databases.  It's the regular sqlite3 driver, plus the
+// `regexp` and `url_domain` functions used for mutes (see `mute_where_clauses`).
+//
+// The search index is an FTS5 table, which go-sqlite3 only compiles in with the `sqlite_fts5` build
+// tag; build and test with `GOFLAGS=-tags=sqlite_fts5`.
+const SQLITE_DRIVER_NAME = "sqlite3_offline_twitter"
+
+func init() {
+	sql.Register(SQLITE_DRIVER_NAME, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("regexp", sql_regexp, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("url_domain", sql_url_domain, true)
+		},
+	})
+}
+
+// Relevance scores are stored in cursors, which are integers, so they're scaled up to keep some precision
+const RELEVANCE_SCALE = 1000000
+
+// SQL for a search result's relevance, from FTS5's `bm25` function.  `bm25` is lower for better
+// matches, so it's negated to make higher scores better.
+var RELEVANCE_SQL = fmt.Sprintf("cast(-bm25(tweets_fts) * %d as integer)", RELEVANCE_SCALE)
+
+// The index uses the "trigram" tokenizer, so keywords match anywhere in a word (case-insensitively),
+// like a `like '%keyword%'`.  But keywords shorter than a trigram can't be looked up in the index.
+const MIN_INDEXED_KEYWORD_LENGTH = 3
+
+func is_indexed_keyword(kw string) bool {
+	return utf8.RuneCountInString(kw) >= MIN_INDEXED_KEYWORD_LENGTH
+}
+
+// Convert a list of keywords into an FTS5 "MATCH" expression.  Each keyword is matched as a phrase,
+// so multi-word keywords (i.e., quoted search terms) have to appear in the given order.  Keywords
+// too short to be indexed are left out; see `short_keyword_where_clauses`.
+func keywords_to_match_expression(keywords []string) string {
+	phrases := []string{}
+	for _, kw := range keywords {
+		kw = strings.TrimSpace(kw)
+		if !is_indexed_keyword(kw) {
+			continue
+		}
+		phrases = append(phrases, `"`+strings.ReplaceAll(kw, `"`, `""`)+`"`)
+	}
+	return strings.Join(phrases, " ")
+}
+
+// Where-clauses matching keywords that are too short to be looked up in the search index.  They
+// still use the index's columns, so they match the same things as the other keywords.
+func short_keyword_where_clauses(keywords []string) ([]string, []interface{}) {
+	where_clauses := []string{}
+	bind_values := []interface{}{}
+	for _, kw := range keywords {
+		kw = strings.TrimSpace(kw)
+		if kw == "" || is_indexed_keyword(kw) {
+			continue
+		}
+		where_clauses = append(where_clauses,
+			"tweets.id in (select rowid from tweets_fts where tweets_fts.text like ? or tweets_fts.urls like ?)")
+		pattern := "%" + kw + "%"
+		bind_values = append(bind_values, pattern, pattern)
+	}
+	return where_clauses, bind_values
+}
+
+// Update a tweet's entry in the full-text search index.  The indexed content is the tweet's text,
+// plus the titles and descriptions of any links (Urls) in it.
+func (p Profile) update_tweet_search_index(id TweetID) error {
+	_, err := p.DB.Exec(`delete from tweets_fts where rowid = ?`, id)
+	if err != nil {
+		return fmt.Errorf("Error deleting search index entry for tweet ID %d:\n  %w", id, err)
+	}
+	_, err = p.DB.Exec(`
+		insert into tweets_fts (rowid, text, urls)
+		     select id, text, ifnull((
+		                select group_concat(ifnull(title, '') || ' ' || ifnull(description, ''), ' ')
+		                  from urls
+		                 where urls.tweet_id = tweets.id
+		            ), '')
+		       from tweets
+		      where id = ?
+	`, id)
+	if err != nil {
+		return fmt.Errorf("Error updating search index for tweet ID %d:\n  %w", id, err)
+	}
+	return nil
+}
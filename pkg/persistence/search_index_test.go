@@ -0,0 +1,164 @@
+package persistence_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Search results sorted by relevance should page through the same results as by newest
+func TestCursorSearchByRelevance(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+
+	c := NewCursor()
+	c.PageSize = 2
+	c.Keywords = []string{"think"}
+	c.SortOrder = SORT_ORDER_RELEVANCE
+
+	found_ids := []TweetID{}
+	last_relevance := -1
+	for !c.CursorPosition.IsEnd() {
+		feed, err := profile.NextPage(c, UserID(0))
+		require.NoError(err)
+		for _, item := range feed.Items {
+			found_ids = append(found_ids, item.TweetID)
+		}
+		c = feed.CursorBottom
+		if c.CursorPosition == CURSOR_MIDDLE {
+			assert.Greater(c.CursorValue, 0)
+			if last_relevance != -1 {
+				assert.LessOrEqual(c.CursorValue, last_relevance)
+			}
+			last_relevance = c.CursorValue
+		}
+	}
+	assert.ElementsMatch(found_ids, []TweetID{
+		1439067163508150272,
+		1439027915404939265,
+		1428939163961790466,
+		1413772782358433792,
+		1343633011364016128,
+	})
+}
+
+// Saving a Tweet or Url should update the search index; search terms can match part of a word
+func TestSearchIndexUpdatedOnSave(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestSearchIndex"
+	profile := create_or_load_profile(profile_path)
+
+	user := create_dummy_user()
+	require.NoError(profile.SaveUser(&user))
+	tweet := create_dummy_tweet()
+	tweet.UserID = user.ID
+	tweet.Urls = []Url{}
+	unique_word := fmt.Sprintf("zorblax%d", rand.Int())
+	tweet.Text = fmt.Sprintf("The %s keeps running", unique_word)
+	require.NoError(profile.SaveTweet(tweet))
+
+	c := NewCursor()
+	c.Keywords = []string{unique_word, "RUN"}
+	feed, err := profile.NextPage(c, UserID(0))
+	require.NoError(err)
+	require.Len(feed.Items, 1)
+	assert.Equal(feed.Items[0].TweetID, tweet.ID)
+
+	// Search in a link's title
+	url := create_url_from_id(rand.Int())
+	url.TweetID = tweet.ID
+	url.Title = fmt.Sprintf("Link title glimmerfax%d", rand.Int())
+	require.NoError(profile.SaveUrl(url))
+
+	c.Keywords = []string{url.Title[len("Link title "):]}
+	feed, err = profile.NextPage(c, UserID(0))
+	require.NoError(err)
+	require.Len(feed.Items, 1)
+	assert.Equal(feed.Items[0].TweetID, tweet.ID)
+}
+
+// Search terms with punctuation or quotes shouldn't cause errors
+func TestSearchKeywordsWithPunctuation(t *testing.T) {
+	require := require.New(t)
+
+	profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+
+	c := NewCursor()
+	for _, kw := range []string{`"`, `-`, `a"b`, `*`, `OR`, `(`, `NEAR/3`} {
+		c.Keywords = []string{kw}
+		_, err := profile.NextPage(c, UserID(0))
+		require.NoError(err, kw)
+	}
+}
+
+// Keywords too short for the search index should still match
+func TestSearchShortKeywords(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestSearchIndex"
+	profile := create_or_load_profile(profile_path)
+
+	tweet := create_dummy_tweet()
+	unique_word := fmt.Sprintf("zq%d", rand.Int())
+	tweet.Text = fmt.Sprintf("Tweet about %s and AI", unique_word)
+	require.NoError(profile.SaveTweet(tweet))
+
+	c := NewCursor()
+	c.Keywords = []string{unique_word, "ai"}
+	feed, err := profile.NextPage(c, UserID(0))
+	require.NoError(err)
+	require.Len(feed.Items, 1)
+	assert.Equal(feed.Items[0].TweetID, tweet.ID)
+
+	// Also in search expressions
+	c, err = NewCursorFromSearchQuery(fmt.Sprintf("%s (ai OR xq)", unique_word))
+	require.NoError(err)
+	feed, err = profile.NextPage(c, UserID(0))
+	require.NoError(err)
+	assert.Len(feed.Items, 1)
+}
+
+// Results with the same relevance shouldn't be skipped at page boundaries
+func TestSearchByRelevanceWithTies(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestSearchIndex"
+	profile := create_or_load_profile(profile_path)
+
+	unique_word := fmt.Sprintf("tiebreak%d", rand.Int())
+	expected_ids := []TweetID{}
+	for i := 0; i < 3; i++ {
+		tweet := create_dummy_tweet()
+		tweet.Text = fmt.Sprintf("Same text %s", unique_word)
+		require.NoError(profile.SaveTweet(tweet))
+		expected_ids = append(expected_ids, tweet.ID)
+	}
+
+	c := NewCursor()
+	c.Keywords = []string{unique_word}
+	c.SortOrder = SORT_ORDER_RELEVANCE
+	c.PageSize = 1
+	found_ids := []TweetID{}
+	for !c.CursorPosition.IsEnd() {
+		feed, err := profile.NextPage(c, UserID(0))
+		require.NoError(err)
+		for _, item := range feed.Items {
+			found_ids = append(found_ids, item.TweetID)
+		}
+		c = feed.CursorBottom
+	}
+	assert.ElementsMatch(expected_ids, found_ids)
+}
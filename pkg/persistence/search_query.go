@@ -0,0 +1,458 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A node in a parsed search query.  Search queries support:
+//   - keywords and quoted phrases: `think tank`, `"think tank"`
+//   - operators, like `from:handle` or `filter:links` (see `Cursor.apply_token`)
+//   - negation of any term or group: `-keyword`, `-from:handle`, `-(a OR b)`
+//   - "OR" between terms or groups: `from:a OR from:b`
+//   - parenthesized groups: `(from:a OR from:b) -filter:replies`
+//
+// Terms next to each other are AND'ed together; "OR" binds more tightly than AND, i.e., `a b OR c`
+// means `a (b OR c)`, like on Twitter.
+type QueryNode interface {
+	// Compile the node to a SQL boolean expression, along with its bind values.  Nodes that don't
+	// filter anything (e.g., a filter with an unknown value) compile to an empty string.
+	where_clause() (string, []interface{}, error)
+}
+
+// A single keyword, phrase or operator (e.g., `from:handle`)
+type QueryTerm struct {
+	Text     string
+	IsPhrase bool // Quoted terms are always keywords, never operators
+	Position int
+}
+
+type QueryNot struct {
+	Operand QueryNode
+}
+
+type QueryAnd struct {
+	Operands []QueryNode
+}
+
+type QueryOr struct {
+	Operands []QueryNode
+}
+
+func (t QueryTerm) where_clause() (string, []interface{}, error) {
+	c := Cursor{SinceTimestamp: TimestampFromUnix(0), UntilTimestamp: TimestampFromUnix(0)}
+	if t.IsPhrase {
+		c.Keywords = []string{t.Text}
+	} else if err := c.apply_token(t.Text); err != nil {
+		return "", nil, err
+	}
+	where_clauses, bind_values := c.filter_where_clauses()
+
+	// Keywords, "liked by" and "bookmarked by" are joins in the main query, but have to be
+	// subqueries in an expression
+	if match_expr := keywords_to_match_expression(c.Keywords); match_expr != "" {
+		where_clauses = append(where_clauses, "tweets.id in (select rowid from tweets_fts where tweets_fts match ?)")
+		bind_values = append(bind_values, match_expr)
+	}
+	if c.LikedByUserHandle != "" {
+		where_clauses = append(where_clauses, `exists (select 1 from likes l where l.tweet_id = tweets.id
+		                                                 and l.user_id = (select id from users_by_handle where handle like ?))`)
+		bind_values = append(bind_values, c.LikedByUserHandle)
+	}
+	if c.BookmarkedByUserHandle != "" {
+		where_clauses = append(where_clauses, `exists (select 1 from bookmarks b where b.tweet_id = tweets.id
+		                                                 and b.user_id = (select id from users_by_handle where handle like ?))`)
+		bind_values = append(bind_values, c.BookmarkedByUserHandle)
+	}
+
+	if len(where_clauses) == 0 {
+		// E.g., a filter with an unknown value, which is ignored
+		return "", bind_values, nil
+	}
+	return "(" + strings.Join(where_clauses, " and ") + ")", bind_values, nil
+}
+
+func (n QueryNot) where_clause() (string, []interface{}, error) {
+	clause, bind_values, err := n.Operand.where_clause()
+	if err != nil || clause == "" {
+		// Negating something that's ignored is also ignored
+		return "", bind_values, err
+	}
+	return "not " + clause, bind_values, nil
+}
+
+func (n QueryAnd) where_clause() (string, []interface{}, error) {
+	return join_where_clauses(n.Operands, " and ")
+}
+
+func (n QueryOr) where_clause() (string, []interface{}, error) {
+	return join_where_clauses(n.Operands, " or ")
+}
+
+// Ignored operands match everything, so they're left out of an "and"; and an "or" with one in it
+// matches everything, so it's ignored too
+func join_where_clauses(nodes []QueryNode, separator string) (string, []interface{}, error) {
+	clauses := []string{}
+	bind_values := []interface{}{}
+	has_ignored_operand := false
+	for _, node := range nodes {
+		clause, binds, err := node.where_clause()
+		if err != nil {
+			return "", nil, err
+		}
+		if clause == "" {
+			has_ignored_operand = true
+			continue
+		}
+		clauses = append(clauses, clause)
+		bind_values = append(bind_values, binds...)
+	}
+	if len(clauses) == 0 || (has_ignored_operand && separator == " or ") {
+		return "", []interface{}{}, nil
+	}
+	return "(" + strings.Join(clauses, separator) + ")", bind_values, nil
+}
+
+// Whether a query expression can match retweets.  Retweets are excluded from searches by default,
+// so if it can, that default has to be turned off.
+func query_includes_retweets(node QueryNode) bool {
+	switch n := node.(type) {
+	case QueryTerm:
+		return !n.IsPhrase && (strings.HasPrefix(n.Text, "retweeted_by:") || strings.HasPrefix(n.Text, "by:") ||
+			n.Text == "filter:retweets")
+	case QueryNot:
+		return query_includes_retweets(n.Operand)
+	case QueryAnd:
+		for _, operand := range n.Operands {
+			if query_includes_retweets(operand) {
+				return true
+			}
+		}
+	case QueryOr:
+		for _, operand := range n.Operands {
+			if query_includes_retweets(operand) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type query_token_type int
+
+const (
+	QUERY_TOKEN_TERM query_token_type = iota
+	QUERY_TOKEN_PHRASE
+	QUERY_TOKEN_NOT
+	QUERY_TOKEN_OR
+	QUERY_TOKEN_OPEN_PAREN
+	QUERY_TOKEN_CLOSE_PAREN
+)
+
+type query_token struct {
+	Type     query_token_type
+	Text     string
+	Position int // 1-indexed character position in the query string, for error messages
+}
+
+func query_error(position int, msg string) error {
+	return fmt.Errorf("%w (%s), at position %d", ErrInvalidQuery, msg, position)
+}
+
+// Split a search query into tokens
+func tokenize_search_query(q string) ([]query_token, error) {
+	ret := []query_token{}
+	chars := []rune(q)
+	for i := 0; i < len(chars); i++ {
+		switch chars[i] {
+		case ' ', '\t', '\n':
+			continue
+		case '(':
+			ret = append(ret, query_token{Type: QUERY_TOKEN_OPEN_PAREN, Text: "(", Position: i + 1})
+			continue
+		case ')':
+			ret = append(ret, query_token{Type: QUERY_TOKEN_CLOSE_PAREN, Text: ")", Position: i + 1})
+			continue
+		case '-':
+			if i+1 < len(chars) && !strings.ContainsRune(" \t\n)", chars[i+1]) {
+				ret = append(ret, query_token{Type: QUERY_TOKEN_NOT, Text: "-", Position: i + 1})
+				continue
+			}
+			// Otherwise, it's just a hyphen; treat it as a regular term
+		}
+
+		// It's a term; read until whitespace or a paren.  Quoted sections can contain those, and a
+		// closing quote ends the term.
+		start := i
+		is_in_quotes := false
+		quote_position := 0
+		text := ""
+		for ; i < len(chars); i++ {
+			if chars[i] == '"' {
+				if is_in_quotes {
+					is_in_quotes = false
+					break
+				}
+				is_in_quotes = true
+				quote_position = i + 1
+				continue
+			}
+			if !is_in_quotes && strings.ContainsRune(" \t\n()", chars[i]) {
+				i-- // Let the outer loop handle it
+				break
+			}
+			text += string(chars[i])
+		}
+		if is_in_quotes {
+			return nil, fmt.Errorf("%w, at position %d", ErrUnmatchedQuotes, quote_position)
+		}
+
+		switch {
+		case chars[start] == '"':
+			if strings.TrimSpace(text) == "" {
+				continue // Ignore empty phrases
+			}
+			ret = append(ret, query_token{Type: QUERY_TOKEN_PHRASE, Text: text, Position: start + 1})
+		case text == "OR":
+			ret = append(ret, query_token{Type: QUERY_TOKEN_OR, Text: text, Position: start + 1})
+		default:
+			ret = append(ret, query_token{Type: QUERY_TOKEN_TERM, Text: text, Position: start + 1})
+		}
+	}
+	return ret, nil
+}
+
+type query_parser struct {
+	tokens []query_token
+	index  int
+	length int // Length of the query string, for "end of query" error positions
+}
+
+func (p *query_parser) peek() (query_token, bool) {
+	if p.index >= len(p.tokens) {
+		return query_token{Position: p.length + 1}, false
+	}
+	return p.tokens[p.index], true
+}
+
+// Parse a search query into a syntax tree.  Returns `nil` if the query is empty.
+//
+// Errors wrap `ErrInvalidQuery`, and include the position in the query where the error occurred.
+func ParseSearchQuery(q string) (QueryNode, error) {
+	tokens, err := tokenize_search_query(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := query_parser{tokens: tokens, length: len([]rune(q))}
+	ret, err := p.parse_and()
+	if err != nil {
+		return nil, err
+	}
+	if token, is_ok := p.peek(); is_ok {
+		// Only a close-paren can stop `parse_and` early
+		return nil, query_error(token.Position, "unmatched ')'")
+	}
+	return ret, nil
+}
+
+// and_expr := or_expr+
+func (p *query_parser) parse_and() (QueryNode, error) {
+	operands := []QueryNode{}
+	for {
+		token, is_ok := p.peek()
+		if !is_ok || token.Type == QUERY_TOKEN_CLOSE_PAREN {
+			break
+		}
+		node, err := p.parse_or()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, node)
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return QueryAnd{Operands: operands}, nil
+}
+
+// or_expr := unary ("OR" unary)*
+func (p *query_parser) parse_or() (QueryNode, error) {
+	node, err := p.parse_unary()
+	if err != nil {
+		return nil, err
+	}
+	operands := []QueryNode{node}
+	for {
+		token, is_ok := p.peek()
+		if !is_ok || token.Type != QUERY_TOKEN_OR {
+			break
+		}
+		p.index++
+		if next, is_ok := p.peek(); !is_ok || next.Type == QUERY_TOKEN_OR || next.Type == QUERY_TOKEN_CLOSE_PAREN {
+			return nil, query_error(token.Position, "expected a search term after 'OR'")
+		}
+		node, err := p.parse_unary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, node)
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return QueryOr{Operands: operands}, nil
+}
+
+// unary := "-" unary | "(" and_expr ")" | term
+func (p *query_parser) parse_unary() (QueryNode, error) {
+	token, is_ok := p.peek()
+	if !is_ok {
+		return nil, query_error(token.Position, "expected a search term at end of query")
+	}
+	p.index++
+
+	switch token.Type {
+	case QUERY_TOKEN_NOT:
+		next, is_ok := p.peek()
+		if !is_ok || next.Type == QUERY_TOKEN_OR || next.Type == QUERY_TOKEN_CLOSE_PAREN {
+			return nil, query_error(token.Position, "expected a search term after '-'")
+		}
+		operand, err := p.parse_unary()
+		if err != nil {
+			return nil, err
+		}
+		return QueryNot{Operand: operand}, nil
+	case QUERY_TOKEN_OPEN_PAREN:
+		if next, is_ok := p.peek(); is_ok && next.Type == QUERY_TOKEN_CLOSE_PAREN {
+			return nil, query_error(token.Position, "empty parentheses")
+		}
+		node, err := p.parse_and()
+		if err != nil {
+			return nil, err
+		}
+		if _, is_ok := p.peek(); !is_ok {
+			return nil, query_error(token.Position, "unmatched '('")
+		}
+		p.index++ // Consume the close-paren
+		return node, nil
+	case QUERY_TOKEN_OR:
+		return nil, query_error(token.Position, "'OR' must be between two search terms")
+	case QUERY_TOKEN_CLOSE_PAREN:
+		return nil, query_error(token.Position, "unmatched ')'")
+	case QUERY_TOKEN_PHRASE:
+		return QueryTerm{Text: token.Text, IsPhrase: true, Position: token.Position}, nil
+	default:
+		// Check that it's a valid operator
+		c := NewCursor()
+		if err := c.apply_token(token.Text); err != nil {
+			return nil, fmt.Errorf("%w, at position %d", err, token.Position)
+		}
+		return QueryTerm{Text: token.Text, Position: token.Position}, nil
+	}
+}
+
+// Convert a search query to one that Twitter's search understands, for scraping.  Operators that
+// only work locally (e.g., `liked_by:` or `tombstone:`) are left out, which makes the remote search
+// broader than the local one; that's fine, since the results are searched locally afterward anyway.
+// `by:` becomes `from:`, since Twitter's search doesn't include retweets.
+//
+// Returns an empty string if there's nothing left to search for.
+func ToTwitterSearchQuery(q string) (string, error) {
+	root, err := ParseSearchQuery(q)
+	if err != nil || root == nil {
+		return "", err
+	}
+	if and_node, is_ok := root.(QueryAnd); is_ok {
+		// No parentheses needed at the top level
+		return strings.Join(to_twitter_search_query_operands(and_node.Operands), " "), nil
+	}
+	return to_twitter_search_query(root), nil
+}
+
+// Operators Twitter's search supports the same way, and what `filter:` values become
+var twitter_search_operators = map[string]bool{"from": true, "to": true, "since": true, "until": true, "list": true,
+	"quoted_tweet_id": true}
+var twitter_search_filters = map[string]string{"links": "links", "images": "images", "videos": "videos",
+	"media": "media", "replies": "replies", "spaces": "spaces", "retweets": "nativeretweets"}
+
+func to_twitter_search_query(node QueryNode) string {
+	switch n := node.(type) {
+	case QueryTerm:
+		if n.IsPhrase {
+			return `"` + n.Text + `"`
+		}
+		operator, value, is_operator := strings.Cut(n.Text, ":")
+		switch {
+		case !is_operator:
+			return n.Text
+		case twitter_search_operators[operator]:
+			return n.Text
+		case operator == "by":
+			return "from:" + value
+		case operator == "filter" && twitter_search_filters[value] != "":
+			return "filter:" + twitter_search_filters[value]
+		}
+		return ""
+	case QueryNot:
+		if !is_exact_twitter_search_query(n.Operand) {
+			// Negating a broader search would make this one narrower, so leave it out
+			return ""
+		}
+		return "-" + to_twitter_search_query(n.Operand)
+	case QueryAnd:
+		operands := to_twitter_search_query_operands(n.Operands)
+		if len(operands) <= 1 {
+			return strings.Join(operands, "")
+		}
+		return "(" + strings.Join(operands, " ") + ")"
+	case QueryOr:
+		operands := []string{}
+		for _, operand := range n.Operands {
+			s := to_twitter_search_query(operand)
+			if s == "" {
+				// Leaving out one of the alternatives would make the search narrower, so leave out all of them
+				return ""
+			}
+			operands = append(operands, s)
+		}
+		return "(" + strings.Join(operands, " OR ") + ")"
+	}
+	panic(fmt.Sprintf("unknown query node type: %T", node))
+}
+
+// Convert the operands of an AND, leaving out the ones Twitter doesn't support
+func to_twitter_search_query_operands(nodes []QueryNode) []string {
+	ret := []string{}
+	for _, node := range nodes {
+		if s := to_twitter_search_query(node); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// Whether a query expression can be converted for Twitter's search without leaving anything out
+func is_exact_twitter_search_query(node QueryNode) bool {
+	switch n := node.(type) {
+	case QueryTerm:
+		return to_twitter_search_query(n) != ""
+	case QueryNot:
+		return is_exact_twitter_search_query(n.Operand)
+	case QueryAnd:
+		for _, operand := range n.Operands {
+			if !is_exact_twitter_search_query(operand) {
+				return false
+			}
+		}
+	case QueryOr:
+		for _, operand := range n.Operands {
+			if !is_exact_twitter_search_query(operand) {
+				return false
+			}
+		}
+	}
+	return true
+}
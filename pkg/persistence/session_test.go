@@ -31,7 +31,8 @@ func TestSaveAndLoadAuthenticatedSession(t *testing.T) {
 			Timeout: 10 * time.Second,
 			Jar:     jar,
 		},
-		CSRFToken: fmt.Sprint(rand.Int()),
+		CSRFToken:   fmt.Sprint(rand.Int()),
+		RateLimiter: scraper.NewRateLimiter(),
 	}
 
 	// Save and load the session; it should come back the same
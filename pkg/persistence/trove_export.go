@@ -0,0 +1,880 @@
+package persistence
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Portable export format for the contents of a TweetTrove, as JSON Lines.  Each line is a record
+// like `{"type": "tweet", "data": {...}}`, where "data" is the JSON encoding of the object.  The
+// first line is always a header (`TroveExportHeader`).
+//
+// Records are written in dependency order (users before the tweets that reference them, etc.), so
+// they can be saved in the order they're read.
+//
+// Increment the format version whenever the format changes incompatibly.
+const TROVE_EXPORT_FORMAT_VERSION = 1
+
+// An export can be "bundled" with its media, as a zip file containing the JSONL file and the media
+// files, with the same directory layout as in a Profile (e.g., "images/ab/abcd.jpg")
+const TROVE_EXPORT_BUNDLE_JSONL_FILENAME = "trove.jsonl"
+
+// Profile subdirectories whose contents can be bundled with an export
+var TROVE_EXPORT_MEDIA_DIRS = []string{"images", "videos", "video_thumbnails", "link_preview_images", "profile_images"}
+
+// How many tweets or messages to fetch at a time when exporting
+const TROVE_EXPORT_BATCH_SIZE = 500
+
+var (
+	ErrInvalidExport            = errors.New("invalid export file")
+	ErrUnsupportedExportVersion = errors.New("unsupported export format version")
+)
+
+const (
+	TROVE_EXPORT_RECORD_HEADER       = "header"
+	TROVE_EXPORT_RECORD_USER         = "user"
+	TROVE_EXPORT_RECORD_SPACE        = "space"
+	TROVE_EXPORT_RECORD_TWEET        = "tweet"
+	TROVE_EXPORT_RECORD_RETWEET      = "retweet"
+	TROVE_EXPORT_RECORD_LIKE         = "like"
+	TROVE_EXPORT_RECORD_BOOKMARK     = "bookmark"
+	TROVE_EXPORT_RECORD_NOTIFICATION = "notification"
+	TROVE_EXPORT_RECORD_CHAT_ROOM    = "chat_room"
+	TROVE_EXPORT_RECORD_CHAT_MESSAGE = "chat_message"
+)
+
+type TroveExportHeader struct {
+	FormatVersion   int       `json:"format_version"`
+	DatabaseVersion int       `json:"database_version"` // Of the profile it was exported from
+	ExportedAt      Timestamp `json:"exported_at"`
+	Query           string    `json:"query"` // Search query used to filter the export; empty for a full export
+}
+
+type trove_export_record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// How many of each thing were written to an export
+type TroveExportCounts struct {
+	NumUsers         int
+	NumSpaces        int
+	NumTweets        int
+	NumRetweets      int
+	NumLikes         int
+	NumBookmarks     int
+	NumNotifications int
+	NumRooms         int
+	NumMessages      int
+}
+
+// Writes an export in the JSONL format, one TweetTrove at a time, so that a large export doesn't
+// have to be held in memory all at once
+type trove_export_writer struct {
+	encoder *json.Encoder
+	counts  TroveExportCounts
+}
+
+// Create a trove_export_writer, and write the header
+func new_trove_export_writer(w io.Writer, query string) (*trove_export_writer, error) {
+	ret := trove_export_writer{encoder: json.NewEncoder(w)}
+	ret.encoder.SetEscapeHTML(false)
+	err := ret.write_record(TROVE_EXPORT_RECORD_HEADER, TroveExportHeader{
+		FormatVersion:   TROVE_EXPORT_FORMAT_VERSION,
+		DatabaseVersion: ENGINE_DATABASE_VERSION,
+		ExportedAt:      Timestamp{time.Now().Truncate(time.Millisecond)},
+		Query:           query,
+	})
+	return &ret, err
+}
+
+func (w *trove_export_writer) write_record(record_type string, obj interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("Error encoding %s: %#v\n  %w", record_type, obj, err)
+	}
+	return w.encoder.Encode(trove_export_record{Type: record_type, Data: data})
+}
+
+// Write the contents of a TweetTrove, in dependency order.  Polls, URLs, images and videos are
+// included in their tweets (or DM messages).
+func (w *trove_export_writer) write_trove(trove TweetTrove) error {
+	// Sort everything, so the output is deterministic
+	for _, id := range slices.Sorted(maps.Keys(trove.Users)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_USER, trove.Users[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Spaces)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_SPACE, trove.Spaces[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Tweets)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_TWEET, trove.Tweets[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Retweets)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_RETWEET, trove.Retweets[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Likes)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_LIKE, trove.Likes[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Bookmarks)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_BOOKMARK, trove.Bookmarks[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Notifications)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_NOTIFICATION, trove.Notifications[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Rooms)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_CHAT_ROOM, trove.Rooms[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(trove.Messages)) {
+		if err := w.write_record(TROVE_EXPORT_RECORD_CHAT_MESSAGE, trove.Messages[id]); err != nil {
+			return err
+		}
+	}
+	w.counts.add(trove)
+	return nil
+}
+
+func (c *TroveExportCounts) add(trove TweetTrove) {
+	c.NumUsers += len(trove.Users)
+	c.NumSpaces += len(trove.Spaces)
+	c.NumTweets += len(trove.Tweets)
+	c.NumRetweets += len(trove.Retweets)
+	c.NumLikes += len(trove.Likes)
+	c.NumBookmarks += len(trove.Bookmarks)
+	c.NumNotifications += len(trove.Notifications)
+	c.NumRooms += len(trove.Rooms)
+	c.NumMessages += len(trove.Messages)
+}
+
+// Write the contents of a TweetTrove in the JSONL export format
+func WriteTweetTroveJSONL(w io.Writer, trove TweetTrove, query string) error {
+	writer, err := new_trove_export_writer(w, query)
+	if err != nil {
+		return err
+	}
+	return writer.write_trove(trove)
+}
+
+// Export the contents of the Profile in the JSONL format.  If `query` is given, only the matching
+// tweets are exported (see `GetTweetTroveForExport`).  The export is fetched and written one batch
+// at a time, so it doesn't have to fit in memory.
+func (p Profile) ExportJSONL(w io.Writer, query string) (TroveExportCounts, error) {
+	writer, err := new_trove_export_writer(w, query)
+	if err != nil {
+		return TroveExportCounts{}, err
+	}
+	err = p.for_each_export_batch(query, writer.write_trove)
+	return writer.counts, err
+}
+
+// Read a TweetTrove from the JSONL export format.
+//
+// Errors wrap `ErrInvalidExport`, or `ErrUnsupportedExportVersion` if it was written by a newer
+// version of this program.
+func ReadTweetTroveJSONL(r io.Reader) (TweetTrove, TroveExportHeader, error) {
+	trove := NewTweetTrove()
+	var header TroveExportHeader
+
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record trove_export_record
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return trove, header, fmt.Errorf("%w: line %d: %s", ErrInvalidExport, line, err.Error())
+		}
+
+		if line == 1 {
+			if record.Type != TROVE_EXPORT_RECORD_HEADER {
+				return trove, header, fmt.Errorf("%w: first line should be a header, but it's a %q", ErrInvalidExport, record.Type)
+			}
+			if err := json.Unmarshal(record.Data, &header); err != nil {
+				return trove, header, fmt.Errorf("%w: header: %s", ErrInvalidExport, err.Error())
+			}
+			if header.FormatVersion > TROVE_EXPORT_FORMAT_VERSION {
+				return trove, header, fmt.Errorf("%w: %d (this version of the program supports up to version %d)",
+					ErrUnsupportedExportVersion, header.FormatVersion, TROVE_EXPORT_FORMAT_VERSION)
+			}
+			continue
+		}
+
+		err = trove.add_export_record(record)
+		if err != nil {
+			return trove, header, fmt.Errorf("%w: line %d: %s", ErrInvalidExport, line, err.Error())
+		}
+	}
+	if header.FormatVersion == 0 {
+		return trove, header, fmt.Errorf("%w: no header found", ErrInvalidExport)
+	}
+	return trove, header, nil
+}
+
+func (trove *TweetTrove) add_export_record(record trove_export_record) error {
+	switch record.Type {
+	case TROVE_EXPORT_RECORD_USER:
+		var u User
+		if err := json.Unmarshal(record.Data, &u); err != nil {
+			return err
+		}
+		trove.Users[u.ID] = u
+	case TROVE_EXPORT_RECORD_SPACE:
+		var s Space
+		if err := json.Unmarshal(record.Data, &s); err != nil {
+			return err
+		}
+		trove.Spaces[s.ID] = s
+	case TROVE_EXPORT_RECORD_TWEET:
+		var t Tweet
+		if err := json.Unmarshal(record.Data, &t); err != nil {
+			return err
+		}
+		trove.Tweets[t.ID] = t
+	case TROVE_EXPORT_RECORD_RETWEET:
+		var r Retweet
+		if err := json.Unmarshal(record.Data, &r); err != nil {
+			return err
+		}
+		trove.Retweets[r.RetweetID] = r
+	case TROVE_EXPORT_RECORD_LIKE:
+		var l Like
+		if err := json.Unmarshal(record.Data, &l); err != nil {
+			return err
+		}
+		trove.add_like(l)
+	case TROVE_EXPORT_RECORD_BOOKMARK:
+		var b Bookmark
+		if err := json.Unmarshal(record.Data, &b); err != nil {
+			return err
+		}
+		trove.add_bookmark(b)
+	case TROVE_EXPORT_RECORD_NOTIFICATION:
+		var n Notification
+		if err := json.Unmarshal(record.Data, &n); err != nil {
+			return err
+		}
+		trove.Notifications[n.ID] = n
+	case TROVE_EXPORT_RECORD_CHAT_ROOM:
+		var r DMChatRoom
+		if err := json.Unmarshal(record.Data, &r); err != nil {
+			return err
+		}
+		trove.Rooms[r.ID] = r
+	case TROVE_EXPORT_RECORD_CHAT_MESSAGE:
+		var m DMMessage
+		if err := json.Unmarshal(record.Data, &m); err != nil {
+			return err
+		}
+		trove.Messages[m.ID] = m
+	default:
+		return fmt.Errorf("unknown record type %q", record.Type)
+	}
+	return nil
+}
+
+// Add a Like to the trove.  Sort IDs aren't unique (e.g., "-1" means "unknown"), so if the sort ID
+// is already taken, the Like is stored under a different map key; it's saved with its real sort ID.
+func (trove *TweetTrove) add_like(l Like) {
+	key := l.SortID
+	for _, is_taken := trove.Likes[key]; is_taken; _, is_taken = trove.Likes[key] {
+		key--
+	}
+	trove.Likes[key] = l
+}
+
+// DUPE: add_like
+func (trove *TweetTrove) add_bookmark(b Bookmark) {
+	key := b.SortID
+	for _, is_taken := trove.Bookmarks[key]; is_taken; _, is_taken = trove.Bookmarks[key] {
+		key--
+	}
+	trove.Bookmarks[key] = b
+}
+
+// Get the contents of the Profile to be exported, as a single TweetTrove.  If `query` is given, it's
+// a search query (see `NewCursorFromSearchQuery`), and only the matching tweets and retweets are
+// exported, along with their authors, quoted tweets, spaces, likes and bookmarks.  Otherwise
+// everything is exported, including notifications and DMs.
+//
+// This holds the whole export in memory; to write an export, use `ExportJSONL` or `ExportBundle`.
+func (p Profile) GetTweetTroveForExport(query string) (TweetTrove, error) {
+	trove := NewTweetTrove()
+	err := p.for_each_export_batch(query, func(batch TweetTrove) error {
+		// Sort IDs aren't unique, so likes and bookmarks can't just be merged by key
+		for _, l := range batch.Likes {
+			trove.add_like(l)
+		}
+		for _, b := range batch.Bookmarks {
+			trove.add_bookmark(b)
+		}
+		batch.Likes = nil
+		batch.Bookmarks = nil
+		trove.MergeWith(batch)
+		return nil
+	})
+	return trove, err
+}
+
+// Call `f` with the contents of the Profile to be exported (see `GetTweetTroveForExport`), one batch
+// at a time.  Batches don't overlap, and they come in dependency order, i.e., each batch only refers
+// to things in it or in previous batches.  Stops at the first error.
+func (p Profile) for_each_export_batch(query string, f func(TweetTrove) error) error {
+	if query == "" {
+		return p.for_each_full_export_batch(f)
+	}
+
+	c, err := NewCursorFromSearchQuery(query)
+	if err != nil {
+		return err
+	}
+	c.PageSize = TROVE_EXPORT_BATCH_SIZE
+	c.ShowMuted = true // Mutes only affect what's displayed
+
+	// Pages can overlap (e.g., a tweet quoted by tweets on different pages), so keep track of what's
+	// been exported already
+	exported_users := map[UserID]bool{}
+	exported_spaces := map[SpaceID]bool{}
+	exported_tweets := map[TweetID]bool{}
+	exported_retweets := map[TweetID]bool{}
+	for !c.CursorPosition.IsEnd() {
+		feed, err := p.NextPage(c, UserID(0))
+		if err != nil {
+			return err
+		}
+		c = feed.CursorBottom
+
+		batch := NewTweetTrove()
+		for id, u := range feed.Users {
+			if !exported_users[id] {
+				batch.Users[id] = u
+				exported_users[id] = true
+			}
+		}
+		for id, s := range feed.Spaces {
+			if !exported_spaces[id] {
+				batch.Spaces[id] = s
+				exported_spaces[id] = true
+			}
+		}
+		for id, t := range feed.Tweets {
+			if !exported_tweets[id] {
+				batch.Tweets[id] = t
+				exported_tweets[id] = true
+			}
+		}
+		for id, r := range feed.Retweets {
+			if !exported_retweets[id] {
+				batch.Retweets[id] = r
+				exported_retweets[id] = true
+			}
+		}
+
+		// Likes and bookmarks of the exported tweets
+		if len(batch.Tweets) > 0 {
+			in_clause := "(" + strings.Repeat("?,", len(batch.Tweets)-1) + "?)"
+			bind_values := []interface{}{}
+			for id := range batch.Tweets {
+				bind_values = append(bind_values, id)
+			}
+			var likes []Like
+			err := p.DB.Select(&likes, `select sort_order, user_id, tweet_id from likes where tweet_id in `+in_clause, bind_values...)
+			if err != nil {
+				panic(err)
+			}
+			for _, l := range likes {
+				batch.add_like(l)
+			}
+			var bookmarks []Bookmark
+			err = p.DB.Select(&bookmarks, `select sort_order, user_id, tweet_id from bookmarks where tweet_id in `+in_clause,
+				bind_values...)
+			if err != nil {
+				panic(err)
+			}
+			for _, b := range bookmarks {
+				batch.add_bookmark(b)
+			}
+		}
+
+		// Make sure users who liked or bookmarked the tweets are included
+		add_user_if_missing := func(id UserID) {
+			if exported_users[id] {
+				return
+			}
+			u, err := p.GetUserByID(id)
+			if err != nil {
+				panic(fmt.Errorf("Error getting user ID %d for export:\n  %w", id, err))
+			}
+			batch.Users[id] = u
+			exported_users[id] = true
+		}
+		for _, l := range batch.Likes {
+			add_user_if_missing(l.UserID)
+		}
+		for _, b := range batch.Bookmarks {
+			add_user_if_missing(b.UserID)
+		}
+
+		if err := f(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call `f` with everything in the Profile, one batch at a time, in dependency order: all the users,
+// then spaces, tweets, retweets, likes, bookmarks, notifications, chat rooms and messages.
+func (p Profile) for_each_full_export_batch(f func(TweetTrove) error) error {
+	// Users
+	for last_id := UserID(math.MinInt64); ; {
+		var users []User
+		err := p.DB.Select(&users, `select `+USERS_ALL_SQL_FIELDS+` from users where id > ? order by id limit ?`,
+			last_id, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(users) == 0 {
+			break
+		}
+		batch := NewTweetTrove()
+		for _, u := range users {
+			batch.Users[u.ID] = u
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_id = users[len(users)-1].ID
+	}
+
+	// Spaces
+	for last_id := SpaceID(""); ; {
+		var space_ids []SpaceID
+		err := p.DB.Select(&space_ids, `select id from spaces where id > ? order by id limit ?`, last_id, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(space_ids) == 0 {
+			break
+		}
+		batch := NewTweetTrove()
+		for _, id := range space_ids {
+			space, err := p.GetSpaceById(id)
+			if err != nil {
+				panic(err)
+			}
+			batch.Spaces[id] = space
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_id = space_ids[len(space_ids)-1]
+	}
+
+	// Tweets, with their content
+	for last_id := TweetID(math.MinInt64); ; {
+		var tweets []Tweet
+		q, bind_values := tweet_select_query(UserID(0))
+		err := p.DB.Select(&tweets, q+`where tweets.id > ? order by tweets.id limit ?`,
+			append(bind_values, last_id, TROVE_EXPORT_BATCH_SIZE)...)
+		if err != nil {
+			panic(err)
+		}
+		if len(tweets) == 0 {
+			break
+		}
+		content_trove := NewTweetTrove()
+		for _, t := range tweets {
+			content_trove.Tweets[t.ID] = t
+		}
+		p.fill_content(&content_trove, UserID(0))
+
+		// `fill_content` also fetches quoted tweets, users, etc.; only take the tweets in this batch
+		batch := NewTweetTrove()
+		for _, t := range tweets {
+			batch.Tweets[t.ID] = content_trove.Tweets[t.ID]
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_id = tweets[len(tweets)-1].ID
+	}
+
+	for last_id := TweetID(math.MinInt64); ; {
+		var retweets []Retweet
+		err := p.DB.Select(&retweets, `select retweet_id, tweet_id, retweeted_by, retweeted_at from retweets
+		                                where retweet_id > ? order by retweet_id limit ?`, last_id, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(retweets) == 0 {
+			break
+		}
+		batch := NewTweetTrove()
+		for _, r := range retweets {
+			batch.Retweets[r.RetweetID] = r
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_id = retweets[len(retweets)-1].RetweetID
+	}
+
+	// Likes and bookmarks have no unique ID, so they're paged by rowid
+	for last_rowid := 0; ; {
+		var likes []struct {
+			RowID int `db:"rowid"`
+			Like
+		}
+		err := p.DB.Select(&likes, `select rowid, sort_order, user_id, tweet_id from likes where rowid > ? order by rowid limit ?`,
+			last_rowid, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(likes) == 0 {
+			break
+		}
+		batch := NewTweetTrove()
+		for _, l := range likes {
+			batch.add_like(l.Like)
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_rowid = likes[len(likes)-1].RowID
+	}
+	for last_rowid := 0; ; {
+		var bookmarks []struct {
+			RowID int `db:"rowid"`
+			Bookmark
+		}
+		err := p.DB.Select(&bookmarks, `select rowid, sort_order, user_id, tweet_id from bookmarks where rowid > ? order by rowid limit ?`,
+			last_rowid, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(bookmarks) == 0 {
+			break
+		}
+		batch := NewTweetTrove()
+		for _, b := range bookmarks {
+			batch.add_bookmark(b.Bookmark)
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_rowid = bookmarks[len(bookmarks)-1].RowID
+	}
+
+	for last_id := NotificationID(""); ; {
+		var notification_ids []NotificationID
+		err := p.DB.Select(&notification_ids, `select id from notifications where id > ? order by id limit ?`,
+			last_id, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(notification_ids) == 0 {
+			break
+		}
+		batch := NewTweetTrove()
+		for _, id := range notification_ids {
+			batch.Notifications[id] = p.GetNotification(id)
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_id = notification_ids[len(notification_ids)-1]
+	}
+
+	// DMs
+	for last_id := DMChatRoomID(""); ; {
+		var rooms []DMChatRoom
+		err := p.DB.Select(&rooms, `select `+CHAT_ROOMS_ALL_SQL_FIELDS+` from chat_rooms where id > ? order by id limit ?`,
+			last_id, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(rooms) == 0 {
+			break
+		}
+		batch := NewTweetTrove()
+		participants_trove := NewTweetTrove() // The participants' users have already been exported
+		for _, room := range rooms {
+			p.fill_chat_room_participants(&room, &participants_trove)
+			batch.Rooms[room.ID] = room
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_id = rooms[len(rooms)-1].ID
+	}
+	for last_id := DMMessageID(math.MinInt64); ; {
+		var messages []DMMessage
+		err := p.DB.Select(&messages, `select `+CHAT_MESSAGES_ALL_SQL_FIELDS+` from chat_messages where id > ? order by id limit ?`,
+			last_id, TROVE_EXPORT_BATCH_SIZE)
+		if err != nil {
+			panic(err)
+		}
+		if len(messages) == 0 {
+			break
+		}
+		content_trove := NewTweetTrove()
+		for _, m := range messages {
+			m.Reactions = make(map[UserID]DMReaction)
+			content_trove.Messages[m.ID] = m
+		}
+		p.fill_dm_contents(&content_trove)
+
+		// `fill_dm_contents` also fetches replied-to messages, but without their contents; only
+		// take the ones in this batch
+		batch := NewTweetTrove()
+		for _, m := range messages {
+			batch.Messages[m.ID] = content_trove.Messages[m.ID]
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+		last_id = messages[len(messages)-1].ID
+	}
+	return nil
+}
+
+// Get the paths (relative to the Profile directory) of all the media files that the TweetTrove
+// refers to, whether they've been downloaded or not.
+func (trove TweetTrove) MediaPaths() []string {
+	paths := map[string]bool{}
+	add_image := func(img Image) {
+		paths[path.Join("images", img.LocalFilename)] = true
+	}
+	add_video := func(v Video) {
+		paths[path.Join("videos", v.LocalFilename)] = true
+		if v.ThumbnailLocalPath != "" {
+			paths[path.Join("video_thumbnails", v.ThumbnailLocalPath)] = true
+		}
+	}
+	add_url := func(u Url) {
+		if u.HasThumbnail && u.ThumbnailLocalPath != "" {
+			paths[path.Join("link_preview_images", u.ThumbnailLocalPath)] = true
+		}
+	}
+
+	for _, u := range trove.Users {
+		if u.ProfileImageLocalPath != "" {
+			paths[path.Join("profile_images", u.ProfileImageLocalPath)] = true
+		}
+		paths[path.Join("profile_images", u.GetTinyProfileImageLocalPath())] = true
+		if u.BannerImageLocalPath != "" {
+			paths[path.Join("profile_images", u.BannerImageLocalPath)] = true
+		}
+	}
+	for _, t := range trove.Tweets {
+		for _, img := range t.Images {
+			add_image(img)
+		}
+		for _, v := range t.Videos {
+			add_video(v)
+		}
+		for _, u := range t.Urls {
+			add_url(u)
+		}
+	}
+	for _, m := range trove.Messages {
+		for _, img := range m.Images {
+			add_image(img)
+		}
+		for _, v := range m.Videos {
+			add_video(v)
+		}
+		for _, u := range m.Urls {
+			add_url(u)
+		}
+	}
+	return slices.Sorted(maps.Keys(paths))
+}
+
+// Export the contents of the Profile as a bundle: a zip file containing the JSONL export, plus
+// whichever of its media files have been downloaded in this Profile.  Like `ExportJSONL`, it's
+// fetched and written one batch at a time; only the list of media files is kept in memory.
+func (p Profile) ExportBundle(w io.Writer, query string) (TroveExportCounts, error) {
+	zip_writer := zip.NewWriter(w)
+	jsonl_writer, err := zip_writer.Create(TROVE_EXPORT_BUNDLE_JSONL_FILENAME)
+	if err != nil {
+		return TroveExportCounts{}, fmt.Errorf("Error creating export bundle:\n  %w", err)
+	}
+	writer, err := new_trove_export_writer(jsonl_writer, query)
+	if err != nil {
+		return TroveExportCounts{}, err
+	}
+
+	// A zip file can only be written one file at a time, so the media files have to wait until the
+	// JSONL file is finished
+	media_paths := map[string]bool{}
+	err = p.for_each_export_batch(query, func(batch TweetTrove) error {
+		for _, media_path := range batch.MediaPaths() {
+			media_paths[media_path] = true
+		}
+		return writer.write_trove(batch)
+	})
+	if err != nil {
+		return writer.counts, err
+	}
+
+	for _, media_path := range slices.Sorted(maps.Keys(media_paths)) {
+		if err := p.add_media_file_to_bundle(zip_writer, media_path); err != nil {
+			return writer.counts, err
+		}
+	}
+	return writer.counts, zip_writer.Close()
+}
+
+// Copy a media file into an export bundle, if it's been downloaded
+func (p Profile) add_media_file_to_bundle(zip_writer *zip.Writer, media_path string) error {
+	in, err := os.Open(filepath.Join(p.ProfileDir, media_path))
+	if errors.Is(err, os.ErrNotExist) {
+		// Not downloaded
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Error reading media file %q:\n  %w", media_path, err)
+	}
+	defer in.Close()
+
+	// Media files are already compressed, so don't bother compressing them again
+	out, err := zip_writer.CreateHeader(&zip.FileHeader{Name: media_path, Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("Error adding media file %q to export bundle:\n  %w", media_path, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("Error adding media file %q to export bundle:\n  %w", media_path, err)
+	}
+	return nil
+}
+
+// Read an export bundle, copying its media files into the Profile.  Existing files aren't
+// overwritten.  The returned TweetTrove still has to be imported (see `ImportTweetTrove`).
+func (p Profile) ReadTweetTroveBundle(r *zip.Reader) (TweetTrove, TroveExportHeader, error) {
+	jsonl_file, err := r.Open(TROVE_EXPORT_BUNDLE_JSONL_FILENAME)
+	if err != nil {
+		return NewTweetTrove(), TroveExportHeader{}, fmt.Errorf("%w: no %s found in bundle", ErrInvalidExport,
+			TROVE_EXPORT_BUNDLE_JSONL_FILENAME)
+	}
+	defer jsonl_file.Close()
+	trove, header, err := ReadTweetTroveJSONL(jsonl_file)
+	if err != nil {
+		return trove, header, err
+	}
+
+	for _, f := range r.File {
+		if f.Name == TROVE_EXPORT_BUNDLE_JSONL_FILENAME || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		// Only accept files in the media directories, and don't allow escaping them
+		dir, _, _ := strings.Cut(f.Name, "/")
+		if !slices.Contains(TROVE_EXPORT_MEDIA_DIRS, dir) || path.Clean(f.Name) != f.Name || strings.Contains(f.Name, "..") {
+			return trove, header, fmt.Errorf("%w: unexpected file in bundle: %q", ErrInvalidExport, f.Name)
+		}
+		outfile := filepath.Join(p.ProfileDir, filepath.FromSlash(f.Name))
+		if file_exists(outfile) {
+			continue
+		}
+		if err := copy_zip_file(f, outfile); err != nil {
+			return trove, header, err
+		}
+	}
+	return trove, header, nil
+}
+
+func copy_zip_file(f *zip.File, outfile string) error {
+	reader, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("Error opening %q in export bundle:\n  %w", f.Name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("Error reading %q in export bundle:\n  %w", f.Name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(outfile), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %q:\n  %w", outfile, err)
+	}
+	if err := os.WriteFile(outfile, data, 0644); err != nil {
+		return fmt.Errorf("Error writing %q:\n  %w", outfile, err)
+	}
+	return nil
+}
+
+// Save an imported TweetTrove.  Any media that isn't present in this Profile is marked as not
+// downloaded, so it can be downloaded later.  Since it's saved with `SaveTweetTrove`, importing the
+// same thing more than once is harmless.
+//
+// Returns a list of UserIDs that had conflicting handles with another user (see `SaveTweetTrove`).
+func (p Profile) ImportTweetTrove(trove TweetTrove) []UserID {
+	is_missing := func(subdir string, filename string) bool {
+		return !file_exists(filepath.Join(p.ProfileDir, subdir, filename))
+	}
+	for id, u := range trove.Users {
+		if u.IsContentDownloaded && (is_missing("profile_images", u.ProfileImageLocalPath) ||
+			(u.BannerImageLocalPath != "" && is_missing("profile_images", u.BannerImageLocalPath))) {
+			u.IsContentDownloaded = false
+			trove.Users[id] = u
+		}
+	}
+	for id, t := range trove.Tweets {
+		for i, img := range t.Images {
+			if img.IsDownloaded && is_missing("images", img.LocalFilename) {
+				t.Images[i].IsDownloaded = false
+				t.IsContentDownloaded = false
+			}
+		}
+		for i, v := range t.Videos {
+			if v.IsDownloaded && (is_missing("videos", v.LocalFilename) || is_missing("video_thumbnails", v.ThumbnailLocalPath)) {
+				t.Videos[i].IsDownloaded = false
+				t.IsContentDownloaded = false
+			}
+		}
+		for i, u := range t.Urls {
+			if u.IsContentDownloaded && u.HasThumbnail && is_missing("link_preview_images", u.ThumbnailLocalPath) {
+				t.Urls[i].IsContentDownloaded = false
+				t.IsContentDownloaded = false
+			}
+		}
+		trove.Tweets[id] = t
+	}
+	for id, m := range trove.Messages {
+		for i, img := range m.Images {
+			if img.IsDownloaded && is_missing("images", img.LocalFilename) {
+				m.Images[i].IsDownloaded = false
+			}
+		}
+		for i, v := range m.Videos {
+			if v.IsDownloaded && is_missing("videos", v.LocalFilename) {
+				m.Videos[i].IsDownloaded = false
+			}
+		}
+		trove.Messages[id] = m
+	}
+	return p.SaveTweetTrove(trove, false, nil)
+}
@@ -0,0 +1,241 @@
+package persistence_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Drop the header line (it has a timestamp in it), to compare the rest of an export
+func export_body(data []byte) string {
+	_, body, _ := strings.Cut(string(data), "\n")
+	return body
+}
+
+// Writing a trove, reading it back, and writing it again should produce the same output
+func TestTroveExportRoundTrip(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+
+	trove, err := profile.GetTweetTroveForExport("think")
+	require.NoError(err)
+	assert.Len(trove.Tweets, 5)
+	_, is_ok := trove.Tweets[TweetID(1439067163508150272)]
+	assert.True(is_ok)
+	for _, tweet := range trove.Tweets {
+		_, is_ok := trove.Users[tweet.UserID]
+		assert.True(is_ok, "Author of tweet %d should be exported", tweet.ID)
+	}
+	assert.Len(trove.Notifications, 0)
+	assert.Len(trove.Messages, 0)
+
+	buf := new(bytes.Buffer)
+	require.NoError(WriteTweetTroveJSONL(buf, trove, "think"))
+	first_output := buf.Bytes()
+
+	trove2, header, err := ReadTweetTroveJSONL(bytes.NewReader(first_output))
+	require.NoError(err)
+	assert.Equal(TROVE_EXPORT_FORMAT_VERSION, header.FormatVersion)
+	assert.Equal(ENGINE_DATABASE_VERSION, header.DatabaseVersion)
+	assert.Equal("think", header.Query)
+	assert.Len(trove2.Tweets, len(trove.Tweets))
+	assert.Len(trove2.Users, len(trove.Users))
+
+	buf2 := new(bytes.Buffer)
+	require.NoError(WriteTweetTroveJSONL(buf2, trove2, "think"))
+	assert.Equal(export_body(first_output), export_body(buf2.Bytes()))
+}
+
+// Exporting a profile one batch at a time should produce the same thing as exporting it all at once
+func TestExportJSONL(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+
+	trove, err := profile.GetTweetTroveForExport("")
+	require.NoError(err)
+	buf := new(bytes.Buffer)
+	require.NoError(WriteTweetTroveJSONL(buf, trove, ""))
+
+	streamed_buf := new(bytes.Buffer)
+	counts, err := profile.ExportJSONL(streamed_buf, "")
+	require.NoError(err)
+	assert.Equal(export_body(buf.Bytes()), export_body(streamed_buf.Bytes()))
+	assert.Equal(len(trove.Tweets), counts.NumTweets)
+	assert.Equal(len(trove.Users), counts.NumUsers)
+	assert.Equal(len(trove.Messages), counts.NumMessages)
+
+	// Search query exports shouldn't have duplicates, even if the pages overlap
+	query_trove, err := profile.GetTweetTroveForExport("think")
+	require.NoError(err)
+	streamed_buf.Reset()
+	counts, err = profile.ExportJSONL(streamed_buf, "think")
+	require.NoError(err)
+	assert.Equal(len(query_trove.Tweets), counts.NumTweets)
+	assert.Equal(len(query_trove.Users), counts.NumUsers)
+	streamed_trove, header, err := ReadTweetTroveJSONL(streamed_buf)
+	require.NoError(err)
+	assert.Equal("think", header.Query)
+	assert.Len(streamed_trove.Tweets, len(query_trove.Tweets))
+}
+
+func TestTroveExportInvalidFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := ReadTweetTroveJSONL(strings.NewReader(""))
+	assert.ErrorIs(err, ErrInvalidExport)
+
+	_, _, err = ReadTweetTroveJSONL(strings.NewReader(`{"type":"tweet","data":{"ID":1}}` + "\n"))
+	assert.ErrorIs(err, ErrInvalidExport)
+
+	_, _, err = ReadTweetTroveJSONL(strings.NewReader(`{"type":"header","data":{"format_version":9999}}` + "\n"))
+	assert.ErrorIs(err, ErrUnsupportedExportVersion)
+
+	_, _, err = ReadTweetTroveJSONL(strings.NewReader(
+		`{"type":"header","data":{"format_version":1}}` + "\n" + `{"type":"asdf","data":{}}` + "\n"))
+	assert.ErrorIs(err, ErrInvalidExport)
+}
+
+// Likes with the same (unknown) sort ID shouldn't clobber each other
+func TestTroveExportDuplicateLikeSortIDs(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	trove := NewTweetTrove()
+	trove.Likes[LikeSortID(-1)] = Like{SortID: -1, UserID: 1, TweetID: 10}
+	trove.Likes[LikeSortID(-2)] = Like{SortID: -1, UserID: 1, TweetID: 11}
+	buf := new(bytes.Buffer)
+	require.NoError(WriteTweetTroveJSONL(buf, trove, ""))
+
+	trove2, _, err := ReadTweetTroveJSONL(buf)
+	require.NoError(err)
+	require.Len(trove2.Likes, 2)
+	for _, l := range trove2.Likes {
+		assert.Equal(LikeSortID(-1), l.SortID)
+	}
+}
+
+// Import a full export into another profile; importing it again should be harmless
+func TestImportTweetTrove(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	sample_profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+	trove, err := sample_profile.GetTweetTroveForExport("")
+	require.NoError(err)
+	assert.Greater(len(trove.Notifications), 0)
+	assert.Greater(len(trove.Messages), 0)
+
+	buf := new(bytes.Buffer)
+	require.NoError(WriteTweetTroveJSONL(buf, trove, ""))
+	data := buf.Bytes()
+
+	profile_path := "test_profiles/TestTroveExport"
+	require.NoError(os.RemoveAll(profile_path))
+	profile := create_or_load_profile(profile_path)
+
+	for i := 0; i < 2; i++ {
+		imported, _, err := ReadTweetTroveJSONL(bytes.NewReader(data))
+		require.NoError(err)
+		profile.ImportTweetTrove(imported)
+	}
+
+	// Everything should be there
+	reexported, err := profile.GetTweetTroveForExport("")
+	require.NoError(err)
+	for id := range trove.Tweets {
+		_, is_ok := reexported.Tweets[id]
+		assert.True(is_ok, "Tweet %d should have been imported", id)
+	}
+	for id := range trove.Users {
+		_, is_ok := reexported.Users[id]
+		assert.True(is_ok, "User %d should have been imported", id)
+	}
+	assert.Len(reexported.Retweets, len(trove.Retweets)+1) // Plus the stable retweet
+	assert.Len(reexported.Likes, len(trove.Likes))
+	assert.Len(reexported.Bookmarks, len(trove.Bookmarks))
+	assert.Len(reexported.Notifications, len(trove.Notifications))
+	assert.Len(reexported.Messages, len(trove.Messages))
+
+	// Media isn't bundled, so it should be marked as not downloaded
+	for _, tweet := range reexported.Tweets {
+		for _, img := range tweet.Images {
+			assert.False(img.IsDownloaded)
+		}
+	}
+}
+
+func TestTroveExportBundle(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	sample_profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+	trove, err := sample_profile.GetTweetTroveForExport("from:cernovich")
+	require.NoError(err)
+
+	buf := new(bytes.Buffer)
+	counts, err := sample_profile.ExportBundle(buf, "from:cernovich")
+	require.NoError(err)
+	assert.Equal(len(trove.Tweets), counts.NumTweets)
+	zip_reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(err)
+
+	// Only media files that exist should be bundled
+	num_media_files := 0
+	for _, media_path := range trove.MediaPaths() {
+		if _, err := os.Stat(filepath.Join(sample_profile.ProfileDir, media_path)); err == nil {
+			num_media_files += 1
+		}
+	}
+	assert.Greater(num_media_files, 0)
+	assert.Len(zip_reader.File, num_media_files+1) // Plus the JSONL file
+
+	profile_path := "test_profiles/TestTroveExportBundle"
+	require.NoError(os.RemoveAll(profile_path))
+	profile := create_or_load_profile(profile_path)
+
+	imported, header, err := profile.ReadTweetTroveBundle(zip_reader)
+	require.NoError(err)
+	assert.Equal("from:cernovich", header.Query)
+	assert.Len(imported.Tweets, len(trove.Tweets))
+	for _, f := range zip_reader.File[1:] {
+		_, err := os.Stat(filepath.Join(profile_path, f.Name))
+		assert.NoError(err, "%s should have been copied", f.Name)
+	}
+	profile.ImportTweetTrove(imported)
+}
+
+func TestTroveExportBundleRejectsUnexpectedFiles(t *testing.T) {
+	require := require.New(t)
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, err := w.Create(TROVE_EXPORT_BUNDLE_JSONL_FILENAME)
+	require.NoError(err)
+	require.NoError(WriteTweetTroveJSONL(f, NewTweetTrove(), ""))
+	_, err = w.Create("images/../../../asdf.txt")
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	zip_reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(err)
+	profile := create_or_load_profile("test_profiles/TestTroveExportBundle")
+	_, _, err = profile.ReadTweetTroveBundle(zip_reader)
+	assert.True(t, errors.Is(err, ErrInvalidExport))
+}
@@ -68,6 +68,11 @@ type Tweet struct {
 	TombstoneText string `db:"tombstone_text"`
 	IsStub        bool   `db:"is_stub"`
 
+	// For edited tweets.  `EditTweetIDs` is every version of the tweet (including this one), oldest
+	// first; it's empty if the tweet has never been edited.
+	EditTweetIDs  []TweetID
+	EditableUntil Timestamp `db:"editable_until"`
+
 	IsLikedByCurrentUser     bool      `db:"is_liked_by_current_user"`
 	IsRetweetedByCurrentUser bool      `db:"is_retweeted_by_current_user"`
 	IsContentDownloaded      bool      `db:"is_content_downloaded"`
@@ -0,0 +1,8 @@
+package persistence
+
+// Records that a tweet, which had been archived, was later found to be deleted, suspended or hidden
+type TweetDeletion struct {
+	TweetID       TweetID   `db:"tweet_id"`
+	TombstoneType string    `db:"tombstone_type"`
+	FirstSeenAt   Timestamp `db:"first_seen_at"`
+}
@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Record that a tweet has been deleted (or suspended, or hidden), if it's the first time that's been
+// seen.  Only tweets that were archived with their content count; tweets that were already
+// tombstones when first scraped are skipped.
+func (p Profile) save_tweet_deletion(id TweetID) error {
+	_, err := p.DB.Exec(`
+		insert into tweet_deletions (tweet_id, tombstone_type, first_seen_at)
+		     select id, tombstone_type, ?
+		       from tweets
+		      where id = ?
+		        and is_stub = 0
+		        and tombstone_type in (select rowid from tombstone_types where short_name in ('deleted', 'suspended', 'hidden'))
+		on conflict do nothing
+	`, Timestamp{time.Now()}, id)
+	if err != nil {
+		return fmt.Errorf("Error recording deletion of tweet ID %d:\n  %w", id, err)
+	}
+	return nil
+}
+
+// Get the record of when a tweet was first found to be deleted, suspended or hidden
+func (p Profile) GetTweetDeletion(id TweetID) (TweetDeletion, error) {
+	var ret TweetDeletion
+	err := p.DB.Get(&ret, `
+		select tweet_id, tombstone_types.short_name tombstone_type, first_seen_at
+		  from tweet_deletions
+		  join tombstone_types on tweet_deletions.tombstone_type = tombstone_types.rowid
+		 where tweet_id = ?
+	`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ret, fmt.Errorf("GetTweetDeletion %d: %w", id, ErrNotInDatabase)
+	} else if err != nil {
+		panic(err)
+	}
+	return ret, nil
+}
+
+// Get a batch of archived tweets to re-check for deletion, least recently scraped first.  The
+// batch is interleaved across users, so one prolific user can't take it up entirely.  If `user_id`
+// is non-zero, only that user's tweets are included.
+func (p Profile) GetTweetIDsForDeletionSweep(batch_size int, user_id UserID) []TweetID {
+	ret := []TweetID{}
+	err := p.DB.Select(&ret, `
+		select id
+		  from (select id, last_scraped_at,
+		               row_number() over (partition by user_id order by last_scraped_at, id) user_rank
+		          from tweets
+		         where is_stub = 0
+		           and ifnull(tombstone_type, 0) = 0
+		           and (? = 0 or user_id = ?))
+	  order by user_rank, last_scraped_at, id
+	     limit ?
+	`, user_id, user_id, batch_size)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
@@ -0,0 +1,106 @@
+package persistence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// An archived tweet that turns into a tombstone should be recorded as deleted, once
+func TestSaveTweetDeletion(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestTweetDeletionQueries"
+	profile := create_or_load_profile(profile_path)
+
+	tweet := create_dummy_tweet()
+	require.NoError(profile.SaveTweet(tweet))
+	_, err := profile.GetTweetDeletion(tweet.ID)
+	assert.ErrorIs(err, ErrNotInDatabase)
+
+	// Re-scrape it as a tombstone
+	before_deletion := time.Now().Truncate(time.Millisecond)
+	tombstone := create_dummy_tombstone()
+	tombstone.ID = tweet.ID
+	require.NoError(profile.SaveTweet(tombstone))
+
+	deletion, err := profile.GetTweetDeletion(tweet.ID)
+	require.NoError(err)
+	assert.Equal("deleted", deletion.TombstoneType)
+	assert.False(deletion.FirstSeenAt.Before(before_deletion))
+
+	// Seeing it again shouldn't change the first-seen time
+	require.NoError(profile.SaveTweet(tombstone))
+	deletion2, err := profile.GetTweetDeletion(tweet.ID)
+	require.NoError(err)
+	assert.Equal(deletion.FirstSeenAt, deletion2.FirstSeenAt)
+
+	// The content is still there
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.Equal(tweet.Text, new_tweet.Text)
+
+	// Tweets that were tombstones when they were first scraped weren't archived, so they don't count
+	tombstone2 := create_dummy_tombstone()
+	require.NoError(profile.SaveTweet(tombstone2))
+	_, err = profile.GetTweetDeletion(tombstone2.ID)
+	assert.ErrorIs(err, ErrNotInDatabase)
+
+	// Search for it
+	c, err := NewCursorFromSearchQuery("deleted_since:" + before_deletion.UTC().Format("2006-01-02"))
+	require.NoError(err)
+	feed, err := profile.NextPage(c, UserID(0))
+	require.NoError(err)
+	found_ids := []TweetID{}
+	for _, item := range feed.Items {
+		found_ids = append(found_ids, item.TweetID)
+	}
+	assert.Contains(found_ids, tweet.ID)
+	assert.NotContains(found_ids, tombstone2.ID)
+
+	c, err = NewCursorFromSearchQuery("deleted_since:" + before_deletion.UTC().Add(48*time.Hour).Format("2006-01-02"))
+	require.NoError(err)
+	feed, err = profile.NextPage(c, UserID(0))
+	require.NoError(err)
+	assert.Len(feed.Items, 0)
+}
+
+// Tweets should be re-checked least recently scraped first, interleaved across users
+func TestGetTweetIDsForDeletionSweep(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile, err := LoadProfile("../../sample_data/profile")
+	require.NoError(err)
+
+	ids := profile.GetTweetIDsForDeletionSweep(1000, UserID(0))
+	require.NotEmpty(ids)
+	first_index_of_user := map[UserID]int{}
+	for i, id := range ids {
+		tweet, err := profile.GetTweetById(id)
+		require.NoError(err)
+		assert.Equal("", tweet.TombstoneType)
+		assert.False(tweet.IsStub)
+		if _, is_ok := first_index_of_user[tweet.UserID]; !is_ok {
+			first_index_of_user[tweet.UserID] = i
+		}
+	}
+	// Every user's first tweet comes before any user's second tweet
+	for _, i := range first_index_of_user {
+		assert.Less(i, len(first_index_of_user))
+	}
+
+	// Limited to one user
+	ids = profile.GetTweetIDsForDeletionSweep(3, UserID(1032468021485293568))
+	assert.Len(ids, 3)
+	for _, id := range ids {
+		tweet, err := profile.GetTweetById(id)
+		require.NoError(err)
+		assert.Equal(UserID(1032468021485293568), tweet.UserID)
+	}
+}
@@ -23,13 +23,13 @@ func (p Profile) SaveTweet(t Tweet) error {
         insert into tweets (id, user_id, text, posted_at, num_likes, num_retweets, num_replies, num_quote_tweets, in_reply_to_id,
                             quoted_tweet_id, mentions, reply_mentions, hashtags, space_id, tombstone_type, is_expandable,
                             is_stub, is_content_downloaded,
-                            is_conversation_scraped, last_scraped_at)
+                            is_conversation_scraped, last_scraped_at, editable_until)
         values (:id, :user_id, :text, :posted_at, :num_likes, :num_retweets, :num_replies, :num_quote_tweets, :in_reply_to_id,
                 :quoted_tweet_id, :mentions, :reply_mentions, :hashtags, nullif(:space_id, ''),
                 (select rowid from tombstone_types where short_name=:tombstone_type),
                 :is_expandable,
                 :is_stub, :is_content_downloaded,
-                :is_conversation_scraped, :last_scraped_at)
+                :is_conversation_scraped, :last_scraped_at, :editable_until)
             on conflict do update
            set text=(case
                      when is_stub then
@@ -55,7 +55,8 @@ func (p Profile) SaveTweet(t Tweet) error {
                is_expandable=is_expandable or :is_expandable,
                is_content_downloaded=(is_content_downloaded or :is_content_downloaded),
                is_conversation_scraped=(is_conversation_scraped or :is_conversation_scraped),
-               last_scraped_at=max(last_scraped_at, :last_scraped_at)
+               last_scraped_at=max(last_scraped_at, :last_scraped_at),
+               editable_until=max(editable_until, :editable_until)
         `,
 		t,
 	)
@@ -93,6 +94,24 @@ func (p Profile) SaveTweet(t Tweet) error {
 			return err
 		}
 	}
+	err = p.update_tweet_search_index(t.ID)
+	if err != nil {
+		return err
+	}
+	err = p.save_tweet_engagement_snapshot(t)
+	if err != nil {
+		return err
+	}
+	err = p.save_tweet_deletion(t.ID)
+	if err != nil {
+		return err
+	}
+	if len(t.EditTweetIDs) > 1 {
+		err = p.save_tweet_versions(t.EditTweetIDs)
+		if err != nil {
+			return err
+		}
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -169,6 +188,10 @@ func (p Profile) GetTweetByIdAsUser(id TweetID, u_id UserID) (Tweet, error) {
 	}
 	t.Urls = urls
 
+	if version_ids := p.GetTweetVersionIDs(t.ID); len(version_ids) != 0 {
+		t.EditTweetIDs = version_ids
+	}
+
 	return t, nil
 }
 
@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"strings"
+)
+
+type TextDiffOp string
+
+const (
+	TEXT_DIFF_SAME    TextDiffOp = "same"
+	TEXT_DIFF_ADDED   TextDiffOp = "added"
+	TEXT_DIFF_REMOVED TextDiffOp = "removed"
+)
+
+// A run of words that were added, removed or unchanged between two versions of a text
+type TextDiffChunk struct {
+	Op   TextDiffOp
+	Text string
+}
+
+// Compute a word-by-word diff from `before` to `after`, e.g., between two versions of an edited
+// tweet.  Whitespace isn't preserved; words in each chunk are separated by single spaces.
+func DiffText(before string, after string) []TextDiffChunk {
+	a := strings.Fields(before)
+	b := strings.Fields(after)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ret := []TextDiffChunk{}
+	add_word := func(op TextDiffOp, word string) {
+		if len(ret) != 0 && ret[len(ret)-1].Op == op {
+			ret[len(ret)-1].Text += " " + word
+		} else {
+			ret = append(ret, TextDiffChunk{Op: op, Text: word})
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			add_word(TEXT_DIFF_SAME, a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			add_word(TEXT_DIFF_REMOVED, a[i])
+			i++
+		default:
+			add_word(TEXT_DIFF_ADDED, b[j])
+			j++
+		}
+	}
+	return ret
+}
@@ -0,0 +1,36 @@
+package persistence
+
+import (
+	"fmt"
+)
+
+// Link together all the versions of an edited tweet.  `ids` should be every version's ID, oldest
+// first, as in `Tweet.EditTweetIDs`.
+func (p Profile) save_tweet_versions(ids []TweetID) error {
+	for _, id := range ids {
+		_, err := p.DB.Exec(`
+			insert into tweet_versions (tweet_id, original_tweet_id) values (?, ?)
+			    on conflict do nothing
+		`, id, ids[0])
+		if err != nil {
+			return fmt.Errorf("Error saving version %d of tweet ID %d:\n  %w", id, ids[0], err)
+		}
+	}
+	return nil
+}
+
+// Get the IDs of every known version of a tweet, oldest first (tweet IDs are chronological).  If
+// the tweet has never been edited, the result is empty.
+func (p Profile) GetTweetVersionIDs(id TweetID) []TweetID {
+	ret := []TweetID{}
+	err := p.DB.Select(&ret, `
+		select tweet_id
+		  from tweet_versions
+		 where original_tweet_id = (select original_tweet_id from tweet_versions where tweet_id = ?)
+	  order by tweet_id
+	`, id)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
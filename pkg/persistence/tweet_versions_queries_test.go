@@ -0,0 +1,62 @@
+package persistence_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// All versions of an edited tweet should be linked together, even ones that haven't been scraped
+func TestSaveAndLoadTweetVersions(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestTweetVersionQueries"
+	profile := create_or_load_profile(profile_path)
+
+	original_id := TweetID(rand.Int())
+	edit_ids := []TweetID{original_id, original_id + 1, original_id + 2}
+
+	// Save the middle version; the latest one isn't scraped
+	tweet := create_dummy_tweet()
+	tweet.ID = edit_ids[1]
+	tweet.EditTweetIDs = edit_ids
+	tweet.EditableUntil = TimestampFromUnix(12345)
+	tweet.Images = []Image{}
+	tweet.Videos = []Video{}
+	tweet.Urls = []Url{}
+	tweet.Polls = []Poll{}
+	require.NoError(profile.SaveTweet(tweet))
+
+	for _, id := range edit_ids {
+		assert.Equal(edit_ids, profile.GetTweetVersionIDs(id))
+	}
+
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.Equal(edit_ids, new_tweet.EditTweetIDs)
+	assert.Equal(TimestampFromUnix(12345), new_tweet.EditableUntil)
+
+	// A tweet that's never been edited
+	assert.Len(profile.GetTweetVersionIDs(TweetID(rand.Int())), 0)
+}
+
+func TestDiffText(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]TextDiffChunk{
+		{Op: TEXT_DIFF_SAME, Text: "the quick"},
+		{Op: TEXT_DIFF_REMOVED, Text: "brown"},
+		{Op: TEXT_DIFF_ADDED, Text: "red"},
+		{Op: TEXT_DIFF_SAME, Text: "fox jumps"},
+		{Op: TEXT_DIFF_ADDED, Text: "over the dog"},
+	}, DiffText("the quick brown fox jumps", "the quick red fox  jumps over the dog"))
+
+	assert.Equal([]TextDiffChunk{{Op: TEXT_DIFF_ADDED, Text: "new text"}}, DiffText("", "new text"))
+	assert.Equal([]TextDiffChunk{{Op: TEXT_DIFF_REMOVED, Text: "old text"}}, DiffText("old text", ""))
+	assert.Equal([]TextDiffChunk{}, DiffText("", ""))
+}
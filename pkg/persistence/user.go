@@ -84,6 +84,12 @@ func GetUnknownUserWithHandle(handle UserHandle) User {
 	}
 }
 
+// Whether the User is a placeholder (e.g., from `GetUnknownUser`, or a user known only by ID from an
+// account archive), whose profile fields aren't real
+func (u User) is_placeholder() bool {
+	return u.IsIdFake || u.Bio == "<blank>"
+}
+
 /**
  * Get the URL where we would expect to find a User's tiny profile image
  */
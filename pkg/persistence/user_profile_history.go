@@ -0,0 +1,62 @@
+package persistence
+
+import (
+	"strings"
+)
+
+// A version of a User's profile, as it was observed at some point in time
+type UserProfileSnapshot struct {
+	UserID          UserID     `db:"user_id"`
+	ObservedAt      Timestamp  `db:"observed_at"`
+	Handle          UserHandle `db:"handle"`
+	DisplayName     string     `db:"display_name"`
+	Bio             string     `db:"bio"`
+	Location        string     `db:"location"`
+	Website         string     `db:"website"`
+	ProfileImageUrl string     `db:"profile_image_url"`
+}
+
+// A change to a single profile field, between two UserProfileSnapshots
+type ProfileFieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// Get the fields that changed from `prev` to `s`.  If `prev` is the zero value (i.e., there's no
+// previous snapshot), all the non-empty fields are returned.
+//
+// Handles are case-insensitive, so a handle that only changed case isn't a change.
+func (s UserProfileSnapshot) ChangesFrom(prev UserProfileSnapshot) []ProfileFieldChange {
+	ret := []ProfileFieldChange{}
+	for _, f := range []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"Handle", string(prev.Handle), string(s.Handle)},
+		{"Display name", prev.DisplayName, s.DisplayName},
+		{"Bio", prev.Bio, s.Bio},
+		{"Location", prev.Location, s.Location},
+		{"Website", prev.Website, s.Website},
+		{"Profile image", prev.ProfileImageUrl, s.ProfileImageUrl},
+	} {
+		if f.name == "Handle" && strings.EqualFold(f.before, f.after) {
+			continue
+		}
+		if f.before != f.after {
+			ret = append(ret, ProfileFieldChange{Field: f.name, Before: f.before, After: f.after})
+		}
+	}
+	return ret
+}
+
+// Whether any of the profile fields are different.  Handles are compared case-insensitively.
+func (s UserProfileSnapshot) is_changed_from(prev UserProfileSnapshot) bool {
+	return !strings.EqualFold(string(s.Handle), string(prev.Handle)) ||
+		s.DisplayName != prev.DisplayName ||
+		s.Bio != prev.Bio ||
+		s.Location != prev.Location ||
+		s.Website != prev.Website ||
+		s.ProfileImageUrl != prev.ProfileImageUrl
+}
@@ -0,0 +1,65 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Record the User's current profile in their profile history, if it's different from the most
+// recently observed version.  Banned and deleted users are skipped, since their profile fields
+// aren't updated; so are placeholder users, whose profile fields aren't real.
+func (p Profile) save_user_profile_snapshot(u User) error {
+	if u.IsBanned || u.IsDeleted || u.is_placeholder() {
+		return nil
+	}
+	snapshot := UserProfileSnapshot{
+		UserID:          u.ID,
+		ObservedAt:      Timestamp{time.Now()},
+		Handle:          u.Handle,
+		DisplayName:     u.DisplayName,
+		Bio:             u.Bio,
+		Location:        u.Location,
+		Website:         u.Website,
+		ProfileImageUrl: u.ProfileImageUrl,
+	}
+
+	var latest UserProfileSnapshot
+	err := p.DB.Get(&latest, `
+		select user_id, observed_at, handle, display_name, bio, location, website, profile_image_url
+		  from user_profile_history
+		 where user_id = ?
+	  order by observed_at desc, rowid desc
+	     limit 1
+	`, u.ID)
+	if err == nil && !snapshot.is_changed_from(latest) {
+		return nil
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("Error getting latest profile history for user @%s (ID %d):\n  %w", u.Handle, u.ID, err)
+	}
+
+	_, err = p.DB.NamedExec(`
+		insert into user_profile_history (user_id, observed_at, handle, display_name, bio, location, website, profile_image_url)
+		                          values (:user_id, :observed_at, :handle, :display_name, :bio, :location, :website, :profile_image_url)
+	`, snapshot)
+	if err != nil {
+		return fmt.Errorf("Error saving profile history for user @%s (ID %d):\n  %w", u.Handle, u.ID, err)
+	}
+	return nil
+}
+
+// Get every observed version of a User's profile, newest first
+func (p Profile) GetUserProfileHistory(id UserID) []UserProfileSnapshot {
+	ret := []UserProfileSnapshot{}
+	err := p.DB.Select(&ret, `
+		select user_id, observed_at, handle, display_name, bio, location, website, profile_image_url
+		  from user_profile_history
+		 where user_id = ?
+	  order by observed_at desc, rowid desc
+	`, id)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
@@ -0,0 +1,110 @@
+package persistence_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Saving a User should record a new profile history entry only if their profile has changed
+func TestUserProfileHistory(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestUserProfileHistoryQueries"
+	profile := create_or_load_profile(profile_path)
+
+	user := create_dummy_user()
+	require.NoError(profile.SaveUser(&user))
+	history := profile.GetUserProfileHistory(user.ID)
+	require.Len(history, 1)
+	assert.Equal(user.Handle, history[0].Handle)
+	assert.Equal(user.Bio, history[0].Bio)
+
+	// No changes
+	user.FollowersCount += 10 // Not part of the profile history
+	require.NoError(profile.SaveUser(&user))
+	assert.Len(profile.GetUserProfileHistory(user.ID), 1)
+
+	// Change the handle and bio
+	old_handle := user.Handle
+	user.Handle = UserHandle(fmt.Sprintf("%s_new", user.Handle))
+	user.Bio = "new bio"
+	require.NoError(profile.SaveUser(&user))
+	history = profile.GetUserProfileHistory(user.ID)
+	require.Len(history, 2)
+	assert.Equal(user.Handle, history[0].Handle) // Newest first
+	assert.Equal(old_handle, history[1].Handle)
+	assert.Equal([]ProfileFieldChange{
+		{Field: "Handle", Before: string(old_handle), After: string(user.Handle)},
+		{Field: "Bio", Before: "bio", After: "new bio"},
+	}, history[0].ChangesFrom(history[1]))
+
+	// Handles are case-insensitive, so a change in case alone isn't recorded
+	user.Handle = UserHandle(strings.ToUpper(string(user.Handle)))
+	require.NoError(profile.SaveUser(&user))
+	assert.Len(profile.GetUserProfileHistory(user.ID), 2)
+
+	// Deleted users aren't recorded
+	user.IsDeleted = true
+	user.DisplayName = "<Unknown User>"
+	require.NoError(profile.SaveUser(&user))
+	assert.Len(profile.GetUserProfileHistory(user.ID), 2)
+}
+
+// Placeholder users don't have real profiles, so they shouldn't get a profile history
+func TestUserProfileHistoryPlaceholderUser(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestUserProfileHistoryQueries"
+	profile := create_or_load_profile(profile_path)
+
+	user := create_dummy_user()
+	user.Handle = UserHandle(fmt.Sprintf("unknown_user_%d", user.ID))
+	user.DisplayName = "<Unknown User>"
+	user.Bio = "<blank>"
+	user.Location = "<blank>"
+	user.Website = "<blank>"
+	require.NoError(profile.SaveUser(&user))
+	assert.Len(profile.GetUserProfileHistory(user.ID), 0)
+
+	fake_user := GetUnknownUserWithHandle(UserHandle(fmt.Sprintf("fake_%d", user.ID)))
+	require.NoError(profile.SaveUser(&fake_user))
+	assert.Len(profile.GetUserProfileHistory(fake_user.ID), 0)
+}
+
+// Searching "from:" or "by:" a user's former handle should find their tweets
+func TestSearchByFormerHandle(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	profile_path := "test_profiles/TestUserProfileHistoryQueries"
+	profile := create_or_load_profile(profile_path)
+
+	user := create_dummy_user()
+	require.NoError(profile.SaveUser(&user))
+	tweet := create_dummy_tweet()
+	tweet.UserID = user.ID
+	require.NoError(profile.SaveTweet(tweet))
+
+	old_handle := user.Handle
+	user.Handle = UserHandle(fmt.Sprintf("%s_new", user.Handle))
+	require.NoError(profile.SaveUser(&user))
+
+	for _, q := range []string{"from:", "by:"} {
+		for _, handle := range []UserHandle{old_handle, user.Handle} {
+			c, err := NewCursorFromSearchQuery(q + string(handle))
+			require.NoError(err)
+			feed, err := profile.NextPage(c, UserID(0))
+			require.NoError(err)
+			require.Len(feed.Items, 1, q+string(handle))
+			assert.Equal(tweet.ID, feed.Items[0].TweetID)
+		}
+	}
+}
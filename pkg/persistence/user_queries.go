@@ -30,6 +30,7 @@ const USERS_ALL_SQL_FIELDS = `
 //     2a. if the user is banned or deleted, don't overwrite other fields, blanking them
 //     2b. if the user exists but `handle` conflicts with an active user, do conflict handling
 //  3. If the user doesn't already exist, execute an insert.  Do conflict handling if applicable
+//  4. Record the user's profile in their profile history, if it changed
 //
 // Conflict handling:
 //
@@ -149,7 +150,7 @@ func (p Profile) SaveUser(u *User) error {
 		panic(err)
 	}
 	if rows_affected > 0 {
-		return nil
+		return p.save_user_profile_snapshot(*u)
 	}
 
 	// It's a new user.  Try to insert it:
@@ -165,7 +166,7 @@ func (p Profile) SaveUser(u *User) error {
 	)
 	if err == nil {
 		// It worked; user is inserted, we're done
-		return nil
+		return p.save_user_profile_snapshot(*u)
 	}
 
 	// If execution reaches this point, then an error has occurred; err is not nil.
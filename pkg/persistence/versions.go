@@ -1,7 +1,10 @@
 package persistence
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 
 	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/terminal_utils"
 )
@@ -14,8 +17,9 @@ type VersionMismatchError struct {
 func (e VersionMismatchError) Error() string {
 	return fmt.Sprintf(
 		`This profile was created with database schema version %d, which is newer than this application's database schema version, %d.
-Please upgrade this application to a newer version to use this profile.  Or downgrade the profile's schema version, somehow.`,
-		e.DatabaseVersion, e.EngineVersion,
+Please upgrade this application to a newer version to use this profile.  Or downgrade the profile's schema version, by
+running "migrate --to %d" with the newer version of this application that created it.`,
+		e.DatabaseVersion, e.EngineVersion, e.EngineVersion,
 	)
 }
 
@@ -423,9 +427,471 @@ var MIGRATIONS = []string{
 	`create index index_latest_message_in_chat_room on chat_messages(chat_room_id, sent_at desc)`,
 	`drop index index_retweets_retweeted_at;
 		create index if not exists index_retweets_retweeted_by_and_at on retweets (retweeted_by, retweeted_at desc);`,
+
+	// 35
+	`create virtual table tweets_fts using fts5(text, urls, tokenize=trigram);
+		insert into tweets_fts (rowid, text, urls)
+		     select id, text, ifnull((
+		                select group_concat(ifnull(title, '') || ' ' || ifnull(description, ''), ' ')
+		                  from urls
+		                 where urls.tweet_id = tweets.id
+		            ), '')
+		       from tweets;`,
+
+	// 36
+	`create table tweet_engagement_snapshots (rowid integer primary key,
+		    tweet_id integer not null,
+		    recorded_at integer not null,
+		    num_likes integer not null,
+		    num_retweets integer not null,
+		    num_replies integer not null,
+		    num_quote_tweets integer not null,
+
+		    foreign key(tweet_id) references tweets(id)
+		);
+		create index if not exists index_tweet_engagement_snapshots_tweet_id on tweet_engagement_snapshots (tweet_id, recorded_at);
+		insert into tweet_engagement_snapshots (tweet_id, recorded_at, num_likes, num_retweets, num_replies, num_quote_tweets)
+		     select id, last_scraped_at, num_likes, num_retweets, num_replies, num_quote_tweets
+		       from tweets
+		      where is_stub = 0;
+		create table poll_vote_snapshots (rowid integer primary key,
+		    poll_id integer not null,
+		    recorded_at integer not null,
+		    choice1_votes integer,
+		    choice2_votes integer,
+		    choice3_votes integer,
+		    choice4_votes integer,
+
+		    foreign key(poll_id) references polls(id)
+		);
+		create index if not exists index_poll_vote_snapshots_poll_id on poll_vote_snapshots (poll_id, recorded_at);
+		insert into poll_vote_snapshots (poll_id, recorded_at, choice1_votes, choice2_votes, choice3_votes, choice4_votes)
+		     select id, last_scraped_at, choice1_votes, choice2_votes, choice3_votes, choice4_votes
+		       from polls;`,
+
+	// 37
+	`create table user_profile_history (rowid integer primary key,
+		    user_id integer not null,
+		    observed_at integer not null,
+		    handle text not null,
+		    display_name text not null,
+		    bio text not null default '',
+		    location text not null default '',
+		    website text not null default '',
+		    profile_image_url text not null default '',
+
+		    foreign key(user_id) references users(id)
+		);
+		create index if not exists index_user_profile_history_user_id on user_profile_history (user_id, observed_at);
+		create index if not exists index_user_profile_history_handle on user_profile_history (handle collate nocase);
+		insert into user_profile_history (user_id, observed_at, handle, display_name, bio, location, website, profile_image_url)
+		     select id, cast(strftime('%s', 'now') as integer) * 1000, handle, display_name, ifnull(bio, ''), ifnull(location, ''),
+		            ifnull(website, ''), ifnull(profile_image_url, '')
+		       from users
+		      where is_id_fake = 0 and ifnull(bio, '') != '<blank>';`,
+	// 38
+	`alter table tweets add column editable_until integer not null default 0;
+		create table tweet_versions (rowid integer primary key,
+		    tweet_id integer unique not null,
+		    original_tweet_id integer not null
+		);
+		create index if not exists index_tweet_versions_original_tweet_id on tweet_versions (original_tweet_id);`,
+	// 39
+	`create table tweet_deletions (rowid integer primary key,
+		    tweet_id integer unique not null,
+		    tombstone_type integer not null,
+		    first_seen_at integer not null,
+
+		    foreign key(tweet_id) references tweets(id)
+		    foreign key(tombstone_type) references tombstone_types(rowid)
+		);
+		create index if not exists index_tweet_deletions_first_seen_at on tweet_deletions (first_seen_at);`,
+
+	// 40
+	`begin transaction;
+		alter table images rename to images_old;
+		create table images (rowid integer primary key,
+		    id integer unique not null check(typeof(id) = 'integer'),
+		    tweet_id integer not null,
+		    width integer not null,
+		    height integer not null,
+		    remote_url text not null unique,
+		    local_filename text not null,
+		    is_downloaded boolean default 0,
+
+		    foreign key(tweet_id) references tweets(id)
+		);
+		insert into images (rowid, id, tweet_id, width, height, remote_url, local_filename, is_downloaded)
+		select rowid, id, tweet_id, width, height, remote_url, local_filename, is_downloaded from images_old;
+		drop table images_old;
+		create index if not exists index_images_tweet_id on images (tweet_id);
+		create index if not exists index_images_local_filename on images (local_filename);
+
+		alter table videos rename to videos_old;
+		create table videos (rowid integer primary key,
+		    id integer unique not null check(typeof(id) = 'integer'),
+		    tweet_id integer not null,
+		    width integer not null,
+		    height integer not null,
+		    remote_url text not null unique,
+		    local_filename text not null,
+		    thumbnail_remote_url text not null default 'missing',
+		    thumbnail_local_filename text not null default 'missing',
+		    duration integer not null default 0,
+		    view_count integer not null default 0,
+		    is_gif boolean default 0,
+		    is_downloaded boolean default 0,
+		    is_blocked_by_dmca boolean not null default 0,
+
+		    foreign key(tweet_id) references tweets(id)
+		);
+		insert into videos (rowid, id, tweet_id, width, height, remote_url, local_filename, thumbnail_remote_url,
+		    thumbnail_local_filename, duration, view_count, is_gif, is_downloaded, is_blocked_by_dmca)
+		select rowid, id, tweet_id, width, height, remote_url, local_filename, thumbnail_remote_url,
+		    thumbnail_local_filename, duration, view_count, is_gif, is_downloaded, is_blocked_by_dmca
+		  from videos_old;
+		drop table videos_old;
+		create index if not exists index_videos_tweet_id on videos (tweet_id);
+		create index if not exists index_videos_local_filename on videos (local_filename);
+		commit;`,
+	`create table saved_searches (rowid integer primary key,
+		    name text not null unique,
+		    query text not null,
+		    is_scraped_in_background boolean not null default 0,
+		    last_viewed_at integer not null default 0
+		);`,
+	`create table mutes (rowid integer primary key,
+		    type text not null check(type in ('keyword', 'regex', 'user', 'retweets', 'domain', 'hashtag')),
+		    text text not null default '',
+		    user_id integer not null default 0,
+		    unique(type, text, user_id)
+		);`,
+	`create table scrape_jobs (rowid integer primary key,
+		    type text not null check(type in ('user_tweets', 'user_likes', 'followers', 'followees', 'search')),
+		    target text not null,
+		    priority integer not null default 0,
+		    status text not null default 'queued' check(status in ('queued', 'running', 'done', 'failed', 'cancelled')),
+		    cursor text not null default '',
+		    num_pages integer not null default 0,
+		    max_pages integer not null default 0,
+		    num_failures integer not null default 0,
+		    last_error text not null default '',
+		    retry_at integer not null default 0,
+		    created_at integer not null,
+		    updated_at integer not null
+		);
+		create index if not exists index_scrape_jobs_status on scrape_jobs (status);`,
+	`create table media_download_queue (rowid integer primary key,
+		    type text not null check(type in ('tweet', 'user', 'chat_message')),
+		    item_id integer not null,
+		    num_failures integer not null default 0,
+		    last_error text not null default '',
+		    retry_at integer not null default 0,
+		    is_failed boolean not null default 0,
+		    queued_at integer not null,
+		    unique(type, item_id)
+		);`,
+
+	// 45
+	`create table video_variants (rowid integer primary key,
+		    video_id integer not null,
+		    content_type text not null default 'video/mp4',
+		    bitrate integer not null default 0,
+		    width integer not null default 0,
+		    height integer not null default 0,
+		    url text not null,
+
+		    unique(video_id, url)
+		    foreign key(video_id) references videos(id)
+		);
+		create index if not exists index_video_variants_video_id on video_variants (video_id);
+		insert into video_variants (video_id, content_type, url)
+		     select id, case when remote_url like '%.m3u8%' then 'application/x-mpegURL' else 'video/mp4' end, remote_url
+		       from videos;
+		alter table videos add column downloaded_height integer not null default 0;
+		alter table videos add column downloaded_bitrate integer not null default 0;
+		alter table videos add column is_audio_only boolean not null default 0;
+		update videos set downloaded_height = height where is_downloaded = 1;
+		create table video_policy (rowid integer primary key,
+		    mode text not null default 'video' check(mode in ('video', 'audio_only', 'thumbnail_only')),
+		    max_height integer not null default 0,
+		    max_bitrate integer not null default 0
+		);
+		insert into video_policy (rowid) values (1);`,
+	`create table superseded_media_files (rowid integer primary key,
+		    subdir text not null,
+		    local_filename text not null,
+		    superseded_at integer not null,
+		    unique(subdir, local_filename)
+		);`,
 }
 var ENGINE_DATABASE_VERSION = len(MIGRATIONS)
 
+// Undoes each migration in `MIGRATIONS`: running `DOWN_MIGRATIONS[i]` on a database at version i+1
+// brings it back to version i.  Some migrations changed or deleted data in a way that can't be undone;
+// those only have their schema changes undone.
+var DOWN_MIGRATIONS = []string{
+	// Version 1 => 0
+	`drop table if exists polls;`,
+	`alter table tweets drop column is_conversation_scraped;
+		alter table tweets drop column last_scraped_at;`,
+	// The old text of the "suspended" tombstone isn't known, so it's left as is
+	`update tweets set tombstone_type = 4 where tombstone_type in (5, 6);
+		delete from tombstone_types where rowid in (5, 6);`,
+	`alter table videos drop column thumbnail_remote_url;
+		alter table videos drop column thumbnail_local_filename;`,
+
+	// 5 => 4
+	`alter table videos drop column duration;
+		alter table videos drop column view_count;`,
+	`alter table users drop column is_banned;`,
+	`alter table urls drop column short_text;`,
+	`update tweets set tombstone_type = 4 where tombstone_type = 7;
+		delete from tombstone_types where rowid = 7;`,
+	`alter table users drop column is_followed;`,
+
+	// 10 => 9
+	`drop table if exists fake_user_sequence;
+		alter table users drop column is_id_fake;`,
+	// The deleted URLs can't be restored
+	`-- nothing to do`,
+	// "space_id" might be a table constraint, which can't be dropped, so the table has to be rebuilt
+	`pragma foreign_keys = OFF;
+		begin exclusive transaction;
+		create table tweets_new (rowid integer primary key,
+		    id integer unique not null check(typeof(id) = 'integer'),
+		    user_id integer not null check(typeof(user_id) = 'integer'),
+		    text text not null,
+		    posted_at integer,
+		    num_likes integer,
+		    num_retweets integer,
+		    num_replies integer,
+		    num_quote_tweets integer,
+		    in_reply_to_id integer,
+		    quoted_tweet_id integer,
+		    mentions text,        -- comma-separated
+		    reply_mentions text,  -- comma-separated
+		    hashtags text,        -- comma-separated
+		    tombstone_type integer default 0,
+		    is_stub boolean default 0,
+
+		    is_content_downloaded boolean default 0,
+		    is_conversation_scraped boolean default 0,
+		    last_scraped_at integer not null default 0,
+		    foreign key(user_id) references users(id)
+		);
+		insert into tweets_new (rowid, id, user_id, text, posted_at, num_likes, num_retweets, num_replies,
+		    num_quote_tweets, in_reply_to_id, quoted_tweet_id, mentions, reply_mentions, hashtags, tombstone_type,
+		    is_stub, is_content_downloaded, is_conversation_scraped, last_scraped_at)
+		select rowid, id, user_id, text, posted_at, num_likes, num_retweets, num_replies,
+		    num_quote_tweets, in_reply_to_id, quoted_tweet_id, mentions, reply_mentions, hashtags, tombstone_type,
+		    is_stub, is_content_downloaded, is_conversation_scraped, last_scraped_at
+		  from tweets;
+		drop table tweets;
+		alter table tweets_new rename to tweets;
+		drop table if exists spaces;
+		commit;
+		pragma foreign_keys = ON;`,
+	`alter table videos drop column is_blocked_by_dmca;`,
+	`drop index if exists index_tweets_in_reply_to_id;
+		drop index if exists index_urls_tweet_id;
+		drop index if exists index_polls_tweet_id;
+		drop index if exists index_images_tweet_id;
+		drop index if exists index_videos_tweet_id;`,
+
+	// 15 => 14
+	`drop table if exists space_participants;
+		pragma foreign_keys = OFF;
+		begin exclusive transaction;
+		create table spaces_new(rowid integer primary key,
+		    id text unique not null,
+		    short_url text not null
+		);
+		insert into spaces_new (rowid, id, short_url) select rowid, id, short_url from spaces;
+		drop table spaces;
+		alter table spaces_new rename to spaces;
+		commit;
+		pragma foreign_keys = ON;`,
+	`drop index if exists index_tweets_user_id;`,
+	`alter table tweets drop column is_expandable;`,
+	`create table space_participants_new(rowid integer primary key,
+		    user_id integer not null,
+		    space_id not null,
+		    foreign key(space_id) references spaces(id)
+		);
+		insert into space_participants_new(rowid, user_id, space_id) select rowid, user_id, space_id from space_participants;
+		drop table space_participants;
+		alter table space_participants_new rename to space_participants;`,
+	`drop table if exists likes;`,
+
+	// 20 => 19
+	`drop index if exists index_tweets_posted_at;
+		drop index if exists index_retweets_retweeted_at;`,
+	// Can't tell which timestamps were fixed
+	`-- nothing to do`,
+	`alter table users drop column is_deleted;`,
+	// `sort_order` has to be unique again, so likes with duplicate ones (e.g., -1 for "unknown") are lost
+	`begin transaction;
+		create table likes_new(rowid integer primary key,
+		    sort_order integer unique not null,
+		    user_id integer not null,
+		    tweet_id integer not null,
+		    unique(user_id, tweet_id)
+		    foreign key(user_id) references users(id)
+		    foreign key(tweet_id) references tweets(id)
+		);
+		insert or ignore into likes_new (rowid, sort_order, user_id, tweet_id) select rowid, sort_order, user_id, tweet_id from likes;
+		drop table likes;
+		alter table likes_new rename to likes;
+		commit;`,
+	`update tweets set tombstone_type = 4 where tombstone_type = 8;
+		delete from tombstone_types where rowid = 8;`,
+
+	// 25 => 24
+	`drop table if exists chat_message_reactions;
+		drop table if exists chat_messages;
+		drop table if exists chat_room_participants;
+		drop table if exists chat_rooms;`,
+	`drop table if exists follows;`,
+	`update tweets set
+		    posted_at = posted_at / 1000,
+		    last_scraped_at = last_scraped_at / 1000;
+		update users set join_date = join_date / 1000;
+		update spaces set
+		    created_at = created_at / 1000,
+		    started_at = started_at / 1000,
+		    ended_at = ended_at / 1000,
+		    updated_at = updated_at / 1000;
+		update retweets set retweeted_at = retweeted_at / 1000;
+		update polls set
+		    voting_ends_at = voting_ends_at / 1000,
+		    last_scraped_at = last_scraped_at / 1000;
+		update chat_rooms set created_at = created_at / 1000;`,
+	`drop table if exists list_users;
+		drop table if exists lists;`,
+	`drop table if exists chat_message_images;
+		drop table if exists chat_message_videos;
+		drop table if exists chat_message_urls;`,
+
+	// 30 => 29
+	`drop table if exists bookmarks;`,
+	`drop table if exists notification_users;
+		drop table if exists notification_retweets;
+		drop table if exists notification_tweets;
+		drop table if exists notifications;
+		drop table if exists notification_types;`,
+	// Fails if any users (e.g., deleted ones) have the same handle
+	`pragma foreign_keys = OFF;
+		begin exclusive transaction;
+		drop view if exists users_by_handle;
+		create table users_new (rowid integer primary key,
+		    id integer unique not null check(typeof(id) = 'integer'),
+		    display_name text not null,
+		    handle text unique not null,
+		    bio text,
+		    following_count integer,
+		    followers_count integer,
+		    location text,
+		    website text,
+		    join_date integer,
+		    is_private boolean default 0,
+		    is_verified boolean default 0,
+		    is_banned boolean default 0,
+		    is_deleted boolean default 0,
+		    profile_image_url text,
+		    profile_image_local_path text,
+		    banner_image_url text,
+		    banner_image_local_path text,
+		    pinned_tweet_id integer check(typeof(pinned_tweet_id) = 'integer' or pinned_tweet_id = ''),
+
+		    is_followed boolean default 0,
+		    is_id_fake boolean default 0,
+		    is_content_downloaded boolean default 0
+		);
+		insert into users_new (rowid, id, display_name, handle, bio, following_count, followers_count, location,
+		    website, join_date, is_private, is_verified, is_banned, is_deleted, profile_image_url,
+		    profile_image_local_path, banner_image_url, banner_image_local_path, pinned_tweet_id, is_followed,
+		    is_id_fake, is_content_downloaded)
+		select rowid, id, display_name, handle, bio, following_count, followers_count, location,
+		    website, join_date, is_private, is_verified, is_banned, is_deleted, profile_image_url,
+		    profile_image_local_path, banner_image_url, banner_image_local_path, pinned_tweet_id, is_followed,
+		    is_id_fake, is_content_downloaded
+		  from users;
+		drop table users;
+		alter table users_new rename to users;
+		commit;
+		pragma foreign_keys = ON;`,
+	`drop index if exists index_latest_message_in_chat_room;`,
+	`drop index if exists index_retweets_retweeted_by_and_at;
+		create index if not exists index_retweets_retweeted_at on retweets (retweeted_at);`,
+
+	// 35 => 34
+	`drop table if exists tweets_fts;`,
+	`drop table if exists tweet_engagement_snapshots;
+		drop table if exists poll_vote_snapshots;`,
+	`drop table if exists user_profile_history;`,
+	`drop table if exists tweet_versions;
+		alter table tweets drop column editable_until;`,
+	`drop table if exists tweet_deletions;`,
+
+	// 40 => 39
+	// Fails if any media files are shared (see "dedupe_media"); `MigrateTo` checks for that first
+	`begin transaction;
+		alter table images rename to images_new;
+		create table images (rowid integer primary key,
+		    id integer unique not null check(typeof(id) = 'integer'),
+		    tweet_id integer not null,
+		    width integer not null,
+		    height integer not null,
+		    remote_url text not null unique,
+		    local_filename text not null unique,
+		    is_downloaded boolean default 0,
+
+		    foreign key(tweet_id) references tweets(id)
+		);
+		insert into images (rowid, id, tweet_id, width, height, remote_url, local_filename, is_downloaded)
+		select rowid, id, tweet_id, width, height, remote_url, local_filename, is_downloaded from images_new;
+		drop table images_new;
+		create index if not exists index_images_tweet_id on images (tweet_id);
+
+		alter table videos rename to videos_new;
+		create table videos (rowid integer primary key,
+		    id integer unique not null check(typeof(id) = 'integer'),
+		    tweet_id integer not null,
+		    width integer not null,
+		    height integer not null,
+		    remote_url text not null unique,
+		    local_filename text not null unique,
+		    thumbnail_remote_url text not null default 'missing',
+		    thumbnail_local_filename text not null default 'missing',
+		    duration integer not null default 0,
+		    view_count integer not null default 0,
+		    is_gif boolean default 0,
+		    is_downloaded boolean default 0,
+		    is_blocked_by_dmca boolean not null default 0,
+
+		    foreign key(tweet_id) references tweets(id)
+		);
+		insert into videos (rowid, id, tweet_id, width, height, remote_url, local_filename, thumbnail_remote_url,
+		    thumbnail_local_filename, duration, view_count, is_gif, is_downloaded, is_blocked_by_dmca)
+		select rowid, id, tweet_id, width, height, remote_url, local_filename, thumbnail_remote_url,
+		    thumbnail_local_filename, duration, view_count, is_gif, is_downloaded, is_blocked_by_dmca
+		  from videos_new;
+		drop table videos_new;
+		create index if not exists index_videos_tweet_id on videos (tweet_id);
+		commit;`,
+	`drop table if exists saved_searches;`,
+	`drop table if exists mutes;`,
+	`drop table if exists scrape_jobs;`,
+	`drop table if exists media_download_queue;`,
+	`drop table if exists video_policy;
+		alter table videos drop column downloaded_height;
+		alter table videos drop column downloaded_bitrate;
+		alter table videos drop column is_audio_only;
+		drop table if exists video_variants;`,
+	`drop table superseded_media_files;`,
+}
+
 func (p Profile) GetDatabaseVersion() (int, error) {
 	row := p.DB.QueryRow("select version_number from database_version")
 
@@ -454,7 +920,20 @@ func (p Profile) check_and_update_version() error {
 		fmt.Printf("Database version is out of date.  Upgrading database from version %d to version %d!\n", version,
 			ENGINE_DATABASE_VERSION)
 		fmt.Printf(terminal_utils.COLOR_RESET)
-		return p.UpgradeFromXToY(version, ENGINE_DATABASE_VERSION)
+		result, err := p.MigrateTo(ENGINE_DATABASE_VERSION, false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("The database from before the upgrade was backed up to: %s\n", result.BackupDir)
+		if len(result.SchemaDifferences) != 0 {
+			// Don't refuse to load the profile; it might still be fine
+			fmt.Printf(terminal_utils.COLOR_YELLOW)
+			fmt.Printf("Warning: the upgraded database schema doesn't match what it should be:\n")
+			for _, d := range result.SchemaDifferences {
+				fmt.Printf("    %s\n", d)
+			}
+			fmt.Printf(terminal_utils.COLOR_RESET)
+		}
 	}
 
 	return nil
@@ -467,8 +946,9 @@ func (p Profile) UpgradeFromXToY(x int, y int) error {
 		fmt.Println(MIGRATIONS[i])
 		fmt.Printf(terminal_utils.COLOR_RESET)
 
-		p.DB.MustExec(MIGRATIONS[i])
-		p.DB.MustExec("update database_version set version_number = ?", i+1)
+		if err := p.run_migration(MIGRATIONS[i], i+1); err != nil {
+			return fmt.Errorf("Error upgrading database to version %d:\n  %w", i+1, err)
+		}
 
 		fmt.Printf(terminal_utils.COLOR_YELLOW)
 		fmt.Printf("Now at database schema version %d.\n", i+1)
@@ -480,3 +960,156 @@ func (p Profile) UpgradeFromXToY(x int, y int) error {
 	fmt.Printf(terminal_utils.COLOR_RESET)
 	return nil
 }
+
+// Run all the down-migrations from version X back to version Y (where X > Y), and update the
+// `database_version` table's `version_number`
+func (p Profile) DowngradeFromXToY(x int, y int) error {
+	for i := x; i > y; i-- {
+		fmt.Printf(terminal_utils.COLOR_CYAN)
+		fmt.Println(DOWN_MIGRATIONS[i-1])
+		fmt.Printf(terminal_utils.COLOR_RESET)
+
+		if err := p.run_migration(DOWN_MIGRATIONS[i-1], i-1); err != nil {
+			return fmt.Errorf("Error downgrading database to version %d:\n  %w", i-1, err)
+		}
+
+		fmt.Printf(terminal_utils.COLOR_YELLOW)
+		fmt.Printf("Now at database schema version %d.\n", i-1)
+		fmt.Printf(terminal_utils.COLOR_RESET)
+	}
+	fmt.Printf(terminal_utils.COLOR_GREEN)
+	fmt.Printf("================================================\n")
+	fmt.Printf("Database version has been downgraded to version %d.\n", y)
+	fmt.Printf(terminal_utils.COLOR_RESET)
+	return nil
+}
+
+// Run one migration and set the version number.  Migrations can have several statements, including
+// `begin` / `commit` and `pragma foreign_keys`, so they have to be run on the same connection.  If one
+// fails partway, its transaction is rolled back and foreign keys are turned back on.
+func (p Profile) run_migration(sql string, new_version int) error {
+	ctx := context.Background()
+	conn, err := p.DB.Connx(ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, sql)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "update database_version set version_number = ?", new_version)
+	}
+	if err != nil {
+		_, _ = conn.ExecContext(ctx, "rollback")                 //nolint:errcheck // there might not be a transaction
+		_, _ = conn.ExecContext(ctx, "pragma foreign_keys = on") //nolint:errcheck // best effort
+		return err
+	}
+	return nil
+}
+
+// How many of the backups made before migrating (in "migration_backups") to keep
+const NUM_MIGRATION_BACKUPS_TO_KEEP = 5
+
+var ErrDowngradeNotPossible = errors.New("can't migrate down to that version")
+
+// Checks that a down-migration will work, keyed by the version it migrates down from.  For
+// down-migrations that would fail partway on some data, so it can be refused before anything is changed.
+var down_migration_checks = map[int]func(Profile) error{
+	40: func(p Profile) error {
+		var num_shared_files int
+		err := p.DB.Get(&num_shared_files, `
+			select count(*) from (
+			    select local_filename from images group by local_filename having count(*) > 1
+			     union all
+			    select local_filename from videos group by local_filename having count(*) > 1
+			)`)
+		if err != nil {
+			panic(err)
+		}
+		if num_shared_files > 0 {
+			return fmt.Errorf("%w: %d media files are shared by more than one image or video (see \"dedupe_media\"),"+
+				" but before version 40 each one has to have its own file", ErrDowngradeNotPossible, num_shared_files)
+		}
+		return nil
+	},
+}
+
+// Result of migrating a Profile's database
+type MigrationResult struct {
+	FromVersion int
+	ToVersion   int
+	SQL         []string // The migrations that were run (or would be, for a dry run), in order
+	BackupDir   string   // Backup of the profile from before the migration; empty for a dry run
+
+	// How the migrated schema differs from what `schema.sql` says it should be at that version
+	SchemaDifferences []string
+}
+
+// Migrate the database to the given schema version, either up or down.  The Profile is backed up
+// first (to "migration_backups" in the profile directory, keeping the last few; see `Backup`), and
+// afterward its schema is checked against the expected schema for that version, i.e., `schema.sql`
+// migrated down to it.  If one of the migrations fails, the database is left at the last version that
+// succeeded.  Down-migrations that are known to fail on the Profile's data are refused up front, with
+// `ErrDowngradeNotPossible`.
+//
+// If `is_dry_run` is true, nothing is changed; the result just has the SQL that would be run.
+func (p Profile) MigrateTo(version int, is_dry_run bool) (MigrationResult, error) {
+	if version < 0 || version > ENGINE_DATABASE_VERSION {
+		return MigrationResult{}, fmt.Errorf("Invalid version %d (must be between 0 and %d)", version, ENGINE_DATABASE_VERSION)
+	}
+	current_version, err := p.GetDatabaseVersion()
+	if err != nil {
+		return MigrationResult{}, err
+	}
+	if current_version > ENGINE_DATABASE_VERSION {
+		return MigrationResult{}, VersionMismatchError{ENGINE_DATABASE_VERSION, current_version}
+	}
+	ret := MigrationResult{FromVersion: current_version, ToVersion: version, SQL: []string{}}
+	for i := current_version; i < version; i++ {
+		ret.SQL = append(ret.SQL, MIGRATIONS[i])
+	}
+	for i := current_version; i > version; i-- {
+		ret.SQL = append(ret.SQL, DOWN_MIGRATIONS[i-1])
+		if check, is_ok := down_migration_checks[i]; is_ok {
+			if err := check(p); err != nil {
+				return ret, err
+			}
+		}
+	}
+	if is_dry_run || current_version == version {
+		return ret, nil
+	}
+
+	backup, err := p.Backup(filepath.Join(p.ProfileDir, "migration_backups"), BackupOptions{NumToKeep: NUM_MIGRATION_BACKUPS_TO_KEEP})
+	if err != nil {
+		return ret, fmt.Errorf("Error backing up profile before migrating:\n  %w", err)
+	}
+	ret.BackupDir = backup.SnapshotDir
+
+	if version > current_version {
+		err = p.UpgradeFromXToY(current_version, version)
+	} else {
+		err = p.DowngradeFromXToY(current_version, version)
+	}
+	if err != nil {
+		return ret, fmt.Errorf("%w\n  (The database from before the migration was backed up to %q)", err, ret.BackupDir)
+	}
+
+	expected_schema, err := get_expected_schema(version)
+	if err != nil {
+		return ret, err
+	}
+	ret.SchemaDifferences = expected_schema.diff(get_schema_description(p.DB))
+	return ret, nil
+}
+
+// Migrate the database of the profile in the given directory, without upgrading it first (unlike
+// `LoadProfile`).  See `MigrateTo`.
+func MigrateProfile(profile_dir string, version int, is_dry_run bool) (MigrationResult, error) {
+	p, err := open_profile(profile_dir)
+	if err != nil {
+		return MigrationResult{}, err
+	}
+	defer p.DB.Close()
+	return p.MigrateTo(version, is_dry_run)
+}
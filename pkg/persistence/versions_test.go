@@ -4,12 +4,103 @@ import (
 	"testing"
 
 	"os"
+	"path/filepath"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
 )
 
+// Every migration should be reversible, and migrating down and back up should give the same schema as
+// `schema.sql`
+func TestMigrateDownAndUp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestMigrateDownAndUp"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+	require.Len(DOWN_MIGRATIONS, ENGINE_DATABASE_VERSION)
+
+	tweet := create_dummy_tweet()
+	require.NoError(profile.SaveTweet(tweet))
+
+	// Dry run doesn't change anything
+	result, err := profile.MigrateTo(0, true)
+	require.NoError(err)
+	assert.Len(result.SQL, ENGINE_DATABASE_VERSION)
+	assert.Equal(DOWN_MIGRATIONS[ENGINE_DATABASE_VERSION-1], result.SQL[0])
+	assert.Equal("", result.BackupDir)
+	version, err := profile.GetDatabaseVersion()
+	require.NoError(err)
+	assert.Equal(ENGINE_DATABASE_VERSION, version)
+
+	result, err = profile.MigrateTo(0, false)
+	require.NoError(err)
+	assert.Empty(result.SchemaDifferences)
+	assert.True(file_exists(filepath.Join(result.BackupDir, "twitter.db")))
+	version, err = profile.GetDatabaseVersion()
+	require.NoError(err)
+	assert.Equal(0, version)
+
+	// Check the schema at every version on the way back up
+	for v := 1; v <= ENGINE_DATABASE_VERSION; v++ {
+		result, err := profile.MigrateTo(v, false)
+		require.NoError(err)
+		assert.Empty(result.SchemaDifferences, "version %d", v)
+	}
+
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.Equal(tweet.Text, new_tweet.Text)
+
+	// Only the most recent backups are kept
+	backups, err := ListBackupSnapshots(filepath.Join(profile_path, "migration_backups"))
+	require.NoError(err)
+	assert.Len(backups, NUM_MIGRATION_BACKUPS_TO_KEEP)
+
+	_, err = profile.MigrateTo(ENGINE_DATABASE_VERSION+1, false)
+	assert.Error(err)
+}
+
+// A down-migration that fails should be rolled back, leaving the database at the last version that succeeded
+func TestMigrateDownFails(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestMigrateDownFails"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	// Two images sharing a file can't be migrated back to when `local_filename` was unique (before version 40)
+	tweet := create_dummy_tweet()
+	tweet.Images[1].LocalFilename = tweet.Images[0].LocalFilename
+	require.NoError(profile.SaveTweet(tweet))
+
+	// `MigrateTo` refuses before changing anything (even for a dry run)
+	_, err := profile.MigrateTo(39, true)
+	assert.ErrorIs(err, ErrDowngradeNotPossible)
+	_, err = profile.MigrateTo(39, false)
+	assert.ErrorIs(err, ErrDowngradeNotPossible)
+	version, err := profile.GetDatabaseVersion()
+	require.NoError(err)
+	assert.Equal(ENGINE_DATABASE_VERSION, version)
+	assert.False(file_exists(filepath.Join(profile_path, "migration_backups")))
+
+	// Without that check, the failed migration is rolled back
+	err = profile.DowngradeFromXToY(ENGINE_DATABASE_VERSION, 39)
+	require.Error(err)
+	version, err = profile.GetDatabaseVersion()
+	require.NoError(err)
+	assert.Equal(40, version)
+	images, err := profile.GetImagesForTweet(tweet) // Not `GetTweetById`, since other tables' columns have changed since
+	require.NoError(err)
+	assert.Len(images, 2)
+}
+
 func TestVersionUpgrade(t *testing.T) {
 	require := require.New(t)
 	profile_path := "test_profiles/TestVersions"
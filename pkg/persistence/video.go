@@ -2,6 +2,26 @@ package persistence
 
 type VideoID int64
 
+const (
+	VIDEO_CONTENT_TYPE_MP4 = "video/mp4"
+	VIDEO_CONTENT_TYPE_HLS = "application/x-mpegURL"
+)
+
+// One of the available versions of a video
+type VideoVariant struct {
+	VideoID     VideoID `db:"video_id"`
+	ContentType string  `db:"content_type"`
+	Bitrate     int     `db:"bitrate"`
+	Width       int     `db:"width"`
+	Height      int     `db:"height"`
+	URL         string  `db:"url"`
+}
+
+// Whether it's an HLS playlist, rather than an MP4 file
+func (v VideoVariant) IsHLS() bool {
+	return v.ContentType == VIDEO_CONTENT_TYPE_HLS
+}
+
 type Video struct {
 	ID            VideoID     `db:"id"`
 	TweetID       TweetID     `db:"tweet_id"`
@@ -20,4 +40,10 @@ type Video struct {
 	IsBlockedByDMCA bool `db:"is_blocked_by_dmca"`
 	IsGeoblocked    bool `db:"is_geoblocked"`
 	IsGif           bool `db:"is_gif"`
+
+	// All the available versions (see `GetVideoVariants`), and which one was downloaded
+	Variants          []VideoVariant
+	DownloadedHeight  int  `db:"downloaded_height"`
+	DownloadedBitrate int  `db:"downloaded_bitrate"`
+	IsAudioOnly       bool `db:"is_audio_only"`
 }
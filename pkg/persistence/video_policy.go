@@ -0,0 +1,55 @@
+package persistence
+
+type VideoPolicyMode string
+
+const (
+	VIDEO_POLICY_VIDEO          = VideoPolicyMode("video")          // Download the video
+	VIDEO_POLICY_AUDIO_ONLY     = VideoPolicyMode("audio_only")     // Just the audio track, if there's a separate one
+	VIDEO_POLICY_THUMBNAIL_ONLY = VideoPolicyMode("thumbnail_only") // Don't download videos, just their thumbnails
+)
+
+var VIDEO_POLICY_MODES = []VideoPolicyMode{VIDEO_POLICY_VIDEO, VIDEO_POLICY_AUDIO_ONLY, VIDEO_POLICY_THUMBNAIL_ONLY}
+
+// Which version of each video to download.  The best version within the limits is chosen; if none
+// of them are within the limits, the smallest one is.
+type VideoPolicy struct {
+	Mode       VideoPolicyMode `db:"mode"`
+	MaxHeight  int             `db:"max_height"`  // 0 means no limit
+	MaxBitrate int             `db:"max_bitrate"` // bits per second; 0 means no limit
+}
+
+var DEFAULT_VIDEO_POLICY = VideoPolicy{Mode: VIDEO_POLICY_VIDEO}
+
+// Whether a variant is within the limits.  Unknown heights and bitrates (i.e., 0) are allowed.
+func (p VideoPolicy) allows(v VideoVariant) bool {
+	return (p.MaxHeight == 0 || v.Height <= p.MaxHeight) && (p.MaxBitrate == 0 || v.Bitrate <= p.MaxBitrate)
+}
+
+// Whether variant `a` is better quality than `b`
+func is_better_variant(a VideoVariant, b VideoVariant) bool {
+	if a.Height != b.Height {
+		return a.Height > b.Height
+	}
+	return a.Bitrate > b.Bitrate
+}
+
+// Pick the best variant within the limits (or the smallest one, if none are).  For "audio only",
+// the smallest one is picked, since only its audio is wanted.
+//
+// Returns the index of the chosen variant.  There has to be at least one.
+func (p VideoPolicy) choose_variant_index(variants []VideoVariant) int {
+	best := -1
+	smallest := 0
+	for i, v := range variants {
+		if is_better_variant(variants[smallest], v) {
+			smallest = i
+		}
+		if p.allows(v) && (best == -1 || is_better_variant(v, variants[best])) {
+			best = i
+		}
+	}
+	if best == -1 || p.Mode == VIDEO_POLICY_AUDIO_ONLY {
+		return smallest
+	}
+	return best
+}
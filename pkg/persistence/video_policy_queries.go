@@ -0,0 +1,34 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrInvalidVideoPolicy = errors.New("invalid video policy")
+
+func (p Profile) GetVideoPolicy() VideoPolicy {
+	var ret VideoPolicy
+	err := p.DB.Get(&ret, `select mode, max_height, max_bitrate from video_policy where rowid = 1`)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func (p Profile) SetVideoPolicy(policy VideoPolicy) error {
+	if !slices.Contains(VIDEO_POLICY_MODES, policy.Mode) {
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidVideoPolicy, policy.Mode)
+	}
+	if policy.MaxHeight < 0 || policy.MaxBitrate < 0 {
+		return fmt.Errorf("%w: limits can't be negative", ErrInvalidVideoPolicy)
+	}
+	_, err := p.DB.NamedExec(`
+		update video_policy set mode = :mode, max_height = :max_height, max_bitrate = :max_bitrate where rowid = 1
+	`, policy)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package persistence_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+func TestVideoPolicy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestVideoPolicy"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+
+	assert.Equal(DEFAULT_VIDEO_POLICY, profile.GetVideoPolicy())
+
+	policy := VideoPolicy{Mode: VIDEO_POLICY_AUDIO_ONLY, MaxHeight: 720, MaxBitrate: 1000000}
+	require.NoError(profile.SetVideoPolicy(policy))
+	assert.Equal(policy, profile.GetVideoPolicy())
+
+	// Invalid policies
+	assert.ErrorIs(profile.SetVideoPolicy(VideoPolicy{Mode: "asdf"}), ErrInvalidVideoPolicy)
+	assert.ErrorIs(profile.SetVideoPolicy(VideoPolicy{Mode: VIDEO_POLICY_VIDEO, MaxHeight: -1}), ErrInvalidVideoPolicy)
+	assert.Equal(policy, profile.GetVideoPolicy())
+}
+
+// Give a tweet's video several MP4 variants (and an HLS playlist, which shouldn't be used)
+func add_video_variants(tweet *Tweet) {
+	vid := &tweet.Videos[0]
+	vid.Variants = []VideoVariant{
+		{ContentType: VIDEO_CONTENT_TYPE_HLS, URL: fmt.Sprintf("%d/playlist.m3u8", vid.ID)},
+	}
+	for _, height := range []int{360, 720, 1080} {
+		vid.Variants = append(vid.Variants, VideoVariant{
+			ContentType: VIDEO_CONTENT_TYPE_MP4,
+			Bitrate:     height * 1000,
+			Width:       height * 16 / 9,
+			Height:      height,
+			URL:         fmt.Sprintf("%d/%dp.mp4", vid.ID, height),
+		})
+	}
+}
+
+func TestDownloadVideoWithPolicy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestDownloadVideoWithPolicy"
+	if file_exists(profile_path) {
+		require.NoError(os.RemoveAll(profile_path))
+	}
+	profile := create_or_load_profile(profile_path)
+	downloader := DefaultDownloader{Download: func(url string) ([]byte, error) {
+		return []byte(url), nil
+	}}
+
+	tweet := create_dummy_tweet()
+	add_video_variants(&tweet)
+	vid_id := tweet.Videos[0].ID
+	require.NoError(profile.SaveTweet(tweet))
+
+	// All the variants should be saved, best first
+	variants := profile.GetVideoVariants(vid_id)
+	require.Len(variants, 4)
+	assert.Equal(1080, variants[0].Height)
+	assert.Equal(vid_id, variants[0].VideoID)
+	assert.True(variants[3].IsHLS())
+
+	// Download the best one that's at most 720p
+	require.NoError(profile.SetVideoPolicy(VideoPolicy{Mode: VIDEO_POLICY_VIDEO, MaxHeight: 720}))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	vid := new_tweet.Videos[0]
+	assert.True(vid.IsDownloaded)
+	assert.False(vid.IsAudioOnly)
+	assert.Equal(720, vid.DownloadedHeight)
+	assert.Equal(720000, vid.DownloadedBitrate)
+	contents, err := os.ReadFile(filepath.Join(profile_path, "videos", vid.LocalFilename))
+	require.NoError(err)
+	assert.Equal(fmt.Sprintf("%d/720p.mp4", vid_id), string(contents))
+
+	// Nothing better within the limits, so no upgrade
+	num_upgraded, err := profile.UpgradeTweetVideos(tweet.ID, VideoPolicy{MaxHeight: 720}, downloader)
+	require.NoError(err)
+	assert.Equal(0, num_upgraded)
+
+	// Upgrade to the best one
+	num_upgraded, err = profile.UpgradeTweetVideos(tweet.ID, VideoPolicy{}, downloader)
+	require.NoError(err)
+	assert.Equal(1, num_upgraded)
+	new_tweet, err = profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	vid = new_tweet.Videos[0]
+	assert.Equal(1080, vid.DownloadedHeight)
+	assert.Regexp(`^[0-9a-f]{2}/[0-9a-f]{64}\.mp4$`, vid.LocalFilename)
+	contents, err = os.ReadFile(filepath.Join(profile_path, "videos", vid.LocalFilename))
+	require.NoError(err)
+	assert.Equal(fmt.Sprintf("%d/1080p.mp4", vid_id), string(contents))
+
+	// If none are within the limits, the smallest one is downloaded
+	tweet = create_dummy_tweet()
+	add_video_variants(&tweet)
+	require.NoError(profile.SaveTweet(tweet))
+	require.NoError(profile.SetVideoPolicy(VideoPolicy{Mode: VIDEO_POLICY_VIDEO, MaxBitrate: 1000}))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+	assert.Equal(360, tweet.Videos[0].DownloadedHeight)
+}
+
+func TestDownloadVideoThumbnailOnly(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profile_path := "test_profiles/TestDownloadVideoWithPolicy"
+	profile := create_or_load_profile(profile_path)
+	downloader := NewFakeDownloader()
+
+	tweet := create_dummy_tweet()
+	add_video_variants(&tweet)
+	require.NoError(profile.SaveTweet(tweet))
+	require.NoError(profile.SetVideoPolicy(VideoPolicy{Mode: VIDEO_POLICY_THUMBNAIL_ONLY}))
+	require.NoError(profile.DownloadTweetContentWithInjector(&tweet, downloader))
+
+	// The tweet is done, but its video isn't downloaded
+	new_tweet, err := profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.True(new_tweet.IsContentDownloaded)
+	assert.False(new_tweet.Videos[0].IsDownloaded)
+	assert.True(downloader.Contains(SpyResult{
+		tweet.Videos[0].ThumbnailRemoteUrl,
+		filepath.Join(profile_path, "video_thumbnails", tweet.Videos[0].ThumbnailLocalPath),
+	}))
+	for _, result := range *downloader.Spy {
+		assert.NotEqual(filepath.Join(profile_path, "videos", tweet.Videos[0].LocalFilename), result.outpath)
+	}
+
+	// It can still be downloaded later
+	num_upgraded, err := profile.UpgradeTweetVideos(tweet.ID, VideoPolicy{MaxHeight: 360}, downloader)
+	require.NoError(err)
+	assert.Equal(1, num_upgraded)
+	new_tweet, err = profile.GetTweetById(tweet.ID)
+	require.NoError(err)
+	assert.True(new_tweet.Videos[0].IsDownloaded)
+	assert.Equal(360, new_tweet.Videos[0].DownloadedHeight)
+}
@@ -2,6 +2,8 @@ package scraper
 
 import (
 	"errors"
+	"fmt"
+	"time"
 )
 
 var (
@@ -16,4 +18,27 @@ var (
 
 	// These are not API errors, but network errors generally
 	ErrNoInternet = errors.New("no internet connection")
+
+	// Account archive errors
+	ErrNotATwitterArchive = errors.New("not a Twitter account archive")
+	ErrMediaNotInArchive  = errors.New("media file not found in archive")
 )
+
+// A rate limit error that knows when the limit resets.  It wraps ErrRateLimited, so check for it with
+// `errors.Is(err, ErrRateLimited)`, and use `errors.As` to get the reset time.
+type RateLimitError struct {
+	Endpoint string // Empty if the limit isn't for a particular endpoint (e.g., an HTTP 429)
+	ResetAt  time.Time
+}
+
+func (e RateLimitError) Error() string {
+	if e.Endpoint == "" {
+		return fmt.Sprintf("%s (resets at %d, which is in %s)", ErrRateLimited, e.ResetAt.Unix(), time.Until(e.ResetAt).String())
+	}
+	return fmt.Sprintf("%s (%s: resets at %d, which is in %s)",
+		ErrRateLimited, e.Endpoint, e.ResetAt.Unix(), time.Until(e.ResetAt).String())
+}
+
+func (e RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
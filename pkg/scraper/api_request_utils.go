@@ -26,6 +26,10 @@ type API struct {
 	Client          http.Client
 	CSRFToken       string
 	Delay           time.Duration
+
+	// Copies of an API share the same RateLimiter, but can have different priorities
+	RateLimiter *RateLimiter
+	Priority    RequestPriority
 }
 
 type api_outstruct struct {
@@ -85,6 +89,7 @@ func (api *API) UnmarshalJSON(data []byte) error {
 		Jar:     cookie_jar,
 	}
 	api.CSRFToken = in_struct.CSRFToken
+	api.RateLimiter = NewRateLimiter()
 	return nil
 }
 
@@ -94,10 +99,11 @@ func (api API) add_authentication_headers(req *http.Request) {
 	req.Header.Set("x-twitter-client-language", "en")
 
 	if api.IsAuthenticated {
-		if api.CSRFToken == "" {
+		csrf_token := api.get_csrf_token()
+		if csrf_token == "" {
 			panic("No CSRF token set!")
 		}
-		req.Header.Set("x-csrf-token", api.CSRFToken)
+		req.Header.Set("x-csrf-token", csrf_token)
 	} else {
 		// Not authenticated; use guest token
 		if api.GuestToken == "" {
@@ -124,11 +130,31 @@ func NewGuestSession() (API, error) {
 			Timeout: 10 * time.Second,
 			Jar:     jar,
 		},
-		CSRFToken: "",
+		CSRFToken:   "",
+		RateLimiter: NewRateLimiter(),
 	}, nil
 }
 
 func (api *API) update_csrf_token() {
+	if csrf_token := api.csrf_token_from_cookies(); csrf_token != "" {
+		api.CSRFToken = csrf_token
+	}
+}
+
+// The CSRF token has to match the "ct0" cookie.  Copies of an API share the cookie jar, so another
+// copy's requests might have changed it since this copy's `CSRFToken` was set; use the cookie if
+// there is one.
+func (api API) get_csrf_token() string {
+	if csrf_token := api.csrf_token_from_cookies(); csrf_token != "" {
+		return csrf_token
+	}
+	return api.CSRFToken
+}
+
+func (api API) csrf_token_from_cookies() string {
+	if api.Client.Jar == nil {
+		return ""
+	}
 	dummyURL, err := url.Parse("https://twitter.com/i/api/1.1/onboarding/task.json")
 	if err != nil {
 		panic(err)
@@ -136,10 +162,10 @@ func (api *API) update_csrf_token() {
 
 	for _, cookie := range api.Client.Jar.Cookies(dummyURL) {
 		if cookie.Name == "ct0" {
-			api.CSRFToken = cookie.Value
-			return
+			return cookie.Value
 		}
 	}
+	return ""
 }
 
 func is_timeout(err error) bool {
@@ -184,9 +210,11 @@ func (api *API) do_http_POST(remote_url string, body string, result interface{})
 	api.add_authentication_headers(req)
 
 	log.Debug(print_req(req, api.Client.Jar.Cookies(req.URL)))
-	resp, err := api.Client.Do(req)
+	resp, err := api.send_request(req)
 	if is_timeout(err) {
 		return fmt.Errorf("POST %q:\n  %w", remote_url, ErrRequestTimeout)
+	} else if errors.Is(err, ErrRateLimited) {
+		return fmt.Errorf("POST %q:\n  %w", remote_url, err)
 	} else if err != nil {
 		return fmt.Errorf("Error executing HTTP POST request:\n  %w", err)
 	}
@@ -242,9 +270,11 @@ func (api *API) do_http(remote_url string, cursor string, result interface{}) er
 	api.add_authentication_headers(req)
 
 	log.Debug(print_req(req, api.Client.Jar.Cookies(req.URL)))
-	resp, err := api.Client.Do(req)
+	resp, err := api.send_request(req)
 	if is_timeout(err) {
 		return fmt.Errorf("GET %q:\n  %w", remote_url, ErrRequestTimeout)
+	} else if errors.Is(err, ErrRateLimited) {
+		return fmt.Errorf("GET %q:\n  %w", remote_url, err)
 	} else if err != nil {
 		return fmt.Errorf("Error executing HTTP request:\n  %w", err)
 	}
@@ -259,7 +289,7 @@ func (api *API) do_http(remote_url string, cursor string, result interface{}) er
 		// "Too many requests" => rate limited
 		log.Warn("HTTP 429")
 		reset_at := TimestampFromUnix(int64(int_or_panic(resp.Header.Get("X-Rate-Limit-Reset"))))
-		return fmt.Errorf("%w (resets at %d, which is in %s)", ErrRateLimited, reset_at.Unix(), time.Until(reset_at.Time).String())
+		return RateLimitError{ResetAt: reset_at.Time}
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -290,6 +320,35 @@ func (api *API) do_http(remote_url string, cursor string, result interface{}) er
 	return nil
 }
 
+// Send a request, waiting for the endpoint's rate limit first if necessary (see `RateLimiter`).  If
+// it gets rate limited anyway (HTTP 429), it's sent again once the rate limit resets.
+func (api *API) send_request(req *http.Request) (*http.Response, error) {
+	if api.RateLimiter == nil {
+		return api.Client.Do(req)
+	}
+	endpoint := endpoint_name(req.URL)
+	for is_retry := false; ; is_retry = true {
+		if err := api.RateLimiter.acquire(endpoint, api.Priority); err != nil {
+			return nil, err
+		}
+		resp, err := api.Client.Do(req)
+		api.RateLimiter.release(endpoint, resp)
+		if err != nil || resp.StatusCode != 429 || is_retry || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		log.Warnf("HTTP 429 (%s); waiting for the rate limit to reset", endpoint)
+		resp.Body.Close()
+		if req.GetBody != nil {
+			// The body has already been read; get a fresh copy
+			req.Body, err = req.GetBody()
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
 // Add the query params to get all data
 func add_tweet_query_params(query *url.Values) {
 	query.Add("include_profile_interstitial_type", "1")
@@ -49,8 +49,9 @@ func ParseAPIMedia(apiMedia APIMedia) Image {
 // -------------------------------------------------------------------------
 
 type Variant struct {
-	Bitrate int    `json:"bitrate,omitempty"`
-	URL     string `json:"url"`
+	Bitrate     int    `json:"bitrate,omitempty"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
 }
 type APIExtendedMedia struct {
 	ID            int64  `json:"id_str,string"`
@@ -76,10 +77,31 @@ type APIExtendedMedia struct {
 	URL string `json:"url"` // For DM videos
 }
 
+// MP4 variant URLs include the resolution, e.g., ".../vid/720x1280/sm4iL9_f8Lclh0aa.mp4"
+var video_variant_resolution_regex = regexp.MustCompile(`/(\d+)x(\d+)/`)
+
+// Convert a Variant into a VideoVariant.  Variants with no content type are assumed to be MP4, unless
+// they're m3u8 playlists.
+func ParseAPIVideoVariant(v Variant, video_id VideoID) VideoVariant {
+	ret := VideoVariant{VideoID: video_id, ContentType: v.ContentType, Bitrate: v.Bitrate, URL: v.URL}
+	if ret.ContentType == "" {
+		if strings.Contains(v.URL, ".m3u8") {
+			ret.ContentType = VIDEO_CONTENT_TYPE_HLS
+		} else {
+			ret.ContentType = VIDEO_CONTENT_TYPE_MP4
+		}
+	}
+	if matches := video_variant_resolution_regex.FindStringSubmatch(v.URL); matches != nil {
+		ret.Width = int_or_panic(matches[1])
+		ret.Height = int_or_panic(matches[2])
+	}
+	return ret
+}
+
 func ParseAPIVideo(apiVideo APIExtendedMedia) Video {
 	variants := apiVideo.VideoInfo.Variants
 	slices.SortFunc(variants, func(a, b Variant) int { return b.Bitrate - a.Bitrate })
-	video_remote_url := variants[0].URL
+	video_remote_url := variants[0].URL // The highest-bitrate MP4, if there are any (HLS variants have no bitrate)
 
 	var view_count int
 
@@ -117,7 +139,16 @@ func ParseAPIVideo(apiVideo APIExtendedMedia) Video {
 		panic(err)
 	}
 
-	local_filename := get_prefixed_path(path.Base(video_parsed_url.Path))
+	// HLS videos are saved as MP4 files
+	local_filename := get_prefixed_path(strings.TrimSuffix(path.Base(video_parsed_url.Path), ".m3u8"))
+	if path.Ext(video_parsed_url.Path) == ".m3u8" {
+		local_filename += ".mp4"
+	}
+
+	video_variants := []VideoVariant{}
+	for _, v := range variants {
+		video_variants = append(video_variants, ParseAPIVideoVariant(v, VideoID(apiVideo.ID)))
+	}
 
 	return Video{
 		ID:            VideoID(apiVideo.ID),
@@ -135,6 +166,8 @@ func ParseAPIVideo(apiVideo APIExtendedMedia) Video {
 		IsBlockedByDMCA: false,
 		IsGeoblocked:    apiVideo.ExtMediaAvailability.Reason == "Geoblocked",
 		IsGif:           apiVideo.Type == "animated_gif",
+
+		Variants: video_variants,
 	}
 }
 
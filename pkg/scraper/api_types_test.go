@@ -506,6 +506,37 @@ func TestParseAPIVideo(t *testing.T) {
 	assert.Equal(275952, video.ViewCount)
 	assert.Equal(88300, video.Duration)
 	assert.False(video.IsDownloaded)
+
+	// All the variants are kept, including the HLS playlist
+	require.Len(video.Variants, 4)
+	assert.Equal(VideoVariant{
+		VideoID:     video.ID,
+		ContentType: VIDEO_CONTENT_TYPE_MP4,
+		Bitrate:     2176000,
+		Width:       720,
+		Height:      1280,
+		URL:         video.RemoteURL,
+	}, video.Variants[0])
+	assert.Equal(VideoVariant{
+		VideoID:     video.ID,
+		ContentType: VIDEO_CONTENT_TYPE_HLS,
+		URL:         "https://video.twimg.com/ext_tw_video/1418951950020845568/pu/pl/cB33qJYlO9sdI44P.m3u8?tag=12&container=fmp4",
+	}, video.Variants[3])
+}
+
+func TestParseAPIVideoHLSOnly(t *testing.T) {
+	assert := assert.New(t)
+	apivideo := APIExtendedMedia{ID: 1234, MediaURLHttps: "https://pbs.twimg.com/amplify_video_thumb/1234/img/abcdefg.jpg"}
+	apivideo.VideoInfo.Variants = []Variant{{URL: "https://video.twimg.com/amplify_video/1234/pl/playlist.m3u8?tag=14"}}
+
+	video := ParseAPIVideo(apivideo)
+	assert.Equal("https://video.twimg.com/amplify_video/1234/pl/playlist.m3u8?tag=14", video.RemoteURL)
+	assert.Equal("pl/playlist.mp4", video.LocalFilename)
+	assert.Equal([]VideoVariant{{
+		VideoID:     VideoID(1234),
+		ContentType: VIDEO_CONTENT_TYPE_HLS,
+		URL:         video.RemoteURL,
+	}}, video.Variants)
 }
 
 func TestParseGeoblockedVideo(t *testing.T) {
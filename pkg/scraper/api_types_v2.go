@@ -179,6 +179,12 @@ func (s *Int64Slice) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Info about a tweet's edit history
+type APIV2EditControl struct {
+	EditTweetIDs       Int64Slice `json:"edit_tweet_ids"` // All versions of the tweet, oldest first
+	EditableUntilMsecs int64      `json:"editable_until_msecs,string"`
+}
+
 type Tombstone struct {
 	Text struct {
 		Text string `json:"text"`
@@ -201,10 +207,32 @@ type _Result struct {
 		} `json:"note_tweet_results"`
 	} `json:"note_tweet"`
 	EditControl struct {
-		EditTweetIDs Int64Slice `json:"edit_tweet_ids"`
+		APIV2EditControl
+		// Newer responses nest it, if the tweet is an edit of another tweet
+		EditControlInitial *APIV2EditControl `json:"edit_control_initial"`
 	} `json:"edit_control"`
 }
 
+func (r _Result) get_edit_control() APIV2EditControl {
+	if r.EditControl.EditControlInitial != nil {
+		return *r.EditControl.EditControlInitial
+	}
+	return r.EditControl.APIV2EditControl
+}
+
+// Copy the edit history onto a Tweet.  Tweets that have never been edited don't get a list of versions.
+func (e APIV2EditControl) apply_to(t *Tweet) {
+	if e.EditableUntilMsecs != 0 {
+		t.EditableUntil = TimestampFromUnixMilli(e.EditableUntilMsecs)
+	}
+	if len(e.EditTweetIDs) > 1 {
+		t.EditTweetIDs = []TweetID{}
+		for _, id := range e.EditTweetIDs {
+			t.EditTweetIDs = append(t.EditTweetIDs, TweetID(id))
+		}
+	}
+}
+
 type APIV2Result struct {
 	Result struct {
 		_Result
@@ -240,21 +268,27 @@ func (api_result APIV2Result) ToTweetTrove() (TweetTrove, error) {
 
 	// Process the tweet itself
 	main_tweet_trove, err := api_result.Result.Legacy.ToTweetTrove()
+	edit_control := api_result.Result.get_edit_control()
 	if errors.Is(err, ErrNoTweet) {
 		// If the tweet is edited, the entry is just a list of the more recent versions
-		edit_tweet_ids := api_result.Result.EditControl.EditTweetIDs
+		edit_tweet_ids := edit_control.EditTweetIDs
 		if api_result.Result.ID != 0 && len(edit_tweet_ids) > 1 && edit_tweet_ids[len(edit_tweet_ids)-1] != api_result.Result.ID {
 			// There's a more recent version of the tweet available
-			main_tweet_trove.Tweets[TweetID(api_result.Result.ID)] = Tweet{
+			tombstone := Tweet{
 				TombstoneType: "newer-version-available",
 				ID:            TweetID(api_result.Result.ID),
 			}
+			edit_control.apply_to(&tombstone)
+			main_tweet_trove.Tweets[tombstone.ID] = tombstone
 		} else {
 			// Not edited; something else is wrong
 			return TweetTrove{}, err
 		}
 	} else if err != nil {
 		panic(err)
+	} else if main_tweet, is_ok := main_tweet_trove.Tweets[TweetID(api_result.Result.ID)]; is_ok {
+		edit_control.apply_to(&main_tweet)
+		main_tweet_trove.Tweets[main_tweet.ID] = main_tweet
 	}
 	ret.MergeWith(main_tweet_trove)
 
@@ -1153,6 +1187,62 @@ func (api *API) GetTweetFullAPIV2(id TweetID, how_many int) (TweetTrove, error)
 	return trove, err
 }
 
+// Re-fetch a single tweet, without its replies, to check whether it's still available.  If it's
+// been deleted (or suspended, hidden, etc), the trove will have a tombstone for it instead.
+//
+// If Twitter's response doesn't have the tweet at all (not even a tombstone), that's an error
+// (ErrExternalApiError), rather than a sign that it's gone.
+func (api *API) RecheckTweet(id TweetID) (TweetTrove, error) {
+	resp, err := api.GetTweetDetail(id, "")
+	if errors.Is(err, ErrDoesntExist) {
+		trove := NewTweetTrove()
+		fake_user := GetUnknownUser()
+		trove.Users[fake_user.ID] = fake_user
+		trove.Tweets[id] = Tweet{
+			ID:            id,
+			UserID:        fake_user.ID,
+			TombstoneType: "deleted",
+			IsStub:        true,
+			LastScrapedAt: Timestamp{time.Now()},
+		}
+		return trove, nil
+	} else if err != nil {
+		return TweetTrove{}, err
+	}
+	trove, err := resp.ToTweetTrove()
+	if err != nil {
+		return TweetTrove{}, err
+	}
+
+	tweet, is_ok := trove.Tweets[id]
+	if !is_ok {
+		return TweetTrove{}, fmt.Errorf("%w: tweet %d isn't in the response", ErrExternalApiError, id)
+	}
+	tweet.LastScrapedAt = Timestamp{time.Now()}
+	trove.Tweets[id] = tweet
+	return trove, nil
+}
+
+// Re-check a batch of tweets (see `RecheckTweet`).  If it fails partway through, e.g., from being
+// rate-limited, the tweets checked so far are returned along with the error.
+//
+// Tweets that aren't in Twitter's response are skipped (and left as they are), so one odd response
+// doesn't stop the rest of the batch.
+func (api *API) RecheckTweets(ids []TweetID) (TweetTrove, error) {
+	ret := NewTweetTrove()
+	for _, id := range ids {
+		trove, err := api.RecheckTweet(id)
+		if errors.Is(err, ErrExternalApiError) {
+			log.Warnf("Skipping tweet ID %d:\n  %s", id, err.Error())
+			continue
+		} else if err != nil {
+			return ret, fmt.Errorf("Error re-checking tweet ID %d:\n  %w", id, err)
+		}
+		ret.MergeWith(trove)
+	}
+	return ret, nil
+}
+
 // Paginated User Likes
 // --------------------
 
@@ -2,6 +2,7 @@ package scraper_test
 
 import (
 	"testing"
+	"time"
 
 	"encoding/json"
 	"os"
@@ -641,11 +642,53 @@ func TestTweetWithNewerVersion(t *testing.T) {
 	tweet, is_ok := trove.Tweets[1653413433461579783]
 	assert.True(is_ok)
 	assert.Equal(tweet.TombstoneType, "newer-version-available")
+	assert.Equal([]TweetID{1653413433461579783, 1653413735866814470}, tweet.EditTweetIDs)
+	assert.Equal(int64(1683041256000), tweet.EditableUntil.UnixMilli())
 
 	assert.Len(trove.Users, 0)
 	assert.Len(trove.Retweets, 0)
 }
 
+// Latest version of an edited tweet, with the edit history nested under "edit_control_initial"
+func TestTweetWithEdits(t *testing.T) {
+	assert := assert.New(t)
+	data, err := os.ReadFile("test_responses/api_v2/tweet_with_edits.json")
+	require.NoError(t, err)
+
+	var entry APIV2Result
+	err = json.Unmarshal(data, &entry)
+	require.NoError(t, err)
+
+	trove, err := entry.ToTweetTrove()
+	require.NoError(t, err)
+
+	assert.Len(trove.Tweets, 1)
+	tweet, is_ok := trove.Tweets[1485708879174508550]
+	require.True(t, is_ok)
+	assert.Equal("", tweet.TombstoneType)
+	assert.Equal([]TweetID{1485708879174508549, 1485708879174508550}, tweet.EditTweetIDs)
+	assert.Equal(int64(1643057374000), tweet.EditableUntil.UnixMilli())
+}
+
+// Tweets that have never been edited shouldn't get a list of versions
+func TestTweetWithoutEdits(t *testing.T) {
+	assert := assert.New(t)
+	data, err := os.ReadFile("test_responses/api_v2/expandable_tweet.json")
+	require.NoError(t, err)
+
+	var entry APIV2Result
+	err = json.Unmarshal(data, &entry)
+	require.NoError(t, err)
+
+	trove, err := entry.ToTweetTrove()
+	require.NoError(t, err)
+
+	tweet, is_ok := trove.Tweets[1649600354747572225]
+	require.True(t, is_ok)
+	assert.Nil(tweet.EditTweetIDs)
+	assert.Equal(int64(1682132147000), tweet.EditableUntil.UnixMilli())
+}
+
 func TestAPIV2ConversationThreadWithTombstones(t *testing.T) {
 	assert := assert.New(t)
 	data, err := os.ReadFile("test_responses/api_v2/conversation_thread_with_tombstones.json")
@@ -1045,3 +1088,23 @@ func TestParseTweetThreadWithBannedUser(t *testing.T) {
 	assert.Equal(banned_user.Handle, UserHandle("spandrell3"))
 	assert.True(banned_user.IsBanned)
 }
+
+// A tweet that's missing from the response isn't recorded as a tombstone
+func TestRecheckTweetNotInResponse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Serves a tweet detail response with nothing in it
+	api := rate_limited_api(&rate_limited_transport{
+		body:      `{"data": {"threaded_conversation_with_injections_v2": {"instructions": [{"type": "TimelineAddEntries"}]}}}`,
+		remaining: 10,
+		reset_at:  time.Now().Add(time.Hour),
+	})
+	_, err := api.RecheckTweet(TweetID(1))
+	assert.ErrorIs(err, ErrExternalApiError)
+
+	// It's skipped in a batch
+	trove, err := api.RecheckTweets([]TweetID{1, 2})
+	require.NoError(err)
+	assert.Len(trove.Tweets, 0)
+}
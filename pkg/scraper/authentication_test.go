@@ -36,7 +36,8 @@ func TestJsonifyApi(t *testing.T) {
 			Timeout: 10 * time.Second,
 			Jar:     cookie_jar,
 		},
-		CSRFToken: "csrf token",
+		CSRFToken:   "csrf token",
+		RateLimiter: NewRateLimiter(),
 	}
 
 	bytes, err := json.Marshal(api)
@@ -0,0 +1,300 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// A cassette is a recording of the scraper's HTTP traffic: every request it sent and the response it
+// got back.  In "record" mode, requests are sent as usual and each one is saved to the cassette file;
+// in "replay" mode, responses are served from the file, without using the network.  This way a
+// scrape (e.g., one that hit a parsing bug) can be reproduced exactly, by someone else.
+//
+// The file is in JSON Lines format, one request/response pair per line.  Headers with credentials
+// (cookies, tokens) aren't saved, and neither are credentials in request bodies (e.g., the password
+// sent when logging in).
+
+type CassetteMode string
+
+const (
+	CASSETTE_RECORD = CassetteMode("record")
+	CASSETTE_REPLAY = CassetteMode("replay")
+)
+
+var ErrCassetteMiss = errors.New("no matching response in the cassette")
+
+// Headers that aren't saved, since they have session credentials in them
+var CASSETTE_SCRUBBED_HEADERS = []string{"Authorization", "Cookie", "Set-Cookie", "X-Csrf-Token", "X-Guest-Token"}
+
+// Fields in JSON request bodies whose values aren't saved, since they have login credentials in them
+var CASSETTE_SCRUBBED_BODY_FIELDS = []string{"flow_token", "password", "text_data", "enter_text"}
+
+// What scrubbed values in request bodies are replaced with
+const CASSETTE_SCRUBBED_VALUE = "(scrubbed)"
+
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBinary []byte      `json:"body_binary,omitempty"` // Instead of `Body`, if it isn't text (e.g., media); base64 in JSON
+}
+
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// Whether two requests are the same, for replaying
+func (r CassetteRequest) matches(other CassetteRequest) bool {
+	return r.Method == other.Method && r.URL == other.URL && r.Body == other.Body
+}
+
+// An http.RoundTripper that records or replays requests.  Use it with `API.UseCassette`.
+type Cassette struct {
+	Path         string
+	Mode         CassetteMode
+	Interactions []CassetteInteraction
+
+	// For recording: what sends the actual requests.  If nil, `http.DefaultTransport` is used.
+	Transport http.RoundTripper
+
+	mutex     sync.Mutex
+	is_played []bool // For replaying: which interactions have been served already
+}
+
+// Start recording to a new cassette file.  If the file already exists, it's overwritten.
+func RecordCassette(path string, transport http.RoundTripper) (*Cassette, error) {
+	if err := os.WriteFile(path, []byte{}, 0644); err != nil {
+		return nil, fmt.Errorf("Error creating cassette file %q:\n  %w", path, err)
+	}
+	return &Cassette{Path: path, Mode: CASSETTE_RECORD, Transport: transport}, nil
+}
+
+// Load a cassette file to replay it
+func LoadCassette(path string) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening cassette file %q:\n  %w", path, err)
+	}
+	defer file.Close()
+
+	ret := Cassette{Path: path, Mode: CASSETTE_REPLAY}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 256*1024*1024) // Media files can be big
+	for line_num := 1; scanner.Scan(); line_num++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var interaction CassetteInteraction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("Error parsing cassette file %q, line %d:\n  %w", path, line_num, err)
+		}
+		ret.Interactions = append(ret.Interactions, interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading cassette file %q:\n  %w", path, err)
+	}
+	ret.is_played = make([]bool, len(ret.Interactions))
+	return &ret, nil
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	request := CassetteRequest{Method: req.Method, URL: req.URL.String(), Header: scrub_headers(req.Header)}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading request body:\n  %w", err)
+		}
+		// Replayed requests are scrubbed the same way, so they still match the recorded ones
+		request.Body = scrub_body(string(body))
+		req = req.Clone(req.Context()) // RoundTrippers shouldn't modify the request
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if c.Mode == CASSETTE_REPLAY {
+		return c.replay(req, request)
+	}
+	return c.record(req, request)
+}
+
+// Serve the first response to a matching request that hasn't been served yet
+func (c *Cassette) replay(req *http.Request, request CassetteRequest) (*http.Response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, interaction := range c.Interactions {
+		if c.is_played[i] || !interaction.Request.matches(request) {
+			continue
+		}
+		c.is_played[i] = true
+		body := interaction.Response.BodyBinary
+		if body == nil {
+			body = []byte(interaction.Response.Body)
+		}
+		header := interaction.Response.Header
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, request.Method, req.URL.Path)
+}
+
+// Send the request, and save it and its response
+func (c *Cassette) record(req *http.Request, request CassetteRequest) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		// Nothing to replay; failed requests aren't recorded
+		return resp, err //nolint:wrapcheck // errors should be the same as without a cassette
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response body:\n  %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	response := CassetteResponse{StatusCode: resp.StatusCode, Header: scrub_headers(resp.Header)}
+	if utf8.Valid(body) {
+		response.Body = string(body)
+	} else {
+		response.BodyBinary = body
+	}
+	interaction := CassetteInteraction{Request: request, Response: response}
+	data, err := json.Marshal(interaction)
+	if err != nil {
+		panic(err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Interactions = append(c.Interactions, interaction)
+	file, err := os.OpenFile(c.Path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening cassette file %q:\n  %w", c.Path, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("Error writing to cassette file %q:\n  %w", c.Path, err)
+	}
+	return resp, nil
+}
+
+// Copy headers, without the ones that have credentials in them
+func scrub_headers(header http.Header) http.Header {
+	ret := http.Header{}
+	for key, values := range header {
+		if !slices.Contains(CASSETTE_SCRUBBED_HEADERS, http.CanonicalHeaderKey(key)) {
+			ret[key] = slices.Clone(values)
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// Replace the values of credential fields in a JSON request body.  Other bodies are left as-is.
+func scrub_body(body string) string {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber() // Keep IDs exact
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return body // Not JSON
+	}
+	if !scrub_json_fields(data) {
+		return body
+	}
+	ret, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	return string(ret)
+}
+
+// Replace the values of credential fields in decoded JSON, in place.  Returns whether any were found.
+func scrub_json_fields(data interface{}) bool {
+	is_scrubbed := false
+	switch data := data.(type) {
+	case map[string]interface{}:
+		for key, value := range data {
+			if slices.Contains(CASSETTE_SCRUBBED_BODY_FIELDS, key) {
+				data[key] = CASSETTE_SCRUBBED_VALUE
+				is_scrubbed = true
+			} else if scrub_json_fields(value) {
+				is_scrubbed = true
+			}
+		}
+	case []interface{}:
+		for _, value := range data {
+			if scrub_json_fields(value) {
+				is_scrubbed = true
+			}
+		}
+	}
+	return is_scrubbed
+}
+
+// Send all of the API's requests through a cassette.  When recording, the API's current transport
+// is used to send them.
+func (api *API) UseCassette(c *Cassette) {
+	if api.Client.Transport == c {
+		return // Already using it
+	}
+	if c.Mode == CASSETTE_RECORD && c.Transport == nil {
+		c.Transport = api.Client.Transport
+	}
+	api.Client.Transport = c
+}
+
+// Create a session that replays a cassette, without needing a connection (unlike `NewGuestSession`)
+func NewReplaySession(c *Cassette) API {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		panic(err)
+	}
+	ret := API{
+		IsAuthenticated: false,
+		GuestToken:      "replay", // Not sent anywhere; it just has to be set
+		Client: http.Client{
+			Timeout: 10 * time.Second,
+			Jar:     jar,
+		},
+		RateLimiter: NewRateLimiter(),
+	}
+	ret.UseCassette(c)
+	return ret
+}
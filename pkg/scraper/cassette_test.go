@@ -0,0 +1,140 @@
+package scraper_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/scraper"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	cassette_path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	// Record a scrape
+	cookie_jar, err := cookiejar.New(nil)
+	require.NoError(err)
+	transport := &user_feed_transport{}
+	api := API{
+		GuestToken:  "secret guest token",
+		Client:      http.Client{Transport: transport, Jar: cookie_jar},
+		RateLimiter: NewRateLimiter(),
+	}
+	cassette, err := RecordCassette(cassette_path, nil)
+	require.NoError(err)
+	api.UseCassette(cassette)
+	trove, err := api.GetUserFeed(UserID(44067298), 100)
+	require.ErrorIs(err, END_OF_FEED) // The second page is empty
+	assert.Len(transport.cursors, 2)
+	require.Len(cassette.Interactions, 2)
+
+	// Credentials aren't saved
+	data, err := os.ReadFile(cassette_path)
+	require.NoError(err)
+	assert.NotContains(string(data), "secret guest token")
+	assert.NotContains(string(data), BEARER_TOKEN)
+	assert.Empty(cassette.Interactions[0].Request.Header.Get("Authorization"))
+	assert.Equal("en", cassette.Interactions[0].Request.Header.Get("X-Twitter-Client-Language"))
+
+	// Replay it, with no network
+	cassette, err = LoadCassette(cassette_path)
+	require.NoError(err)
+	assert.Equal(CASSETTE_REPLAY, cassette.Mode)
+	require.Len(cassette.Interactions, 2)
+	replay_api := NewReplaySession(cassette)
+	replayed_trove, err := replay_api.GetUserFeed(UserID(44067298), 100)
+	require.ErrorIs(err, END_OF_FEED)
+	assert.Equal(len(trove.Tweets), len(replayed_trove.Tweets))
+	assert.Equal(len(trove.Users), len(replayed_trove.Users))
+	assert.Len(transport.cursors, 2) // Nothing else was sent
+
+	// Each response is only replayed once
+	_, err = replay_api.GetUserFeed(UserID(44067298), 100)
+	assert.ErrorIs(err, ErrCassetteMiss)
+
+	// A recorded response can be parsed directly, e.g., to reproduce a parsing bug
+	var response APIV2Response
+	require.NoError(json.Unmarshal([]byte(cassette.Interactions[0].Response.Body), &response))
+	parsed_trove, err := response.ToTweetTrove()
+	require.NoError(err)
+	assert.NotEmpty(parsed_trove.Tweets)
+	for id := range parsed_trove.Tweets {
+		assert.Contains(trove.Tweets, id)
+	}
+}
+
+// Binary responses (e.g., media) are replayed byte-for-byte
+type media_transport struct{}
+
+func (t media_transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Set-Cookie": []string{"secret=asdf"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte{0xff, 0xd8, 0xff, 0xe0})),
+		Request:    req,
+	}, nil
+}
+
+func TestCassetteBinaryResponse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	cassette_path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	cassette, err := RecordCassette(cassette_path, media_transport{})
+	require.NoError(err)
+	api := NewReplaySession(cassette) // Doesn't need a guest session either way
+	data, err := api.DownloadMedia("https://pbs.twimg.com/media/asdf.jpg")
+	require.NoError(err)
+	assert.Equal([]byte{0xff, 0xd8, 0xff, 0xe0}, data)
+	assert.Nil(cassette.Interactions[0].Response.Header)
+
+	cassette, err = LoadCassette(cassette_path)
+	require.NoError(err)
+	api = NewReplaySession(cassette)
+	data, err = api.DownloadMedia("https://pbs.twimg.com/media/asdf.jpg")
+	require.NoError(err)
+	assert.Equal([]byte{0xff, 0xd8, 0xff, 0xe0}, data)
+}
+
+func TestCassetteScrubsLoginCredentials(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	cassette_path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	// A request like the "LoginEnterPassword" login subtask's
+	body := `{"flow_token":"secret flow token","subtask_inputs":[{"subtask_id":"LoginEnterPassword",` +
+		`"enter_password":{"password":"hunter2","link":"next_link"}}]}`
+	send := func(transport http.RoundTripper) {
+		req, err := http.NewRequest("POST", "https://api.twitter.com/1.1/onboarding/task.json", strings.NewReader(body))
+		require.NoError(err)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(err)
+		resp.Body.Close()
+	}
+	cassette, err := RecordCassette(cassette_path, media_transport{})
+	require.NoError(err)
+	send(cassette)
+
+	data, err := os.ReadFile(cassette_path)
+	require.NoError(err)
+	assert.NotContains(string(data), "hunter2")
+	assert.NotContains(string(data), "secret flow token")
+	assert.Contains(cassette.Interactions[0].Request.Body, "LoginEnterPassword")
+
+	// It can still be replayed
+	cassette, err = LoadCassette(cassette_path)
+	require.NoError(err)
+	send(cassette)
+}
@@ -0,0 +1,231 @@
+package scraper
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Requests are scheduled per API endpoint, according to the rate limits Twitter reports in the
+// response headers ("x-rate-limit-limit", "x-rate-limit-remaining" and "x-rate-limit-reset").  When
+// an endpoint's budget runs out, requests to it wait until it resets instead of failing, unless that
+// would take longer than the max wait time for the request's priority.
+//
+// Interactive requests (the default) go ahead of background ones.  Background requests leave a few
+// requests in each budget for interactive ones, and don't go while any interactive ones are waiting.
+
+type RequestPriority int
+
+const (
+	PRIORITY_INTERACTIVE RequestPriority = iota
+	PRIORITY_BACKGROUND
+)
+
+const (
+	// How many requests in each endpoint's budget are kept for interactive requests
+	INTERACTIVE_RESERVE = 2
+
+	// Interactive requests have to finish well within the webserver's 10 second write timeout
+	DEFAULT_MAX_INTERACTIVE_WAIT = 5 * time.Second
+	DEFAULT_MAX_BACKGROUND_WAIT  = 16 * time.Minute // Twitter's rate limit windows are 15 minutes
+)
+
+// The rate limit state of an endpoint
+type RateLimitBudget struct {
+	Endpoint   string    `json:"endpoint"`
+	Limit      int       `json:"limit"`
+	Remaining  int       `json:"remaining"`
+	ResetAt    time.Time `json:"reset_at"`
+	NumWaiting int       `json:"num_waiting"` // Requests currently waiting for the budget to reset
+}
+
+type endpoint_budget struct {
+	RateLimitBudget
+	is_known                bool // False until a response with rate limit headers comes back, or after a reset
+	num_in_flight           int
+	num_interactive_waiting int
+}
+
+type RateLimiter struct {
+	MaxInteractiveWait time.Duration
+	MaxBackgroundWait  time.Duration
+
+	mutex   sync.Mutex
+	budgets map[string]*endpoint_budget
+	changed chan struct{} // Closed (and replaced) whenever a budget changes, to wake up waiting requests
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		MaxInteractiveWait: DEFAULT_MAX_INTERACTIVE_WAIT,
+		MaxBackgroundWait:  DEFAULT_MAX_BACKGROUND_WAIT,
+		budgets:            make(map[string]*endpoint_budget),
+		changed:            make(chan struct{}),
+	}
+}
+
+// Get the current budget of every endpoint that's been used, sorted by endpoint
+func (l *RateLimiter) Budgets() []RateLimitBudget {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ret := []RateLimitBudget{}
+	for _, b := range l.budgets {
+		l.check_reset(b)
+		if b.is_known || b.NumWaiting > 0 {
+			ret = append(ret, b.RateLimitBudget)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Endpoint < ret[j].Endpoint })
+	return ret
+}
+
+// Wait until a request to the endpoint can be sent.  Each successful `acquire` must be followed by
+// a `release` once the response comes back.
+//
+// Returns ErrRateLimited if the budget won't reset within the max wait time.
+func (l *RateLimiter) acquire(endpoint string, priority RequestPriority) error {
+	max_wait := l.MaxInteractiveWait
+	if priority == PRIORITY_BACKGROUND {
+		max_wait = l.MaxBackgroundWait
+	}
+	deadline := time.Now().Add(max_wait)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b := l.get_budget(endpoint)
+
+	is_waiting := false
+	stop_waiting := func() {
+		if !is_waiting {
+			return
+		}
+		b.NumWaiting -= 1
+		if priority == PRIORITY_INTERACTIVE {
+			b.num_interactive_waiting -= 1
+			l.notify() // Background requests might be waiting for this one
+		}
+	}
+	for {
+		l.check_reset(b)
+		if l.can_send(b, priority) {
+			stop_waiting()
+			b.num_in_flight += 1
+			return nil
+		}
+
+		wake_at := time.Now().Add(time.Second) // If the budget is unknown, it'll be known soon
+		if b.is_known {
+			wake_at = b.ResetAt
+		}
+		if wake_at.After(deadline) {
+			stop_waiting()
+			return RateLimitError{Endpoint: endpoint, ResetAt: b.ResetAt}
+		}
+		if !is_waiting {
+			is_waiting = true
+			b.NumWaiting += 1
+			if priority == PRIORITY_INTERACTIVE {
+				b.num_interactive_waiting += 1
+			}
+		}
+
+		// Wait for the reset, or for something to change
+		changed := l.changed
+		l.mutex.Unlock()
+		timer := time.NewTimer(time.Until(wake_at))
+		select {
+		case <-timer.C:
+		case <-changed:
+		}
+		timer.Stop()
+		l.mutex.Lock()
+	}
+}
+
+// Update the endpoint's budget from a response (or nil, if the request failed)
+func (l *RateLimiter) release(endpoint string, resp *http.Response) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b := l.get_budget(endpoint)
+	b.num_in_flight -= 1
+
+	if resp != nil {
+		limit, limit_err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Limit"))
+		remaining, remaining_err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining"))
+		reset, reset_err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64)
+		if remaining_err == nil && reset_err == nil {
+			b.is_known = true
+			b.Remaining = remaining
+			b.ResetAt = time.Unix(reset, 0)
+			if limit_err == nil {
+				b.Limit = limit
+			}
+		}
+		if resp.StatusCode == 429 {
+			// "Too many requests" => out of budget, whatever the headers say
+			b.Remaining = 0
+		}
+	}
+	l.notify()
+}
+
+func (l *RateLimiter) get_budget(endpoint string) *endpoint_budget {
+	b, is_ok := l.budgets[endpoint]
+	if !is_ok {
+		b = &endpoint_budget{RateLimitBudget: RateLimitBudget{Endpoint: endpoint}}
+		l.budgets[endpoint] = b
+	}
+	return b
+}
+
+// Once the reset time passes, the budget is unknown again until the next response
+func (l *RateLimiter) check_reset(b *endpoint_budget) {
+	if b.is_known && !time.Now().Before(b.ResetAt) {
+		b.is_known = false
+		b.Remaining = b.Limit
+	}
+}
+
+func (l *RateLimiter) can_send(b *endpoint_budget, priority RequestPriority) bool {
+	if priority == PRIORITY_BACKGROUND && b.num_interactive_waiting > 0 {
+		return false
+	}
+	if !b.is_known {
+		return true
+	}
+	available := b.Remaining - b.num_in_flight
+	if priority == PRIORITY_BACKGROUND {
+		available -= INTERACTIVE_RESERVE
+	}
+	return available > 0
+}
+
+func (l *RateLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Path segments that are IDs, e.g., a DM chat room ID like "12345-67890.json"
+var id_path_segment_regex = regexp.MustCompile(`^[0-9-]+(\.json)?$`)
+
+// Get the rate-limited endpoint of a URL.  GraphQL endpoints are identified by their operation name
+// (the query ID changes when Twitter updates it); other ones by their path, with any IDs taken out.
+func endpoint_name(u *url.URL) string {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if n := len(segments); n >= 3 && segments[n-3] == "graphql" {
+		// ".../graphql/<query ID>/<operation name>"
+		return segments[n-1]
+	}
+	for i, segment := range segments {
+		if id_path_segment_regex.MatchString(segment) {
+			segments[i] = ":id" + strings.TrimLeft(segment, "0123456789-")
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
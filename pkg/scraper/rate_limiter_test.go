@@ -0,0 +1,191 @@
+package scraper_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"net/http"
+	"net/http/cookiejar"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/scraper"
+)
+
+// Serves empty API responses (or the given body), with the given rate limit headers
+type rate_limited_transport struct {
+	body         string
+	remaining    int
+	reset_at     time.Time
+	num_429s     int // Respond with "HTTP 429 Too Many Requests" this many times first
+	num_requests int
+}
+
+func (t *rate_limited_transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.num_requests += 1
+	header := http.Header{}
+	header.Set("X-Rate-Limit-Limit", "50")
+	header.Set("X-Rate-Limit-Remaining", fmt.Sprint(t.remaining))
+	header.Set("X-Rate-Limit-Reset", fmt.Sprint(t.reset_at.Unix()))
+	status_code := 200
+	if t.num_429s > 0 {
+		t.num_429s -= 1
+		status_code = 429
+	}
+	body := t.body
+	if body == "" {
+		body = "{}"
+	}
+	return &http.Response{
+		StatusCode: status_code,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func rate_limited_api(transport *rate_limited_transport) API {
+	cookie_jar, err := cookiejar.New(nil)
+	if err != nil {
+		panic(err)
+	}
+	return API{
+		GuestToken:  "guest token",
+		Client:      http.Client{Transport: transport, Jar: cookie_jar},
+		RateLimiter: NewRateLimiter(),
+	}
+}
+
+func TestRateLimiterBudgets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reset_at := time.Now().Add(time.Hour)
+	api := rate_limited_api(&rate_limited_transport{remaining: 10, reset_at: reset_at})
+	assert.Len(api.RateLimiter.Budgets(), 0)
+
+	_, err := api.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+	budgets := api.RateLimiter.Budgets()
+	require.Len(budgets, 1)
+	assert.Equal("TweetDetail", budgets[0].Endpoint)
+	assert.Equal(50, budgets[0].Limit)
+	assert.Equal(10, budgets[0].Remaining)
+	assert.Equal(reset_at.Unix(), budgets[0].ResetAt.Unix())
+	assert.Equal(0, budgets[0].NumWaiting)
+}
+
+func TestRateLimiterPriorities(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	transport := &rate_limited_transport{remaining: INTERACTIVE_RESERVE, reset_at: time.Now().Add(time.Hour)}
+	api := rate_limited_api(transport)
+	background_api := api
+	background_api.Priority = PRIORITY_BACKGROUND
+
+	// The budget isn't known until the first response
+	_, err := background_api.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+	require.Equal(1, transport.num_requests)
+
+	// Background requests can't use up the last few requests, and the reset is too far away to wait
+	_, err = background_api.GetTweetDetail(TweetID(1), "")
+	assert.ErrorIs(err, ErrRateLimited)
+	assert.Equal(1, transport.num_requests)
+
+	// Interactive ones can
+	transport.remaining = 0
+	_, err = api.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+	assert.Equal(2, transport.num_requests)
+
+	// Now the budget is used up
+	_, err = api.GetTweetDetail(TweetID(1), "")
+	assert.ErrorIs(err, ErrRateLimited)
+	assert.Equal(2, transport.num_requests)
+}
+
+func TestRateLimiterWaitsForReset(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	transport := &rate_limited_transport{remaining: 0, reset_at: time.Now().Add(2 * time.Second)}
+	api := rate_limited_api(transport)
+	_, err := api.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+
+	// Out of budget, but it resets soon enough to wait for it
+	start := time.Now()
+	_, err = api.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+	assert.Equal(2, transport.num_requests)
+	assert.Greater(time.Since(start), 500*time.Millisecond)
+}
+
+func TestRateLimiterRetriesAfter429(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The first response is a 429, even though the budget looked fine
+	transport := &rate_limited_transport{remaining: 10, reset_at: time.Now().Add(2 * time.Second), num_429s: 1}
+	api := rate_limited_api(transport)
+	_, err := api.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+	assert.Equal(2, transport.num_requests)
+
+	// If it's still a 429 after the reset, give up
+	transport.num_429s = 2
+	transport.reset_at = time.Now().Add(2 * time.Second)
+	_, err = api.GetTweetDetail(TweetID(1), "")
+	assert.ErrorIs(err, ErrRateLimited)
+	assert.Equal(4, transport.num_requests)
+}
+
+// Sets a new "ct0" cookie on every response, and records the CSRF token each request was sent with
+type csrf_rotating_transport struct {
+	num_requests int
+	csrf_tokens  []string
+}
+
+func (t *csrf_rotating_transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.num_requests += 1
+	t.csrf_tokens = append(t.csrf_tokens, req.Header.Get("x-csrf-token"))
+	header := http.Header{}
+	header.Add("Set-Cookie", fmt.Sprintf("ct0=token%d; Domain=twitter.com; Path=/", t.num_requests))
+	return &http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func TestAPICopiesShareCSRFToken(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	transport := &csrf_rotating_transport{}
+	cookie_jar, err := cookiejar.New(nil)
+	require.NoError(err)
+	api := API{
+		IsAuthenticated: true,
+		CSRFToken:       "token0",
+		Client:          http.Client{Transport: transport, Jar: cookie_jar},
+		RateLimiter:     NewRateLimiter(),
+	}
+
+	// A copy (e.g., a background task's) updates the cookie; the original should send the new token
+	api_copy := api
+	api_copy.Priority = PRIORITY_BACKGROUND
+	_, err = api_copy.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+	_, err = api.GetTweetDetail(TweetID(1), "")
+	require.NoError(err)
+	assert.Equal([]string{"token0", "token1"}, transport.csrf_tokens)
+}
@@ -0,0 +1,165 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Failed scrape jobs are retried with exponential backoff (1 minute, 2 minutes, 4 minutes, ...), until
+// they've failed this many times in a row
+const (
+	MAX_SCRAPE_JOB_FAILURES   = 5
+	SCRAPE_JOB_RETRY_DELAY    = time.Minute
+	SCRAPE_JOB_MAX_RETRY_WAIT = time.Hour
+)
+
+// A running job saves its progress after every page, so if it hasn't for this long (longer than the
+// rate limiter will wait), whatever was running it has probably been stopped
+const SCRAPE_JOB_STALE_TIMEOUT = 30 * time.Minute
+
+// Get the paginated query for a scrape job.  User handles are looked up in the profile first, and
+// fetched if they aren't there.
+func (api *API) scrape_job_query(profile Profile, job ScrapeJob) (PaginatedQuery, UserID, error) {
+	if job.Type == SCRAPE_JOB_SEARCH {
+		return PaginatedSearch{job.Target}, UserID(0), nil
+	}
+
+	handle := UserHandle(job.Target)
+	if len(handle) > 0 && handle[0] == '@' {
+		handle = handle[1:]
+	}
+	user, err := profile.GetUserByHandle(handle)
+	if errors.Is(err, ErrNotInDatabase) {
+		user, err = api.GetUser(handle)
+		if err != nil {
+			return nil, UserID(0), fmt.Errorf("Error fetching user %q:\n  %w", handle, err)
+		}
+		if err = profile.SaveUser(&user); err != nil {
+			return nil, UserID(0), fmt.Errorf("Error saving user %q:\n  %w", handle, err)
+		}
+	} else if err != nil {
+		return nil, UserID(0), err
+	}
+
+	switch job.Type {
+	case SCRAPE_JOB_USER_TWEETS:
+		return PaginatedUserFeed{user.ID}, user.ID, nil
+	case SCRAPE_JOB_USER_LIKES:
+		return PaginatedUserLikes{user.ID}, user.ID, nil
+	case SCRAPE_JOB_FOLLOWERS:
+		return PaginatedFollowers{user.ID}, user.ID, nil
+	case SCRAPE_JOB_FOLLOWEES:
+		return PaginatedFollowees{user.ID}, user.ID, nil
+	default:
+		return nil, UserID(0), fmt.Errorf("%w: unknown type %q", ErrInvalidScrapeJob, job.Type)
+	}
+}
+
+// Run a scrape job (see `ClaimNextScrapeJob`) one page at a time, until it's done, it fails or it's
+// cancelled.  Each page is passed to `save_trove`, then the job's progress (its cursor) is saved, so
+// if it's interrupted it can resume from the next page.
+//
+// If it fails, it's put back in the queue to be retried later, unless it has failed too many times
+// or can't succeed by retrying (e.g., the session is logged out).  Returns the error, if any.
+func (api *API) RunScrapeJob(profile Profile, job *ScrapeJob, save_trove func(TweetTrove)) error {
+	pq, user_id, err := api.scrape_job_query(profile, *job)
+	if err != nil {
+		return api.fail_scrape_job(profile, job, err)
+	}
+
+	for job.MaxPages == 0 || job.NumPages < job.MaxPages {
+		// Check whether it's been cancelled
+		current, err := profile.GetScrapeJobById(job.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status == SCRAPE_JOB_CANCELLED {
+			*job = current
+			log.Infof("Scrape job %d was cancelled", job.ID)
+			return nil
+		}
+
+		if job.NumPages > 0 && api.Delay != 0 {
+			time.Sleep(api.Delay) // Slow down the requests, if applicable
+		}
+		resp, err := pq.NextPage(api, job.Cursor)
+		if err != nil {
+			return api.fail_scrape_job(profile, job, err)
+		}
+		if resp.IsEmpty() || (job.Cursor != "" && resp.GetCursorBottom() == job.Cursor) {
+			// No more results
+			break
+		}
+		trove, err := pq.ToTweetTrove(resp)
+		if err != nil {
+			return api.fail_scrape_job(profile, job, err)
+		}
+		if err = api.PostProcess(&trove); err != nil {
+			return api.fail_scrape_job(profile, job, err)
+		}
+		save_trove(trove)
+		switch job.Type {
+		case SCRAPE_JOB_FOLLOWERS:
+			profile.SaveAsFollowersList(user_id, trove)
+		case SCRAPE_JOB_FOLLOWEES:
+			profile.SaveAsFolloweesList(user_id, trove)
+		}
+
+		job.Cursor = resp.GetCursorBottom()
+		job.NumPages += 1
+		job.NumFailures = 0
+		job.LastError = ""
+		if job.Cursor == "" {
+			break
+		}
+		if err = profile.SaveScrapeJob(job); err != nil {
+			panic(err)
+		}
+		log.Infof("Scrape job %d: saved page %d", job.ID, job.NumPages)
+	}
+
+	job.Status = SCRAPE_JOB_DONE
+	if err = profile.SaveScrapeJob(job); err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+// Record a failure, and either put the job back in the queue to retry later or give up on it.
+//
+// Being rate limited isn't a failure, since retrying will work once the limit resets; the job is put back
+// in the queue to retry then.
+func (api *API) fail_scrape_job(profile Profile, job *ScrapeJob, err error) error {
+	job.LastError = err.Error()
+	if errors.Is(err, ErrRateLimited) {
+		retry_at := time.Now().Add(SCRAPE_JOB_RETRY_DELAY) // In case the reset time is unknown
+		var rate_limit_err RateLimitError
+		if errors.As(err, &rate_limit_err) && rate_limit_err.ResetAt.After(time.Now()) {
+			retry_at = rate_limit_err.ResetAt
+		}
+		job.Status = SCRAPE_JOB_QUEUED
+		job.RetryAt = Timestamp{retry_at}
+	} else {
+		job.NumFailures += 1
+		if job.NumFailures >= MAX_SCRAPE_JOB_FAILURES || errors.Is(err, ErrLoginRequired) ||
+			errors.Is(err, ErrSessionInvalidated) || errors.Is(err, ErrDoesntExist) || errors.Is(err, ErrUserIsBanned) {
+			job.Status = SCRAPE_JOB_FAILED
+		} else {
+			retry_wait := SCRAPE_JOB_RETRY_DELAY << (job.NumFailures - 1)
+			if retry_wait > SCRAPE_JOB_MAX_RETRY_WAIT {
+				retry_wait = SCRAPE_JOB_MAX_RETRY_WAIT
+			}
+			job.Status = SCRAPE_JOB_QUEUED
+			job.RetryAt = Timestamp{time.Now().Add(retry_wait)}
+		}
+	}
+	if save_err := profile.SaveScrapeJob(job); save_err != nil {
+		panic(save_err)
+	}
+	return fmt.Errorf("Error running scrape job %d (%s %q):\n  %w", job.ID, job.Type, job.Target, err)
+}
@@ -0,0 +1,148 @@
+package scraper_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"net/http"
+	"net/http/cookiejar"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/scraper"
+)
+
+// Serves one page of a user feed, followed by an empty page
+type user_feed_transport struct {
+	cursors []string // The cursor of each request
+	is_down bool
+}
+
+func (t *user_feed_transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.is_down {
+		return nil, errors.New("network is down")
+	}
+	cursor := req.URL.Query().Get("cursor")
+	t.cursors = append(t.cursors, cursor)
+	filename := "test_responses/api_v2/user_feed_apiv2.json"
+	if cursor != "" {
+		filename = "test_responses/api_v2/empty_response.json"
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	return &http.Response{StatusCode: 200, Header: http.Header{}, Body: file, Request: req}, nil
+}
+
+func TestRunScrapeJob(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	profile, err := NewProfile(filepath.Join(t.TempDir(), "profile"))
+	require.NoError(err)
+	user := User{ID: UserID(44067298), Handle: UserHandle("Michael_Malice"), DisplayName: "Michael Malice"}
+	require.NoError(profile.SaveUser(&user))
+
+	cookie_jar, err := cookiejar.New(nil)
+	require.NoError(err)
+	transport := &user_feed_transport{is_down: true}
+	api := API{
+		GuestToken:  "guest token",
+		Client:      http.Client{Transport: transport, Jar: cookie_jar},
+		RateLimiter: NewRateLimiter(),
+	}
+
+	job := ScrapeJob{Type: SCRAPE_JOB_USER_TWEETS, Target: "@Michael_Malice"}
+	require.NoError(profile.SaveScrapeJob(&job))
+	job, err = profile.ClaimNextScrapeJob()
+	require.NoError(err)
+
+	// If it fails, it's retried later
+	num_saved := 0
+	save_trove := func(trove TweetTrove) {
+		num_saved += len(trove.Tweets)
+	}
+	err = api.RunScrapeJob(profile, &job, save_trove)
+	assert.Error(err)
+	job, err = profile.GetScrapeJobById(job.ID)
+	require.NoError(err)
+	assert.Equal(SCRAPE_JOB_QUEUED, job.Status)
+	assert.Equal(1, job.NumFailures)
+	assert.Contains(job.LastError, "network is down")
+	assert.True(job.RetryAt.After(time.Now()))
+	_, err = profile.ClaimNextScrapeJob()
+	assert.ErrorIs(err, ErrNotInDatabase)
+
+	// Scrape the first page, then the next one is empty
+	transport.is_down = false
+	require.NoError(api.RunScrapeJob(profile, &job, save_trove))
+	job, err = profile.GetScrapeJobById(job.ID)
+	require.NoError(err)
+	assert.Equal(SCRAPE_JOB_DONE, job.Status)
+	assert.Equal(1, job.NumPages)
+	assert.Equal(0, job.NumFailures)
+	assert.Equal("HBaYgL2Fp/T7nCkAAA==", job.Cursor)
+	assert.Greater(num_saved, 0)
+	assert.Equal([]string{"", "HBaYgL2Fp/T7nCkAAA=="}, transport.cursors)
+
+	// A job with saved progress resumes from its cursor
+	transport.cursors = []string{}
+	resumed_job := ScrapeJob{Type: SCRAPE_JOB_USER_TWEETS, Target: "Michael_Malice", Cursor: "HBaYgL2Fp/T7nCkAAA==", NumPages: 3}
+	require.NoError(profile.SaveScrapeJob(&resumed_job))
+	require.NoError(api.RunScrapeJob(profile, &resumed_job, save_trove))
+	assert.Equal([]string{"HBaYgL2Fp/T7nCkAAA=="}, transport.cursors)
+	assert.Equal(SCRAPE_JOB_DONE, resumed_job.Status)
+	assert.Equal(3, resumed_job.NumPages)
+
+	// Stops at the max pages
+	transport.cursors = []string{}
+	limited_job := ScrapeJob{Type: SCRAPE_JOB_USER_TWEETS, Target: "Michael_Malice", MaxPages: 1}
+	require.NoError(profile.SaveScrapeJob(&limited_job))
+	require.NoError(api.RunScrapeJob(profile, &limited_job, save_trove))
+	assert.Equal([]string{""}, transport.cursors)
+	assert.Equal(SCRAPE_JOB_DONE, limited_job.Status)
+
+	// Cancelled jobs stop before the next page
+	transport.cursors = []string{}
+	cancelled_job := ScrapeJob{Type: SCRAPE_JOB_USER_TWEETS, Target: "Michael_Malice"}
+	require.NoError(profile.SaveScrapeJob(&cancelled_job))
+	require.NoError(profile.CancelScrapeJob(cancelled_job.ID))
+	require.NoError(api.RunScrapeJob(profile, &cancelled_job, save_trove))
+	assert.Len(transport.cursors, 0)
+	assert.Equal(SCRAPE_JOB_CANCELLED, cancelled_job.Status)
+}
+
+// Being rate limited doesn't count as a failure; the job is retried when the limit resets
+func TestRunScrapeJobRateLimited(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	profile, err := NewProfile(filepath.Join(t.TempDir(), "profile"))
+	require.NoError(err)
+	user := User{ID: UserID(44067298), Handle: UserHandle("Michael_Malice"), DisplayName: "Michael Malice"}
+	require.NoError(profile.SaveUser(&user))
+
+	reset_at := time.Now().Add(time.Hour)
+	api := rate_limited_api(&rate_limited_transport{reset_at: reset_at, num_429s: 1})
+
+	job := ScrapeJob{Type: SCRAPE_JOB_USER_TWEETS, Target: "Michael_Malice"}
+	require.NoError(profile.SaveScrapeJob(&job))
+
+	// First an HTTP 429, then the rate limiter knows the budget is used up
+	for i := 0; i < MAX_SCRAPE_JOB_FAILURES+1; i++ {
+		err = api.RunScrapeJob(profile, &job, func(TweetTrove) {})
+		assert.ErrorIs(err, ErrRateLimited)
+		job, err = profile.GetScrapeJobById(job.ID)
+		require.NoError(err)
+		assert.Equal(SCRAPE_JOB_QUEUED, job.Status)
+		assert.Equal(0, job.NumFailures)
+		assert.Contains(job.LastError, "rate limited")
+		assert.Equal(reset_at.Unix(), job.RetryAt.Unix())
+	}
+}
@@ -0,0 +1,12 @@
+window.YTD.account.part0 = [
+  {
+    "account" : {
+      "email" : "someone@example.com",
+      "createdVia" : "web",
+      "username" : "archive_owner",
+      "accountId" : "1488963321701171204",
+      "createdAt" : "2022-02-02T19:37:24.000Z",
+      "accountDisplayName" : "Archive Owner"
+    }
+  }
+]
@@ -0,0 +1,35 @@
+window.YTD.direct_messages_group.part0 = [
+  {
+    "dmConversation" : {
+      "conversationId" : "1710215025518948715",
+      "messages" : [
+        {
+          "messageCreate" : {
+            "reactions" : [ ],
+            "urls" : [ ],
+            "text" : "Hello group",
+            "mediaUrls" : [ ],
+            "senderId" : "1178839081222115328",
+            "id" : "1710215100000000000",
+            "createdAt" : "2023-10-06T09:00:00.000Z",
+            "editHistory" : [ ]
+          }
+        },
+        {
+          "conversationNameUpdate" : {
+            "initiatingUserId" : "1178839081222115328",
+            "name" : "Group chat",
+            "createdAt" : "2023-10-06T08:55:00.000Z"
+          }
+        },
+        {
+          "joinConversation" : {
+            "initiatingUserId" : "1178839081222115328",
+            "participantsSnapshot" : [ "1178839081222115328", "1458284524761075714", "1488963321701171204" ],
+            "createdAt" : "2023-10-06T08:50:00.000Z"
+          }
+        }
+      ]
+    }
+  }
+]
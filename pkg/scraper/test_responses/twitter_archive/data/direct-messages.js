@@ -0,0 +1,48 @@
+window.YTD.direct_messages.part0 = [
+  {
+    "dmConversation" : {
+      "conversationId" : "1458284524761075714-1488963321701171204",
+      "messages" : [
+        {
+          "messageCreate" : {
+            "recipientId" : "1458284524761075714",
+            "reactions" : [
+              {
+                "senderId" : "1458284524761075714",
+                "reactionKey" : "funny",
+                "eventId" : "1663623300000000000",
+                "createdAt" : "2023-05-30T19:10:00.000Z"
+              }
+            ],
+            "urls" : [
+              {
+                "url" : "https://t.co/LinkLink12",
+                "expanded" : "https://example.com/article",
+                "display" : "example.com/article"
+              }
+            ],
+            "text" : "Check this out https://t.co/LinkLink12",
+            "mediaUrls" : [ ],
+            "senderId" : "1488963321701171204",
+            "id" : "1663623250000000000",
+            "createdAt" : "2023-05-30T19:08:00.000Z",
+            "editHistory" : [ ]
+          }
+        },
+        {
+          "messageCreate" : {
+            "recipientId" : "1488963321701171204",
+            "reactions" : [ ],
+            "urls" : [ ],
+            "text" : "Yeah i know who you are lol https://t.co/MediaLnk12",
+            "mediaUrls" : [ "https://ton.twitter.com/1.1/ton/data/dm/1663623203644751885/1663623199999999999/AbCdEfGh.jpg" ],
+            "senderId" : "1458284524761075714",
+            "id" : "1663623203644751885",
+            "createdAt" : "2023-05-30T19:07:35.064Z",
+            "editHistory" : [ ]
+          }
+        }
+      ]
+    }
+  }
+]
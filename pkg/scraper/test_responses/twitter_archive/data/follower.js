@@ -0,0 +1,8 @@
+window.YTD.follower.part0 = [
+  {
+    "follower" : {
+      "accountId" : "1458284524761075714",
+      "userLink" : "https://twitter.com/intent/user?user_id=1458284524761075714"
+    }
+  }
+]
@@ -0,0 +1,14 @@
+window.YTD.following.part0 = [
+  {
+    "following" : {
+      "accountId" : "1458284524761075714",
+      "userLink" : "https://twitter.com/intent/user?user_id=1458284524761075714"
+    }
+  },
+  {
+    "following" : {
+      "accountId" : "44067298",
+      "userLink" : "https://twitter.com/intent/user?user_id=44067298"
+    }
+  }
+]
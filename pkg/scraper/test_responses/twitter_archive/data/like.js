@@ -0,0 +1,16 @@
+window.YTD.like.part0 = [
+  {
+    "like" : {
+      "tweetId" : "1623639042717155328",
+      "fullText" : "Here's a picture from my #archives https://t.co/Q4Ua9H0cEV",
+      "expandedUrl" : "https://twitter.com/i/web/status/1623639042717155328"
+    }
+  },
+  {
+    "like" : {
+      "tweetId" : "1413646595493568516",
+      "fullText" : "Some liked tweet by someone else",
+      "expandedUrl" : "https://twitter.com/i/web/status/1413646595493568516"
+    }
+  }
+]
@@ -0,0 +1,13 @@
+window.YTD.profile.part0 = [
+  {
+    "profile" : {
+      "description" : {
+        "bio" : "Just some guy",
+        "website" : "https://t.co/abcdEFGH12",
+        "location" : "Earth"
+      },
+      "avatarMediaUrl" : "https://pbs.twimg.com/profile_images/1491197225441771521/pdp1KSXl.jpg",
+      "headerMediaUrl" : "https://pbs.twimg.com/profile_banners/1488963321701171204/1644002394"
+    }
+  }
+]
@@ -0,0 +1,78 @@
+window.YTD.tweets.part1 = [
+  {
+    "tweet" : {
+      "retweeted" : false,
+      "source" : "<a href=\"https://mobile.twitter.com\" rel=\"nofollow\">Twitter Web App</a>",
+      "entities" : {
+        "hashtags" : [ ],
+        "symbols" : [ ],
+        "user_mentions" : [ ],
+        "urls" : [ ],
+        "media" : [
+          {
+            "expanded_url" : "https://twitter.com/archive_owner/status/1600000000000000000/video/1",
+            "indices" : [ "11", "34" ],
+            "url" : "https://t.co/VidLink123",
+            "media_url" : "http://pbs.twimg.com/ext_tw_video_thumb/1599999999999999999/pu/img/ThumbNail.jpg",
+            "id_str" : "1599999999999999999",
+            "id" : "1599999999999999999",
+            "media_url_https" : "https://pbs.twimg.com/ext_tw_video_thumb/1599999999999999999/pu/img/ThumbNail.jpg",
+            "sizes" : {
+              "large" : { "w" : "1280", "h" : "720", "resize" : "fit" }
+            },
+            "type" : "photo",
+            "display_url" : "pic.twitter.com/VidLink123"
+          }
+        ]
+      },
+      "display_text_range" : [ "0", "10" ],
+      "favorite_count" : "0",
+      "id_str" : "1600000000000000000",
+      "truncated" : false,
+      "retweet_count" : "0",
+      "id" : "1600000000000000000",
+      "created_at" : "Tue Dec 06 05:29:13 +0000 2022",
+      "favorited" : false,
+      "full_text" : "Cool video https://t.co/VidLink123",
+      "lang" : "en",
+      "extended_entities" : {
+        "media" : [
+          {
+            "expanded_url" : "https://twitter.com/archive_owner/status/1600000000000000000/video/1",
+            "indices" : [ "11", "34" ],
+            "url" : "https://t.co/VidLink123",
+            "media_url" : "http://pbs.twimg.com/ext_tw_video_thumb/1599999999999999999/pu/img/ThumbNail.jpg",
+            "id_str" : "1599999999999999999",
+            "video_info" : {
+              "aspect_ratio" : [ "16", "9" ],
+              "duration_millis" : "8000",
+              "variants" : [
+                {
+                  "bitrate" : "832000",
+                  "content_type" : "video/mp4",
+                  "url" : "https://video.twimg.com/ext_tw_video/1599999999999999999/pu/vid/640x360/LowQuality.mp4?tag=12"
+                },
+                {
+                  "content_type" : "application/x-mpegURL",
+                  "url" : "https://video.twimg.com/ext_tw_video/1599999999999999999/pu/pl/Playlist.m3u8?tag=12"
+                },
+                {
+                  "bitrate" : "2176000",
+                  "content_type" : "video/mp4",
+                  "url" : "https://video.twimg.com/ext_tw_video/1599999999999999999/pu/vid/1280x720/HighQuality.mp4?tag=12"
+                }
+              ]
+            },
+            "id" : "1599999999999999999",
+            "media_url_https" : "https://pbs.twimg.com/ext_tw_video_thumb/1599999999999999999/pu/img/ThumbNail.jpg",
+            "sizes" : {
+              "large" : { "w" : "1280", "h" : "720", "resize" : "fit" }
+            },
+            "type" : "video",
+            "display_url" : "pic.twitter.com/VidLink123"
+          }
+        ]
+      }
+    }
+  }
+]
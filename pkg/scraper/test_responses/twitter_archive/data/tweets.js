@@ -0,0 +1,105 @@
+window.YTD.tweets.part0 = [
+  {
+    "tweet" : {
+      "edit_info" : {
+        "initial" : {
+          "editTweetIds" : [ "1623639042717155328" ],
+          "editableUntil" : "2023-02-09T12:00:00.000Z",
+          "editsRemaining" : "5",
+          "isEditEligible" : true
+        }
+      },
+      "retweeted" : false,
+      "source" : "<a href=\"https://mobile.twitter.com\" rel=\"nofollow\">Twitter Web App</a>",
+      "entities" : {
+        "hashtags" : [ { "text" : "archives", "indices" : [ "25", "34" ] } ],
+        "symbols" : [ ],
+        "user_mentions" : [ ],
+        "urls" : [ ],
+        "media" : [
+          {
+            "expanded_url" : "https://twitter.com/archive_owner/status/1623639042717155328/photo/1",
+            "indices" : [ "35", "58" ],
+            "url" : "https://t.co/Q4Ua9H0cEV",
+            "media_url" : "http://pbs.twimg.com/media/FoeZzEyXoAE4Hxp.jpg",
+            "id_str" : "1623639040246685697",
+            "id" : "1623639040246685697",
+            "media_url_https" : "https://pbs.twimg.com/media/FoeZzEyXoAE4Hxp.jpg",
+            "sizes" : {
+              "large" : { "w" : "1200", "h" : "800", "resize" : "fit" },
+              "small" : { "w" : "680", "h" : "453", "resize" : "fit" },
+              "thumb" : { "w" : "150", "h" : "150", "resize" : "crop" },
+              "medium" : { "w" : "1200", "h" : "800", "resize" : "fit" }
+            },
+            "type" : "photo",
+            "display_url" : "pic.twitter.com/Q4Ua9H0cEV"
+          }
+        ]
+      },
+      "display_text_range" : [ "0", "34" ],
+      "favorite_count" : "12",
+      "id_str" : "1623639042717155328",
+      "truncated" : false,
+      "retweet_count" : "3",
+      "id" : "1623639042717155328",
+      "possibly_sensitive" : false,
+      "created_at" : "Thu Feb 09 11:00:00 +0000 2023",
+      "favorited" : false,
+      "full_text" : "Here's a picture from my #archives https://t.co/Q4Ua9H0cEV",
+      "lang" : "en",
+      "extended_entities" : {
+        "media" : [
+          {
+            "expanded_url" : "https://twitter.com/archive_owner/status/1623639042717155328/photo/1",
+            "indices" : [ "35", "58" ],
+            "url" : "https://t.co/Q4Ua9H0cEV",
+            "media_url" : "http://pbs.twimg.com/media/FoeZzEyXoAE4Hxp.jpg",
+            "id_str" : "1623639040246685697",
+            "id" : "1623639040246685697",
+            "media_url_https" : "https://pbs.twimg.com/media/FoeZzEyXoAE4Hxp.jpg",
+            "sizes" : {
+              "large" : { "w" : "1200", "h" : "800", "resize" : "fit" }
+            },
+            "type" : "photo",
+            "display_url" : "pic.twitter.com/Q4Ua9H0cEV"
+          }
+        ]
+      }
+    }
+  },
+  {
+    "tweet" : {
+      "retweeted" : false,
+      "source" : "<a href=\"https://mobile.twitter.com\" rel=\"nofollow\">Twitter Web App</a>",
+      "entities" : {
+        "hashtags" : [ ],
+        "symbols" : [ ],
+        "user_mentions" : [
+          {
+            "name" : "Someone Else",
+            "screen_name" : "someone_else",
+            "indices" : [ "0", "13" ],
+            "id_str" : "1458284524761075714",
+            "id" : "1458284524761075714"
+          }
+        ],
+        "urls" : [ ]
+      },
+      "display_text_range" : [ "14", "42" ],
+      "favorite_count" : "1",
+      "in_reply_to_status_id_str" : "1623600000000000000",
+      "id_str" : "1623650000000000000",
+      "in_reply_to_user_id" : "1458284524761075714",
+      "truncated" : false,
+      "retweet_count" : "0",
+      "id" : "1623650000000000000",
+      "in_reply_to_status_id" : "1623600000000000000",
+      "created_at" : "Thu Feb 09 11:43:32 +0000 2023",
+      "favorited" : false,
+      "full_text" : "@someone_else I agree with this &amp; that",
+      "lang" : "en",
+      "in_reply_to_screen_name" : "someone_else",
+      "in_reply_to_user_id_str" : "1458284524761075714"
+    }
+  }
+]
@@ -0,0 +1,670 @@
+package scraper
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// -------------------------------------------------------------------------
+// Account archives
+//
+// Users can download an archive of their own account from Twitter.  It's a zip file containing
+// a `data/` folder with a bunch of JS files like `tweets.js` and `like.js`, each of which is a JSON
+// array assigned to a global variable (e.g., `window.YTD.tweets.part0 = [...]`), along with folders
+// of media files like `data/tweets_media/`.
+// -------------------------------------------------------------------------
+
+type ArchiveAccount struct {
+	AccountID   int64  `json:"accountId,string"`
+	Username    string `json:"username"`
+	DisplayName string `json:"accountDisplayName"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type ArchiveProfile struct {
+	Description struct {
+		Bio      string `json:"bio"`
+		Website  string `json:"website"`
+		Location string `json:"location"`
+	} `json:"description"`
+	AvatarMediaUrl string `json:"avatarMediaUrl"`
+	HeaderMediaUrl string `json:"headerMediaUrl"`
+}
+
+// Archive media is like APIMedia / APIExtendedMedia, but all the numbers are strings
+type ArchiveMedia struct {
+	ID            int64  `json:"id_str,string"`
+	MediaURLHttps string `json:"media_url_https"`
+	Type          string `json:"type"`
+	URL           string `json:"url"`
+	Sizes         struct {
+		Large struct {
+			Width  int `json:"w,string"`
+			Height int `json:"h,string"`
+		} `json:"large"`
+	} `json:"sizes"`
+	VideoInfo struct {
+		Variants []struct {
+			Bitrate     int    `json:"bitrate,string"`
+			ContentType string `json:"content_type"`
+			URL         string `json:"url"`
+		} `json:"variants"`
+		Duration int `json:"duration_millis,string"`
+	} `json:"video_info"`
+}
+
+// A Tweet from `tweets.js`.  It's a v1.1-style tweet, like APITweet, but all the numbers are strings.
+// It has no user info, since they're all by the owner of the archive.
+type ArchiveTweet struct {
+	ID               int64    `json:"id_str,string"`
+	CreatedAt        string   `json:"created_at"`
+	FavoriteCount    int      `json:"favorite_count,string"`
+	RetweetCount     int      `json:"retweet_count,string"`
+	FullText         string   `json:"full_text"`
+	DisplayTextRange []string `json:"display_text_range"`
+	Entities         struct {
+		Hashtags []struct {
+			Text string `json:"text"`
+		} `json:"hashtags"`
+		Media []ArchiveMedia `json:"media"`
+		URLs  []struct {
+			ExpandedURL  string `json:"expanded_url"`
+			ShortenedUrl string `json:"url"`
+		} `json:"urls"`
+		Mentions []struct {
+			UserName string `json:"screen_name"`
+			UserID   int64  `json:"id_str,string"`
+		} `json:"user_mentions"`
+	} `json:"entities"`
+	ExtendedEntities struct {
+		Media []ArchiveMedia `json:"media"`
+	} `json:"extended_entities"`
+	InReplyToStatusID   int64  `json:"in_reply_to_status_id_str,string"`
+	InReplyToUserID     int64  `json:"in_reply_to_user_id_str,string"`
+	InReplyToScreenName string `json:"in_reply_to_screen_name"`
+}
+
+// Convert it to an APITweet, so it can be parsed the same way as a scraped tweet
+func (t ArchiveTweet) ToAPITweet(author ArchiveAccount) (APITweet, error) {
+	ret := APITweet{}
+	ret.ID = t.ID
+	ret.CreatedAt = t.CreatedAt
+	ret.FavoriteCount = t.FavoriteCount
+	ret.RetweetCount = t.RetweetCount
+	ret.FullText = t.FullText
+	for _, s := range t.DisplayTextRange {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return ret, fmt.Errorf("Error parsing display_text_range %q of archived tweet ID %d:\n  %w", t.DisplayTextRange, t.ID, err)
+		}
+		ret.DisplayTextRange = append(ret.DisplayTextRange, i)
+	}
+	for _, hashtag := range t.Entities.Hashtags {
+		ret.Entities.Hashtags = append(ret.Entities.Hashtags, struct {
+			Text string `json:"text"`
+		}{hashtag.Text})
+	}
+	for _, media := range t.Entities.Media {
+		ret.Entities.Media = append(ret.Entities.Media, media.to_api_media())
+	}
+	ret.Entities.URLs = t.Entities.URLs
+	ret.Entities.Mentions = t.Entities.Mentions
+	for _, media := range t.ExtendedEntities.Media {
+		ret.ExtendedEntities.Media = append(ret.ExtendedEntities.Media, media.to_api_extended_media())
+	}
+	ret.InReplyToStatusID = t.InReplyToStatusID
+	ret.InReplyToUserID = t.InReplyToUserID
+	ret.InReplyToScreenName = t.InReplyToScreenName
+	ret.UserID = author.AccountID
+	ret.UserHandle = author.Username
+	return ret, nil
+}
+
+func (m ArchiveMedia) to_api_media() APIMedia {
+	ret := APIMedia{ID: m.ID, MediaURLHttps: m.MediaURLHttps, Type: m.Type, URL: m.URL}
+	ret.OriginalInfo.Width = m.Sizes.Large.Width
+	ret.OriginalInfo.Height = m.Sizes.Large.Height
+	return ret
+}
+
+func (m ArchiveMedia) to_api_extended_media() APIExtendedMedia {
+	ret := APIExtendedMedia{ID: m.ID, MediaURLHttps: m.MediaURLHttps, Type: m.Type, URL: m.URL}
+	for _, v := range m.VideoInfo.Variants {
+		ret.VideoInfo.Variants = append(ret.VideoInfo.Variants, Variant{Bitrate: v.Bitrate, ContentType: v.ContentType, URL: v.URL})
+	}
+	ret.VideoInfo.Duration = m.VideoInfo.Duration
+	ret.OriginalInfo.Width = m.Sizes.Large.Width
+	ret.OriginalInfo.Height = m.Sizes.Large.Height
+	return ret
+}
+
+// A liked tweet from `like.js`.  Only the ID and text are included; the author isn't.
+type ArchiveLike struct {
+	TweetID  int64  `json:"tweetId,string"`
+	FullText string `json:"fullText"`
+}
+
+type ArchiveDMMessage struct {
+	ID          int64    `json:"id,string"`
+	SenderID    int64    `json:"senderId,string"`
+	RecipientID int64    `json:"recipientId,string"` // Only in 1-on-1 conversations
+	Text        string   `json:"text"`
+	CreatedAt   string   `json:"createdAt"`
+	MediaUrls   []string `json:"mediaUrls"`
+	Urls        []struct {
+		ShortenedUrl string `json:"url"`
+		ExpandedURL  string `json:"expanded"`
+	} `json:"urls"`
+	Reactions []struct {
+		SenderID    int64  `json:"senderId,string"`
+		ReactionKey string `json:"reactionKey"`
+		EventID     int64  `json:"eventId,string"`
+		CreatedAt   string `json:"createdAt"`
+	} `json:"reactions"`
+}
+
+type ArchiveDMConversation struct {
+	ConversationID string `json:"conversationId"`
+	Messages       []struct {
+		MessageCreate          ArchiveDMMessage `json:"messageCreate"`
+		ConversationNameUpdate struct {
+			Name      string `json:"name"`
+			CreatedAt string `json:"createdAt"`
+		} `json:"conversationNameUpdate"`
+		JoinConversation struct {
+			InitiatingUserID     int64    `json:"initiatingUserId,string"`
+			ParticipantsSnapshot []string `json:"participantsSnapshot"`
+			CreatedAt            string   `json:"createdAt"`
+		} `json:"joinConversation"`
+		ParticipantsJoin struct {
+			UserIDs []string `json:"userIds"`
+		} `json:"participantsJoin"`
+	} `json:"messages"`
+}
+
+// Emoji for each of the archive's DM reaction types
+var ARCHIVE_DM_REACTION_EMOJIS = map[string]string{
+	"like":      "❤️",
+	"funny":     "😂",
+	"surprised": "😲",
+	"sad":       "😢",
+	"agree":     "👍",
+	"disagree":  "👎",
+	"excited":   "🔥",
+}
+
+// A parsed account archive.
+type TwitterArchive struct {
+	Account ArchiveAccount
+	Profile ArchiveProfile
+
+	// Everything in the archive.  Users who only appear as an ID (e.g., DM participants and
+	// followers) are included as placeholders; see `GetArchivePlaceholderUser`.
+	Trove TweetTrove
+
+	FollowerIDs []UserID // Users following the archive's owner
+	FolloweeIDs []UserID // Users the archive's owner follows
+
+	reader *zip.Reader
+	closer io.Closer
+
+	// Bundled media files, by filename (without the "<tweet-or-message-ID>-" prefix)
+	media map[string]*zip.File
+}
+
+// Open and parse an account archive zip file.
+func OpenTwitterArchive(filename string) (TwitterArchive, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return TwitterArchive{}, fmt.Errorf("Error opening archive %q:\n  %w", filename, err)
+	}
+	ret, err := ParseTwitterArchive(&r.Reader)
+	if err != nil {
+		r.Close()
+		return TwitterArchive{}, fmt.Errorf("Error parsing archive %q:\n  %w", filename, err)
+	}
+	ret.closer = r
+	return ret, nil
+}
+
+func (a TwitterArchive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// Parse an account archive from an open zip file.
+func ParseTwitterArchive(r *zip.Reader) (TwitterArchive, error) {
+	ret := TwitterArchive{reader: r, media: make(map[string]*zip.File), Trove: NewTweetTrove()}
+
+	// Index the media files
+	for _, f := range r.File {
+		dir, filename := path.Split(f.Name)
+		if !strings.HasSuffix(dir, "_media/") || filename == "" {
+			continue
+		}
+		// Filenames are like "<tweet-id>-<original filename>"
+		_, original_filename, is_ok := strings.Cut(filename, "-")
+		if !is_ok {
+			continue
+		}
+		ret.media[original_filename] = f
+	}
+
+	// Account info
+	var accounts []struct {
+		Account ArchiveAccount `json:"account"`
+	}
+	if err := ret.read_data_files(&accounts, "account"); err != nil {
+		return ret, err
+	}
+	if len(accounts) == 0 {
+		return ret, fmt.Errorf("no account info found (data/account.js):\n  %w", ErrNotATwitterArchive)
+	}
+	ret.Account = accounts[0].Account
+
+	var profiles []struct {
+		Profile ArchiveProfile `json:"profile"`
+	}
+	if err := ret.read_data_files(&profiles, "profile"); err != nil {
+		return ret, err
+	}
+	if len(profiles) > 0 {
+		ret.Profile = profiles[0].Profile
+	}
+	owner, err := ret.parse_owner()
+	if err != nil {
+		return ret, err
+	}
+	ret.Trove.Users[owner.ID] = owner
+
+	// Tweets.  Older archives call the file "tweet.js" instead of "tweets.js"
+	var tweets []struct {
+		Tweet ArchiveTweet `json:"tweet"`
+	}
+	if err := ret.read_data_files(&tweets, "tweets", "tweet"); err != nil {
+		return ret, err
+	}
+	for _, t := range tweets {
+		// Retweets in an archive are just the text of the retweet ("RT @someone: ..."), with no
+		// reference to the original tweet, so they're saved as regular tweets
+		api_tweet, err := t.Tweet.ToAPITweet(ret.Account)
+		if err != nil {
+			return ret, err
+		}
+		tweet, err := ParseSingleTweet(api_tweet)
+		if err != nil {
+			return ret, fmt.Errorf("Error parsing archived tweet ID %d:\n  %w", t.Tweet.ID, err)
+		}
+		ret.Trove.Tweets[tweet.ID] = tweet
+	}
+
+	// Likes
+	var likes []struct {
+		Like ArchiveLike `json:"like"`
+	}
+	if err := ret.read_data_files(&likes, "like"); err != nil {
+		return ret, err
+	}
+	for i, l := range likes {
+		tweet_id := TweetID(l.Like.TweetID)
+		if _, is_ok := ret.Trove.Tweets[tweet_id]; !is_ok {
+			ret.Trove.Tweets[tweet_id] = parse_archive_liked_tweet(l.Like)
+		}
+		// Likes are listed newest first, and the archive has no sort indexes for them
+		sort_id := LikeSortID(len(likes) - i)
+		ret.Trove.Likes[sort_id] = Like{SortID: sort_id, UserID: owner.ID, TweetID: tweet_id}
+	}
+	if len(likes) > 0 {
+		unknown_user := GetUnknownUser()
+		ret.Trove.Users[unknown_user.ID] = unknown_user
+	}
+
+	// DMs
+	var conversations []struct {
+		DMConversation ArchiveDMConversation `json:"dmConversation"`
+	}
+	if err := ret.read_data_files(&conversations, "direct-messages", "direct-messages-group"); err != nil {
+		return ret, err
+	}
+	for _, c := range conversations {
+		if err := ret.parse_dm_conversation(c.DMConversation); err != nil {
+			return ret, err
+		}
+	}
+
+	// Follows
+	var followers []struct {
+		Follower struct {
+			AccountID int64 `json:"accountId,string"`
+		} `json:"follower"`
+	}
+	if err := ret.read_data_files(&followers, "follower"); err != nil {
+		return ret, err
+	}
+	for _, f := range followers {
+		ret.FollowerIDs = append(ret.FollowerIDs, UserID(f.Follower.AccountID))
+	}
+	var followees []struct {
+		Following struct {
+			AccountID int64 `json:"accountId,string"`
+		} `json:"following"`
+	}
+	if err := ret.read_data_files(&followees, "following"); err != nil {
+		return ret, err
+	}
+	for _, f := range followees {
+		ret.FolloweeIDs = append(ret.FolloweeIDs, UserID(f.Following.AccountID))
+	}
+
+	// Add placeholders for users who are only known by ID
+	for _, id := range append(ret.FollowerIDs, ret.FolloweeIDs...) {
+		ret.add_placeholder_user(id)
+	}
+	for _, room := range ret.Trove.Rooms {
+		for id := range room.Participants {
+			ret.add_placeholder_user(id)
+		}
+	}
+	return ret, nil
+}
+
+// Read data files by name, e.g., "tweets" for "data/tweets.js", including any extra parts (e.g.,
+// "data/tweets-part1.js"), and decode the items in their JSON arrays into `dest` (a pointer to a
+// slice).  Missing files are skipped.
+func (a TwitterArchive) read_data_files(dest interface{}, names ...string) error {
+	items := []json.RawMessage{}
+	for _, name := range names {
+		part_regex := regexp.MustCompile(`^data/` + regexp.QuoteMeta(name) + `(-part\d+)?\.js$`)
+		files := []*zip.File{}
+		for _, f := range a.reader.File {
+			if part_regex.MatchString(f.Name) {
+				files = append(files, f)
+			}
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+		for _, f := range files {
+			data, err := read_zip_file(f)
+			if err != nil {
+				return err
+			}
+			// Strip the `window.YTD.<name>.partN = ` prefix
+			index := bytes.IndexByte(data, '=')
+			if index < 0 {
+				return fmt.Errorf("Error parsing %s: no data found:\n  %w", f.Name, ErrNotATwitterArchive)
+			}
+			var part []json.RawMessage
+			if err := json.Unmarshal(data[index+1:], &part); err != nil {
+				return fmt.Errorf("Error parsing %s:\n  %w", f.Name, err)
+			}
+			items = append(items, part...)
+		}
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("Error parsing data/%s.js:\n  %w", names[0], err)
+	}
+	return nil
+}
+
+func read_zip_file(f *zip.File) ([]byte, error) {
+	reader, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("Error opening %s in archive:\n  %w", f.Name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s in archive:\n  %w", f.Name, err)
+	}
+	return data, nil
+}
+
+func (a TwitterArchive) parse_owner() (User, error) {
+	api_user := APIUser{}
+	api_user.ID = a.Account.AccountID
+	api_user.ScreenName = a.Account.Username
+	api_user.Name = a.Account.DisplayName
+	api_user.CreatedAt = a.Account.CreatedAt
+	api_user.Description = a.Profile.Description.Bio
+	api_user.Location = a.Profile.Description.Location
+	if a.Profile.Description.Website != "" {
+		api_user.Entities.URL.Urls = append(api_user.Entities.URL.Urls, struct {
+			ExpandedURL string `json:"expanded_url"`
+		}{a.Profile.Description.Website})
+	}
+	api_user.ProfileImageURLHTTPS = a.Profile.AvatarMediaUrl
+	api_user.ProfileBannerURL = a.Profile.HeaderMediaUrl
+
+	ret, err := ParseSingleUser(api_user)
+	if err != nil {
+		return ret, fmt.Errorf("Error parsing archive's account info:\n  %w", err)
+	}
+	return ret, nil
+}
+
+// Liked tweets have no author or timestamp, so they're stubs by the Unknown User.  The posting time
+// is taken from the tweet ID, which is a "snowflake" ID that includes a timestamp.
+func parse_archive_liked_tweet(l ArchiveLike) Tweet {
+	return Tweet{
+		ID:            TweetID(l.TweetID),
+		UserID:        GetUnknownUser().ID,
+		Text:          l.FullText,
+		PostedAt:      TimestampFromUnixMilli((l.TweetID >> 22) + TWITTER_SNOWFLAKE_EPOCH_MILLIS),
+		IsStub:        true,
+		LastScrapedAt: TimestampFromUnix(0),
+	}
+}
+
+// Twitter's "snowflake" IDs store a timestamp in milliseconds, relative to this epoch
+const TWITTER_SNOWFLAKE_EPOCH_MILLIS = 1288834974657
+
+func (a *TwitterArchive) parse_dm_conversation(c ArchiveDMConversation) error {
+	room := DMChatRoom{ID: DMChatRoomID(c.ConversationID), Participants: make(map[UserID]DMChatParticipant)}
+	add_participant := func(id int64) {
+		if id != 0 {
+			room.Participants[UserID(id)] = DMChatParticipant{DMChatRoomID: room.ID, UserID: UserID(id)}
+		}
+	}
+
+	// Group conversation IDs are a single number; 1-on-1 conversation IDs are "<user ID>-<user ID>"
+	if ids := strings.Split(c.ConversationID, "-"); len(ids) == 2 {
+		room.Type = "ONE_TO_ONE"
+		for _, id := range ids {
+			add_participant(idstr_to_int(id))
+		}
+	} else {
+		room.Type = "GROUP_DM"
+	}
+
+	// Messages are listed newest first
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		entry := c.Messages[i]
+		switch {
+		case entry.MessageCreate.ID != 0:
+			msg, err := parse_archive_dm_message(entry.MessageCreate, room.ID)
+			if err != nil {
+				return fmt.Errorf("Error parsing DM conversation %q:\n  %w", c.ConversationID, err)
+			}
+			a.Trove.Messages[msg.ID] = msg
+			add_participant(entry.MessageCreate.SenderID)
+			add_participant(entry.MessageCreate.RecipientID)
+			for _, r := range msg.Reactions {
+				add_participant(int64(r.SenderID))
+			}
+			if msg.SentAt.After(room.LastMessagedAt.Time) {
+				room.LastMessagedAt = msg.SentAt
+				room.LastMessageID = msg.ID
+			}
+		case entry.ConversationNameUpdate.Name != "":
+			room.Name = entry.ConversationNameUpdate.Name
+		case entry.JoinConversation.InitiatingUserID != 0:
+			// The archive's owner was added to a group chat
+			add_participant(entry.JoinConversation.InitiatingUserID)
+			for _, id := range entry.JoinConversation.ParticipantsSnapshot {
+				add_participant(idstr_to_int(id))
+			}
+		default:
+			for _, id := range entry.ParticipantsJoin.UserIDs {
+				add_participant(idstr_to_int(id))
+			}
+		}
+	}
+	add_participant(a.Account.AccountID)
+	a.Trove.Rooms[room.ID] = room
+	return nil
+}
+
+func parse_archive_dm_message(m ArchiveDMMessage, room_id DMChatRoomID) (DMMessage, error) {
+	msg := DMMessage{ID: DMMessageID(m.ID), DMChatRoomID: room_id, SenderID: UserID(m.SenderID)}
+	var err error
+	msg.SentAt, err = TimestampFromString(m.CreatedAt)
+	if err != nil {
+		return msg, fmt.Errorf("Error parsing time on DM message ID %d:\n  %w", m.ID, err)
+	}
+
+	msg.Reactions = make(map[UserID]DMReaction)
+	for _, r := range m.Reactions {
+		reacc := DMReaction{ID: DMMessageID(r.EventID), DMMessageID: msg.ID, SenderID: UserID(r.SenderID)}
+		reacc.SentAt, err = TimestampFromString(r.CreatedAt)
+		if err != nil {
+			return msg, fmt.Errorf("Error parsing time on reaction to DM message ID %d:\n  %w", m.ID, err)
+		}
+		reacc.Emoji = r.ReactionKey
+		if emoji, is_ok := ARCHIVE_DM_REACTION_EMOJIS[r.ReactionKey]; is_ok {
+			reacc.Emoji = emoji
+		}
+		msg.Reactions[reacc.SenderID] = reacc
+	}
+
+	text := m.Text
+	for _, u := range m.Urls {
+		// Remove short-links at the end of the message, like with tweets
+		if strings.HasSuffix(text, u.ShortenedUrl) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, u.ShortenedUrl))
+		}
+		msg.Urls = append(msg.Urls, Url{DMMessageID: msg.ID, Text: u.ExpandedURL, ShortText: u.ShortenedUrl})
+	}
+
+	for _, media_url := range m.MediaUrls {
+		// Attached media also has a short-link at the end of the message, which isn't in "urls"
+		if words := strings.Fields(text); len(words) > 0 && strings.HasPrefix(words[len(words)-1], "https://t.co/") {
+			text = strings.TrimSpace(strings.TrimSuffix(text, words[len(words)-1]))
+		}
+
+		parsed_url, err := url.Parse(media_url)
+		if err != nil {
+			return msg, fmt.Errorf("Error parsing media URL %q on DM message ID %d:\n  %w", media_url, m.ID, err)
+		}
+		media_id, is_video, is_gif, is_ok := parse_archive_dm_media_url(parsed_url)
+		if !is_ok {
+			continue
+		}
+		local_filename := get_prefixed_path(path.Base(parsed_url.Path))
+		if is_video {
+			// The archive has no thumbnails for DM videos
+			msg.Videos = append(msg.Videos, Video{
+				ID:            VideoID(media_id),
+				DMMessageID:   msg.ID,
+				RemoteURL:     media_url,
+				LocalFilename: local_filename,
+				IsGif:         is_gif,
+			})
+		} else {
+			msg.Images = append(msg.Images, Image{
+				ID:            ImageID(media_id),
+				DMMessageID:   msg.ID,
+				RemoteURL:     media_url,
+				LocalFilename: local_filename,
+			})
+		}
+	}
+	msg.Text = html.UnescapeString(text)
+	return msg, nil
+}
+
+// Get the media ID from a DM media URL, which look like:
+//   - images: "https://ton.twitter.com/1.1/ton/data/dm/<message ID>/<media ID>/<filename>.jpg"
+//   - videos: "https://video.twimg.com/dm_video/<media ID>/vid/<size>/<filename>.mp4"
+//   - gifs: "https://video.twimg.com/dm_gif/<media ID>/<filename>.mp4"
+func parse_archive_dm_media_url(u *url.URL) (media_id int64, is_video bool, is_gif bool, is_ok bool) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, part := range parts {
+		if i+2 >= len(parts) {
+			break
+		}
+		var id_str string
+		switch part {
+		case "dm":
+			id_str = parts[i+2]
+		case "dm_video", "dm_gif":
+			id_str = parts[i+1]
+			is_video = true
+			is_gif = part == "dm_gif"
+		default:
+			continue
+		}
+		id, err := strconv.ParseInt(id_str, 10, 64)
+		return id, is_video, is_gif, err == nil
+	}
+	return 0, false, false, false
+}
+
+func (a *TwitterArchive) add_placeholder_user(id UserID) {
+	if _, is_ok := a.Trove.Users[id]; !is_ok {
+		a.Trove.Users[id] = GetArchivePlaceholderUser(id)
+	}
+}
+
+// Account archives include followers, followees and DM participants by ID only.  A placeholder
+// User is created for each of them, which will be filled in if they're ever scraped.  It's marked
+// as not downloaded, so that scraping it fetches its real profile and images.
+//
+// Real handles are at most 15 characters, so the placeholder handle can't clash with one.
+func GetArchivePlaceholderUser(id UserID) User {
+	return User{
+		ID:                  id,
+		DisplayName:         "<Unknown User>",
+		Handle:              UserHandle(fmt.Sprintf("unknown_user_%d", id)),
+		Bio:                 "<blank>",
+		Location:            "<blank>",
+		Website:             "<blank>",
+		JoinDate:            TimestampFromUnix(0),
+		IsContentDownloaded: false,
+	}
+}
+
+// Get a media file bundled in the archive, by its remote URL.  Can be used as the `download` func
+// when saving the archive's TweetTrove, to copy bundled media into the profile instead of
+// downloading it.
+//
+// Returns `ErrMediaNotInArchive` if the file isn't in the archive.
+func (a TwitterArchive) DownloadMedia(remote_url string) ([]byte, error) {
+	parsed_url, err := url.Parse(remote_url)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing media URL %q:\n  %w", remote_url, err)
+	}
+	f, is_ok := a.media[path.Base(parsed_url.Path)]
+	if !is_ok {
+		return nil, fmt.Errorf("%q:\n  %w", remote_url, ErrMediaNotInArchive)
+	}
+	return read_zip_file(f)
+}
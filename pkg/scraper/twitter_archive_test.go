@@ -0,0 +1,193 @@
+package scraper_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/scraper"
+)
+
+// Zip up a test archive directory in memory
+func zip_test_archive(dir string) *zip.Reader {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel_path, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := w.Create(filepath.ToSlash(rel_path))
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestParseTwitterArchive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	archive, err := ParseTwitterArchive(zip_test_archive("test_responses/twitter_archive"))
+	require.NoError(err)
+	trove := archive.Trove
+	owner_id := UserID(1488963321701171204)
+
+	// Account owner
+	owner, is_ok := trove.Users[owner_id]
+	require.True(is_ok)
+	assert.Equal(UserHandle("archive_owner"), owner.Handle)
+	assert.Equal("Archive Owner", owner.DisplayName)
+	assert.Equal("Just some guy", owner.Bio)
+	assert.Equal("Earth", owner.Location)
+	assert.Equal("https://t.co/abcdEFGH12", owner.Website)
+	assert.Equal(int64(1643830644000), owner.JoinDate.UnixMilli())
+	assert.Equal("https://pbs.twimg.com/profile_images/1491197225441771521/pdp1KSXl.jpg", owner.ProfileImageUrl)
+
+	// Tweets, including ones from "tweets-part1.js"
+	tweet, is_ok := trove.Tweets[TweetID(1623639042717155328)]
+	require.True(is_ok)
+	assert.Equal(owner_id, tweet.UserID)
+	assert.Equal("Here's a picture from my #archives", tweet.Text)
+	assert.Equal(12, tweet.NumLikes)
+	assert.Equal(3, tweet.NumRetweets)
+	assert.Equal(CommaSeparatedList{"archives"}, tweet.Hashtags)
+	assert.False(tweet.IsStub)
+	require.Len(tweet.Images, 1)
+	assert.Equal(ImageID(1623639040246685697), tweet.Images[0].ID)
+	assert.Equal(1200, tweet.Images[0].Width)
+	assert.Equal(800, tweet.Images[0].Height)
+
+	reply, is_ok := trove.Tweets[TweetID(1623650000000000000)]
+	require.True(is_ok)
+	assert.Equal("I agree with this & that", reply.Text)
+	assert.Equal(TweetID(1623600000000000000), reply.InReplyToID)
+	assert.Equal(CommaSeparatedList{"someone_else"}, reply.ReplyMentions)
+
+	video_tweet, is_ok := trove.Tweets[TweetID(1600000000000000000)]
+	require.True(is_ok)
+	assert.Len(video_tweet.Images, 0)
+	require.Len(video_tweet.Videos, 1)
+	assert.Equal(
+		"https://video.twimg.com/ext_tw_video/1599999999999999999/pu/vid/1280x720/HighQuality.mp4?tag=12",
+		video_tweet.Videos[0].RemoteURL,
+	)
+	assert.Equal(8000, video_tweet.Videos[0].Duration)
+
+	// Likes; liked tweets that aren't in the archive are stubs
+	require.Len(trove.Likes, 2)
+	assert.Equal(Like{SortID: 2, UserID: owner_id, TweetID: 1623639042717155328}, trove.Likes[2])
+	assert.Equal(Like{SortID: 1, UserID: owner_id, TweetID: 1413646595493568516}, trove.Likes[1])
+	liked_tweet, is_ok := trove.Tweets[TweetID(1413646595493568516)]
+	require.True(is_ok)
+	assert.True(liked_tweet.IsStub)
+	assert.Equal(GetUnknownUser().ID, liked_tweet.UserID)
+	assert.Equal("Some liked tweet by someone else", liked_tweet.Text)
+	assert.Equal(int64(1625874587306), liked_tweet.PostedAt.UnixMilli()) // From the snowflake ID
+	assert.False(trove.Tweets[TweetID(1623639042717155328)].IsStub)      // Already in the archive
+
+	// DMs
+	require.Len(trove.Rooms, 2)
+	room, is_ok := trove.Rooms[DMChatRoomID("1458284524761075714-1488963321701171204")]
+	require.True(is_ok)
+	assert.Equal("ONE_TO_ONE", room.Type)
+	assert.Len(room.Participants, 2)
+	assert.Equal(DMMessageID(1663623250000000000), room.LastMessageID)
+
+	msg, is_ok := trove.Messages[DMMessageID(1663623250000000000)]
+	require.True(is_ok)
+	assert.Equal(room.ID, msg.DMChatRoomID)
+	assert.Equal(owner_id, msg.SenderID)
+	assert.Equal("Check this out", msg.Text)
+	require.Len(msg.Urls, 1)
+	assert.Equal("https://example.com/article", msg.Urls[0].Text)
+	require.Len(msg.Reactions, 1)
+	assert.Equal("😂", msg.Reactions[UserID(1458284524761075714)].Emoji)
+
+	msg_with_image, is_ok := trove.Messages[DMMessageID(1663623203644751885)]
+	require.True(is_ok)
+	assert.Equal("Yeah i know who you are lol", msg_with_image.Text)
+	assert.Equal(int64(1685473655064), msg_with_image.SentAt.UnixMilli())
+	require.Len(msg_with_image.Images, 1)
+	assert.Equal(ImageID(1663623199999999999), msg_with_image.Images[0].ID)
+
+	group_room, is_ok := trove.Rooms[DMChatRoomID("1710215025518948715")]
+	require.True(is_ok)
+	assert.Equal("GROUP_DM", group_room.Type)
+	assert.Equal("Group chat", group_room.Name)
+	assert.Len(group_room.Participants, 3)
+
+	// Follows
+	assert.Equal([]UserID{1458284524761075714}, archive.FollowerIDs)
+	assert.Equal([]UserID{1458284524761075714, 44067298}, archive.FolloweeIDs)
+
+	// Users only known by ID are placeholders
+	for _, id := range []UserID{1458284524761075714, 44067298, 1178839081222115328} {
+		assert.Equal(GetArchivePlaceholderUser(id), trove.Users[id])
+		assert.False(trove.Users[id].IsContentDownloaded)
+	}
+	assert.Len(trove.Users, 5) // Including the Unknown User, for liked tweets
+}
+
+func TestTwitterArchiveDownloadMedia(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	archive, err := ParseTwitterArchive(zip_test_archive("test_responses/twitter_archive"))
+	require.NoError(err)
+
+	data, err := archive.DownloadMedia("https://pbs.twimg.com/media/FoeZzEyXoAE4Hxp.jpg")
+	require.NoError(err)
+	assert.Equal("fake jpg data", string(data))
+
+	data, err = archive.DownloadMedia(
+		"https://video.twimg.com/ext_tw_video/1599999999999999999/pu/vid/1280x720/HighQuality.mp4?tag=12")
+	require.NoError(err)
+	assert.Equal("fake mp4 data", string(data))
+
+	data, err = archive.DownloadMedia("https://ton.twitter.com/1.1/ton/data/dm/1663623203644751885/1663623199999999999/AbCdEfGh.jpg")
+	require.NoError(err)
+	assert.Equal("fake dm jpg data", string(data))
+
+	_, err = archive.DownloadMedia("https://pbs.twimg.com/ext_tw_video_thumb/1599999999999999999/pu/img/ThumbNail.jpg")
+	assert.ErrorIs(err, ErrMediaNotInArchive)
+}
+
+func TestParseTwitterArchiveNotAnArchive(t *testing.T) {
+	_, err := ParseTwitterArchive(zip_test_archive("test_responses/dms"))
+	assert.True(t, errors.Is(err, ErrNotATwitterArchive))
+}
+
+func TestArchiveTweetBadDisplayTextRange(t *testing.T) {
+	tweet := ArchiveTweet{ID: 1234, DisplayTextRange: []string{"0", "asdf"}}
+	_, err := tweet.ToAPITweet(ArchiveAccount{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,706 @@
+package webserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/scraper"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/tracing"
+)
+
+// JSON API, for scripts and other clients.  Everything is under a versioned namespace, so it can
+// change later without breaking existing clients.  URLs look like:
+//   - GET /api/v1/tweets/<tweet-id>
+//   - POST /api/v1/tweets/<tweet-id>/like (or "unlike")
+//   - GET /api/v1/timeline
+//   - GET /api/v1/search?q=<search query>&sort-order=<sort order>
+//   - GET /api/v1/users/<user-handle>
+//   - GET /api/v1/users/<user-handle>/tweets (or "media", "likes")
+//   - GET /api/v1/users/<user-handle>/followers (or "followees")
+//   - POST /api/v1/users/<user-handle>/follow (or "unfollow")
+//   - GET /api/v1/lists
+//   - GET /api/v1/lists/<list-id>
+//   - GET /api/v1/lists/<list-id>/tweets
+//   - POST /api/v1/lists/<list-id>/users/<user-handle> (DELETE to remove them)
+//   - GET /api/v1/notifications
+//   - GET /api/v1/messages
+//   - GET /api/v1/messages/<room-id>
+//   - POST /api/v1/admin/backup?media=<true|false>&keep=<N> (only if the webserver has a backup directory)
+//   - GET /api/v1/admin/backup/status
+//   - GET /api/v1/admin/backups
+//   - GET /api/v1/admin/rate-limits
+//   - GET /api/v1/admin/media-downloads
+//
+// Paginated responses have a "next_cursor" token, which can be passed back as the `cursor` query
+// param to get the next page.  It's empty on the last page.
+func (app *Application) APIv1(w http.ResponseWriter, r *http.Request) {
+	_span := tracing.GetActiveSpan(r.Context()).AddChild("api_v1")
+	defer _span.End()
+	app.TraceLog.Printf("'APIv1' handler (path: %q)", r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "v1" {
+		app.api_error(w, 404, "Unknown API version")
+		return
+	}
+	parts = parts[1:]
+
+	switch {
+	case len(parts) == 2 && parts[0] == "tweets":
+		app.api_tweet_detail(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "tweets" && (parts[2] == "like" || parts[2] == "unlike"):
+		app.api_like_tweet(w, r, parts[1], parts[2] == "like")
+	case len(parts) == 1 && parts[0] == "timeline":
+		app.api_feed(w, r, NewTimelineCursor())
+	case len(parts) == 1 && parts[0] == "search":
+		app.api_search(w, r)
+	case len(parts) >= 2 && parts[0] == "users":
+		app.api_user(w, r, UserHandle(parts[1]), parts[2:])
+	case len(parts) == 1 && parts[0] == "lists":
+		app.api_lists(w, r)
+	case len(parts) >= 2 && parts[0] == "lists":
+		app.api_list_detail(w, r, parts[1], parts[2:])
+	case len(parts) == 1 && parts[0] == "notifications":
+		app.api_notifications(w, r)
+	case len(parts) == 1 && parts[0] == "messages":
+		app.api_messages(w, r)
+	case len(parts) == 2 && parts[0] == "messages":
+		app.api_message_room(w, r, DMChatRoomID(parts[1]))
+	case len(parts) == 2 && parts[0] == "admin" && parts[1] == "backup":
+		app.api_backup(w, r)
+	case len(parts) == 3 && parts[0] == "admin" && parts[1] == "backup" && parts[2] == "status":
+		app.api_backup_status(w, r)
+	case len(parts) == 2 && parts[0] == "admin" && parts[1] == "backups":
+		app.api_list_backups(w, r)
+	case len(parts) == 2 && parts[0] == "admin" && parts[1] == "rate-limits":
+		app.api_rate_limits(w, r)
+	case len(parts) == 2 && parts[0] == "admin" && parts[1] == "media-downloads":
+		app.api_media_downloads(w, r)
+	default:
+		app.api_error(w, 404, "Not found: "+r.URL.Path)
+	}
+}
+
+// Response types
+// --------------
+
+// A page of a timeline, search, user feed, List feed, or notifications
+type APIFeed struct {
+	Items      []FeedItem `json:"items"`
+	Trove      TweetTrove `json:"trove"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+type APITweetDetail struct {
+	MainTweetID TweetID     `json:"main_tweet_id"`
+	ParentIDs   []TweetID   `json:"parent_ids"`
+	ThreadIDs   []TweetID   `json:"thread_ids"`
+	ReplyChains [][]TweetID `json:"reply_chains"`
+	Trove       TweetTrove  `json:"trove"`
+}
+
+type APIListDetail struct {
+	List  List   `json:"list"`
+	Users []User `json:"users"`
+}
+
+type APIMessages struct {
+	RoomIDs    []DMChatRoomID `json:"room_ids"`
+	MessageIDs []DMMessageID  `json:"message_ids"`
+	Trove      TweetTrove     `json:"trove"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+type APIBackupResult struct {
+	Snapshot         string   `json:"snapshot"`
+	FilesCopied      int      `json:"files_copied"`
+	FilesLinked      int      `json:"files_linked"`
+	BytesCopied      int64    `json:"bytes_copied"`
+	SnapshotsDeleted []string `json:"snapshots_deleted"`
+}
+
+// The most recent backup started from the API.  `Result` is set once it's finished successfully,
+// and `Error` if it failed.
+type APIBackupStatus struct {
+	IsRunning bool             `json:"is_running"`
+	StartedAt Timestamp        `json:"started_at"`
+	Result    *APIBackupResult `json:"result"`
+	Error     string           `json:"error"`
+}
+
+type APIBackups struct {
+	Snapshots []string `json:"snapshots"`
+}
+
+// The scraper's current rate limit budget for each Twitter API endpoint it has used
+type APIRateLimits struct {
+	Endpoints []scraper.RateLimitBudget `json:"endpoints"`
+}
+
+type APIError struct {
+	Error string `json:"error"`
+}
+
+func (app *Application) api_write_json(w http.ResponseWriter, status_code int, data interface{}) {
+	body, err := json.Marshal(data)
+	panic_if(err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status_code)
+	_, err = w.Write(body)
+	panic_if(err)
+}
+
+func (app *Application) api_error(w http.ResponseWriter, status_code int, msg string) {
+	app.api_write_json(w, status_code, APIError{Error: msg})
+}
+
+func (app *Application) api_error_401(w http.ResponseWriter) {
+	msg := "Please log in or set an active session."
+	if app.ActiveUser.ID != 0 {
+		msg += "  (There is currently an active user, but scraping is disabled.)"
+	}
+	app.api_error(w, 401, msg)
+}
+
+// Returns whether the request's method is allowed; if not, writes a 405 response
+func (app *Application) api_check_method(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	app.api_error(w, 405, "Method not allowed")
+	return false
+}
+
+// Cursor tokens
+// -------------
+
+// Pagination state, encoded as an opaque token for API clients.  The other cursor params (what
+// feed it is, search filters, etc) come from the URL, so they don't need to be in the token.
+type api_cursor_token struct {
+	SortOrder        SortOrder `json:"s"`
+	CursorValue      int64     `json:"v"`
+	CursorTiebreaker TweetID   `json:"t,omitempty"`
+}
+
+func (t api_cursor_token) encode() string {
+	data, err := json.Marshal(t)
+	panic_if(err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Returns a zero-valued token (and no error) if there's no `cursor` param
+func decode_cursor_token(r *http.Request) (api_cursor_token, bool, error) {
+	var ret api_cursor_token
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return ret, false, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ret, false, fmt.Errorf("invalid cursor token %q: %w", token, err)
+	}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return ret, false, fmt.Errorf("invalid cursor token %q: %w", token, err)
+	}
+	if !ret.SortOrder.IsValid() {
+		return ret, false, fmt.Errorf("invalid cursor token %q: unknown sort order %d", token, ret.SortOrder)
+	}
+	return ret, true, nil
+}
+
+// Feeds
+// -----
+
+func (app *Application) api_feed(w http.ResponseWriter, r *http.Request, c Cursor) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+
+	if page_size := r.URL.Query().Get("limit"); page_size != "" {
+		val, err := strconv.Atoi(page_size)
+		if err != nil || val <= 0 {
+			app.api_error(w, 400, "Invalid limit (must be a positive number)")
+			return
+		}
+		c.PageSize = min(val, 200)
+	}
+	token, is_ok, err := decode_cursor_token(r)
+	if err != nil {
+		app.api_error(w, 400, err.Error())
+		return
+	}
+	if is_ok {
+		// "Liked at" and "bookmarked at" sort orders only work on feeds filtered by those
+		if (token.SortOrder == SORT_ORDER_LIKED_AT && c.LikedByUserHandle == "") ||
+			(token.SortOrder == SORT_ORDER_BOOKMARKED_AT && c.BookmarkedByUserHandle == "") {
+			app.api_error(w, 400, fmt.Sprintf("invalid cursor token: sort order %q doesn't apply to this feed", token.SortOrder))
+			return
+		}
+		c.SortOrder = token.SortOrder
+		c.CursorValue = int(token.CursorValue)
+		c.CursorTiebreaker = token.CursorTiebreaker
+		c.CursorPosition = CURSOR_MIDDLE
+	}
+
+	span := tracing.GetActiveSpan(r.Context()).AddChild("cursor_next_page")
+	c.ShowMuted = is_showing_muted(r)
+	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
+	if err != nil && !errors.Is(err, ErrEndOfFeed) {
+		panic(err)
+	}
+	span.End()
+
+	ret := APIFeed{Items: feed.Items, Trove: feed.TweetTrove}
+	if feed.CursorBottom.CursorPosition != CURSOR_END {
+		ret.NextCursor = api_cursor_token{
+			SortOrder:        feed.CursorBottom.SortOrder,
+			CursorValue:      int64(feed.CursorBottom.CursorValue),
+			CursorTiebreaker: feed.CursorBottom.CursorTiebreaker,
+		}.encode()
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+func (app *Application) api_search(w http.ResponseWriter, r *http.Request) {
+	search_text := r.URL.Query().Get("q")
+	if search_text == "" {
+		app.api_error(w, 400, "Empty search query")
+		return
+	}
+	c, err := NewCursorFromSearchQuery(search_text)
+	if err != nil {
+		app.api_error(w, 400, err.Error())
+		return
+	}
+	if sort_order := r.URL.Query().Get("sort-order"); sort_order != "" {
+		var is_ok bool
+		c.SortOrder, is_ok = SortOrderFromString(sort_order)
+		if !is_ok {
+			app.api_error(w, 400, "Invalid sort order")
+			return
+		}
+	}
+	app.api_feed(w, r, c)
+}
+
+func (app *Application) api_notifications(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	if app.ActiveUser.ID == 0 {
+		app.api_error_401(w)
+		return
+	}
+	token, _, err := decode_cursor_token(r)
+	if err != nil {
+		app.api_error(w, 400, err.Error())
+		return
+	}
+
+	const page_size = 50
+	feed := app.Profile.GetNotificationsForUser(app.ActiveUser.ID, token.CursorValue, page_size, is_showing_muted(r))
+
+	ret := APIFeed{Items: feed.Items, Trove: feed.TweetTrove}
+	// Muted notifications are left out, so a page can be short without being the last one
+	if !feed.CursorBottom.CursorPosition.IsEnd() {
+		ret.NextCursor = api_cursor_token{SortOrder: SORT_ORDER_NEWEST, CursorValue: int64(feed.CursorBottom.CursorValue)}.encode()
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+// Tweets
+// ------
+
+func parse_api_tweet_id(s string) (TweetID, error) {
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		return TweetID(0), fmt.Errorf("Invalid tweet ID: %q", s)
+	}
+	return TweetID(val), nil
+}
+
+func (app *Application) api_tweet_detail(w http.ResponseWriter, r *http.Request, id_str string) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	tweet_id, err := parse_api_tweet_id(id_str)
+	if err != nil {
+		app.api_error(w, 400, err.Error())
+		return
+	}
+
+	_, err = app.ensure_tweet(tweet_id, r.URL.Query().Has("scrape"), true)
+	if err != nil {
+		app.ErrorLog.Print(fmt.Errorf("API tweet detail (%d): %w", tweet_id, err))
+		if errors.Is(err, ErrNotFound) {
+			app.api_error(w, 404, "Tweet not found")
+			return
+		} else if !errors.Is(err, scraper.ErrSessionInvalidated) && !errors.Is(err, scraper.ErrRateLimited) {
+			panic(err)
+		}
+		// Otherwise, just return what we've got
+	}
+
+	twt_detail, err := app.Profile.GetTweetDetail(tweet_id, app.ActiveUser.ID, is_showing_muted(r))
+	panic_if(err) // ErrNotInDatabase should be impossible, since we already fetched the single tweet successfully
+
+	app.api_write_json(w, 200, APITweetDetail{
+		MainTweetID: twt_detail.MainTweetID,
+		ParentIDs:   twt_detail.ParentIDs,
+		ThreadIDs:   twt_detail.ThreadIDs,
+		ReplyChains: twt_detail.ReplyChains,
+		Trove:       twt_detail.TweetTrove,
+	})
+}
+
+func (app *Application) api_like_tweet(w http.ResponseWriter, r *http.Request, id_str string, is_liking bool) {
+	if !app.api_check_method(w, r, "POST") {
+		return
+	}
+	if app.IsScrapingDisabled {
+		app.api_error_401(w)
+		return
+	}
+	tweet_id, err := parse_api_tweet_id(id_str)
+	if err != nil {
+		app.api_error(w, 400, err.Error())
+		return
+	}
+	tweet, err := app.ensure_tweet(tweet_id, false, false)
+	if errors.Is(err, ErrNotFound) {
+		app.api_error(w, 404, "Tweet not found")
+		return
+	}
+	panic_if(err)
+
+	// As in the HTML handlers, "already liked" and "haven't liked" errors are treated as success
+	if is_liking {
+		like, err := app.API.LikeTweet(tweet.ID)
+		if err != nil && !errors.Is(err, scraper.ErrAlreadyLikedThisTweet) {
+			panic(err)
+		}
+		panic_if(app.Profile.SaveLike(like))
+	} else {
+		err := app.API.UnlikeTweet(tweet.ID)
+		if err != nil && !errors.Is(err, scraper.ErrHaventLikedThisTweet) {
+			panic(err)
+		}
+		panic_if(app.Profile.DeleteLike(Like{UserID: app.ActiveUser.ID, TweetID: tweet.ID}))
+	}
+	tweet.IsLikedByCurrentUser = is_liking
+	app.api_write_json(w, 200, tweet)
+}
+
+// Users
+// -----
+
+func (app *Application) api_user(w http.ResponseWriter, r *http.Request, handle UserHandle, parts []string) {
+	user, err := app.Profile.GetUserByHandle(handle)
+	if errors.Is(err, ErrNotInDatabase) {
+		app.api_error(w, 404, fmt.Sprintf("User not found: %q", handle))
+		return
+	}
+	panic_if(err)
+
+	if len(parts) > 1 {
+		app.api_error(w, 404, "Not found: "+r.URL.Path)
+		return
+	}
+	subpage := ""
+	if len(parts) == 1 {
+		subpage = parts[0]
+	}
+
+	switch subpage {
+	case "":
+		if app.api_check_method(w, r, "GET") {
+			app.api_write_json(w, 200, user)
+		}
+	case "tweets":
+		app.api_feed(w, r, NewUserFeedCursor(user.Handle))
+	case "media":
+		app.api_feed(w, r, NewUserFeedMediaCursor(user.Handle))
+	case "likes":
+		app.api_feed(w, r, NewUserFeedLikesCursor(user.Handle))
+	case "followers":
+		if app.api_check_method(w, r, "GET") {
+			app.api_write_json(w, 200, non_nil_users(app.Profile.GetFollowers(user.ID)))
+		}
+	case "followees":
+		if app.api_check_method(w, r, "GET") {
+			app.api_write_json(w, 200, non_nil_users(app.Profile.GetFollowees(user.ID)))
+		}
+	case "follow", "unfollow":
+		if !app.api_check_method(w, r, "POST") {
+			return
+		}
+		if app.IsScrapingDisabled {
+			app.api_error_401(w)
+			return
+		}
+		if subpage == "follow" {
+			panic_if(app.API.FollowUser(user.ID))
+			panic_if(app.Profile.SaveFollow(app.ActiveUser.ID, user.ID))
+		} else {
+			panic_if(app.API.UnfollowUser(user.ID))
+			app.Profile.DeleteFollow(app.ActiveUser.ID, user.ID)
+		}
+		user.IsFollowed = subpage == "follow"
+		app.api_write_json(w, 200, user)
+	default:
+		app.api_error(w, 404, "Not found: "+r.URL.Path)
+	}
+}
+
+// So empty lists come out as `[]` rather than `null`
+func non_nil_users(users []User) []User {
+	if users == nil {
+		return []User{}
+	}
+	return users
+}
+
+// Lists
+// -----
+
+func (app *Application) api_lists(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	lists := app.Profile.GetAllLists()
+	if lists == nil {
+		lists = []List{}
+	}
+	app.api_write_json(w, 200, lists)
+}
+
+func (app *Application) api_list_detail(w http.ResponseWriter, r *http.Request, id_str string, parts []string) {
+	list_id, err := strconv.Atoi(id_str)
+	if err != nil {
+		app.api_error(w, 400, fmt.Sprintf("Invalid list ID: %q", id_str))
+		return
+	}
+	list, err := app.Profile.GetListById(ListID(list_id))
+	if errors.Is(err, ErrNotInDatabase) {
+		app.api_error(w, 404, "List not found")
+		return
+	}
+	panic_if(err)
+
+	switch {
+	case len(parts) == 0:
+		if app.api_check_method(w, r, "GET") {
+			app.api_write_json(w, 200, APIListDetail{List: list, Users: non_nil_users(app.Profile.GetListUsers(list.ID))})
+		}
+	case len(parts) == 1 && parts[0] == "tweets":
+		app.api_feed(w, r, NewListCursor(list.ID))
+	case len(parts) == 2 && parts[0] == "users":
+		if !app.api_check_method(w, r, "POST", "DELETE") {
+			return
+		}
+		user, err := app.Profile.GetUserByHandle(UserHandle(strings.TrimPrefix(parts[1], "@")))
+		if errors.Is(err, ErrNotInDatabase) {
+			app.api_error(w, 404, fmt.Sprintf("User not found: %q", parts[1]))
+			return
+		}
+		panic_if(err)
+		if r.Method == "POST" {
+			app.Profile.SaveListUser(list.ID, user.ID)
+		} else {
+			app.Profile.DeleteListUser(list.ID, user.ID)
+		}
+		app.api_write_json(w, 200, APIListDetail{List: list, Users: non_nil_users(app.Profile.GetListUsers(list.ID))})
+	default:
+		app.api_error(w, 404, "Not found: "+r.URL.Path)
+	}
+}
+
+// Messages
+// --------
+
+func (app *Application) api_messages(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	if app.ActiveUser.ID == 0 {
+		app.api_error_401(w)
+		return
+	}
+	chat_view := app.Profile.GetChatRoomsPreview(app.ActiveUser.ID)
+	app.api_write_json(w, 200, APIMessages{
+		RoomIDs:    chat_view.RoomIDs,
+		MessageIDs: []DMMessageID{},
+		Trove:      chat_view.TweetTrove,
+	})
+}
+
+func (app *Application) api_message_room(w http.ResponseWriter, r *http.Request, room_id DMChatRoomID) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	if app.ActiveUser.ID == 0 {
+		app.api_error_401(w)
+		return
+	}
+	if _, is_ok := app.Profile.GetChatRoomsPreview(app.ActiveUser.ID).Rooms[room_id]; !is_ok {
+		app.api_error(w, 404, "Chat room not found")
+		return
+	}
+
+	c := NewConversationCursor(room_id)
+	token, is_ok, err := decode_cursor_token(r)
+	if err != nil {
+		app.api_error(w, 400, err.Error())
+		return
+	}
+	if is_ok {
+		c.CursorValue = token.CursorValue
+		c.CursorPosition = CURSOR_MIDDLE
+	}
+	chat_view := app.Profile.GetChatRoomMessagesByCursor(c)
+
+	ret := APIMessages{
+		RoomIDs:    []DMChatRoomID{room_id},
+		MessageIDs: chat_view.MessageIDs,
+		Trove:      chat_view.TweetTrove,
+	}
+	if chat_view.Cursor.CursorPosition != CURSOR_END {
+		ret.NextCursor = api_cursor_token{SortOrder: chat_view.Cursor.SortOrder, CursorValue: chat_view.Cursor.CursorValue}.encode()
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+// Admin
+// -----
+
+// The backup started from the API most recently.  Only one can run at a time.
+var api_backup_job struct {
+	sync.Mutex
+	status APIBackupStatus
+}
+
+// Start a backup.  It can take much longer than a request is allowed to, so it runs in the
+// background; its progress can be checked with `api_backup_status`.
+func (app *Application) api_backup(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "POST") {
+		return
+	}
+	if app.BackupDir == "" {
+		app.api_error(w, 403, "Backups are disabled.  Start the webserver with `--backup-dir` to enable them.")
+		return
+	}
+	opts := BackupOptions{IncludeMedia: r.URL.Query().Get("media") == "true"}
+	if keep := r.URL.Query().Get("keep"); keep != "" {
+		val, err := strconv.Atoi(keep)
+		if err != nil || val < 0 {
+			app.api_error(w, 400, "Invalid keep (must be a non-negative number)")
+			return
+		}
+		opts.NumToKeep = val
+	}
+
+	api_backup_job.Lock()
+	defer api_backup_job.Unlock()
+	if api_backup_job.status.IsRunning {
+		app.api_error(w, 409, "A backup is already running")
+		return
+	}
+	api_backup_job.status = APIBackupStatus{IsRunning: true, StartedAt: Timestamp{time.Now()}}
+	go app.run_api_backup(opts)
+	app.api_write_json(w, 202, api_backup_job.status)
+}
+
+func (app *Application) run_api_backup(opts BackupOptions) {
+	result, err := app.Profile.Backup(app.BackupDir, opts)
+
+	api_backup_job.Lock()
+	defer api_backup_job.Unlock()
+	api_backup_job.status.IsRunning = false
+	if err != nil {
+		app.ErrorLog.Printf("Error backing up:\n  %s", err.Error())
+		api_backup_job.status.Error = err.Error()
+		return
+	}
+	ret := APIBackupResult{
+		Snapshot:         filepath.Base(result.SnapshotDir),
+		FilesCopied:      result.FilesCopied,
+		FilesLinked:      result.FilesLinked,
+		BytesCopied:      result.BytesCopied,
+		SnapshotsDeleted: []string{},
+	}
+	for _, snapshot := range result.SnapshotsDeleted {
+		ret.SnapshotsDeleted = append(ret.SnapshotsDeleted, filepath.Base(snapshot))
+	}
+	api_backup_job.status.Result = &ret
+}
+
+func (app *Application) api_backup_status(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	if app.BackupDir == "" {
+		app.api_error(w, 403, "Backups are disabled.  Start the webserver with `--backup-dir` to enable them.")
+		return
+	}
+	api_backup_job.Lock()
+	ret := api_backup_job.status
+	api_backup_job.Unlock()
+	if ret.StartedAt.IsZero() {
+		app.api_error(w, 404, "No backup has been started")
+		return
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+func (app *Application) api_list_backups(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	if app.BackupDir == "" {
+		app.api_error(w, 403, "Backups are disabled.  Start the webserver with `--backup-dir` to enable them.")
+		return
+	}
+	ret := APIBackups{Snapshots: []string{}}
+	snapshots, err := ListBackupSnapshots(app.BackupDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		// No backups yet
+		app.api_write_json(w, 200, ret)
+		return
+	}
+	panic_if(err)
+	for _, snapshot := range snapshots {
+		ret.Snapshots = append(ret.Snapshots, filepath.Base(snapshot))
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+func (app *Application) api_rate_limits(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	ret := APIRateLimits{Endpoints: []scraper.RateLimitBudget{}}
+	if app.API.RateLimiter != nil {
+		ret.Endpoints = app.API.RateLimiter.Budgets()
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+func (app *Application) api_media_downloads(w http.ResponseWriter, r *http.Request) {
+	if !app.api_check_method(w, r, "GET") {
+		return
+	}
+	app.api_write_json(w, 200, app.MediaDownloads.Progress())
+}
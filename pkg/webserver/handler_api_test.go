@@ -0,0 +1,292 @@
+package webserver_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/webserver"
+)
+
+func decode_api_response(t *testing.T, resp *http.Response, expected_status int, out interface{}) {
+	t.Helper()
+	require.Equal(t, expected_status, resp.StatusCode)
+	require.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+}
+
+func TestAPITimeline(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var page1 webserver.APIFeed
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/timeline?limit=5", nil)), 200, &page1)
+	require.Len(page1.Items, 5)
+	require.NotEqual("", page1.NextCursor)
+	for _, item := range page1.Items {
+		tweet, is_ok := page1.Trove.Tweets[item.TweetID]
+		require.True(is_ok)
+		_, is_ok = page1.Trove.Users[tweet.UserID]
+		assert.True(is_ok)
+	}
+
+	// Next page should be different tweets
+	var page2 webserver.APIFeed
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/timeline?limit=5&cursor="+page1.NextCursor, nil)), 200, &page2)
+	require.Len(page2.Items, 5)
+	for _, item := range page2.Items {
+		assert.NotContains(page1.Items, item)
+	}
+
+	// Last page has no cursor
+	var all webserver.APIFeed
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/timeline?limit=200", nil)), 200, &all)
+	assert.Equal("", all.NextCursor)
+}
+
+func TestAPIInvalidParams(t *testing.T) {
+	assert := assert.New(t)
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/timeline?cursor=asdf", nil)), 400, &api_err)
+	assert.Contains(api_err.Error, "invalid cursor token")
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/timeline?limit=-1", nil)), 400, &api_err)
+
+	// Well-formed tokens with a bad sort order
+	for _, token := range []string{`{"s":99,"v":1}`, `{"s":-1,"v":1}`, `{"s":4,"v":1}`} {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(token))
+		decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/timeline?cursor="+cursor, nil)), 400, &api_err)
+		assert.Contains(api_err.Error, "invalid cursor token")
+	}
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/search", nil)), 400, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/search?q=since:fawejk", nil)), 400, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/tweets/asdf", nil)), 400, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/tweets/1234", nil)), 404, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/users/not_a_real_user", nil)), 404, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/lists/asdf", nil)), 400, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/lists/123456", nil)), 404, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/asdf", nil)), 404, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v2/timeline", nil)), 404, &api_err)
+}
+
+func TestAPISearch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var feed webserver.APIFeed
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/search?q=who%20are", nil)), 200, &feed)
+	assert.Len(feed.Items, 3)
+
+	// Sort order should be kept in the cursor token
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/search?q=think&sort-order=most%20likes&limit=2", nil)), 200, &feed)
+	require.Len(feed.Items, 2)
+	assert.Contains(feed.Trove.Tweets[feed.Items[0].TweetID].Text, "Morally nuanced and complicated discussion")
+	assert.Contains(feed.Trove.Tweets[feed.Items[1].TweetID].Text, "a lot of y’all embarrass yourselves on this")
+	req := httptest.NewRequest("GET", "/api/v1/search?q=think&limit=2&cursor="+feed.NextCursor, nil)
+	decode_api_response(t, do_request(req), 200, &feed)
+	require.Len(feed.Items, 2)
+	assert.Contains(feed.Trove.Tweets[feed.Items[0].TweetID].Text, "this is why the \"think tank mindset\" is a dead end")
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/search?q=think&sort-order=asdf", nil)), 400, &api_err)
+}
+
+func TestAPITweetDetail(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var detail webserver.APITweetDetail
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/tweets/1413658466795737091", nil)), 200, &detail)
+	assert.Equal(TweetID(1413658466795737091), detail.MainTweetID)
+	assert.Contains(detail.ParentIDs, TweetID(1413657324267311104))
+	tweet, is_ok := detail.Trove.Tweets[detail.MainTweetID]
+	require.True(is_ok)
+	assert.Equal(TweetID(1413657324267311104), tweet.InReplyToID)
+	assert.Equal(UserHandle("Peter_Nimitz"), detail.Trove.Users[tweet.UserID].Handle)
+}
+
+func TestAPIUser(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var user User
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/users/Cernovich", nil)), 200, &user)
+	assert.Equal(UserHandle("Cernovich"), user.Handle)
+
+	var feed webserver.APIFeed
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/users/Cernovich/tweets", nil)), 200, &feed)
+	require.NotEmpty(feed.Items)
+	for _, item := range feed.Items {
+		if item.RetweetID == TweetID(0) {
+			assert.Equal(user.ID, feed.Trove.Tweets[item.TweetID].UserID)
+		}
+	}
+
+	var users []User
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/users/Offline_Twatter/followees", nil)), 200, &users)
+	assert.NotEmpty(users)
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/users/Offline_Twatter/followers", nil)), 200, &users)
+	assert.NotNil(users)
+}
+
+func TestAPIMutationsRequireLogin(t *testing.T) {
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/tweets/1413658466795737091/like", nil)), 401, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/tweets/1413658466795737091/unlike", nil)), 401, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/users/Cernovich/follow", nil)), 401, &api_err)
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/users/Cernovich/unfollow", nil)), 401, &api_err)
+
+	// Wrong method
+	resp := do_request(httptest.NewRequest("GET", "/api/v1/users/Cernovich/follow", nil))
+	decode_api_response(t, resp, 405, &api_err)
+	assert.Equal(t, "POST", resp.Header.Get("Allow"))
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/timeline", nil)), 405, &api_err)
+}
+
+func TestAPILists(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var lists []List
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/lists", nil)), 200, &lists)
+	assert.True(len(lists) >= 2)
+
+	var detail webserver.APIListDetail
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/lists/1", nil)), 200, &detail)
+	assert.Equal("Offline Follows", detail.List.Name)
+	assert.Len(detail.Users, 5)
+
+	var feed webserver.APIFeed
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/lists/1/tweets", nil)), 200, &feed)
+	assert.NotEmpty(feed.Items)
+
+	// Add a user, then remove them again
+	has_user := func(users []User, handle UserHandle) bool {
+		for _, u := range users {
+			if u.Handle == handle {
+				return true
+			}
+		}
+		return false
+	}
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/lists/3/users/Denlesks", nil)), 200, &detail)
+	require.True(has_user(detail.Users, "Denlesks"))
+	decode_api_response(t, do_request(httptest.NewRequest("DELETE", "/api/v1/lists/3/users/@Denlesks", nil)), 200, &detail)
+	require.False(has_user(detail.Users, "Denlesks"))
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/lists/3/users/not_a_real_user", nil)), 404, &api_err)
+}
+
+func TestAPINotifications(t *testing.T) {
+	assert := assert.New(t)
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/notifications", nil)), 401, &api_err)
+
+	var feed webserver.APIFeed
+	decode_api_response(t, do_request_with_active_user(httptest.NewRequest("GET", "/api/v1/notifications", nil)), 200, &feed)
+	assert.NotEmpty(feed.Items)
+	for _, item := range feed.Items {
+		_, is_ok := feed.Trove.Notifications[item.NotificationID]
+		assert.True(is_ok)
+	}
+}
+
+func TestAPIMessages(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/messages", nil)), 401, &api_err)
+
+	var rooms webserver.APIMessages
+	decode_api_response(t, do_request_with_active_user(httptest.NewRequest("GET", "/api/v1/messages", nil)), 200, &rooms)
+	assert.Len(rooms.RoomIDs, 2)
+
+	var messages webserver.APIMessages
+	room_id := DMChatRoomID("1488963321701171204-1178839081222115328")
+	decode_api_response(t, do_request_with_active_user(httptest.NewRequest("GET", "/api/v1/messages/"+string(room_id), nil)), 200, &messages)
+	require.Len(messages.MessageIDs, 5)
+	for _, id := range messages.MessageIDs {
+		assert.Equal(room_id, messages.Trove.Messages[id].DMChatRoomID)
+	}
+	assert.Equal("", messages.NextCursor)
+
+	decode_api_response(t, do_request_with_active_user(httptest.NewRequest("GET", "/api/v1/messages/asdf", nil)), 404, &api_err)
+}
+
+func TestAPIBackup(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Disabled unless there's a backup directory
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/admin/backup", nil)), 403, &api_err)
+
+	app := make_testing_app(nil)
+	app.BackupDir = t.TempDir()
+	do_admin_request := func(req *http.Request) *http.Response {
+		recorder := httptest.NewRecorder()
+		app.WithMiddlewares().ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	decode_api_response(t, do_admin_request(httptest.NewRequest("GET", "/api/v1/admin/backup/status", nil)), 404, &api_err)
+
+	// It runs in the background; wait for it to finish
+	var status webserver.APIBackupStatus
+	decode_api_response(t, do_admin_request(httptest.NewRequest("POST", "/api/v1/admin/backup?keep=1", nil)), 202, &status)
+	assert.True(status.IsRunning)
+	require.Eventually(func() bool {
+		status = webserver.APIBackupStatus{}
+		decode_api_response(t, do_admin_request(httptest.NewRequest("GET", "/api/v1/admin/backup/status", nil)), 200, &status)
+		return !status.IsRunning
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal("", status.Error)
+	require.NotNil(status.Result)
+	result := *status.Result
+	assert.NotEqual("", result.Snapshot)
+	assert.Greater(result.BytesCopied, int64(0))
+	assert.Len(result.SnapshotsDeleted, 0)
+
+	var backups webserver.APIBackups
+	decode_api_response(t, do_admin_request(httptest.NewRequest("GET", "/api/v1/admin/backups", nil)), 200, &backups)
+	require.Len(backups.Snapshots, 1)
+	assert.Equal(result.Snapshot, backups.Snapshots[0])
+
+	decode_api_response(t, do_admin_request(httptest.NewRequest("POST", "/api/v1/admin/backup?keep=asdf", nil)), 400, &api_err)
+	decode_api_response(t, do_admin_request(httptest.NewRequest("GET", "/api/v1/admin/backup", nil)), 405, &api_err)
+}
+
+func TestAPIRateLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	// No requests have been sent yet
+	var rate_limits webserver.APIRateLimits
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/admin/rate-limits", nil)), 200, &rate_limits)
+	assert.Len(rate_limits.Endpoints, 0)
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/admin/rate-limits", nil)), 405, &api_err)
+}
+
+func TestAPIMediaDownloads(t *testing.T) {
+	assert := assert.New(t)
+
+	// The test app's download workers aren't running
+	var progress MediaDownloadProgress
+	decode_api_response(t, do_request(httptest.NewRequest("GET", "/api/v1/admin/media-downloads", nil)), 200, &progress)
+	assert.Equal(0, progress.NumInProgress)
+	assert.Equal(0, progress.NumDownloaded)
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_request(httptest.NewRequest("POST", "/api/v1/admin/media-downloads", nil)), 405, &api_err)
+}
@@ -0,0 +1,333 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/tracing"
+)
+
+// Atom and RSS feeds, for feed readers.  URLs look like:
+//   - /feeds/timeline.atom
+//   - /feeds/lists/<list-id>.atom
+//   - /feeds/users/<user-handle>.atom
+//   - /feeds/search.atom?q=<search query>
+//
+// Use ".rss" instead of ".atom" for RSS 2.0.
+func (app *Application) Feeds(w http.ResponseWriter, r *http.Request) {
+	_span := tracing.GetActiveSpan(r.Context()).AddChild("feeds")
+	defer _span.End()
+	app.TraceLog.Printf("'Feeds' handler (path: %q)", r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	format := path.Ext(parts[len(parts)-1])
+	if format != ".atom" && format != ".rss" {
+		app.error_404(w, r)
+		return
+	}
+	parts[len(parts)-1] = strings.TrimSuffix(parts[len(parts)-1], format)
+
+	base_url := get_base_url(r)
+	var c Cursor
+	var title string
+	var html_url string
+	switch {
+	case len(parts) == 1 && parts[0] == "timeline":
+		c = NewTimelineCursor()
+		title = "Timeline"
+		html_url = "/timeline/offline"
+	case len(parts) == 2 && parts[0] == "lists":
+		list_id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			app.error_400_with_message(w, r, fmt.Sprintf("Invalid list ID: %q", parts[1]))
+			return
+		}
+		list, err := app.Profile.GetListById(ListID(list_id))
+		if errors.Is(err, ErrNotInDatabase) {
+			app.error_404(w, r)
+			return
+		}
+		panic_if(err)
+		c = NewListCursor(list.ID)
+		title = list.Name
+		html_url = fmt.Sprintf("/lists/%d", list.ID)
+	case len(parts) == 2 && parts[0] == "users":
+		user, err := app.Profile.GetUserByHandle(UserHandle(parts[1]))
+		if errors.Is(err, ErrNotInDatabase) {
+			app.error_404(w, r)
+			return
+		}
+		panic_if(err)
+		c = NewUserFeedCursor(user.Handle)
+		title = fmt.Sprintf("%s (@%s)", user.DisplayName, user.Handle)
+		html_url = fmt.Sprintf("/%s", user.Handle)
+	case len(parts) == 1 && parts[0] == "search":
+		search_text := r.URL.Query().Get("q")
+		if search_text == "" {
+			app.error_400_with_message(w, r, "Empty search query")
+			return
+		}
+		var err error
+		c, err = NewCursorFromSearchQuery(search_text)
+		if err != nil {
+			app.error_400_with_message(w, r, err.Error())
+			return
+		}
+		title = fmt.Sprintf("Search results: %s", search_text)
+		html_url = fmt.Sprintf("/search/%s", url.PathEscape(search_text))
+	default:
+		app.error_404(w, r)
+		return
+	}
+
+	span := tracing.GetActiveSpan(r.Context()).AddChild("cursor_next_page")
+	c.ShowMuted = is_showing_muted(r)
+	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
+	if err != nil && !errors.Is(err, ErrEndOfFeed) {
+		panic(err)
+	}
+	span.End()
+	app.add_reply_context(&feed)
+
+	entries := app.make_feed_entries(feed, base_url)
+	var data interface{}
+	if format == ".atom" {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		// `r.URL` has had the "/feeds" prefix stripped, but `r.RequestURI` is the original
+		data = make_atom_feed(title, base_url+r.RequestURI, base_url+html_url, entries)
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		data = make_rss_feed(title, base_url+html_url, entries)
+	}
+
+	buf := bytes.NewBufferString(xml.Header)
+	encoder := xml.NewEncoder(buf)
+	encoder.Indent("", "  ")
+	panic_if(encoder.Encode(data))
+	_, err = buf.WriteTo(w)
+	panic_if(err)
+}
+
+// Fetch the tweets that the feed's tweets are replying to (if they're in the DB), so entries can
+// show what they're replying to
+func (app *Application) add_reply_context(feed *Feed) {
+	for _, item := range feed.Items {
+		tweet := feed.Tweets[item.TweetID]
+		if tweet.InReplyToID == TweetID(0) {
+			continue
+		}
+		if _, is_ok := feed.Tweets[tweet.InReplyToID]; is_ok {
+			continue
+		}
+		parent, err := app.Profile.GetTweetById(tweet.InReplyToID)
+		if errors.Is(err, ErrNotInDatabase) {
+			continue
+		}
+		panic_if(err)
+		feed.Tweets[parent.ID] = parent
+		if _, is_ok := feed.Users[parent.UserID]; !is_ok {
+			user, err := app.Profile.GetUserByID(parent.UserID)
+			panic_if(err)
+			feed.Users[user.ID] = user
+		}
+	}
+}
+
+// A feed entry, independent of whether it's going to be Atom or RSS
+type feed_entry struct {
+	ID          string
+	Title       string
+	URL         string
+	AuthorName  string
+	AuthorURL   string
+	PublishedAt time.Time
+	Content     string // HTML
+}
+
+func (app *Application) make_feed_entries(feed Feed, base_url string) []feed_entry {
+	global_data := PageGlobalData{TweetTrove: feed.TweetTrove}
+	ret := []feed_entry{}
+	for _, item := range feed.Items {
+		if item.TweetID == TweetID(0) {
+			// Notifications don't go in feeds
+			continue
+		}
+		tweet := feed.Tweets[item.TweetID]
+		author := feed.Users[tweet.UserID]
+		entry := feed_entry{
+			ID:          fmt.Sprintf("%s/tweet/%d", base_url, tweet.ID),
+			Title:       fmt.Sprintf("@%s: %s", author.Handle, feed_entry_title_text(tweet)),
+			URL:         fmt.Sprintf("%s/tweet/%d", base_url, tweet.ID),
+			AuthorName:  fmt.Sprintf("%s (@%s)", author.DisplayName, author.Handle),
+			AuthorURL:   fmt.Sprintf("%s/%s", base_url, author.Handle),
+			PublishedAt: tweet.PostedAt.Time,
+		}
+		if item.RetweetID != TweetID(0) {
+			retweet := feed.Retweets[item.RetweetID]
+			retweeted_by := feed.Users[retweet.RetweetedByID]
+			// Retweets are separate entries from the tweet itself
+			entry.ID = fmt.Sprintf("%s/tweet/%d?retweet=%d", base_url, tweet.ID, retweet.RetweetID)
+			entry.Title = fmt.Sprintf("@%s retweeted %s", retweeted_by.Handle, entry.Title)
+			entry.PublishedAt = retweet.RetweetedAt.Time
+		}
+
+		buf := new(bytes.Buffer)
+		panic_if(FeedEntryContent(global_data, item.TweetID, item.RetweetID, base_url).Render(context.Background(), buf))
+		entry.Content = buf.String()
+		ret = append(ret, entry)
+	}
+	return ret
+}
+
+// Shortened first line of a tweet, for an entry title
+func feed_entry_title_text(tweet Tweet) string {
+	const max_length = 80
+	text, _, _ := strings.Cut(tweet.Text, "\n")
+	if text == "" {
+		if len(tweet.Images) != 0 || len(tweet.Videos) != 0 {
+			return "[media]"
+		}
+		return "[no text]"
+	}
+	if utf8.RuneCountInString(text) > max_length {
+		return string([]rune(text)[:max_length-1]) + "…"
+	}
+	return text
+}
+
+// Atom
+// ----
+
+type atom_link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atom_person struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atom_text struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atom_entry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Link      atom_link   `xml:"link"`
+	Author    atom_person `xml:"author"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Content   atom_text   `xml:"content"`
+}
+
+type atom_feed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Links   []atom_link  `xml:"link"`
+	Entries []atom_entry `xml:"entry"`
+}
+
+func make_atom_feed(title string, self_url string, html_url string, entries []feed_entry) atom_feed {
+	ret := atom_feed{
+		ID:    self_url,
+		Title: title,
+		Links: []atom_link{
+			{Href: self_url, Rel: "self", Type: "application/atom+xml"},
+			{Href: html_url, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: []atom_entry{},
+	}
+	// An empty feed was last updated just now, as far as anyone can tell
+	updated_at := time.Now()
+	if len(entries) > 0 {
+		updated_at = entries[0].PublishedAt
+	}
+	for _, e := range entries {
+		ret.Entries = append(ret.Entries, atom_entry{
+			ID:        e.ID,
+			Title:     e.Title,
+			Link:      atom_link{Href: e.URL, Rel: "alternate", Type: "text/html"},
+			Author:    atom_person{Name: e.AuthorName, URI: e.AuthorURL},
+			Published: e.PublishedAt.UTC().Format(time.RFC3339),
+			Updated:   e.PublishedAt.UTC().Format(time.RFC3339),
+			Content:   atom_text{Type: "html", Body: e.Content},
+		})
+		if e.PublishedAt.After(updated_at) {
+			updated_at = e.PublishedAt
+		}
+	}
+	ret.Updated = updated_at.UTC().Format(time.RFC3339)
+	return ret
+}
+
+// RSS
+// ---
+
+type rss_guid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rss_item struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rss_guid `xml:"guid"`
+	Creator     string   `xml:"dc:creator"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+}
+
+type rss_channel struct {
+	Title       string     `xml:"title"`
+	Link        string     `xml:"link"`
+	Description string     `xml:"description"`
+	Items       []rss_item `xml:"item"`
+}
+
+type rss_feed struct {
+	XMLName     xml.Name    `xml:"rss"`
+	Version     string      `xml:"version,attr"`
+	DCNamespace string      `xml:"xmlns:dc,attr"`
+	Channel     rss_channel `xml:"channel"`
+}
+
+func make_rss_feed(title string, html_url string, entries []feed_entry) rss_feed {
+	ret := rss_feed{
+		Version:     "2.0",
+		DCNamespace: "http://purl.org/dc/elements/1.1/",
+		Channel: rss_channel{
+			Title:       title,
+			Link:        html_url,
+			Description: fmt.Sprintf("%s | Offline Twitter", title),
+			Items:       []rss_item{},
+		},
+	}
+	for _, e := range entries {
+		ret.Channel.Items = append(ret.Channel.Items, rss_item{
+			Title:       e.Title,
+			Link:        e.URL,
+			GUID:        rss_guid{IsPermaLink: false, Value: e.ID},
+			Creator:     e.AuthorName,
+			PubDate:     e.PublishedAt.UTC().Format(time.RFC1123Z),
+			Description: e.Content,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,186 @@
+package webserver_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"net/http/httptest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type test_atom_feed struct {
+	Title   string `xml:"title"`
+	Updated string `xml:"updated"`
+	Links   []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Entries []struct {
+		ID      string `xml:"id"`
+		Title   string `xml:"title"`
+		Content string `xml:"content"`
+	} `xml:"entry"`
+}
+
+type test_rss_feed struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func TestFeedsTimelineAtom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/feeds/timeline.atom", nil))
+	require.Equal(200, resp.StatusCode)
+	assert.Equal("application/atom+xml; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	var feed test_atom_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	assert.Equal("Timeline", feed.Title)
+	assert.Len(feed.Entries, 21) // Same as the offline timeline page
+}
+
+func TestFeedsUserFeedAtom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/feeds/users/cernovich.atom", nil))
+	require.Equal(200, resp.StatusCode)
+
+	var feed test_atom_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	assert.Equal("Cernovich (@Cernovich)", feed.Title)
+	require.Greater(len(feed.Entries), 0)
+
+	// Media should be linked to "/content"
+	is_video_found := false
+	for _, e := range feed.Entries {
+		if e.ID == "http://example.com/tweet/1453461248142495744" {
+			is_video_found = true
+			assert.Contains(e.Content, `src="http://example.com/content/videos/1453461248142495744.mp4"`)
+		}
+	}
+	assert.True(is_video_found)
+}
+
+func TestFeedsSearchRSS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/feeds/search.rss?q=think", nil))
+	require.Equal(200, resp.StatusCode)
+	assert.Equal("application/rss+xml; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	var feed test_rss_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	assert.Equal("Search results: think", feed.Channel.Title)
+	assert.Len(feed.Channel.Items, 5)
+}
+
+func TestFeedsListAtom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/feeds/lists/2.atom", nil))
+	require.Equal(200, resp.StatusCode)
+
+	var feed test_atom_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	assert.Greater(len(feed.Entries), 0)
+}
+
+// Replies should show what they're replying to, and quote-tweets should include the quoted tweet
+func TestFeedsReplyAndQuoteContext(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/feeds/search.atom?q=from:Cernovich", nil))
+	require.Equal(200, resp.StatusCode)
+	var feed test_atom_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	is_quote_tweet_found := false
+	for _, e := range feed.Entries {
+		if e.ID == "http://example.com/tweet/1439068749336748043" {
+			is_quote_tweet_found = true
+			assert.Contains(e.Content, `<blockquote><p><b><a href="http://example.com/tweet/1439068429768605696">`)
+		}
+	}
+	assert.True(is_quote_tweet_found)
+
+	resp = do_request(httptest.NewRequest("GET", "/feeds/search.atom?q=from:Peter_Nimitz", nil))
+	require.Equal(200, resp.StatusCode)
+	feed = test_atom_feed{}
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	is_reply_found := false
+	for _, e := range feed.Entries {
+		if e.ID == "http://example.com/tweet/1413658466795737091" {
+			is_reply_found = true
+			// Replied-to tweet (1413657324267311104) isn't in the search results, but it should be fetched
+			assert.Contains(e.Content, "Replying to")
+			assert.Contains(e.Content, `<a href="http://example.com/tweet/1413657324267311104">@ShazCoder</a>`)
+			assert.Contains(e.Content, "<blockquote>")
+		}
+	}
+	assert.True(is_reply_found)
+}
+
+// Links should use the scheme the client used, even behind a reverse proxy
+func TestFeedsLinkScheme(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	req := httptest.NewRequest("GET", "/feeds/timeline.atom", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	resp := do_request(req)
+	require.Equal(200, resp.StatusCode)
+	var feed test_atom_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	require.Len(feed.Links, 2)
+	assert.Equal("https://example.com/feeds/timeline.atom", feed.Links[0].Href)
+	assert.Equal("https://example.com/timeline/offline", feed.Links[1].Href)
+
+	resp = do_request(httptest.NewRequest("GET", "/feeds/timeline.atom", nil))
+	require.Equal(200, resp.StatusCode)
+	var http_feed test_atom_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&http_feed))
+	require.NotEmpty(http_feed.Links)
+	for _, link := range http_feed.Links {
+		assert.True(strings.HasPrefix(link.Href, "http://"), link.Href)
+	}
+}
+
+// An empty feed should still have a valid "updated" time
+func TestFeedsEmptyAtom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/feeds/search.atom?q=asdfjklasdfjkl", nil))
+	require.Equal(200, resp.StatusCode)
+	var feed test_atom_feed
+	require.NoError(xml.NewDecoder(resp.Body).Decode(&feed))
+	assert.Len(feed.Entries, 0)
+	updated, err := time.Parse(time.RFC3339, feed.Updated)
+	require.NoError(err)
+	assert.WithinDuration(time.Now(), updated, time.Minute)
+}
+
+func TestFeedsErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(404, do_request(httptest.NewRequest("GET", "/feeds/timeline.json", nil)).StatusCode)
+	assert.Equal(404, do_request(httptest.NewRequest("GET", "/feeds/users/asdfjklasdfjkl.atom", nil)).StatusCode)
+	assert.Equal(404, do_request(httptest.NewRequest("GET", "/feeds/lists/9999.atom", nil)).StatusCode)
+	assert.Equal(400, do_request(httptest.NewRequest("GET", "/feeds/lists/asdf.atom", nil)).StatusCode)
+	assert.Equal(400, do_request(httptest.NewRequest("GET", "/feeds/search.atom", nil)).StatusCode)
+	assert.Equal(400, do_request(httptest.NewRequest("GET", "/feeds/search.atom?q=since:asdf", nil)).StatusCode)
+}
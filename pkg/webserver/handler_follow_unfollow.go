@@ -32,7 +32,7 @@ func (app *Application) UserFollow(w http.ResponseWriter, r *http.Request) {
 	span.End()
 
 	panic_if(app.API.FollowUser(user.ID))
-	app.Profile.SaveFollow(app.ActiveUser.ID, user.ID)
+	panic_if(app.Profile.SaveFollow(app.ActiveUser.ID, user.ID))
 	user.IsFollowed = true
 
 	app.buffered_render_htmx2(w, r, "following-button", PageGlobalData{}, user)
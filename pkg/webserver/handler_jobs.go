@@ -0,0 +1,127 @@
+package webserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/tracing"
+)
+
+type JobsData struct {
+	Jobs           []ScrapeJob
+	MediaDownloads MediaDownloadProgress
+}
+
+func (app *Application) Jobs(w http.ResponseWriter, r *http.Request) {
+	_span := tracing.GetActiveSpan(r.Context()).AddChild("jobs")
+	defer _span.End()
+	app.TraceLog.Printf("'Jobs' handler (path: %q)", r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// Retry failed media downloads
+	if parts[0] == "media-downloads" {
+		if r.Method != "POST" || len(parts) != 2 || parts[1] != "retry" {
+			app.error_404(w, r)
+			return
+		}
+		if app.Profile.RetryFailedMediaDownloads() != 0 {
+			app.MediaDownloads.Notify()
+		}
+		http.Redirect(w, r, "/jobs", 303)
+		return
+	}
+
+	// Cancel, retry or change the priority of a job
+	if parts[0] != "" {
+		if r.Method != "POST" || len(parts) != 2 {
+			app.error_404(w, r)
+			return
+		}
+		_id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			app.error_400_with_message(w, r, "Job ID must be a number")
+			return
+		}
+		id := ScrapeJobID(_id)
+		switch parts[1] {
+		case "cancel":
+			err = app.Profile.CancelScrapeJob(id)
+		case "retry":
+			err = app.Profile.RetryScrapeJob(id)
+		case "priority":
+			var formdata struct {
+				Priority string `json:"priority"`
+			}
+			data, read_err := io.ReadAll(r.Body)
+			panic_if(read_err)
+			if json.Unmarshal(data, &formdata) != nil {
+				app.error_400_with_message(w, r, "Invalid form data")
+				return
+			}
+			priority, parse_err := strconv.Atoi(formdata.Priority)
+			if parse_err != nil {
+				app.error_400_with_message(w, r, "Priority must be a number")
+				return
+			}
+			err = app.Profile.SetScrapeJobPriority(id, priority)
+		default:
+			app.error_404(w, r)
+			return
+		}
+		if err != nil {
+			app.error_400_with_message(w, r, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/jobs", 303)
+		return
+	}
+
+	// New job
+	if r.Method == "POST" {
+		var formdata struct {
+			Type     string `json:"type"`
+			Target   string `json:"target"`
+			Priority string `json:"priority"`
+			MaxPages string `json:"max_pages"`
+		}
+		data, err := io.ReadAll(r.Body)
+		panic_if(err)
+		err = json.Unmarshal(data, &formdata)
+		if err != nil {
+			app.error_400_with_message(w, r, "Invalid form data")
+			return
+		}
+		job := ScrapeJob{Type: ScrapeJobType(formdata.Type), Target: formdata.Target}
+		if formdata.Priority != "" {
+			if job.Priority, err = strconv.Atoi(formdata.Priority); err != nil {
+				app.error_400_with_message(w, r, "Priority must be a number")
+				return
+			}
+		}
+		if formdata.MaxPages != "" {
+			if job.MaxPages, err = strconv.Atoi(formdata.MaxPages); err != nil {
+				app.error_400_with_message(w, r, "Max pages must be a number")
+				return
+			}
+		}
+		if err := app.Profile.SaveScrapeJob(&job); err != nil {
+			app.error_400_with_message(w, r, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/jobs", 302)
+		return
+	}
+
+	// Jobs index
+	app.buffered_render_page2(
+		w, r,
+		"tpl/jobs.tpl",
+		PageGlobalData{Title: "Jobs"},
+		JobsData{Jobs: app.Profile.GetAllScrapeJobs(), MediaDownloads: app.MediaDownloads.Progress()},
+	)
+}
@@ -0,0 +1,120 @@
+package webserver_test
+
+import (
+	"strings"
+	"testing"
+
+	"net/http/httptest"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestQueueAndCancelJob(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	resp := do_request(httptest.NewRequest("POST", "/jobs",
+		strings.NewReader(`{"type": "followers", "target": "@jobs_test_user", "priority": "3", "max_pages": "5"}`)))
+	require.Equal(resp.StatusCode, 302)
+	assert.Equal("/jobs", resp.Header.Get("Location"))
+
+	// Find it on the jobs page; get the URL to cancel it
+	get_job := func() *html.Node {
+		resp := do_request(httptest.NewRequest("GET", "/jobs", nil))
+		require.Equal(resp.StatusCode, 200)
+		root, err := html.Parse(resp.Body)
+		require.NoError(err)
+		var ret *html.Node
+		for _, node := range cascadia.QueryAll(root, selector(".job")) {
+			target := cascadia.Query(node, selector(".job__target"))
+			if target != nil && target.FirstChild.Data == "@jobs_test_user" && ret == nil {
+				ret = node // The first one is the most recent one, from this test run
+			}
+		}
+		require.NotNil(ret)
+		return ret
+	}
+	get_attr := func(node *html.Node, key string) string {
+		for _, attr := range node.Attr {
+			if attr.Key == key {
+				return attr.Val
+			}
+		}
+		return ""
+	}
+	job := get_job()
+	assert.Equal("queued", cascadia.Query(job, selector(".job__status")).FirstChild.Data)
+	assert.Equal("3", get_attr(cascadia.Query(job, selector(".job__priority input[name='priority']")), "value"))
+	cancel_url := get_attr(cascadia.Query(job, selector(".button--danger")), "hx-post")
+	require.True(strings.HasSuffix(cancel_url, "/cancel"))
+	priority_url := strings.TrimSuffix(cancel_url, "/cancel") + "/priority"
+
+	// Change its priority
+	resp = do_request(httptest.NewRequest("POST", priority_url, strings.NewReader(`{"priority": "8"}`)))
+	require.Equal(resp.StatusCode, 303)
+	assert.Equal("8", get_attr(cascadia.Query(get_job(), selector(".job__priority input[name='priority']")), "value"))
+
+	// Cancel it
+	resp = do_request(httptest.NewRequest("POST", cancel_url, nil))
+	require.Equal(resp.StatusCode, 303)
+	assert.Equal("/jobs", resp.Header.Get("Location"))
+	job = get_job()
+	assert.Equal("cancelled", cascadia.Query(job, selector(".job__status")).FirstChild.Data)
+
+	// Can't cancel it twice
+	resp = do_request(httptest.NewRequest("POST", cancel_url, nil))
+	assert.Equal(resp.StatusCode, 400)
+
+	// Retry it
+	retry_url := get_attr(cascadia.Query(job, selector("a.button")), "hx-post")
+	require.True(strings.HasSuffix(retry_url, "/retry"))
+	resp = do_request(httptest.NewRequest("POST", retry_url, nil))
+	require.Equal(resp.StatusCode, 303)
+	assert.Equal("queued", cascadia.Query(get_job(), selector(".job__status")).FirstChild.Data)
+
+	// Cancel it again, so it doesn't get left in the queue
+	resp = do_request(httptest.NewRequest("POST", cancel_url, nil))
+	require.Equal(resp.StatusCode, 303)
+}
+
+func TestQueueJobInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := do_request(httptest.NewRequest("POST", "/jobs", strings.NewReader(`{"type": "asdf", "target": "asdf"}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/jobs", strings.NewReader(`{"type": "search", "target": ""}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/jobs",
+		strings.NewReader(`{"type": "search", "target": "asdf", "priority": "high"}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/jobs/asdf/cancel", nil))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/jobs/12345678/cancel", nil))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/jobs/1/asdf", nil))
+	assert.Equal(resp.StatusCode, 404)
+}
+
+func TestJobsPageMediaDownloads(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/jobs", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err := html.Parse(resp.Body)
+	require.NoError(err)
+	media_downloads := cascadia.Query(root, selector(".media-downloads"))
+	require.NotNil(media_downloads)
+	assert.NotNil(cascadia.Query(media_downloads, selector(".media-downloads__queued")))
+	assert.NotNil(cascadia.Query(media_downloads, selector(".media-downloads__failed")))
+
+	// Retry failed downloads
+	resp = do_request(httptest.NewRequest("POST", "/jobs/media-downloads/retry", nil))
+	require.Equal(resp.StatusCode, 303)
+	assert.Equal("/jobs", resp.Header.Get("Location"))
+	resp = do_request(httptest.NewRequest("GET", "/jobs/media-downloads/retry", nil))
+	assert.Equal(resp.StatusCode, 404)
+}
@@ -45,6 +45,7 @@ func (app *Application) ListDetailFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	span := tracing.GetActiveSpan(r.Context()).AddChild("cursor_next_page")
+	c.ShowMuted = is_showing_muted(r)
 	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
 	if err != nil && !errors.Is(err, ErrEndOfFeed) {
 		panic(err)
@@ -147,5 +147,6 @@ func (app *Application) ChangeSession(w http.ResponseWriter, r *http.Request) {
 	if app.LastReadNotificationSortIndex != 0 {
 		data.NumRegularNotifications = app.Profile.GetUnreadNotificationsCount(app.ActiveUser.ID, app.LastReadNotificationSortIndex)
 	}
-	app.buffered_render_htmx2(w, r, "nav-sidebar", PageGlobalData{}, data)
+	data.SavedSearches = app.get_saved_searches_with_counts()
+	app.buffered_render_htmx2(w, r, "nav-sidebar", PageGlobalData{NotificationBubbles: data}, data)
 }
@@ -0,0 +1,529 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/tracing"
+)
+
+// Mastodon-compatible client API, so Mastodon apps can be used to browse the archive.  It's a
+// read-mostly subset of the real thing: https://docs.joinmastodon.org/methods/
+//
+// Mastodon's `/api/v1/lists` clashes with the JSON API's, so this is served on its own address
+// rather than by the main router.  Apps log in with OAuth as usual, but every token is accepted;
+// it's only meant to be used locally.
+//
+// Supported endpoints:
+//   - GET /api/v1/timelines/home
+//   - GET /api/v1/timelines/list/:list_id
+//   - GET /api/v1/timelines/tag/:hashtag
+//   - GET /api/v1/accounts/verify_credentials
+//   - GET /api/v1/accounts/:id
+//   - GET /api/v1/accounts/:id/statuses
+//   - GET /api/v1/statuses/:id
+//   - GET /api/v1/statuses/:id/context
+//   - GET /api/v2/search
+//   - GET /api/v1/lists
+//   - GET /api/v1/lists/:id
+//
+// Plus enough of the instance, app-registration and OAuth endpoints for apps to log in.
+func (app *Application) MastodonAPI(w http.ResponseWriter, r *http.Request) {
+	_span := tracing.GetActiveSpan(r.Context()).AddChild("mastodon_api")
+	defer _span.End()
+	app.TraceLog.Printf("'MastodonAPI' handler (path: %q)", r.URL.Path)
+
+	// Browser-based apps need CORS
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Expose-Headers", "Link")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(204)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	m := mastodon_converter{TweetTrove: NewTweetTrove(), base_url: get_base_url(r)}
+
+	switch {
+	case parts[0] == "content":
+		http.StripPrefix("/content", http.FileServer(http.Dir(app.Profile.ProfileDir))).ServeHTTP(w, r)
+	case len(parts) == 2 && parts[0] == "oauth":
+		app.mastodon_oauth(w, r, parts[1])
+	case len(parts) < 3 || parts[0] != "api":
+		app.api_error(w, 404, "Record not found")
+	case parts[1] == "v1":
+		app.mastodon_api_v1(w, r, m, parts[2:])
+	case parts[1] == "v2" && len(parts) == 3 && parts[2] == "search":
+		app.mastodon_search(w, r, m)
+	case parts[1] == "v2" && len(parts) == 3 && parts[2] == "instance":
+		app.api_write_json(w, 200, app.mastodon_instance(r))
+	default:
+		app.api_error(w, 404, "Record not found")
+	}
+}
+
+func (app *Application) mastodon_api_v1(w http.ResponseWriter, r *http.Request, m mastodon_converter, parts []string) {
+	switch {
+	case len(parts) == 1 && parts[0] == "instance":
+		app.api_write_json(w, 200, app.mastodon_instance(r))
+	case len(parts) == 1 && parts[0] == "apps":
+		app.mastodon_register_app(w, r)
+	case len(parts) == 2 && parts[0] == "timelines" && parts[1] == "home":
+		app.mastodon_timeline(w, r, m, NewTimelineCursor())
+	case len(parts) == 3 && parts[0] == "timelines" && parts[1] == "list":
+		list_id, err := strconv.Atoi(parts[2])
+		if err != nil {
+			app.api_error(w, 404, "Record not found")
+			return
+		}
+		if _, err := app.Profile.GetListById(ListID(list_id)); errors.Is(err, ErrNotInDatabase) {
+			app.api_error(w, 404, "Record not found")
+			return
+		}
+		app.mastodon_timeline(w, r, m, NewListCursor(ListID(list_id)))
+	case len(parts) == 3 && parts[0] == "timelines" && parts[1] == "tag":
+		c, err := NewCursorFromSearchQuery("#" + parts[2])
+		if err != nil {
+			app.api_error(w, 422, err.Error())
+			return
+		}
+		app.mastodon_timeline(w, r, m, c)
+	case len(parts) == 2 && parts[0] == "accounts" && parts[1] == "verify_credentials":
+		account := m.Account(app.ActiveUser)
+		account.Source = &MastodonAccountSource{Privacy: "public", Fields: []MastodonField{}}
+		app.api_write_json(w, 200, account)
+	case len(parts) >= 2 && parts[0] == "accounts":
+		app.mastodon_account(w, r, m, parts[1], parts[2:])
+	case len(parts) == 2 && parts[0] == "statuses":
+		app.mastodon_status(w, r, m, parts[1])
+	case len(parts) == 3 && parts[0] == "statuses" && parts[2] == "context":
+		app.mastodon_status_context(w, r, m, parts[1])
+	case len(parts) == 1 && parts[0] == "lists":
+		ret := []MastodonList{}
+		for _, l := range app.Profile.GetAllLists() {
+			ret = append(ret, mastodon_list(l))
+		}
+		app.api_write_json(w, 200, ret)
+	case len(parts) == 2 && parts[0] == "lists":
+		list_id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			app.api_error(w, 404, "Record not found")
+			return
+		}
+		list, err := app.Profile.GetListById(ListID(list_id))
+		if errors.Is(err, ErrNotInDatabase) {
+			app.api_error(w, 404, "Record not found")
+			return
+		}
+		panic_if(err)
+		app.api_write_json(w, 200, mastodon_list(list))
+	case len(parts) == 1 && (parts[0] == "custom_emojis" || parts[0] == "filters" || parts[0] == "announcements" ||
+		parts[0] == "notifications" || parts[0] == "conversations" || parts[0] == "follow_requests"):
+		// Not supported, but apps expect them to exist
+		app.api_write_json(w, 200, []struct{}{})
+	default:
+		app.api_error(w, 404, "Record not found")
+	}
+}
+
+func mastodon_list(l List) MastodonList {
+	return MastodonList{ID: fmt.Sprint(l.ID), Title: l.Name, RepliesPolicy: "list"}
+}
+
+// Timelines
+// ---------
+
+// Mastodon clients paginate using status IDs (`max_id`, `since_id` and `min_id`), but feeds are
+// ordered by time, not ID.  So look up when the given status was posted (or retweeted).
+func (app *Application) mastodon_status_chrono(id_str string) (Timestamp, error) {
+	val, err := strconv.Atoi(id_str)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid status ID %q", id_str)
+	}
+	if tweet, err := app.Profile.GetTweetById(TweetID(val)); err == nil {
+		return tweet.PostedAt, nil
+	} else if !errors.Is(err, ErrNotInDatabase) {
+		panic(err)
+	}
+	retweet, err := app.Profile.GetRetweetById(TweetID(val))
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("status not found: %q", id_str)
+	}
+	return retweet.RetweetedAt, nil
+}
+
+func (app *Application) mastodon_timeline(w http.ResponseWriter, r *http.Request, m mastodon_converter, c Cursor) {
+	query := r.URL.Query()
+	c.PageSize = 20
+	if limit := query.Get("limit"); limit != "" {
+		val, err := strconv.Atoi(limit)
+		if err != nil || val <= 0 {
+			app.api_error(w, 422, "Invalid limit")
+			return
+		}
+		c.PageSize = min(val, 40)
+	}
+	if max_id := query.Get("max_id"); max_id != "" {
+		chrono, err := app.mastodon_status_chrono(max_id)
+		if err != nil {
+			app.api_error(w, 422, err.Error())
+			return
+		}
+		c.CursorPosition = CURSOR_MIDDLE
+		c.CursorValue = int(chrono.UnixMilli())
+	}
+	for _, param := range []string{"since_id", "min_id"} {
+		if since_id := query.Get(param); since_id != "" {
+			chrono, err := app.mastodon_status_chrono(since_id)
+			if err != nil {
+				app.api_error(w, 422, err.Error())
+				return
+			}
+			c.SinceTimestamp = chrono
+		}
+	}
+	if query.Get("only_media") == "true" {
+		c.FilterMedia = REQUIRE
+	}
+
+	span := tracing.GetActiveSpan(r.Context()).AddChild("cursor_next_page")
+	c.ShowMuted = is_showing_muted(r)
+	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
+	if err != nil && !errors.Is(err, ErrEndOfFeed) {
+		panic(err)
+	}
+	span.End()
+
+	m.TweetTrove = feed.TweetTrove
+	ret := []MastodonStatus{}
+	for _, item := range feed.Items {
+		if item.TweetID == TweetID(0) {
+			continue
+		}
+		ret = append(ret, m.FeedItemStatus(item))
+	}
+
+	// Pagination links
+	if len(ret) > 0 {
+		links := []string{}
+		next_query := url.Values{}
+		for k, v := range query {
+			if k != "max_id" && k != "since_id" && k != "min_id" {
+				next_query[k] = v
+			}
+		}
+		prev_query := url.Values{}
+		for k, v := range next_query {
+			prev_query[k] = v
+		}
+		if feed.CursorBottom.CursorPosition != CURSOR_END {
+			next_query.Set("max_id", ret[len(ret)-1].ID)
+			links = append(links, fmt.Sprintf(`<%s%s?%s>; rel="next"`, m.base_url, r.URL.Path, next_query.Encode()))
+		}
+		prev_query.Set("min_id", ret[0].ID)
+		links = append(links, fmt.Sprintf(`<%s%s?%s>; rel="prev"`, m.base_url, r.URL.Path, prev_query.Encode()))
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+// Accounts
+// --------
+
+func (app *Application) mastodon_account(w http.ResponseWriter, r *http.Request, m mastodon_converter, id_str string, parts []string) {
+	user_id, err := strconv.Atoi(id_str)
+	if err != nil {
+		app.api_error(w, 404, "Record not found")
+		return
+	}
+	user, err := app.Profile.GetUserByID(UserID(user_id))
+	if errors.Is(err, ErrNotInDatabase) {
+		app.api_error(w, 404, "Record not found")
+		return
+	}
+	panic_if(err)
+
+	switch {
+	case len(parts) == 0:
+		app.api_write_json(w, 200, m.Account(user))
+	case len(parts) == 1 && parts[0] == "statuses":
+		query := r.URL.Query()
+		if query.Get("pinned") == "true" {
+			ret := []MastodonStatus{}
+			if user.PinnedTweetID != TweetID(0) {
+				if tweet, err := app.Profile.GetTweetById(user.PinnedTweetID); err == nil {
+					m.Tweets[tweet.ID] = tweet
+					m.Users[user.ID] = user
+					ret = append(ret, m.Status(tweet))
+				}
+			}
+			app.api_write_json(w, 200, ret)
+			return
+		}
+		c := NewUserFeedCursor(user.Handle)
+		if query.Get("exclude_replies") == "true" {
+			c.FilterReplies = EXCLUDE
+		}
+		if query.Get("exclude_reblogs") == "true" {
+			c.FilterRetweets = EXCLUDE
+		}
+		app.mastodon_timeline(w, r, m, c)
+	default:
+		app.api_error(w, 404, "Record not found")
+	}
+}
+
+// Statuses
+// --------
+
+func (app *Application) mastodon_get_tweet_detail(w http.ResponseWriter, r *http.Request, id_str string) (TweetDetailView, bool) {
+	val, err := strconv.Atoi(id_str)
+	if err != nil {
+		app.api_error(w, 404, "Record not found")
+		return TweetDetailView{}, false
+	}
+	twt_detail, err := app.Profile.GetTweetDetail(TweetID(val), app.ActiveUser.ID, is_showing_muted(r))
+	if errors.Is(err, ErrNotInDatabase) {
+		app.api_error(w, 404, "Record not found")
+		return TweetDetailView{}, false
+	}
+	panic_if(err)
+	return twt_detail, true
+}
+
+func (app *Application) mastodon_status(w http.ResponseWriter, r *http.Request, m mastodon_converter, id_str string) {
+	// Could be a retweet
+	if val, err := strconv.Atoi(id_str); err == nil {
+		if retweet, err := app.Profile.GetRetweetById(TweetID(val)); err == nil {
+			twt_detail, is_ok := app.mastodon_get_tweet_detail(w, r, fmt.Sprint(retweet.TweetID))
+			if !is_ok {
+				return
+			}
+			m.TweetTrove = twt_detail.TweetTrove
+			m.Retweets[retweet.RetweetID] = retweet
+			if _, is_ok := m.Users[retweet.RetweetedByID]; !is_ok {
+				retweeter, err := app.Profile.GetUserByID(retweet.RetweetedByID)
+				panic_if(err)
+				m.Users[retweeter.ID] = retweeter
+			}
+			app.api_write_json(w, 200, m.FeedItemStatus(FeedItem{TweetID: retweet.TweetID, RetweetID: retweet.RetweetID}))
+			return
+		}
+	}
+
+	twt_detail, is_ok := app.mastodon_get_tweet_detail(w, r, id_str)
+	if !is_ok {
+		return
+	}
+	m.TweetTrove = twt_detail.TweetTrove
+	app.api_write_json(w, 200, m.Status(m.Tweets[twt_detail.MainTweetID]))
+}
+
+func (app *Application) mastodon_status_context(w http.ResponseWriter, r *http.Request, m mastodon_converter, id_str string) {
+	twt_detail, is_ok := app.mastodon_get_tweet_detail(w, r, id_str)
+	if !is_ok {
+		return
+	}
+	m.TweetTrove = twt_detail.TweetTrove
+
+	ret := MastodonContext{Ancestors: []MastodonStatus{}, Descendants: []MastodonStatus{}}
+	for _, id := range twt_detail.ParentIDs {
+		ret.Ancestors = append(ret.Ancestors, m.Status(m.Tweets[id]))
+	}
+	for _, id := range twt_detail.ThreadIDs {
+		ret.Descendants = append(ret.Descendants, m.Status(m.Tweets[id]))
+	}
+	for _, chain := range twt_detail.ReplyChains {
+		for _, id := range chain {
+			ret.Descendants = append(ret.Descendants, m.Status(m.Tweets[id]))
+		}
+	}
+	app.api_write_json(w, 200, ret)
+}
+
+// Search
+// ------
+
+func (app *Application) mastodon_search(w http.ResponseWriter, r *http.Request, m mastodon_converter) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	search_type := query.Get("type")
+	limit := 20
+	if limit_str := query.Get("limit"); limit_str != "" {
+		val, err := strconv.Atoi(limit_str)
+		if err != nil || val <= 0 {
+			app.api_error(w, 422, "Invalid limit")
+			return
+		}
+		limit = min(val, 40)
+	}
+	offset, err := strconv.Atoi(query.Get("offset"))
+	if err != nil {
+		offset = 0
+	}
+
+	ret := MastodonSearchResults{Accounts: []MastodonAccount{}, Statuses: []MastodonStatus{}, Hashtags: []MastodonTag{}}
+	if q == "" {
+		app.api_write_json(w, 200, ret)
+		return
+	}
+
+	if search_type == "" || search_type == "accounts" {
+		users := app.Profile.SearchUsers(strings.TrimPrefix(q, "@"))
+		for i, u := range users {
+			if i < offset {
+				continue
+			}
+			if len(ret.Accounts) == limit {
+				break
+			}
+			ret.Accounts = append(ret.Accounts, m.Account(u))
+		}
+	}
+
+	if search_type == "" || search_type == "statuses" {
+		c, err := NewCursorFromSearchQuery(q)
+		if err != nil {
+			app.api_error(w, 422, err.Error())
+			return
+		}
+		c.PageSize = offset + limit
+		c.ShowMuted = is_showing_muted(r)
+		feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
+		if err != nil && !errors.Is(err, ErrEndOfFeed) {
+			panic(err)
+		}
+		m.TweetTrove = feed.TweetTrove
+		for i, item := range feed.Items {
+			if i >= offset && item.TweetID != TweetID(0) {
+				ret.Statuses = append(ret.Statuses, m.FeedItemStatus(item))
+			}
+		}
+	}
+
+	if (search_type == "" || search_type == "hashtags") && strings.HasPrefix(q, "#") && !strings.Contains(q, " ") {
+		ret.Hashtags = append(ret.Hashtags, MastodonTag{
+			Name: q[1:],
+			URL:  fmt.Sprintf("https://twitter.com/hashtag/%s", q[1:]),
+		})
+	}
+
+	app.api_write_json(w, 200, ret)
+}
+
+// Instance info and logging in
+// ----------------------------
+
+func (app *Application) mastodon_instance(r *http.Request) map[string]interface{} {
+	return map[string]interface{}{
+		"uri":               r.Host,
+		"domain":            r.Host,
+		"title":             "Offline Twitter",
+		"short_description": "A local archive of Twitter",
+		"description":       "A local archive of Twitter",
+		"email":             "",
+		"version":           "4.0.0 (compatible; Offline Twitter)",
+		"urls":              map[string]string{},
+		"stats":             map[string]int{"user_count": 1, "status_count": 0, "domain_count": 0},
+		"thumbnail":         nil,
+		"languages":         []string{"en"},
+		"registrations":     false,
+		"approval_required": false,
+		"invites_enabled":   false,
+		"contact_account":   nil,
+		"rules":             []struct{}{},
+	}
+}
+
+func (app *Application) mastodon_register_app(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		app.api_error(w, 405, "Method not allowed")
+		return
+	}
+	panic_if(r.ParseForm())
+	app.api_write_json(w, 200, map[string]string{
+		"id":            "1",
+		"name":          r.Form.Get("client_name"),
+		"website":       r.Form.Get("website"),
+		"redirect_uri":  r.Form.Get("redirect_uris"),
+		"client_id":     "offline-twitter",
+		"client_secret": "offline-twitter",
+		"vapid_key":     "",
+	})
+}
+
+const MASTODON_ACCESS_TOKEN = "offline-twitter"
+
+func (app *Application) mastodon_oauth(w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "authorize":
+		// No login form; just grant it
+		redirect_uri := r.URL.Query().Get("redirect_uri")
+		if redirect_uri == "" || redirect_uri == "urn:ietf:wg:oauth:2.0:oob" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintf(w, "Authorization code: %s\n", MASTODON_ACCESS_TOKEN)
+			return
+		}
+		u, err := url.Parse(redirect_uri)
+		if err != nil {
+			app.api_error(w, 400, "Invalid redirect_uri")
+			return
+		}
+		q := u.Query()
+		q.Set("code", MASTODON_ACCESS_TOKEN)
+		if state := r.URL.Query().Get("state"); state != "" {
+			q.Set("state", state)
+		}
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.String(), 302)
+	case "token":
+		if r.Method != "POST" {
+			app.api_error(w, 405, "Method not allowed")
+			return
+		}
+		app.api_write_json(w, 200, map[string]interface{}{
+			"access_token": MASTODON_ACCESS_TOKEN,
+			"token_type":   "Bearer",
+			"scope":        "read",
+			"created_at":   time.Now().Unix(),
+		})
+	case "revoke":
+		app.api_write_json(w, 200, map[string]string{})
+	default:
+		app.api_error(w, 404, "Record not found")
+	}
+}
+
+// Serve the Mastodon-compatible API on a separate address (see `MastodonAPI`)
+func (app *Application) RunMastodonAPI(address string) {
+	srv := &http.Server{
+		Addr:     address,
+		ErrorLog: app.ErrorLog,
+		Handler:  app.MastodonAPIHandler(),
+		TLSConfig: &tls.Config{
+			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		},
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	app.InfoLog.Printf("Starting Mastodon API server on %s", address)
+	err := srv.ListenAndServe()
+	app.ErrorLog.Fatal(err)
+}
+
+func (app *Application) MastodonAPIHandler() http.Handler {
+	var ret http.Handler = http.HandlerFunc(app.MastodonAPI)
+	for i := range app.Middlewares {
+		ret = app.Middlewares[i](ret)
+	}
+	return ret
+}
@@ -0,0 +1,195 @@
+package webserver_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/webserver"
+)
+
+// Run an HTTP request against the Mastodon API and return the response
+func do_mastodon_request(req *http.Request) *http.Response {
+	recorder := httptest.NewRecorder()
+	app := make_testing_app(nil)
+	app.MastodonAPIHandler().ServeHTTP(recorder, req)
+	return recorder.Result()
+}
+
+func TestMastodonHomeTimeline(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_mastodon_request(httptest.NewRequest("GET", "/api/v1/timelines/home", nil))
+	var page1 []webserver.MastodonStatus
+	decode_api_response(t, resp, 200, &page1)
+	require.Len(page1, 20)
+	is_reblog_found := false
+	for _, s := range page1 {
+		assert.NotEqual("", s.Account.ID)
+		if s.Reblog != nil {
+			is_reblog_found = true
+			assert.NotEqual(s.ID, s.Reblog.ID)
+			assert.NotEqual(s.Account.ID, "")
+		}
+	}
+	assert.True(is_reblog_found)
+
+	// Follow the "next" link
+	link := resp.Header.Get("Link")
+	require.Contains(link, `rel="next"`)
+	next_url, _, _ := strings.Cut(strings.TrimPrefix(link, "<"), ">")
+	parsed_url, err := url.Parse(next_url)
+	require.NoError(err)
+	assert.Equal(page1[len(page1)-1].ID, parsed_url.Query().Get("max_id"))
+
+	var page2 []webserver.MastodonStatus
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", parsed_url.RequestURI(), nil)), 200, &page2)
+	require.NotEmpty(page2)
+	for _, s := range page2 {
+		for _, s1 := range page1 {
+			assert.NotEqual(s1.ID, s.ID)
+		}
+		assert.True(s.CreatedAt <= page1[len(page1)-1].CreatedAt)
+	}
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/timelines/home?max_id=1234", nil)), 422, &api_err)
+}
+
+func TestMastodonAccount(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	user, err := profile.GetUserByHandle("Cernovich")
+	require.NoError(err)
+
+	var account webserver.MastodonAccount
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/accounts/"+fmt.Sprint(user.ID), nil)), 200, &account)
+	assert.Equal("Cernovich", account.Username)
+	assert.Equal(user.DisplayName, account.DisplayName)
+	assert.Equal(user.FollowersCount, account.FollowersCount)
+
+	var statuses []webserver.MastodonStatus
+	req := httptest.NewRequest("GET", "/api/v1/accounts/"+fmt.Sprint(user.ID)+"/statuses?exclude_reblogs=true", nil)
+	decode_api_response(t, do_mastodon_request(req), 200, &statuses)
+	require.NotEmpty(statuses)
+	for _, s := range statuses {
+		assert.Nil(s.Reblog)
+		assert.Equal(account.ID, s.Account.ID)
+	}
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/accounts/1234", nil)), 404, &api_err)
+}
+
+func TestMastodonStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Video tweet (an animated GIF)
+	var status webserver.MastodonStatus
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/statuses/1453461248142495744", nil)), 200, &status)
+	assert.Equal("1453461248142495744", status.ID)
+	require.Len(status.MediaAttachments, 1)
+	assert.Equal("gifv", status.MediaAttachments[0].Type)
+	assert.Equal("http://example.com/content/videos/1453461248142495744.mp4", status.MediaAttachments[0].URL)
+
+	// Quote tweet
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/statuses/1439068749336748043", nil)), 200, &status)
+	assert.Contains(status.Content, "/status/1439068429768605696")
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/statuses/1234", nil)), 404, &api_err)
+}
+
+func TestMastodonStatusContext(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var context webserver.MastodonContext
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/statuses/1413658466795737091/context", nil)), 200, &context)
+	require.NotEmpty(context.Ancestors)
+	assert.Equal("1413657324267311104", context.Ancestors[len(context.Ancestors)-1].ID)
+	assert.NotNil(context.Descendants)
+
+	// From the parent's side
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/statuses/1413657324267311104/context", nil)), 200, &context)
+	is_found := false
+	for _, s := range context.Descendants {
+		if s.ID == "1413658466795737091" {
+			is_found = true
+			require.NotNil(s.InReplyToID)
+			assert.Equal("1413657324267311104", *s.InReplyToID)
+		}
+	}
+	assert.True(is_found)
+}
+
+func TestMastodonSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	var results webserver.MastodonSearchResults
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v2/search?q=who%20are&type=statuses", nil)), 200, &results)
+	assert.Len(results.Statuses, 3)
+	assert.Len(results.Accounts, 0)
+
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v2/search?q=cernovich&type=accounts", nil)), 200, &results)
+	assert.Len(results.Statuses, 0)
+	assert.NotEmpty(results.Accounts)
+
+	var api_err webserver.APIError
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v2/search?q=since:fawejk", nil)), 422, &api_err)
+}
+
+func TestMastodonLists(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var lists []webserver.MastodonList
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/lists", nil)), 200, &lists)
+	require.True(len(lists) >= 2)
+	assert.Equal("1", lists[0].ID)
+	assert.Equal("Offline Follows", lists[0].Title)
+
+	var statuses []webserver.MastodonStatus
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/timelines/list/1", nil)), 200, &statuses)
+	assert.NotEmpty(statuses)
+}
+
+func TestMastodonLogin(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var instance map[string]interface{}
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/instance", nil)), 200, &instance)
+	assert.Contains(instance["version"], "compatible")
+
+	req := httptest.NewRequest("POST", "/api/v1/apps", strings.NewReader("client_name=Test&redirect_uris=http://localhost/callback"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var registered_app map[string]string
+	decode_api_response(t, do_mastodon_request(req), 200, &registered_app)
+	assert.Equal("Test", registered_app["name"])
+
+	resp := do_mastodon_request(httptest.NewRequest("GET", "/oauth/authorize?redirect_uri=http://localhost/callback&state=asdf", nil))
+	require.Equal(302, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(err)
+	assert.Equal("localhost", location.Host)
+	assert.NotEqual("", location.Query().Get("code"))
+	assert.Equal("asdf", location.Query().Get("state"))
+
+	var token map[string]interface{}
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("POST", "/oauth/token", nil)), 200, &token)
+	assert.Equal("Bearer", token["token_type"])
+
+	var account webserver.MastodonAccount
+	decode_api_response(t, do_mastodon_request(httptest.NewRequest("GET", "/api/v1/accounts/verify_credentials", nil)), 200, &account)
+	assert.NotNil(account.Source)
+}
@@ -0,0 +1,120 @@
+package webserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/tracing"
+)
+
+type MutesData struct {
+	Mutes          []Mute
+	IsShowingMuted bool
+}
+
+// Set by the "show muted tweets" button on the mutes page
+const SHOW_MUTED_COOKIE = "show-muted"
+
+// Whether to ignore mute rules for this request: if the "show muted tweets" cookie is set, or (for
+// API and feed clients) the `show-muted=true` query param
+func is_showing_muted(r *http.Request) bool {
+	if r.URL.Query().Get("show-muted") == "true" {
+		return true
+	}
+	cookie, err := r.Cookie(SHOW_MUTED_COOKIE)
+	return err == nil && cookie.Value == "true"
+}
+
+func (app *Application) Mutes(w http.ResponseWriter, r *http.Request) {
+	_span := tracing.GetActiveSpan(r.Context()).AddChild("mutes")
+	defer _span.End()
+	app.TraceLog.Printf("'Mutes' handler (path: %q)", r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// Toggle whether mute rules are applied
+	if parts[0] == "show-muted" {
+		if r.Method != "POST" {
+			app.error_404(w, r)
+			return
+		}
+		cookie := http.Cookie{Name: SHOW_MUTED_COOKIE, Value: "true", Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode}
+		if is_showing_muted(r) {
+			cookie.Value = ""
+			cookie.MaxAge = -1 // Delete it
+		}
+		http.SetCookie(w, &cookie)
+		http.Redirect(w, r, "/mutes", 303)
+		return
+	}
+
+	// Unmute
+	if parts[0] != "" {
+		if r.Method != "DELETE" {
+			app.error_404(w, r)
+			return
+		}
+		_id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			app.error_400_with_message(w, r, "Mute ID must be a number")
+			return
+		}
+		app.Profile.DeleteMute(MuteID(_id))
+		// 303 so the redirect isn't another DELETE
+		http.Redirect(w, r, "/mutes", 303)
+		return
+	}
+
+	// New mute
+	if r.Method == "POST" {
+		var formdata struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		data, err := io.ReadAll(r.Body)
+		panic_if(err)
+		err = json.Unmarshal(data, &formdata)
+		if err != nil {
+			app.error_400_with_message(w, r, "Invalid form data")
+			return
+		}
+		m := Mute{Type: MuteType(formdata.Type), Text: formdata.Text}
+		if m.Type.IsUserMute() {
+			// User mutes are entered as a handle
+			user, err := app.Profile.GetUserByHandle(UserHandle(strings.TrimPrefix(strings.TrimSpace(m.Text), "@")))
+			if err != nil {
+				app.error_400_with_message(w, r, "Unknown user: "+m.Text)
+				return
+			}
+			m.UserID = user.ID
+		}
+		if err := app.Profile.SaveMute(&m); err != nil {
+			app.error_400_with_message(w, r, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/mutes", 302)
+		return
+	}
+
+	// Mutes index
+	mutes := app.Profile.GetAllMutes()
+	trove := NewTweetTrove()
+	for _, m := range mutes {
+		if m.Type.IsUserMute() {
+			user, err := app.Profile.GetUserByID(m.UserID)
+			if err == nil {
+				trove.Users[user.ID] = user
+			}
+		}
+	}
+	app.buffered_render_page2(
+		w, r,
+		"tpl/mutes.tpl",
+		PageGlobalData{Title: "Mutes", TweetTrove: trove},
+		MutesData{Mutes: mutes, IsShowingMuted: is_showing_muted(r)},
+	)
+}
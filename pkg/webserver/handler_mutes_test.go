@@ -0,0 +1,132 @@
+package webserver_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"net/http/httptest"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/webserver"
+)
+
+func TestMuteThenUnmute(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	count_search_results_for_request := func(req *http.Request) int {
+		resp := do_request(req)
+		require.Equal(resp.StatusCode, 200)
+		root, err := html.Parse(resp.Body)
+		require.NoError(err)
+		return len(cascadia.QueryAll(root, selector(".timeline > .tweet")))
+	}
+	count_search_results := func() int {
+		return count_search_results_for_request(httptest.NewRequest("GET", "/search/who%20are", nil))
+	}
+	num_results := count_search_results()
+	require.Greater(num_results, 0)
+
+	// Mute it
+	resp := do_request(httptest.NewRequest("POST", "/mutes",
+		strings.NewReader(`{"type": "keyword", "text": "who"}`)))
+	require.Equal(resp.StatusCode, 302)
+	assert.Equal("/mutes", resp.Header.Get("Location"))
+	assert.Equal(0, count_search_results())
+
+	// Showing muted tweets only applies to requests with the cookie (or query param)
+	resp = do_request(httptest.NewRequest("POST", "/mutes/show-muted", nil))
+	require.Equal(resp.StatusCode, 303)
+	assert.Equal("/mutes", resp.Header.Get("Location"))
+	cookies := resp.Cookies()
+	require.Len(cookies, 1)
+	assert.Equal(webserver.SHOW_MUTED_COOKIE, cookies[0].Name)
+	req := httptest.NewRequest("GET", "/search/who%20are", nil)
+	req.AddCookie(cookies[0])
+	assert.Equal(num_results, count_search_results_for_request(req))
+	assert.Equal(num_results, count_search_results_for_request(httptest.NewRequest("GET", "/search/who%20are?show-muted=true", nil)))
+	assert.Equal(0, count_search_results())
+
+	// Toggling it again deletes the cookie
+	req = httptest.NewRequest("POST", "/mutes/show-muted", nil)
+	req.AddCookie(cookies[0])
+	resp = do_request(req)
+	require.Equal(resp.StatusCode, 303)
+	require.Len(resp.Cookies(), 1)
+	assert.True(resp.Cookies()[0].MaxAge < 0)
+
+	// Should be on the mutes page
+	resp = do_request(httptest.NewRequest("GET", "/mutes", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err := html.Parse(resp.Body)
+	require.NoError(err)
+	var unmute_url string
+	for _, node := range cascadia.QueryAll(root, selector(".mute")) {
+		text := cascadia.Query(node, selector(".mute__text"))
+		if text != nil && text.FirstChild.Data == "who" {
+			for _, attr := range cascadia.Query(node, selector(".button--danger")).Attr {
+				if attr.Key == "hx-delete" {
+					unmute_url = attr.Val
+				}
+			}
+		}
+	}
+	require.NotEqual("", unmute_url)
+
+	// Can't mute it twice
+	resp = do_request(httptest.NewRequest("POST", "/mutes",
+		strings.NewReader(`{"type": "keyword", "text": "who"}`)))
+	assert.Equal(resp.StatusCode, 400)
+
+	// Unmute it
+	resp = do_request(httptest.NewRequest("DELETE", unmute_url, nil))
+	require.Equal(resp.StatusCode, 303)
+	assert.Equal("/mutes", resp.Header.Get("Location"))
+	assert.Equal(num_results, count_search_results())
+}
+
+func TestMuteUser(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	resp := do_request(httptest.NewRequest("POST", "/mutes",
+		strings.NewReader(`{"type": "retweets", "text": "@Cernovich"}`)))
+	require.Equal(resp.StatusCode, 302)
+
+	resp = do_request(httptest.NewRequest("GET", "/mutes", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err := html.Parse(resp.Body)
+	require.NoError(err)
+	var unmute_url string
+	for _, node := range cascadia.QueryAll(root, selector(".mute")) {
+		handle := cascadia.Query(node, selector(".author-info__handle"))
+		if handle != nil && handle.FirstChild.Data == "@Cernovich" {
+			for _, attr := range cascadia.Query(node, selector(".button--danger")).Attr {
+				if attr.Key == "hx-delete" {
+					unmute_url = attr.Val
+				}
+			}
+		}
+	}
+	require.NotEqual("", unmute_url)
+	resp = do_request(httptest.NewRequest("DELETE", unmute_url, nil))
+	assert.Equal(resp.StatusCode, 303)
+}
+
+func TestMuteInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := do_request(httptest.NewRequest("POST", "/mutes", strings.NewReader(`{"type": "user", "text": "@nobody_asdfasdf"}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/mutes", strings.NewReader(`{"type": "regex", "text": "(asdf"}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/mutes", strings.NewReader(`{"type": "asdf", "text": "asdf"}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("DELETE", "/mutes/asdf", nil))
+	assert.Equal(resp.StatusCode, 400)
+}
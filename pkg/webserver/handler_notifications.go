@@ -35,7 +35,7 @@ func (app *Application) Notifications(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	feed := app.Profile.GetNotificationsForUser(app.ActiveUser.ID, int64(cursor_val), 50) // TODO: parameterizable
+	feed := app.Profile.GetNotificationsForUser(app.ActiveUser.ID, int64(cursor_val), 50, is_showing_muted(r)) // TODO: parameterizable
 
 	if is_htmx(r) && cursor_val != 0 {
 		// It's a Show More request
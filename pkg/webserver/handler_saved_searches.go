@@ -0,0 +1,136 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/tracing"
+)
+
+func (app *Application) SavedSearches(w http.ResponseWriter, r *http.Request) {
+	_span := tracing.GetActiveSpan(r.Context()).AddChild("saved_searches")
+	defer _span.End()
+	app.TraceLog.Printf("'SavedSearches' handler (path: %q)", r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// New saved search
+	if parts[0] == "" {
+		if r.Method != "POST" {
+			app.error_404(w, r)
+			return
+		}
+		var formdata struct {
+			Name                  string `json:"name"`
+			Query                 string `json:"query"`
+			IsScrapedInBackground string `json:"is_scraped_in_background"` // Checkbox; absent if unchecked
+		}
+		data, err := io.ReadAll(r.Body)
+		panic_if(err)
+		err = json.Unmarshal(data, &formdata)
+		if err != nil {
+			app.error_400_with_message(w, r, "Invalid form data")
+			return
+		}
+		s := SavedSearch{
+			Name:                  strings.TrimSpace(formdata.Name),
+			Query:                 formdata.Query,
+			IsScrapedInBackground: formdata.IsScrapedInBackground != "",
+		}
+		if s.Name == "" {
+			app.error_400_with_message(w, r, "Saved search needs a name")
+			return
+		}
+		if err := app.Profile.SaveSavedSearch(&s); err != nil {
+			app.error_400_with_message(w, r, err.Error())
+			return
+		}
+		http.Redirect(w, r, saved_search_url(s), 302)
+		return
+	}
+
+	_id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		app.error_400_with_message(w, r, "Saved search ID must be a number")
+		return
+	}
+	s, err := app.Profile.GetSavedSearchById(SavedSearchID(_id))
+	if err != nil {
+		app.error_404(w, r)
+		return
+	}
+	switch r.Method {
+	case "DELETE":
+		app.Profile.DeleteSavedSearch(s.ID)
+		// 303 so the redirect isn't another DELETE
+		http.Redirect(w, r, saved_search_url(s), 303)
+	default:
+		// The search page marks it as viewed
+		http.Redirect(w, r, saved_search_url(s), 302)
+	}
+}
+
+func saved_search_url(s SavedSearch) string {
+	return fmt.Sprintf("/search/%s", url.PathEscape(s.Query))
+}
+
+// How long saved searches' new-result counts are cached for.  Counting runs each saved search, and the
+// counts are on every page (and polled by the nav sidebar), so they aren't recounted every time.
+const SAVED_SEARCH_COUNTS_CACHE_TIME = 1 * time.Minute
+
+type saved_search_count struct {
+	query            string
+	last_viewed_at   Timestamp
+	user_id          UserID
+	count            int
+	is_query_invalid bool
+	counted_at       time.Time
+}
+
+// Cached new-result counts, by saved search ID.  A count is only used if the saved search's query
+// and last-viewed time (and the active user) are the same as when it was counted.
+type saved_search_counts_cache struct {
+	sync.Mutex
+	counts map[SavedSearchID]saved_search_count
+}
+
+// Get all the saved searches, with how many new results each one has (for the nav sidebar)
+func (app *Application) get_saved_searches_with_counts() []SavedSearch {
+	ret := app.Profile.GetAllSavedSearches()
+
+	app.saved_search_counts.Lock()
+	defer app.saved_search_counts.Unlock()
+	for i := range ret {
+		cached, is_ok := app.saved_search_counts.counts[ret[i].ID]
+		if is_ok && cached.query == ret[i].Query && cached.last_viewed_at.Equal(ret[i].LastViewedAt.Time) &&
+			cached.user_id == app.ActiveUser.ID && time.Since(cached.counted_at) < SAVED_SEARCH_COUNTS_CACHE_TIME {
+			ret[i].NumNewResults = cached.count
+			ret[i].IsQueryInvalid = cached.is_query_invalid
+			continue
+		}
+		count, err := app.Profile.CountNewSavedSearchResults(ret[i], app.ActiveUser.ID)
+		if err != nil {
+			// Flag it in the nav sidebar, rather than making it look like there's nothing new
+			app.ErrorLog.Print(err)
+			ret[i].IsQueryInvalid = true
+		}
+		ret[i].NumNewResults = count
+		app.saved_search_counts.counts[ret[i].ID] = saved_search_count{
+			query:            ret[i].Query,
+			last_viewed_at:   ret[i].LastViewedAt,
+			user_id:          app.ActiveUser.ID,
+			count:            ret[i].NumNewResults,
+			is_query_invalid: ret[i].IsQueryInvalid,
+			counted_at:       time.Now(),
+		}
+	}
+	return ret
+}
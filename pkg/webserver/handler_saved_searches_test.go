@@ -0,0 +1,92 @@
+package webserver_test
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"testing"
+
+	"net/http/httptest"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestSaveSearchThenDelete(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	query := "to:spacex filter:replies"
+	search_url := fmt.Sprintf("/search/%s", url.PathEscape(query))
+	name := fmt.Sprintf("Test Saved Search %d", rand.Int())
+
+	// Not saved yet
+	resp := do_request(httptest.NewRequest("GET", search_url, nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err := html.Parse(resp.Body)
+	require.NoError(err)
+	assert.NotNil(cascadia.Query(root, selector("#saveSearchDialog")))
+	assert.Nil(cascadia.Query(root, selector(".saved-search__name")))
+
+	// Save it
+	resp = do_request(httptest.NewRequest("POST", "/saved-searches",
+		strings.NewReader(fmt.Sprintf(`{"name": %q, "query": %q}`, name, query))))
+	require.Equal(resp.StatusCode, 302)
+	assert.Equal(search_url, resp.Header.Get("Location"))
+
+	// Should be in the nav sidebar
+	resp = do_request(httptest.NewRequest("GET", "/timeline", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err = html.Parse(resp.Body)
+	require.NoError(err)
+	var saved_search_link string
+	for _, node := range cascadia.QueryAll(root, selector("#nav-sidebar a")) {
+		label := cascadia.Query(node, selector(".nav-sidebar__saved-search label"))
+		if label != nil && label.FirstChild.Data == name {
+			for _, attr := range node.Attr {
+				if attr.Key == "href" {
+					saved_search_link = attr.Val
+				}
+			}
+		}
+	}
+	require.NotEqual("", saved_search_link)
+
+	// The link goes to the search page, which shows that it's saved
+	resp = do_request(httptest.NewRequest("GET", saved_search_link, nil))
+	require.Equal(resp.StatusCode, 302)
+	assert.Equal(search_url, resp.Header.Get("Location"))
+	resp = do_request(httptest.NewRequest("GET", search_url, nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err = html.Parse(resp.Body)
+	require.NoError(err)
+	name_node := cascadia.Query(root, selector(".saved-search__name"))
+	require.NotNil(name_node)
+	assert.Equal("Saved search: "+name, name_node.FirstChild.Data)
+
+	// Names have to be unique
+	resp = do_request(httptest.NewRequest("POST", "/saved-searches",
+		strings.NewReader(fmt.Sprintf(`{"name": %q, "query": "asdf"}`, name))))
+	assert.Equal(resp.StatusCode, 400)
+
+	// Delete it
+	resp = do_request(httptest.NewRequest("DELETE", saved_search_link, nil))
+	require.Equal(resp.StatusCode, 303)
+	assert.Equal(search_url, resp.Header.Get("Location"))
+	resp = do_request(httptest.NewRequest("GET", saved_search_link, nil))
+	assert.Equal(resp.StatusCode, 404)
+}
+
+func TestSaveSearchInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := do_request(httptest.NewRequest("POST", "/saved-searches", strings.NewReader(`{"name": "asdf", "query": "\"asdf"}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("POST", "/saved-searches", strings.NewReader(`{"name": "", "query": "asdf"}`)))
+	assert.Equal(resp.StatusCode, 400)
+	resp = do_request(httptest.NewRequest("GET", "/saved-searches/asdf", nil))
+	assert.Equal(resp.StatusCode, 400)
+}
@@ -20,6 +20,7 @@ type SearchPageData struct {
 	SortOrderOptions []string
 	IsUsersSearch    bool
 	UserIDs          []UserID
+	SavedSearch      SavedSearch // If this query is a saved search; otherwise, zero value
 	// TODO: fill out the search text in the search bar as well (needs modifying the base template)
 }
 
@@ -28,6 +29,7 @@ func NewSearchPageData() SearchPageData {
 	for i := 0; i < 4; i++ { // Don't include "Liked At" option which is #4
 		ret.SortOrderOptions = append(ret.SortOrderOptions, SortOrder(i).String())
 	}
+	ret.SortOrderOptions = append(ret.SortOrderOptions, SORT_ORDER_RELEVANCE.String())
 	return ret
 }
 
@@ -113,13 +115,15 @@ func (app *Application) Search(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Run scraper
-		trove, err := app.API.Search(search_text, 1) // TODO: parameterizable
-		if err != nil && !errors.Is(err, scraper.END_OF_FEED) {
-			app.ErrorLog.Print(err)
-			// TOOD: show error in UI
+		// Run scraper.  If the query is invalid, that's reported below.
+		if query, err := ToTwitterSearchQuery(search_text); err == nil && query != "" {
+			trove, err := app.API.Search(query, 1) // TODO: parameterizable
+			if err != nil && !errors.Is(err, scraper.END_OF_FEED) {
+				app.ErrorLog.Print(err)
+				// TOOD: show error in UI
+			}
+			app.full_save_tweet_trove(trove)
 		}
-		app.full_save_tweet_trove(trove)
 	}
 
 	c, err := NewCursorFromSearchQuery(search_text)
@@ -139,6 +143,7 @@ func (app *Application) Search(w http.ResponseWriter, r *http.Request) {
 	}
 
 	span := tracing.GetActiveSpan(r.Context()).AddChild("cursor_next_page")
+	c.ShowMuted = is_showing_muted(r)
 	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
 	if err != nil && !errors.Is(err, ErrEndOfFeed) {
 		panic(err)
@@ -154,6 +159,14 @@ func (app *Application) Search(w http.ResponseWriter, r *http.Request) {
 		// It's a Show More request
 		app.buffered_render_htmx2(w, r, "timeline", PageGlobalData{TweetTrove: data.Feed.TweetTrove, SearchText: search_text}, data)
 	} else {
+		// If it's a saved search, it's been viewed now
+		saved_search, err := app.Profile.GetSavedSearchByQuery(search_text)
+		if err == nil {
+			app.Profile.MarkSavedSearchViewed(saved_search.ID)
+			data.SavedSearch = saved_search
+		} else if !errors.Is(err, ErrNotInDatabase) {
+			panic(err)
+		}
 		app.buffered_render_page2(
 			w, r,
 			"tpl/search.tpl",
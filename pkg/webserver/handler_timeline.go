@@ -29,6 +29,7 @@ func (app *Application) OfflineTimeline(w http.ResponseWriter, r *http.Request)
 	}
 
 	span := tracing.GetActiveSpan(r.Context()).AddChild("cursor_next_page")
+	c.ShowMuted = is_showing_muted(r)
 	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
 	if err != nil && !errors.Is(err, ErrEndOfFeed) {
 		panic(err)
@@ -80,6 +81,7 @@ func (app *Application) Timeline(w http.ResponseWriter, r *http.Request) {
 	}
 
 	span := tracing.GetActiveSpan(r.Context()).AddChild("cursor_next_page")
+	c.ShowMuted = is_showing_muted(r)
 	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
 	if err != nil && !errors.Is(err, ErrEndOfFeed) {
 		panic(err)
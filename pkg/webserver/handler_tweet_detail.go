@@ -17,7 +17,23 @@ var ErrNotFound = errors.New("not found")
 
 type TweetDetailData struct {
 	TweetDetailView
-	MainTweetID TweetID
+	MainTweetID       TweetID
+	EngagementHistory []TweetEngagementSnapshot
+	Versions          []TweetVersionItem
+}
+
+// A version of an edited tweet, with the changes to its text from the previous scraped version
+type TweetVersionItem struct {
+	Number    int // Starting from 1
+	TweetID   TweetID
+	Tweet     Tweet
+	IsScraped bool
+	Diff      []TextDiffChunk
+}
+
+// Whether the main tweet has been edited, or is an edit of another tweet
+func (d TweetDetailData) IsEdited() bool {
+	return len(d.Versions) > 1
 }
 
 func NewTweetDetailData() TweetDetailData {
@@ -26,6 +42,56 @@ func NewTweetDetailData() TweetDetailData {
 	}
 }
 
+// Size of the engagement history sparkline, in SVG units
+const (
+	SPARKLINE_WIDTH  = 300
+	SPARKLINE_HEIGHT = 40
+)
+
+// Whether there's enough engagement history to graph it (i.e., the counts have changed at least once)
+func (d TweetDetailData) HasEngagementHistory() bool {
+	return len(d.EngagementHistory) > 1
+}
+func (d TweetDetailData) EngagementHistoryStart() TweetEngagementSnapshot {
+	return d.EngagementHistory[0]
+}
+func (d TweetDetailData) EngagementHistoryEnd() TweetEngagementSnapshot {
+	return d.EngagementHistory[len(d.EngagementHistory)-1]
+}
+
+// Get the points for an SVG polyline graphing the given count ("likes" or "retweets") over time.
+// It's scaled to fill the sparkline's height, so it shows the shape of the growth, not the size.
+func (d TweetDetailData) EngagementSparklinePoints(series string) string {
+	get_value := func(s TweetEngagementSnapshot) int {
+		switch series {
+		case "likes":
+			return s.NumLikes
+		case "retweets":
+			return s.NumRetweets
+		default:
+			panic(series)
+		}
+	}
+
+	start_time := d.EngagementHistoryStart().RecordedAt.Unix()
+	duration := d.EngagementHistoryEnd().RecordedAt.Unix() - start_time
+	if duration == 0 {
+		duration = 1
+	}
+	max_value := 1
+	for _, s := range d.EngagementHistory {
+		max_value = max(max_value, get_value(s))
+	}
+
+	points := []string{}
+	for _, s := range d.EngagementHistory {
+		x := float64(s.RecordedAt.Unix()-start_time) / float64(duration) * SPARKLINE_WIDTH
+		y := SPARKLINE_HEIGHT - float64(get_value(s))/float64(max_value)*SPARKLINE_HEIGHT
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
 func (app *Application) ensure_tweet(id TweetID, is_forced bool, is_conversation_required bool) (Tweet, error) {
 	is_available := false
 	is_needing_scrape := is_forced
@@ -155,10 +221,12 @@ func (app *Application) TweetDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	twt_detail, err := app.Profile.GetTweetDetail(data.MainTweetID, app.ActiveUser.ID)
+	twt_detail, err := app.Profile.GetTweetDetail(data.MainTweetID, app.ActiveUser.ID, is_showing_muted(r))
 	panic_if(err) // ErrNotInDatabase should be impossible, since we already fetched the single tweet successfully
 
 	data.TweetDetailView = twt_detail
+	data.EngagementHistory = app.Profile.GetTweetEngagementHistory(data.MainTweetID)
+	data.Versions = app.get_tweet_versions(data.MainTweetID)
 
 	app.buffered_render_page2(
 		w, r,
@@ -168,6 +236,34 @@ func (app *Application) TweetDetail(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// Get every version of a tweet, oldest first.  Each scraped version is diffed against the one before it.
+func (app *Application) get_tweet_versions(id TweetID) []TweetVersionItem {
+	ret := []TweetVersionItem{}
+	prev_text := ""
+	is_prev_scraped := false
+	for i, version_id := range app.Profile.GetTweetVersionIDs(id) {
+		item := TweetVersionItem{Number: i + 1, TweetID: version_id}
+		version, err := app.Profile.GetTweetById(version_id)
+		if err != nil && !errors.Is(err, ErrNotInDatabase) {
+			panic(err)
+		}
+		// Older versions can be saved as "newer-version-available" tombstones, with no content
+		item.IsScraped = err == nil && version.TombstoneType == "" && !version.IsStub
+		if item.IsScraped {
+			item.Tweet = version
+			if is_prev_scraped {
+				item.Diff = DiffText(prev_text, version.Text)
+			} else {
+				item.Diff = DiffText(version.Text, version.Text)
+			}
+			prev_text = version.Text
+			is_prev_scraped = true
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
+
 type key string
 
 const TWEET_KEY = key("tweet")
@@ -147,3 +147,60 @@ func TestTweetThread(t *testing.T) {
 	thread_chain := reply_chains[0]
 	assert.Len(cascadia.QueryAll(thread_chain, selector(".reply-tweet")), 7)
 }
+
+func TestTweetDetailEngagementHistory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// No history yet (only 1 snapshot)
+	resp := do_request(httptest.NewRequest("GET", "/tweet/1413773185296650241", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err := html.Parse(resp.Body)
+	require.NoError(err)
+	assert.Nil(cascadia.Query(root, selector(".engagement-history")))
+
+	// Add an older snapshot
+	profile.DB.MustExec(`
+		insert into tweet_engagement_snapshots (tweet_id, recorded_at, num_likes, num_retweets, num_replies, num_quote_tweets)
+		values (1413772782358433792, 1000, 0, 0, 0, 0)
+	`)
+	resp = do_request(httptest.NewRequest("GET", "/tweet/1413772782358433792", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err = html.Parse(resp.Body)
+	require.NoError(err)
+	assert.NotNil(cascadia.Query(root, selector(".engagement-history")))
+	assert.Len(cascadia.QueryAll(root, selector(".engagement-history__sparkline polyline")), 2)
+}
+
+func TestTweetDetailEditedTweet(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Not edited
+	resp := do_request(httptest.NewRequest("GET", "/tweet/1413647919215906817", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err := html.Parse(resp.Body)
+	require.NoError(err)
+	assert.Nil(cascadia.Query(root, selector(".tweet-versions")))
+
+	// Link two tweets as versions of each other, plus a newer version that hasn't been scraped
+	profile.DB.MustExec(`
+		insert into tweet_versions (tweet_id, original_tweet_id)
+		values (1413658466795737091, 1413658466795737091),
+		       (1413664406995566593, 1413658466795737091),
+		       (1413664406995566594, 1413658466795737091)
+		    on conflict do nothing
+	`)
+	resp = do_request(httptest.NewRequest("GET", "/tweet/1413664406995566593", nil))
+	require.Equal(resp.StatusCode, 200)
+	root, err = html.Parse(resp.Body)
+	require.NoError(err)
+	assert.NotNil(cascadia.Query(root, selector(".tweet-versions .edited-badge")))
+	versions := cascadia.QueryAll(root, selector(".tweet-version"))
+	require.Len(versions, 3)
+	assert.Len(cascadia.QueryAll(versions[0], selector(".text-diff__same")), 1)
+	assert.NotNil(cascadia.Query(versions[1], selector(".text-diff__added")))
+	assert.NotNil(cascadia.Query(versions[1], selector(".text-diff__removed")))
+	assert.Nil(cascadia.Query(versions[2], selector(".tweet-version__diff")))
+	assert.NotNil(cascadia.Query(versions[2], selector(".tweet-version__not-scraped")))
+}
@@ -14,8 +14,16 @@ import (
 type UserFeedData struct {
 	Feed
 	UserID
-	PinnedTweet Tweet
-	FeedType    string
+	PinnedTweet    Tweet
+	FeedType       string
+	ProfileHistory []ProfileHistoryItem
+}
+
+// An entry in a User's profile history, with what changed since the previous entry
+type ProfileHistoryItem struct {
+	UserProfileSnapshot
+	Changes     []ProfileFieldChange
+	IsFirstSeen bool
 }
 
 func (app *Application) UserFeed(w http.ResponseWriter, r *http.Request) {
@@ -119,6 +127,11 @@ func (app *Application) UserFeed(w http.ResponseWriter, r *http.Request) {
 	user.FollowersYouKnow = app.Profile.GetFollowersYouKnow(app.ActiveUser.ID, user.ID)
 	span.End()
 
+	if len(parts) > 1 && parts[1] == "profile_history" {
+		app.UserProfileHistory(w, r, user)
+		return
+	}
+
 	var c Cursor
 	if len(parts) > 1 && parts[1] == "likes" {
 		c = NewUserFeedLikesCursor(user.Handle)
@@ -138,6 +151,7 @@ func (app *Application) UserFeed(w http.ResponseWriter, r *http.Request) {
 	}
 
 	span = tracing.GetActiveSpan(r.Context()).AddChild("next_page")
+	c.ShowMuted = is_showing_muted(r)
 	feed, err := app.Profile.NextPage(c, app.ActiveUser.ID)
 	span.End()
 	if err != nil && !errors.Is(err, ErrEndOfFeed) {
@@ -306,3 +320,26 @@ func (app *Application) UserMutualFollowers(w http.ResponseWriter, r *http.Reque
 	data.HeaderUserID = user.ID
 	app.buffered_render_page2(w, r, "tpl/follows.tpl", PageGlobalData{Title: "Mutual followers", TweetTrove: trove}, data)
 }
+
+func (app *Application) UserProfileHistory(w http.ResponseWriter, r *http.Request, user User) {
+	data := UserFeedData{Feed: NewFeed(), UserID: user.ID, FeedType: "profile_history", ProfileHistory: []ProfileHistoryItem{}}
+	data.Feed.Users[user.ID] = user
+
+	history := app.Profile.GetUserProfileHistory(user.ID) // Newest first
+	for i, snapshot := range history {
+		item := ProfileHistoryItem{UserProfileSnapshot: snapshot, IsFirstSeen: i == len(history)-1}
+		if item.IsFirstSeen {
+			item.Changes = snapshot.ChangesFrom(UserProfileSnapshot{})
+		} else {
+			item.Changes = snapshot.ChangesFrom(history[i+1])
+		}
+		data.ProfileHistory = append(data.ProfileHistory, item)
+	}
+
+	app.buffered_render_page2(
+		w, r,
+		"tpl/user_feed.tpl",
+		PageGlobalData{Title: fmt.Sprintf("@%s", user.Handle), TweetTrove: data.Feed.TweetTrove},
+		data,
+	)
+}
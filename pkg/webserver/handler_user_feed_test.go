@@ -122,6 +122,22 @@ func TestUserFeedLikesTab(t *testing.T) {
 	assert.Len(tweets, 4)
 }
 
+func TestUserFeedProfileHistoryTab(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resp := do_request(httptest.NewRequest("GET", "/Cernovich/profile_history", nil))
+	require.Equal(resp.StatusCode, 200)
+
+	root, err := html.Parse(resp.Body)
+	require.NoError(err)
+	assert.Len(cascadia.QueryAll(root, selector(".timeline")), 0)
+	entries := cascadia.QueryAll(root, selector(".profile-history__entry"))
+	require.True(len(entries) >= 1)
+	assert.NotNil(cascadia.Query(entries[len(entries)-1], selector(".profile-history__first-seen")))
+	assert.Equal("Cernovich", cascadia.Query(entries[len(entries)-1], selector(".profile-history__after")).FirstChild.Data)
+}
+
 // Followers and followees
 // -----------------------
 
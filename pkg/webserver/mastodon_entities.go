@@ -0,0 +1,478 @@
+package webserver
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Entities for the Mastodon-compatible API.  See: https://docs.joinmastodon.org/entities/
+//
+// Mastodon IDs are strings, and timestamps are ISO 8601.  Nullable fields are pointers.
+
+type MastodonAccount struct {
+	ID             string          `json:"id"`
+	Username       string          `json:"username"`
+	Acct           string          `json:"acct"`
+	DisplayName    string          `json:"display_name"`
+	Locked         bool            `json:"locked"`
+	Bot            bool            `json:"bot"`
+	Discoverable   bool            `json:"discoverable"`
+	Group          bool            `json:"group"`
+	CreatedAt      string          `json:"created_at"`
+	Note           string          `json:"note"` // HTML
+	URL            string          `json:"url"`
+	Avatar         string          `json:"avatar"`
+	AvatarStatic   string          `json:"avatar_static"`
+	Header         string          `json:"header"`
+	HeaderStatic   string          `json:"header_static"`
+	FollowersCount int             `json:"followers_count"`
+	FollowingCount int             `json:"following_count"`
+	StatusesCount  int             `json:"statuses_count"`
+	LastStatusAt   *string         `json:"last_status_at"`
+	Emojis         []struct{}      `json:"emojis"`
+	Fields         []MastodonField `json:"fields"`
+
+	// Only for `verify_credentials`
+	Source *MastodonAccountSource `json:"source,omitempty"`
+}
+
+type MastodonField struct {
+	Name       string  `json:"name"`
+	Value      string  `json:"value"` // HTML
+	VerifiedAt *string `json:"verified_at"`
+}
+
+type MastodonAccountSource struct {
+	Privacy   string          `json:"privacy"`
+	Sensitive bool            `json:"sensitive"`
+	Language  string          `json:"language"`
+	Note      string          `json:"note"`
+	Fields    []MastodonField `json:"fields"`
+}
+
+type MastodonStatus struct {
+	ID                 string                    `json:"id"`
+	URI                string                    `json:"uri"`
+	URL                *string                   `json:"url"`
+	CreatedAt          string                    `json:"created_at"`
+	EditedAt           *string                   `json:"edited_at"`
+	Account            MastodonAccount           `json:"account"`
+	Content            string                    `json:"content"` // HTML
+	Visibility         string                    `json:"visibility"`
+	Sensitive          bool                      `json:"sensitive"`
+	SpoilerText        string                    `json:"spoiler_text"`
+	MediaAttachments   []MastodonMediaAttachment `json:"media_attachments"`
+	Mentions           []MastodonMention         `json:"mentions"`
+	Tags               []MastodonTag             `json:"tags"`
+	Emojis             []struct{}                `json:"emojis"`
+	ReblogsCount       int                       `json:"reblogs_count"`
+	FavouritesCount    int                       `json:"favourites_count"`
+	RepliesCount       int                       `json:"replies_count"`
+	InReplyToID        *string                   `json:"in_reply_to_id"`
+	InReplyToAccountID *string                   `json:"in_reply_to_account_id"`
+	Reblog             *MastodonStatus           `json:"reblog"`
+	Poll               *MastodonPoll             `json:"poll"`
+	Card               *MastodonCard             `json:"card"`
+	Language           *string                   `json:"language"`
+	Favourited         bool                      `json:"favourited"`
+	Reblogged          bool                      `json:"reblogged"`
+	Muted              bool                      `json:"muted"`
+	Bookmarked         bool                      `json:"bookmarked"`
+}
+
+type MastodonMediaAttachment struct {
+	ID          string            `json:"id"`
+	Type        string            `json:"type"` // "image", "video" or "gifv"
+	URL         string            `json:"url"`
+	PreviewURL  string            `json:"preview_url"`
+	RemoteURL   *string           `json:"remote_url"`
+	Meta        MastodonMediaMeta `json:"meta"`
+	Description *string           `json:"description"`
+	Blurhash    *string           `json:"blurhash"`
+}
+
+type MastodonMediaMeta struct {
+	Original MastodonMediaSize `json:"original"`
+}
+
+type MastodonMediaSize struct {
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Size     string  `json:"size"`
+	Aspect   float64 `json:"aspect"`
+	Duration float64 `json:"duration,omitempty"` // Seconds; videos only
+}
+
+type MastodonMention struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	URL      string `json:"url"`
+	Acct     string `json:"acct"`
+}
+
+type MastodonTag struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type MastodonPoll struct {
+	ID          string               `json:"id"`
+	ExpiresAt   *string              `json:"expires_at"`
+	Expired     bool                 `json:"expired"`
+	Multiple    bool                 `json:"multiple"`
+	VotesCount  int                  `json:"votes_count"`
+	VotersCount *int                 `json:"voters_count"`
+	Options     []MastodonPollOption `json:"options"`
+	Emojis      []struct{}           `json:"emojis"`
+	Voted       bool                 `json:"voted"`
+	OwnVotes    []int                `json:"own_votes"`
+}
+
+type MastodonPollOption struct {
+	Title      string `json:"title"`
+	VotesCount int    `json:"votes_count"`
+}
+
+type MastodonCard struct {
+	URL          string  `json:"url"`
+	Title        string  `json:"title"`
+	Description  string  `json:"description"`
+	Type         string  `json:"type"`
+	ProviderName string  `json:"provider_name"`
+	ProviderURL  string  `json:"provider_url"`
+	Image        *string `json:"image"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	HTML         string  `json:"html"`
+}
+
+type MastodonContext struct {
+	Ancestors   []MastodonStatus `json:"ancestors"`
+	Descendants []MastodonStatus `json:"descendants"`
+}
+
+type MastodonList struct {
+	ID            string `json:"id"`
+	Title         string `json:"title"`
+	RepliesPolicy string `json:"replies_policy"`
+	Exclusive     bool   `json:"exclusive"`
+}
+
+type MastodonSearchResults struct {
+	Accounts []MastodonAccount `json:"accounts"`
+	Statuses []MastodonStatus  `json:"statuses"`
+	Hashtags []MastodonTag     `json:"hashtags"`
+}
+
+// Converting to Mastodon entities
+// -------------------------------
+
+// Converts Tweets, Users, etc. to Mastodon entities.  Media is served from the API's own
+// "/content" path, so `base_url` is needed to make absolute URLs for it.
+type mastodon_converter struct {
+	TweetTrove
+	base_url string
+}
+
+func mastodon_time(t Timestamp) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func mastodon_id[T ~int64](id T) string {
+	return fmt.Sprint(id)
+}
+
+func (m mastodon_converter) content_url(p string) string {
+	return m.base_url + "/content/" + strings.TrimPrefix(p, "/")
+}
+
+func (m mastodon_converter) Account(u User) MastodonAccount {
+	avatar := u.ProfileImageUrl
+	if u.IsContentDownloaded {
+		avatar = m.content_url(u.GetProfileImageLocalPath())
+	}
+	header := u.BannerImageUrl
+	if u.IsContentDownloaded && u.BannerImageLocalPath != "" {
+		header = m.content_url("profile_images/" + u.BannerImageLocalPath)
+	}
+	if header == "" {
+		// Clients expect there to always be a header image
+		header = avatar
+	}
+
+	fields := []MastodonField{}
+	if u.Location != "" {
+		fields = append(fields, MastodonField{Name: "Location", Value: html.EscapeString(u.Location)})
+	}
+	if u.Website != "" {
+		fields = append(fields, MastodonField{Name: "Website", Value: mastodon_link(u.Website, u.Website)})
+	}
+
+	return MastodonAccount{
+		ID:             mastodon_id(u.ID),
+		Username:       string(u.Handle),
+		Acct:           string(u.Handle),
+		DisplayName:    u.DisplayName,
+		Locked:         u.IsPrivate,
+		CreatedAt:      mastodon_time(u.JoinDate),
+		Note:           m.html_content(u.Bio),
+		URL:            fmt.Sprintf("https://twitter.com/%s", u.Handle),
+		Avatar:         avatar,
+		AvatarStatic:   avatar,
+		Header:         header,
+		HeaderStatic:   header,
+		FollowersCount: u.FollowersCount,
+		FollowingCount: u.FollowingCount,
+		Emojis:         []struct{}{},
+		Fields:         fields,
+	}
+}
+
+// Get the Status for an item in a Feed.  Retweets become "reblogs".
+func (m mastodon_converter) FeedItemStatus(item FeedItem) MastodonStatus {
+	if item.RetweetID == TweetID(0) {
+		return m.Status(m.Tweets[item.TweetID])
+	}
+	retweet := m.Retweets[item.RetweetID]
+	reblog := m.Status(m.Tweets[item.TweetID])
+	return MastodonStatus{
+		ID:               mastodon_id(retweet.RetweetID),
+		URI:              reblog.URI,
+		CreatedAt:        mastodon_time(retweet.RetweetedAt),
+		Account:          m.Account(m.Users[retweet.RetweetedByID]),
+		Visibility:       "public",
+		MediaAttachments: []MastodonMediaAttachment{},
+		Mentions:         []MastodonMention{},
+		Tags:             []MastodonTag{},
+		Emojis:           []struct{}{},
+		Reblog:           &reblog,
+	}
+}
+
+func (m mastodon_converter) Status(t Tweet) MastodonStatus {
+	author, is_ok := m.Users[t.UserID]
+	if !is_ok {
+		author = GetUnknownUser()
+	}
+	url := fmt.Sprintf("https://twitter.com/%s/status/%d", author.Handle, t.ID)
+
+	ret := MastodonStatus{
+		ID:               mastodon_id(t.ID),
+		URI:              url,
+		URL:              &url,
+		CreatedAt:        mastodon_time(t.PostedAt),
+		Account:          m.Account(author),
+		Visibility:       "public",
+		MediaAttachments: []MastodonMediaAttachment{},
+		Mentions:         []MastodonMention{},
+		Tags:             []MastodonTag{},
+		Emojis:           []struct{}{},
+		ReblogsCount:     t.NumRetweets,
+		FavouritesCount:  t.NumLikes,
+		RepliesCount:     t.NumReplies,
+		Favourited:       t.IsLikedByCurrentUser,
+		Reblogged:        t.IsRetweetedByCurrentUser,
+	}
+	if author.IsPrivate {
+		ret.Visibility = "private"
+	}
+	if len(t.EditTweetIDs) > 1 && t.EditTweetIDs[0] != t.ID {
+		edited_at := ret.CreatedAt
+		ret.EditedAt = &edited_at
+	}
+
+	// Content
+	content := m.html_content(t.Text)
+	if t.TombstoneType != "" {
+		content = fmt.Sprintf("<p><i>%s</i></p>", html.EscapeString(t.TombstoneText)) + content
+	}
+	if t.QuotedTweetID != TweetID(0) {
+		// Mastodon doesn't have quote-posts, so just link to it
+		quoted_url := fmt.Sprintf("https://twitter.com/i/status/%d", t.QuotedTweetID)
+		if quoted_tweet, is_ok := m.Tweets[t.QuotedTweetID]; is_ok {
+			quoted_url = fmt.Sprintf("https://twitter.com/%s/status/%d", m.Users[quoted_tweet.UserID].Handle, quoted_tweet.ID)
+		}
+		content += fmt.Sprintf(`<p class="quote-inline">QT: %s</p>`, mastodon_link(quoted_url, quoted_url))
+	}
+	ret.Content = content
+
+	// Reply
+	if t.InReplyToID != TweetID(0) {
+		in_reply_to_id := mastodon_id(t.InReplyToID)
+		ret.InReplyToID = &in_reply_to_id
+		if parent, is_ok := m.Tweets[t.InReplyToID]; is_ok {
+			in_reply_to_account_id := mastodon_id(parent.UserID)
+			ret.InReplyToAccountID = &in_reply_to_account_id
+		} else if t.InReplyToUserID != UserID(0) {
+			in_reply_to_account_id := mastodon_id(t.InReplyToUserID)
+			ret.InReplyToAccountID = &in_reply_to_account_id
+		}
+	}
+
+	// Media
+	for _, img := range t.Images {
+		url := img.RemoteURL
+		if img.IsDownloaded {
+			url = m.content_url("images/" + img.LocalFilename)
+		}
+		remote_url := img.RemoteURL
+		ret.MediaAttachments = append(ret.MediaAttachments, MastodonMediaAttachment{
+			ID:         mastodon_id(img.ID),
+			Type:       "image",
+			URL:        url,
+			PreviewURL: url,
+			RemoteURL:  &remote_url,
+			Meta:       MastodonMediaMeta{Original: mastodon_media_size(img.Width, img.Height)},
+		})
+	}
+	for _, vid := range t.Videos {
+		url := vid.RemoteURL
+		preview_url := vid.ThumbnailRemoteUrl
+		if vid.IsDownloaded {
+			url = m.content_url("videos/" + vid.LocalFilename)
+			preview_url = m.content_url("video_thumbnails/" + vid.ThumbnailLocalPath)
+		}
+		remote_url := vid.RemoteURL
+		attachment := MastodonMediaAttachment{
+			ID:         mastodon_id(vid.ID),
+			Type:       "video",
+			URL:        url,
+			PreviewURL: preview_url,
+			RemoteURL:  &remote_url,
+			Meta:       MastodonMediaMeta{Original: mastodon_media_size(vid.Width, vid.Height)},
+		}
+		if vid.IsGif {
+			attachment.Type = "gifv"
+		}
+		attachment.Meta.Original.Duration = float64(vid.Duration) / 1000
+		ret.MediaAttachments = append(ret.MediaAttachments, attachment)
+	}
+
+	// Mentions and hashtags
+	for _, handle := range t.Mentions {
+		for _, u := range m.Users {
+			if strings.EqualFold(string(u.Handle), handle) {
+				ret.Mentions = append(ret.Mentions, MastodonMention{
+					ID:       mastodon_id(u.ID),
+					Username: string(u.Handle),
+					URL:      fmt.Sprintf("https://twitter.com/%s", u.Handle),
+					Acct:     string(u.Handle),
+				})
+				break
+			}
+		}
+	}
+	for _, hashtag := range t.Hashtags {
+		ret.Tags = append(ret.Tags, MastodonTag{
+			Name: hashtag,
+			URL:  fmt.Sprintf("https://twitter.com/hashtag/%s", hashtag),
+		})
+	}
+
+	// Poll
+	if len(t.Polls) > 0 {
+		poll := t.Polls[0]
+		expires_at := mastodon_time(poll.VotingEndsAt)
+		ret.Poll = &MastodonPoll{
+			ID:         mastodon_id(poll.ID),
+			ExpiresAt:  &expires_at,
+			Expired:    poll.VotingEndsAt.Before(time.Now()),
+			VotesCount: poll.TotalVotes(),
+			Options: []MastodonPollOption{
+				{Title: poll.Choice1, VotesCount: poll.Choice1_Votes},
+				{Title: poll.Choice2, VotesCount: poll.Choice2_Votes},
+			},
+			Emojis:   []struct{}{},
+			OwnVotes: []int{},
+		}
+		if poll.NumChoices > 2 {
+			ret.Poll.Options = append(ret.Poll.Options, MastodonPollOption{Title: poll.Choice3, VotesCount: poll.Choice3_Votes})
+		}
+		if poll.NumChoices > 3 {
+			ret.Poll.Options = append(ret.Poll.Options, MastodonPollOption{Title: poll.Choice4, VotesCount: poll.Choice4_Votes})
+		}
+	}
+
+	// Link preview card
+	for _, u := range t.Urls {
+		if !u.HasCard {
+			continue
+		}
+		ret.Card = &MastodonCard{
+			URL:          u.Text,
+			Title:        u.Title,
+			Description:  u.Description,
+			Type:         "link",
+			ProviderName: u.GetDomain(),
+		}
+		if u.HasThumbnail {
+			image := u.ThumbnailRemoteUrl
+			if u.IsContentDownloaded {
+				image = m.content_url("link_preview_images/" + u.ThumbnailLocalPath)
+			}
+			ret.Card.Image = &image
+			ret.Card.Width = u.ThumbnailWidth
+			ret.Card.Height = u.ThumbnailHeight
+		}
+		break
+	}
+
+	return ret
+}
+
+func mastodon_media_size(width int, height int) MastodonMediaSize {
+	ret := MastodonMediaSize{Width: width, Height: height, Size: fmt.Sprintf("%dx%d", width, height)}
+	if height != 0 {
+		ret.Aspect = float64(width) / float64(height)
+	}
+	return ret
+}
+
+func mastodon_link(href string, text string) string {
+	return fmt.Sprintf(`<a href="%s" rel="nofollow noopener noreferrer" target="_blank">%s</a>`,
+		html.EscapeString(href), html.EscapeString(text))
+}
+
+var mastodon_url_regex = regexp.MustCompile(`https?://[^\s]+`)
+
+// Convert plain text (e.g., a tweet or a bio) to Mastodon-style HTML.  Mentions, hashtags and
+// links are made into links.
+func (m mastodon_converter) html_content(text string) string {
+	if text == "" {
+		return ""
+	}
+	paragraphs := []string{}
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		lines := []string{}
+		for _, line := range strings.Split(paragraph, "\n") {
+			b := new(strings.Builder)
+			for _, e := range get_entities(line) {
+				switch e.EntityType {
+				case ENTITY_TYPE_MENTION:
+					b.WriteString(fmt.Sprintf(`<span class="h-card"><a href="https://twitter.com/%s" class="u-url mention">@<span>%s</span></a></span>`,
+						html.EscapeString(e.Contents), html.EscapeString(e.Contents)))
+				case ENTITY_TYPE_HASHTAG:
+					b.WriteString(fmt.Sprintf(`<a href="https://twitter.com/hashtag/%s" class="mention hashtag" rel="tag">#<span>%s</span></a>`,
+						html.EscapeString(e.Contents), html.EscapeString(e.Contents)))
+				default:
+					start := 0
+					for _, idxs := range mastodon_url_regex.FindAllStringIndex(e.Contents, -1) {
+						b.WriteString(html.EscapeString(e.Contents[start:idxs[0]]))
+						url := e.Contents[idxs[0]:idxs[1]]
+						b.WriteString(mastodon_link(url, url))
+						start = idxs[1]
+					}
+					b.WriteString(html.EscapeString(e.Contents[start:]))
+				}
+			}
+			lines = append(lines, b.String())
+		}
+		paragraphs = append(paragraphs, "<p>"+strings.Join(lines, "<br />")+"</p>")
+	}
+	return strings.Join(paragraphs, "")
+}
@@ -17,6 +17,9 @@ import (
 type NotificationBubbles struct {
 	NumMessageNotifications int
 	NumRegularNotifications int
+
+	// With the number of new results for each one
+	SavedSearches []SavedSearch
 }
 
 // TODO: this name sucks
@@ -28,6 +31,9 @@ type PageGlobalData struct {
 	FocusedTweetID TweetID
 	Toasts         []Toast
 	NotificationBubbles
+
+	// Only set when rendering a static site (see `StaticSite`)
+	StaticPage *StaticPageInfo
 }
 
 func (d PageGlobalData) Tweet(id TweetID) Tweet {
@@ -60,6 +66,9 @@ func (d PageGlobalData) GetSearchText() string {
 func (d PageGlobalData) GlobalData() PageGlobalData {
 	return d
 }
+func (d PageGlobalData) IsStatic() bool {
+	return d.StaticPage != nil
+}
 
 // Config object for buffered rendering
 type renderer struct {
@@ -106,6 +115,7 @@ func (app *Application) buffered_render_page(w http.ResponseWriter, tpl_file str
 			app.LastReadNotificationSortIndex,
 		)
 	}
+	global_data.NotificationBubbles.SavedSearches = app.get_saved_searches_with_counts()
 
 	r := renderer{
 		Funcs:     app.make_funcmap(global_data),
@@ -157,6 +167,9 @@ func (app *Application) make_funcmap(global_data PageGlobalData) template.FuncMa
 		"cursor_to_query_params": func(c Cursor) string {
 			result := url.Values{}
 			result.Set("cursor", fmt.Sprint(c.CursorValue))
+			if c.SortOrder == SORT_ORDER_RELEVANCE {
+				result.Set("cursor-tiebreaker", fmt.Sprint(c.CursorTiebreaker))
+			}
 			result.Set("sort-order", c.SortOrder.String())
 			return result.Encode()
 		},
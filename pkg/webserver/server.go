@@ -32,6 +32,15 @@ type Application struct {
 	IsScrapingDisabled            bool
 	API                           scraper.API
 	LastReadNotificationSortIndex int64
+	IsDeletedTweetSweepEnabled    bool
+
+	// Where the admin API puts backups.  If empty, backing up from the web UI is disabled.
+	BackupDir string
+
+	// Downloads media for scraped content in the background; its workers start when the server does
+	MediaDownloads *MediaDownloadManager
+
+	saved_search_counts *saved_search_counts_cache
 }
 
 func NewApp(profile Profile) Application {
@@ -44,6 +53,9 @@ func NewApp(profile Profile) Application {
 		Profile:            profile,
 		ActiveUser:         get_default_user(),
 		IsScrapingDisabled: true, // Until an active user is set
+		MediaDownloads:     NewMediaDownloadManager(profile),
+
+		saved_search_counts: &saved_search_counts_cache{counts: map[SavedSearchID]saved_search_count{}},
 	}
 
 	// Can ignore errors; if not authenticated, it won't be used for anything.
@@ -130,12 +142,22 @@ func (app *Application) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.StripPrefix("/search", http.HandlerFunc(app.Search)).ServeHTTP(w, r)
 	case "lists":
 		http.StripPrefix("/lists", http.HandlerFunc(app.Lists)).ServeHTTP(w, r)
+	case "saved-searches":
+		http.StripPrefix("/saved-searches", http.HandlerFunc(app.SavedSearches)).ServeHTTP(w, r)
+	case "mutes":
+		http.StripPrefix("/mutes", http.HandlerFunc(app.Mutes)).ServeHTTP(w, r)
+	case "jobs":
+		http.StripPrefix("/jobs", http.HandlerFunc(app.Jobs)).ServeHTTP(w, r)
 	case "bookmarks":
 		app.Bookmarks(w, r)
 	case "notifications":
 		http.StripPrefix("/notifications", http.HandlerFunc(app.Notifications)).ServeHTTP(w, r)
 	case "messages":
 		http.StripPrefix("/messages", http.HandlerFunc(app.Messages)).ServeHTTP(w, r)
+	case "api":
+		http.StripPrefix("/api", http.HandlerFunc(app.APIv1)).ServeHTTP(w, r)
+	case "feeds":
+		http.StripPrefix("/feeds", http.HandlerFunc(app.Feeds)).ServeHTTP(w, r)
 	case "nav-sidebar-poll-updates":
 		app.NavSidebarPollUpdates(w, r)
 	case "communities":
@@ -161,6 +183,10 @@ func (app *Application) Run(address string, should_auto_open bool) {
 	app.InfoLog.Printf("Starting server on %s", address)
 
 	app.start_background()
+	app.MediaDownloads.Start(DefaultDownloader{Download: func(url string) ([]byte, error) {
+		// The session can change (e.g., logging in), so use whichever one is current
+		return app.API.DownloadMedia(url)
+	}})
 
 	if should_auto_open {
 		page := "/login"
@@ -198,5 +224,27 @@ func parse_cursor_value(c *Cursor, r *http.Request) error {
 		}
 		c.CursorPosition = CURSOR_MIDDLE
 	}
+	if tiebreaker_param := r.URL.Query().Get("cursor-tiebreaker"); tiebreaker_param != "" {
+		tiebreaker, err := strconv.Atoi(tiebreaker_param)
+		if err != nil {
+			return fmt.Errorf("attempted to parse cursor tiebreaker %q as int: %w", tiebreaker_param, err)
+		}
+		c.CursorTiebreaker = TweetID(tiebreaker)
+	}
 	return nil
 }
+
+// Get the URL of this server (e.g., "https://example.com:1973"), as the request sees it, for making
+// absolute links.  If it's behind a reverse proxy, the proxy's scheme is used.
+func get_base_url(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	// Only the first proxy's scheme matters, if there's a chain of them
+	forwarded_proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	if forwarded_proto = strings.ToLower(strings.TrimSpace(forwarded_proto)); forwarded_proto == "http" || forwarded_proto == "https" {
+		scheme = forwarded_proto
+	}
+	return scheme + "://" + r.Host
+}
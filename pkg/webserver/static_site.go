@@ -0,0 +1,370 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+)
+
+// Info for rendering a page of a static site
+type StaticPageInfo struct {
+	SiteTitle   string
+	HomePageURL string
+
+	// For feed pages
+	PageNumber  int
+	NumPages    int
+	PrevPageURL string
+	NextPageURL string
+}
+
+// Renders a read-only snapshot of a feed (a user feed, a list or a search) as a static website,
+// which can be hosted anywhere (or opened directly from disk).  It uses the same components as
+// the webserver, but every link is relative, and nothing needs htmx or the webserver.
+//
+// Layout of the output directory:
+//   - index.html, page-2.html, page-3.html, ...: the feed
+//   - tweet/<id>.html: thread page for each tweet in the feed
+//   - static/: stylesheets, icons etc.
+//   - content/: copies of the media that the pages use (same layout as in the Profile)
+//
+// Links to things that aren't part of the site (e.g., other users) point to twitter.com instead.
+type StaticSite struct {
+	Profile   Profile
+	OutputDir string
+	PageSize  int
+
+	app Application
+
+	// Maps webserver URLs (e.g., "/tweet/1234") to the page rendered for it (e.g., "tweet/1234.html")
+	pages map[string]string
+	// Media files used by the pages, relative to the Profile directory
+	media_paths map[string]bool
+}
+
+func NewStaticSite(profile Profile, output_dir string) StaticSite {
+	return StaticSite{
+		Profile:   profile,
+		OutputDir: output_dir,
+		PageSize:  50,
+		app: Application{
+			Profile:            profile,
+			ActiveUser:         get_default_user(),
+			IsScrapingDisabled: true,
+		},
+		pages:       make(map[string]string),
+		media_paths: make(map[string]bool),
+	}
+}
+
+// Render a user's feed (tweets, replies and retweets)
+func (s *StaticSite) RenderUserFeed(handle UserHandle) error {
+	user, err := s.Profile.GetUserByHandle(handle)
+	if err != nil {
+		return fmt.Errorf("Error getting user %q:\n  %w", handle, err)
+	}
+	s.pages["/"+string(user.Handle)] = "index.html"
+
+	var pinned_tweet Tweet
+	if user.PinnedTweetID != TweetID(0) {
+		pinned_tweet, err = s.Profile.GetTweetById(user.PinnedTweetID)
+		if err != nil && !errors.Is(err, ErrNotInDatabase) {
+			panic(err)
+		}
+	}
+
+	return s.render_feed(NewUserFeedCursor(user.Handle), fmt.Sprintf("@%s", user.Handle),
+		func(global_data PageGlobalData, feed Feed) templ.Component {
+			feed.Users[user.ID] = user
+			data := UserFeedData{Feed: feed, UserID: user.ID}
+			// Pinned tweet only goes on the first page
+			if global_data.StaticPage.PageNumber == 1 && pinned_tweet.ID != TweetID(0) {
+				data.PinnedTweet = pinned_tweet
+				feed.Tweets[pinned_tweet.ID] = pinned_tweet
+				s.add_quoted_tweet(&feed.TweetTrove, pinned_tweet)
+			}
+			return UserFeedPage(global_data, data)
+		},
+	)
+}
+
+// Render a List's feed
+func (s *StaticSite) RenderListFeed(list_id ListID) error {
+	list, err := s.Profile.GetListById(list_id)
+	if err != nil {
+		return fmt.Errorf("Error getting list %d:\n  %w", list_id, err)
+	}
+	s.pages[fmt.Sprintf("/lists/%d", list.ID)] = "index.html"
+
+	return s.render_feed(NewListCursor(list.ID), list.Name, func(global_data PageGlobalData, feed Feed) templ.Component {
+		return ListDetailPage(global_data, ListData{Feed: feed, List: list, ActiveTab: "feed"})
+	})
+}
+
+// Render the results of a search query (see `NewCursorFromSearchQuery`)
+func (s *StaticSite) RenderSearch(query string) error {
+	c, err := NewCursorFromSearchQuery(query)
+	if err != nil {
+		return fmt.Errorf("Invalid search query %q:\n  %w", query, err)
+	}
+	title := fmt.Sprintf("Search results: %s", query)
+	return s.render_feed(c, title, func(global_data PageGlobalData, feed Feed) templ.Component {
+		return StaticFeedPage(global_data, title, feed)
+	})
+}
+
+// Render every page of a feed, the thread pages for its tweets, and copy the media and static files.
+func (s *StaticSite) render_feed(c Cursor, title string, render_page func(PageGlobalData, Feed) templ.Component) error {
+	// Get all the pages first, so the thread pages are known when rendering the feed pages
+	c.PageSize = s.PageSize
+	feeds := []Feed{}
+	for {
+		feed, err := s.Profile.NextPage(c, s.app.ActiveUser.ID)
+		if err != nil {
+			return fmt.Errorf("Error getting feed:\n  %w", err)
+		}
+		feeds = append(feeds, feed)
+		if feed.CursorBottom.CursorPosition.IsEnd() {
+			break
+		}
+		c = feed.CursorBottom
+	}
+
+	s.pages["/"] = "index.html"
+	for i := range feeds {
+		if i > 0 {
+			s.pages[feed_page_url(i+1)] = fmt.Sprintf("page-%d.html", i+1)
+		}
+	}
+	thread_ids := []TweetID{}
+	for _, feed := range feeds {
+		for _, item := range feed.Items {
+			if item.TweetID == TweetID(0) {
+				continue
+			}
+			tweet_url := fmt.Sprintf("/tweet/%d", item.TweetID)
+			if _, is_ok := s.pages[tweet_url]; !is_ok {
+				s.pages[tweet_url] = fmt.Sprintf("tweet/%d.html", item.TweetID)
+				thread_ids = append(thread_ids, item.TweetID)
+			}
+		}
+	}
+
+	// Feed pages
+	for i, feed := range feeds {
+		page_info := StaticPageInfo{SiteTitle: title, HomePageURL: "/", PageNumber: i + 1, NumPages: len(feeds)}
+		if i > 0 {
+			page_info.PrevPageURL = feed_page_url(i)
+		}
+		if i < len(feeds)-1 {
+			page_info.NextPageURL = feed_page_url(i + 2)
+		}
+		global_data := PageGlobalData{Title: title, TweetTrove: feed.TweetTrove, StaticPage: &page_info}
+		if err := s.write_page(s.pages[feed_page_url(i+1)], global_data, render_page(global_data, feed)); err != nil {
+			return err
+		}
+	}
+
+	// Thread pages
+	for _, id := range thread_ids {
+		if err := s.render_thread(id, title); err != nil {
+			return err
+		}
+	}
+
+	if err := s.copy_static_files(); err != nil {
+		return err
+	}
+	return s.copy_media()
+}
+
+func feed_page_url(page_number int) string {
+	if page_number == 1 {
+		return "/"
+	}
+	// Can't be confused with a user handle, since those can't have a "-" in them
+	return fmt.Sprintf("/page-%d", page_number)
+}
+
+func (s *StaticSite) render_thread(id TweetID, site_title string) error {
+	twt_detail, err := s.Profile.GetTweetDetail(id, s.app.ActiveUser.ID, false) // Mute rules always apply to static sites
+	if err != nil {
+		return fmt.Errorf("Error getting tweet detail for tweet ID %d:\n  %w", id, err)
+	}
+	data := NewTweetDetailData()
+	data.MainTweetID = id
+	data.TweetDetailView = twt_detail
+	data.EngagementHistory = s.Profile.GetTweetEngagementHistory(id)
+	data.Versions = s.app.get_tweet_versions(id)
+
+	page_info := StaticPageInfo{SiteTitle: site_title, HomePageURL: "/"}
+	global_data := PageGlobalData{
+		Title:          "Tweet",
+		TweetTrove:     twt_detail.TweetTrove,
+		FocusedTweetID: id,
+		StaticPage:     &page_info,
+	}
+	return s.write_page(s.pages[fmt.Sprintf("/tweet/%d", id)], global_data, TweetDetailPage(global_data, data))
+}
+
+// Fetch a tweet's quoted tweet (and its author), if it's in the DB
+func (s *StaticSite) add_quoted_tweet(trove *TweetTrove, tweet Tweet) {
+	if tweet.QuotedTweetID == TweetID(0) {
+		return
+	}
+	quoted_tweet, err := s.Profile.GetTweetById(tweet.QuotedTweetID)
+	if errors.Is(err, ErrNotInDatabase) {
+		return
+	}
+	panic_if(err)
+	trove.Tweets[quoted_tweet.ID] = quoted_tweet
+	if _, is_ok := trove.Users[quoted_tweet.UserID]; !is_ok {
+		user, err := s.Profile.GetUserByID(quoted_tweet.UserID)
+		panic_if(err)
+		trove.Users[user.ID] = user
+	}
+}
+
+// Render a page and write it to the given path (relative to the output directory)
+func (s *StaticSite) write_page(page_path string, global_data PageGlobalData, main_component templ.Component) error {
+	buf := new(bytes.Buffer)
+	err := StaticBase(global_data, main_component).Render(context.Background(), buf)
+	if err != nil {
+		return fmt.Errorf("Error rendering page %q:\n  %w", page_path, err)
+	}
+
+	return write_file(filepath.Join(s.OutputDir, filepath.FromSlash(page_path)), s.relativize_links(buf.Bytes(), page_path))
+}
+
+var (
+	// Attributes with a link to somewhere on the webserver
+	link_attr_regex = regexp.MustCompile(`(\s(?:href|src|poster)=")(/[^"]*)"`)
+	// htmx attributes, which do nothing on a static site
+	htmx_attr_regex = regexp.MustCompile(`\shx-[a-z-]+(?:="[^"]*")?`)
+
+	// Webserver pages that don't make sense without the webserver
+	app_only_pages = []string{"timeline", "lists", "bookmarks", "notifications", "messages", "login", "communities"}
+)
+
+// Rewrite a rendered page's links to be relative to the page's location in the output directory
+func (s *StaticSite) relativize_links(page []byte, page_path string) []byte {
+	page = htmx_attr_regex.ReplaceAll(page, nil)
+
+	path_to_root := strings.Repeat("../", strings.Count(page_path, "/"))
+	return link_attr_regex.ReplaceAllFunc(page, func(match []byte) []byte {
+		parts := link_attr_regex.FindSubmatch(match)
+		target := s.resolve_link(html.UnescapeString(string(parts[2])))
+		if !strings.Contains(target, "://") && target != "#" {
+			target = path_to_root + target
+		}
+		return []byte(string(parts[1]) + html.EscapeString(target) + `"`)
+	})
+}
+
+// Find where a webserver URL should point on the static site.  Returns either a path relative to
+// the output directory, or an absolute URL.
+func (s *StaticSite) resolve_link(link string) string {
+	link_path, query, _ := strings.Cut(link, "?")
+	if page, is_ok := s.pages[link_path]; is_ok {
+		return page
+	}
+
+	parts := strings.Split(strings.Trim(link_path, "/"), "/")
+	switch parts[0] {
+	case "static":
+		return strings.TrimPrefix(link_path, "/")
+	case "content":
+		media_path := strings.TrimPrefix(link_path, "/content/")
+		s.media_paths[media_path] = true
+		return "content/" + media_path
+	case "tweet":
+		if len(parts) > 1 {
+			if _, err := strconv.Atoi(parts[1]); err == nil {
+				return fmt.Sprintf("https://twitter.com/i/status/%s", parts[1])
+			}
+		}
+		return "#"
+	case "search":
+		search_text := strings.TrimPrefix(link_path, "/search/")
+		if search_text == link_path || search_text == "" {
+			// Search bar (query params)
+			values, err := url.ParseQuery(query)
+			if err != nil {
+				return "#"
+			}
+			search_text = url.QueryEscape(values.Get("q"))
+		}
+		return fmt.Sprintf("https://twitter.com/search?q=%s", search_text)
+	}
+	for _, p := range app_only_pages {
+		if parts[0] == p {
+			return "#"
+		}
+	}
+	// It's a user
+	return "https://twitter.com" + link_path
+}
+
+// Copy the webserver's static files (stylesheets, icons etc)
+func (s *StaticSite) copy_static_files() error {
+	var static_fs fs.FS
+	if use_embedded == "true" {
+		var err error
+		static_fs, err = fs.Sub(embedded_files, "static")
+		panic_if(err)
+	} else {
+		static_fs = os.DirFS(get_filepath("static"))
+	}
+	return fs.WalkDir(static_fs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(static_fs, p)
+		if err != nil {
+			return fmt.Errorf("Error reading static file %q:\n  %w", p, err)
+		}
+		return write_file(filepath.Join(s.OutputDir, "static", filepath.FromSlash(p)), data)
+	})
+}
+
+// Copy the media used by the pages out of the Profile.  Media that doesn't exist is skipped.
+func (s *StaticSite) copy_media() error {
+	for media_path := range s.media_paths {
+		if strings.Contains(media_path, "..") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.Profile.ProfileDir, filepath.FromSlash(media_path)))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Error reading media file %q:\n  %w", media_path, err)
+		}
+		if err := write_file(filepath.Join(s.OutputDir, "content", filepath.FromSlash(media_path)), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func write_file(outfile string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(outfile), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %q:\n  %w", outfile, err)
+	}
+	if err := os.WriteFile(outfile, data, 0644); err != nil {
+		return fmt.Errorf("Error writing %q:\n  %w", outfile, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package webserver_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+
+	. "gitlab.com/offline-twitter/twitter_offline_engine/pkg/persistence"
+	"gitlab.com/offline-twitter/twitter_offline_engine/pkg/webserver"
+)
+
+func parse_static_page(t *testing.T, filename string) *html.Node {
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	root, err := html.Parse(f)
+	require.NoError(t, err)
+	return root
+}
+
+// Every link in a static site should be relative or external, and point to a file that exists (except
+// media files, which might not be downloaded)
+func assert_static_links_ok(t *testing.T, output_dir string, page_path string) {
+	root := parse_static_page(t, filepath.Join(output_dir, page_path))
+	for _, node := range cascadia.QueryAll(root, selector("*")) {
+		for _, attr := range node.Attr {
+			assert.False(t, strings.HasPrefix(attr.Key, "hx-"), "%s: htmx attribute %q", page_path, attr.Key)
+			if attr.Key != "href" && attr.Key != "src" && attr.Key != "poster" {
+				continue
+			}
+			if attr.Val == "" || attr.Val == "#" || strings.Contains(attr.Val, "://") {
+				continue
+			}
+			assert.False(t, strings.HasPrefix(attr.Val, "/"), "%s: absolute link %q", page_path, attr.Val)
+			if strings.Contains(attr.Val, "content/") {
+				// Media files that are missing from the profile are skipped
+				continue
+			}
+			_, err := os.Stat(filepath.Join(output_dir, filepath.Dir(page_path), attr.Val))
+			assert.NoError(t, err, "%s: broken link %q", page_path, attr.Val)
+		}
+	}
+}
+
+func TestStaticSiteUserFeed(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	output_dir := t.TempDir()
+	site := webserver.NewStaticSite(profile, output_dir)
+	site.PageSize = 3
+	require.NoError(site.RenderUserFeed(UserHandle("cernovich")))
+
+	// Paginated feed
+	root := parse_static_page(t, filepath.Join(output_dir, "index.html"))
+	assert.Len(cascadia.QueryAll(root, selector(".timeline > .tweet")), 3)
+	assert.Len(cascadia.QueryAll(root, selector(".user-header")), 1)
+	assert.Len(cascadia.QueryAll(root, selector(".show-more")), 0)
+	next_link := cascadia.Query(root, selector(".static-pagination__next"))
+	require.NotNil(next_link)
+	assert.Contains(next_link.Attr, html.Attribute{Key: "href", Val: "page-2.html"})
+	assert.Nil(cascadia.Query(root, selector("script[src]")))
+
+	page_files, err := filepath.Glob(filepath.Join(output_dir, "page-*.html"))
+	require.NoError(err)
+	assert.Greater(len(page_files), 0)
+
+	// Thread pages for each tweet in the feed
+	thread_link := cascadia.Query(root, selector(".timeline > .tweet .interactions a[title='View thread']"))
+	require.NotNil(thread_link)
+	for _, attr := range thread_link.Attr {
+		if attr.Key == "href" {
+			assert.True(strings.HasPrefix(attr.Val, "tweet/"))
+			thread_root := parse_static_page(t, filepath.Join(output_dir, attr.Val))
+			assert.Len(cascadia.QueryAll(thread_root, selector(".focused-tweet")), 1)
+		}
+	}
+
+	// Static files and media are copied
+	_, err = os.Stat(filepath.Join(output_dir, "static", "styles.css"))
+	assert.NoError(err)
+	_, err = os.Stat(filepath.Join(output_dir, "content", "videos", "1453461248142495744.mp4"))
+	assert.NoError(err)
+
+	thread_pages, err := filepath.Glob(filepath.Join(output_dir, "tweet", "*.html"))
+	require.NoError(err)
+	assert.Greater(len(thread_pages), 0)
+	for _, page := range append(append(page_files, thread_pages...), filepath.Join(output_dir, "index.html")) {
+		rel_path, err := filepath.Rel(output_dir, page)
+		require.NoError(err)
+		assert_static_links_ok(t, output_dir, rel_path)
+	}
+}
+
+func TestStaticSiteSearch(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	output_dir := t.TempDir()
+	site := webserver.NewStaticSite(profile, output_dir)
+	require.NoError(site.RenderSearch("think"))
+
+	root := parse_static_page(t, filepath.Join(output_dir, "index.html"))
+	assert.Len(cascadia.QueryAll(root, selector(".timeline > .tweet")), 5)
+	assert.Equal("Page 1 of 1", strings.TrimSpace(cascadia.Query(root, selector(".static-pagination__label")).FirstChild.Data))
+	assert_static_links_ok(t, output_dir, "index.html")
+
+	_, err := os.Stat(filepath.Join(output_dir, "tweet", "1439067163508150272.html"))
+	assert.NoError(err)
+}
+
+func TestStaticSiteInvalidQuery(t *testing.T) {
+	site := webserver.NewStaticSite(profile, t.TempDir())
+	assert.ErrorIs(t, site.RenderSearch("since:fawejk"), ErrInvalidQuery)
+}
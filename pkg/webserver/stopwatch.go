@@ -47,8 +47,12 @@ func (t *BackgroundTask) Do() {
 		t.log.Print("starting scrape")
 	}
 
-	// Run the task
-	trove := t.GetTroveFunc(&t.app.API)
+	// Run the task.  It gets its own copy of the API, so that its requests have background priority
+	// (see `scraper.RateLimiter`).  The copy shares the cookie jar, so if its requests update the
+	// CSRF cookie, the app's API picks that up from the jar; nothing has to be copied back.
+	api := t.app.API
+	api.Priority = scraper.PRIORITY_BACKGROUND
+	trove := t.GetTroveFunc(&api)
 	t.log.Print("saving results")
 	t.app.full_save_tweet_trove(trove)
 	t.log.Print("success")
@@ -152,7 +156,7 @@ func (app *Application) start_background() {
 	bookmarks_task := BackgroundTask{
 		Name: "bookmarks",
 		GetTroveFunc: func(api *scraper.API) TweetTrove {
-			trove, err := app.API.GetBookmarks(10)
+			trove, err := api.GetBookmarks(10)
 			if err != nil && !errors.Is(err, scraper.END_OF_FEED) && !errors.Is(err, scraper.ErrRateLimited) {
 				panic(err)
 			}
@@ -167,7 +171,7 @@ func (app *Application) start_background() {
 	own_profile_task := BackgroundTask{
 		Name: "user profile",
 		GetTroveFunc: func(api *scraper.API) TweetTrove {
-			trove, err := app.API.GetUserFeed(api.UserID, 1)
+			trove, err := api.GetUserFeed(api.UserID, 1)
 			if err != nil && !errors.Is(err, scraper.END_OF_FEED) && !errors.Is(err, scraper.ErrRateLimited) {
 				panic(err)
 			}
@@ -178,4 +182,79 @@ func (app *Application) start_background() {
 		app:        app,
 	}
 	own_profile_task.StartBackground()
+
+	saved_searches_task := BackgroundTask{
+		Name: "saved searches",
+		GetTroveFunc: func(api *scraper.API) TweetTrove {
+			// Only the ones that are set to be searched in the background
+			trove := NewTweetTrove()
+			for _, s := range app.Profile.GetAllSavedSearches() {
+				if !s.IsScrapedInBackground {
+					continue
+				}
+				query, err := ToTwitterSearchQuery(s.Query)
+				if err != nil || query == "" {
+					// Nothing in it that Twitter's search supports
+					continue
+				}
+				search_trove, err := api.Search(query, 1)
+				trove.MergeWith(search_trove)
+				if errors.Is(err, scraper.ErrRateLimited) {
+					break
+				} else if err != nil && !errors.Is(err, scraper.END_OF_FEED) {
+					panic(err)
+				}
+			}
+			return trove
+		},
+		StartDelay: 30 * time.Second,
+		Period:     15 * time.Minute,
+		app:        app,
+	}
+	saved_searches_task.StartBackground()
+
+	scrape_jobs_task := BackgroundTask{
+		Name: "scrape jobs",
+		GetTroveFunc: func(api *scraper.API) TweetTrove {
+			// Resume jobs that were running when the webserver was stopped
+			app.Profile.RequeueInterruptedScrapeJobs(scraper.SCRAPE_JOB_STALE_TIMEOUT)
+
+			// Run queued jobs.  They save each page as they go, and if they fail, they're retried later.
+			for {
+				job, err := app.Profile.ClaimNextScrapeJob()
+				if errors.Is(err, ErrNotInDatabase) {
+					break
+				}
+				err = api.RunScrapeJob(app.Profile, &job, app.full_save_tweet_trove)
+				if errors.Is(err, scraper.ErrRateLimited) {
+					break
+				} else if err != nil {
+					app.ErrorLog.Print(err.Error())
+				}
+			}
+			return NewTweetTrove()
+		},
+		StartDelay: 20 * time.Second,
+		Period:     1 * time.Minute,
+		app:        app,
+	}
+	scrape_jobs_task.StartBackground()
+
+	if app.IsDeletedTweetSweepEnabled {
+		deleted_tweets_task := BackgroundTask{
+			Name: "deleted tweets sweep",
+			GetTroveFunc: func(api *scraper.API) TweetTrove {
+				// If it fails partway through, save whatever was re-checked before that
+				trove, err := api.RecheckTweets(app.Profile.GetTweetIDsForDeletionSweep(20, UserID(0)))
+				if err != nil && !errors.Is(err, scraper.ErrRateLimited) {
+					app.ErrorLog.Print(err.Error())
+				}
+				return trove
+			},
+			StartDelay: 1 * time.Minute,
+			Period:     15 * time.Minute,
+			app:        app,
+		}
+		deleted_tweets_task.StartBackground()
+	}
 }
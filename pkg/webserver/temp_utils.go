@@ -37,6 +37,8 @@ func (app *Application) full_save_tweet_trove(trove TweetTrove) {
 		}
 	}
 
-	// Download media content in background
-	go app.Profile.SaveTweetTrove(trove, true, app.API.DownloadMedia)
+	// Queue its media content to be downloaded in the background
+	if app.Profile.QueueMediaDownloads(trove) != 0 {
+		app.MediaDownloads.Notify()
+	}
 }
@@ -51,6 +51,29 @@
           <label class="nav-sidebar__button-label">Bookmarks</label>
         </li>
       </a>
+      {{range .SavedSearches}}
+        <a href="/saved-searches/{{.ID}}">
+          <li class="nav-sidebar__saved-search button labelled-icon" title="{{.Query}}">
+            <img class="svg-icon" src="/static/icons/explore.svg" width="24" height="24" />
+            {{if .NumNewResults}}
+              <span class="nav-sidebar__notifications-count">{{.NumNewResults}}</span>
+            {{end}}
+            <label class="nav-sidebar__button-label">{{.Name}}</label>
+          </li>
+        </a>
+      {{end}}
+      <a href="/mutes">
+        <li class="button labelled-icon">
+          <img class="svg-icon" src="/static/icons/eye.svg" width="24" height="24" />
+          <label class="nav-sidebar__button-label">Mutes</label>
+        </li>
+      </a>
+      <a href="/jobs">
+        <li class="button labelled-icon">
+          <img class="svg-icon" src="/static/icons/refresh.svg" width="24" height="24" />
+          <label class="nav-sidebar__button-label">Jobs</label>
+        </li>
+      </a>
       <a hx-get="/communities">
       <li class="button labelled-icon">
         <img class="svg-icon" src="/static/icons/communities.svg" width="24" height="24" />
@@ -0,0 +1,67 @@
+{{define "main"}}
+  <h1>Jobs</h1>
+
+  <div class="media-downloads row">
+    <span class="media-downloads__title">Media downloads:</span>
+    <span class="media-downloads__queued">{{.MediaDownloads.NumQueued}} queued</span>
+    <span class="media-downloads__in-progress">{{.MediaDownloads.NumInProgress}} downloading</span>
+    <span class="media-downloads__downloaded">{{.MediaDownloads.NumDownloaded}} downloaded</span>
+    <span class="media-downloads__waiting">{{.MediaDownloads.NumWaitingToRetry}} waiting to retry</span>
+    <span class="media-downloads__failed">{{.MediaDownloads.NumFailed}} failed</span>
+    {{if .MediaDownloads.NumFailed}}
+      <a class="button" hx-post="/jobs/media-downloads/retry" hx-target="body">Retry failed</a>
+    {{end}}
+  </div>
+
+  <form class="jobs__new-job row" hx-post="/jobs" hx-ext="json-enc" hx-target="body" hx-push-url="true">
+    <select name="type">
+      <option value="user_tweets">User's tweets</option>
+      <option value="user_likes">User's likes</option>
+      <option value="followers">Followers</option>
+      <option value="followees">Followees</option>
+      <option value="search">Search</option>
+    </select>
+    <input name="target" placeholder="@handle or search query" />
+    <input name="priority" type="number" placeholder="Priority" />
+    <input name="max_pages" type="number" min="0" placeholder="Max pages" />
+    <input type="submit" value="Queue" />
+  </form>
+
+  <div class="jobs__list">
+    {{range .Jobs}}
+      <div class="job row row--spread">
+        <span class="job__status job__status--{{.Status}}">{{.Status}}</span>
+        <div class="job__info">
+          <div class="row">
+            <span class="job__type">{{.Type}}</span>
+            <span class="job__target">{{.Target}}</span>
+          </div>
+          <div class="row">
+            <span class="job__progress">{{.NumPages}} pages</span>
+            {{if .MaxPages}}
+              <span class="job__max-pages">(max {{.MaxPages}})</span>
+            {{end}}
+            {{if .IsWaitingToRetry}}
+              <span class="job__retry-at">retrying at {{.RetryAt.Time.Format "Jan 2, 3:04 pm"}}</span>
+            {{end}}
+          </div>
+          {{if .LastError}}
+            <div class="job__error">{{.LastError}}</div>
+          {{end}}
+        </div>
+        {{if not .IsFinished}}
+          <form class="job__priority row" hx-post="/jobs/{{.ID}}/priority" hx-ext="json-enc" hx-target="body">
+            <input name="priority" type="number" value="{{.Priority}}" />
+            <input type="submit" value="Set priority" />
+          </form>
+          <a class="button button--danger"
+            hx-post="/jobs/{{.ID}}/cancel" hx-target="body"
+            onclick="return confirm('Cancel this job?  Are you sure?')"
+          >Cancel</a>
+        {{else if (or (eq .Status "failed") (eq .Status "cancelled"))}}
+          <a class="button" hx-post="/jobs/{{.ID}}/retry" hx-target="body">Retry</a>
+        {{end}}
+      </div>
+    {{end}}
+  </div>
+{{end}}
@@ -0,0 +1,43 @@
+{{define "main"}}
+  <h1>Mutes</h1>
+
+  <div class="mutes__show-muted row row--spread">
+    {{if .IsShowingMuted}}
+      <span>Muted tweets are being shown</span>
+      <button hx-post="/mutes/show-muted" hx-target="body">Hide muted tweets</button>
+    {{else}}
+      <span>Muted tweets are hidden</span>
+      <button hx-post="/mutes/show-muted" hx-target="body">Show muted tweets</button>
+    {{end}}
+  </div>
+
+  <form class="mutes__new-mute row" hx-post="/mutes" hx-ext="json-enc" hx-target="body" hx-push-url="true">
+    <select name="type">
+      <option value="keyword">Keyword</option>
+      <option value="regex">Regex</option>
+      <option value="user">User</option>
+      <option value="retweets">Retweets from user</option>
+      <option value="domain">Domain</option>
+      <option value="hashtag">Hashtag</option>
+    </select>
+    <input name="text" placeholder="Keyword, regex, @handle, domain or #hashtag" />
+    <input type="submit" value="Mute" />
+  </form>
+
+  <div class="mutes__list">
+    {{range .Mutes}}
+      <div class="mute row row--spread">
+        <span class="mute__type">{{.Type}}</span>
+        {{if .Type.IsUserMute}}
+          {{template "author-info" (user .UserID)}}
+        {{else}}
+          <span class="mute__text">{{.Text}}</span>
+        {{end}}
+        <a class="button button--danger"
+          hx-delete="/mutes/{{.ID}}" hx-target="body"
+          onclick="return confirm('Unmute this?  Are you sure?')"
+        >Unmute</a>
+      </div>
+    {{end}}
+  </div>
+{{end}}
@@ -21,6 +21,31 @@
         <span class="tabs__tab-label">Users</span>
       </a>
     </div>
+    {{if (not .IsUsersSearch)}}
+      <div class="saved-search row">
+        {{if .SavedSearch.ID}}
+          <span class="saved-search__name">Saved search: {{.SavedSearch.Name}}</span>
+          <a class="button button--danger"
+            hx-delete="/saved-searches/{{.SavedSearch.ID}}" hx-target="body"
+            onclick="return confirm('Delete this saved search?  Are you sure?')"
+          >Delete</a>
+        {{else}}
+          <button onclick="document.querySelector('#saveSearchDialog').showModal()">Save search</button>
+          <dialog id="saveSearchDialog">
+            <h3>Save search</h3>
+            <form hx-post="/saved-searches" hx-ext="json-enc" hx-target="body" hx-push-url="true">
+              <input type="hidden" name="query" value="{{.SearchText}}" />
+              <label for="name">Name</label>
+              <input name="name" />
+              <label for="is_scraped_in_background">Also search on Twitter periodically</label>
+              <input type="checkbox" name="is_scraped_in_background" value="true" />
+              <input type="submit" value="Save" />
+            </form>
+            <button onclick="saveSearchDialog.close()">Cancel</button>
+          </dialog>
+        {{end}}
+      </div>
+    {{end}}
     <div class="htmx-spinner">
       <div class="htmx-spinner__fullscreen-forcer">
         <div class="htmx-spinner__background"></div>
@@ -10,6 +10,60 @@
       {{template "tweet" (dict "TweetID" .MainTweetID "RetweetID" 0 "QuoteNestingLevel" 0)}}
     </div>
 
+    {{if .IsEdited}}
+      <div class="tweet-versions">
+        <div class="tweet-versions__header">
+          <span class="edited-badge">Edited</span>
+          <span class="tweet-versions__count">{{len .Versions}} versions</span>
+        </div>
+        <ol class="tweet-versions__list">
+          {{range .Versions}}
+            <li class="tweet-version">
+              <div class="tweet-version__header">
+                <a class="tweet-version__link" href="/tweet/{{.TweetID}}">
+                  Version {{.Number}}
+                </a>
+                {{if .IsScraped}}
+                  <span class="tweet-version__posted-at">
+                    {{(.Tweet.PostedAt.Time.Format "Jan 2, 2006 3:04 pm")}}
+                  </span>
+                {{else}}
+                  <span class="tweet-version__not-scraped">Not scraped</span>
+                {{end}}
+              </div>
+              {{if .IsScraped}}
+                <div class="tweet-version__diff">
+                  {{range .Diff}}
+                    <span class="text-diff__{{.Op}}">{{.Text}}</span>
+                  {{end}}
+                </div>
+              {{end}}
+            </li>
+          {{end}}
+        </ol>
+      </div>
+    {{end}}
+
+    {{if .HasEngagementHistory}}
+      <div class="engagement-history">
+        <svg class="engagement-history__sparkline" viewBox="0 0 300 40" preserveAspectRatio="none">
+          <polyline class="engagement-history__likes" points="{{.EngagementSparklinePoints "likes"}}"></polyline>
+          <polyline class="engagement-history__retweets" points="{{.EngagementSparklinePoints "retweets"}}"></polyline>
+        </svg>
+        <div class="engagement-history__legend">
+          <span class="engagement-history__likes-label">
+            Likes: {{.EngagementHistoryStart.NumLikes}} → {{.EngagementHistoryEnd.NumLikes}}
+          </span>
+          <span class="engagement-history__retweets-label">
+            Retweets: {{.EngagementHistoryStart.NumRetweets}} → {{.EngagementHistoryEnd.NumRetweets}}
+          </span>
+          <span class="engagement-history__dates">
+            {{(.EngagementHistoryStart.RecordedAt.Time.Format "Jan 2, 2006")}} – {{(.EngagementHistoryEnd.RecordedAt.Time.Format "Jan 2, 2006")}}
+          </span>
+        </div>
+      </div>
+    {{end}}
+
     {{if (len .ThreadIDs)}}
       <div class="reply-chain">
         {{range .ThreadIDs}}
@@ -16,19 +16,51 @@
       <a class="tabs__tab {{if (eq .FeedType "likes")}}tabs__tab--active{{end}}" href="/{{$user.Handle}}/likes">
         <span class="tabs__tab-label">Likes</span>
       </a>
+      <a class="tabs__tab {{if (eq .FeedType "profile_history")}}tabs__tab--active{{end}}" href="/{{$user.Handle}}/profile_history">
+        <span class="tabs__tab-label">Profile history</span>
+      </a>
     </div>
   </div>
 
-  <div class="timeline user-feed-timeline">
-    {{if .PinnedTweet.ID}}
-      <div class="pinned-tweet">
-        <div class="pinned-tweet__pin-container labelled-icon">
-          <img class="svg-icon pinned-tweet__pin-icon" src="/static/icons/pin.svg" width="24" height="24" />
-          <label>Pinned</label>
+  {{if (eq .FeedType "profile_history")}}
+    <div class="profile-history">
+      {{range .ProfileHistory}}
+        <div class="profile-history__entry">
+          <div class="profile-history__date">
+            <span>{{.ObservedAt.Time.Format "Jan 2, 2006"}}</span>
+            {{if .IsFirstSeen}}
+              <span class="profile-history__first-seen">First seen</span>
+            {{end}}
+          </div>
+          <ul class="profile-history__changes">
+            {{range .Changes}}
+              <li class="profile-history__change">
+                <span class="profile-history__field">{{.Field}}</span>
+                {{if .Before}}
+                  <span class="profile-history__before">{{.Before}}</span>
+                  <span class="profile-history__arrow">→</span>
+                {{end}}
+                <span class="profile-history__after">{{.After}}</span>
+              </li>
+            {{end}}
+          </ul>
         </div>
-        {{template "tweet" (dict "TweetID" .PinnedTweet.ID "RetweetID" 0 "QuoteNestingLevel" 0)}}
-      </div>
-    {{end}}
-    {{template "timeline" .}}
-  </div>
+      {{else}}
+        <p class="profile-history__empty">No profile history has been recorded for this user.</p>
+      {{end}}
+    </div>
+  {{else}}
+    <div class="timeline user-feed-timeline">
+      {{if .PinnedTweet.ID}}
+        <div class="pinned-tweet">
+          <div class="pinned-tweet__pin-container labelled-icon">
+            <img class="svg-icon pinned-tweet__pin-icon" src="/static/icons/pin.svg" width="24" height="24" />
+            <label>Pinned</label>
+          </div>
+          {{template "tweet" (dict "TweetID" .PinnedTweet.ID "RetweetID" 0 "QuoteNestingLevel" 0)}}
+        </div>
+      {{end}}
+      {{template "timeline" .}}
+    </div>
+  {{end}}
 {{end}}